@@ -1,76 +1,315 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/ShoppingDem/backend/shop/internal/auth"
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/internal/config"
 	"github.com/ShoppingDem/backend/shop/internal/database"
 	"github.com/ShoppingDem/backend/shop/internal/graph"
+	"github.com/ShoppingDem/backend/shop/internal/health"
+	"github.com/ShoppingDem/backend/shop/internal/idempotency"
+	"github.com/ShoppingDem/backend/shop/internal/inventory"
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/internal/metrics"
+	"github.com/ShoppingDem/backend/shop/internal/middleware"
+	"github.com/ShoppingDem/backend/shop/internal/payment"
+	"github.com/ShoppingDem/backend/shop/internal/repository"
+	"github.com/ShoppingDem/backend/shop/internal/signup"
+	"github.com/ShoppingDem/backend/shop/internal/storage"
+	"github.com/ShoppingDem/backend/shop/internal/token"
+	"github.com/ShoppingDem/backend/shop/internal/tracing"
+	"github.com/ShoppingDem/backend/shop/internal/webhook"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/gorilla/websocket"
 )
 
-const defaultPort = "8080"
-
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("failed to configure logging: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	// Tracing: spans are exported over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set.
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		fatal(logger, "failed to configure tracing", err)
 	}
 
-	db, err := database.Connect()
+	db, err := database.Connect(cfg.DB)
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		fatal(logger, "failed to connect to database", err)
 	}
-	defer db.Close()
 
-	// Remove the Okta client initialization
-	// if err := auth.InitOktaClient(); err != nil {
-	// 	log.Fatalf("failed to initialize Okta client: %v", err)
-	// }
+	if cfg.RunMigrations {
+		applied, err := database.Migrate(context.Background(), db)
+		if err != nil {
+			fatal(logger, "failed to run migrations", err)
+		}
+		for _, m := range applied {
+			logger.Info("applied migration", slog.Int("version", m.Version), slog.String("name", m.Name))
+		}
+	}
+
+	authClient := auth.New(cfg.OktaOrgURL, cfg.OktaAPIToken, cfg.OktaClientID, cfg.OktaClientSecret)
+	authClient.HTTPClient.Transport = auth.NewTransport(cfg.OktaTransport)
+	authClient.Logger = logger
+	authClient.Redactor = logging.NewRedactor(cfg.LogRedactFields)
+
+	tokens := token.New([]byte(cfg.JWTSecret), cfg.JWTExpiry)
+
+	admins := map[string]bool{}
+	for _, id := range cfg.AdminUserIDs {
+		admins[id] = true
+	}
+
+	var payments models.PaymentProvider
+	if cfg.StripeSecretKey != "" {
+		payments = payment.NewStripe(cfg.StripeSecretKey)
+	}
+
+	// Uploaded avatars go to the S3 bucket when one is configured, and otherwise to a local
+	// directory served at /uploads/.
+	var avatars models.ObjectStore
+	var uploads http.Handler
+	if cfg.S3.Bucket != "" {
+		s3 := storage.NewS3Store(cfg.S3.Endpoint, cfg.S3.Region, cfg.S3.Bucket, cfg.S3.AccessKeyID, cfg.S3.SecretAccessKey)
+		s3.PublicURL = cfg.S3.PublicURL
+		avatars = s3
+	} else {
+		files := storage.NewFileStore(cfg.UploadDir, cfg.UploadBaseURL)
+		avatars, uploads = files, files.Handler()
+	}
+
+	// Orders shipping to a region without a rate aren't taxed.
+	var taxes models.TaxCalculator
+	if cfg.TaxRates != nil {
+		taxes = cfg.TaxRates
+	}
 
 	// Create the base server.
-	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{DB: db}}))
+	users := repository.NewUserRepository(db)
+	reservations := repository.NewReservationRepository(db)
+	orders := repository.NewOrderRepository(db, taxes, clock.Real{})
+	reviews := repository.NewReviewRepository(db)
+	productImages := repository.NewProductImageRepository(db)
+	webhooks := repository.NewWebhookDeliveryRepository(db)
+	flashSales := repository.NewFlashSaleRepository(db)
+	dispatcher := webhook.NewDispatcher(webhooks, &http.Client{Timeout: webhook.DefaultDeliveryTimeout}, cfg.WebhookSigningSecret, cfg.WebhookRetry, cfg.WebhookDispatchInterval, logger)
+	// Delivered orders are only sent to the accounting system when it's configured.
+	var accounting *webhook.Accounting
+	if cfg.AccountingWebhookURL != "" {
+		accounting = webhook.NewAccounting(dispatcher, cfg.AccountingWebhookURL)
+	}
+	orderEvents := graph.NewOrderEvents()
+	signupStore := signup.NewMemoryStore()
+	srv := handler.New(graph.NewExecutableSchema(graph.NewConfig(&graph.Resolver{
+		Users:           users,
+		Products:        repository.NewProductRepository(db),
+		ProductImages:   productImages,
+		FlashSales:      flashSales,
+		Categories:      repository.NewCategoryRepository(db),
+		Carts:           repository.NewCartRepository(db),
+		Wishlists:       repository.NewWishlistRepository(db),
+		Preferences:     repository.NewListingPreferencesRepository(db),
+		Addresses:       repository.NewAddressRepository(db),
+		Reviews:         reviews,
+		Orders:          orders,
+		Reservations:    reservations,
+		RefreshTokens:   repository.NewRefreshTokenRepository(db),
+		Webhooks:        webhooks,
+		Accounting:      accounting,
+		Payments:        payments,
+		Avatars:         avatars,
+		ReservationTTL:  cfg.ReservationTTL,
+		PaymentGrace:    cfg.PaymentGracePeriod,
+		RefreshTokenTTL: cfg.RefreshTokenExpiry,
+		Auth:            authClient,
+		Tokens:          tokens,
+		Logger:          logger,
+		Admins:          admins,
+		GroupRoles:      cfg.GroupRoles,
+		Registrations:   signup.NewThrottle(signupStore, cfg.RegistrationWindow, cfg.RegistrationLimitPerIP, cfg.RegistrationLimitPerDomain),
+		Lookups:         signup.NewLookupThrottle(signupStore, cfg.RegistrationWindow, cfg.LookupLimitPerIP),
+		Recommendations: graph.NewRecommendationCache(cfg.RecommendationCacheTTL),
+		OrderEvents:     orderEvents,
+	})))
+
+	// The origin allowlist is shared by the CORS middleware and the websocket upgrader.
+	origins := middleware.ParseOriginAllowlist(cfg.AllowedOrigins)
 
 	// 1. Configure transports (order matters here):
 	srv.AddTransport(transport.Websocket{
 		Upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				// Allow connections from any origin (adjust as needed for security).
-				return true
-			},
+			CheckOrigin:      origins.CheckOrigin,
 			HandshakeTimeout: 5 * time.Second, // Customize timeout
 		},
-		KeepAlivePingInterval: 10 * time.Second,    // Keep-alive ping
-		InitFunc:              graph.WebsocketInit, // Add an init function for Websockets
+		KeepAlivePingInterval: 10 * time.Second,            // Keep-alive ping
+		InitFunc:              graph.WebsocketInit(tokens), // Authenticate subscriptions with the session token
 	})
 	srv.AddTransport(transport.Options{})
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
-	srv.AddTransport(transport.MultipartForm{})
+	srv.AddTransport(transport.MultipartForm{MaxUploadSize: cfg.MaxUploadSize})
+	srv.AroundOperations(graph.OperationLogger(logger))
+	srv.Use(graph.Metrics{})
+	srv.Use(graph.Tracing{})
 
 	// 2. Add extensions (e.g., for complexity limit, tracing, etc.):
-	srv.Use(extension.Introspection{}) // Enable introspection queries (useful for development)
-	srv.Use(extension.AutomaticPersistedQueries{})
-	// srv.Use(extension.FixedComplexityLimit(100)) // Set a complexity limit (adjust as needed)
+	if cfg.EnableIntrospection {
+		srv.Use(extension.Introspection{})
+	}
+	persisted, err := graph.LoadPersistedQueries(cfg.PersistedQueriesFile)
+	if err != nil {
+		fatal(logger, "failed to load persisted queries", err)
+	}
+	if cfg.PersistedQueriesOnly && len(persisted) == 0 {
+		fatal(logger, "failed to load persisted queries", errors.New("PERSISTED_QUERIES_ONLY is set but the manifest is empty"))
+	}
+	srv.Use(graph.PersistedQueries{Queries: persisted, Only: cfg.PersistedQueriesOnly})
+	srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New[string](100)})
+	srv.Use(extension.FixedComplexityLimit(cfg.ComplexityLimit))
 
-	// 3. Error handling
-	// You can add a custom error presenter or formatter here if you need to customize error responses.
-	// srv.SetErrorPresenter(...)
-	// srv.SetRecoverFunc(...)
+	// 3. Error handling: errors carry an extensions.code, and internal details are only sent to
+	// clients when ExposeErrors is set (for development).
+	srv.SetErrorPresenter(graph.ErrorPresenter(logger, cfg.ExposeErrors))
+	srv.SetRecoverFunc(graph.RecoverFunc(logger))
 
-	// 4. Query Complexity
-	// You can implement more advanced query complexity calculation if necessary.
+	// 4. Per-client rate limiting on /query.
+	limiter := middleware.NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
 
-	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	var queryHandler http.Handler = graph.Loaders(users, reviews, productImages, orders, flashSales)(srv)
+	queryHandler = middleware.Authenticate(tokens)(queryHandler)
+	queryHandler = middleware.MaxBodySize(cfg.MaxBodySize, cfg.MaxUploadSize)(queryHandler)
+	queryHandler = middleware.RateLimit(limiter, cfg.RateLimitTrustProxy)(queryHandler)
+	queryHandler = middleware.CORS(origins)(queryHandler)
 
-	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	http.Handle("/", playgroundHandler(cfg.EnablePlayground))
+	http.Handle("/query", queryHandler)
+	if uploads != nil {
+		http.Handle("/uploads/", http.StripPrefix("/uploads", uploads))
+	}
+	http.Handle("/healthz", health.Liveness())
+	http.Handle("/readyz", health.Readiness(db, health.DefaultReadinessTimeout))
+	http.Handle("/metrics", metrics.Handler())
+
+	// The webhooks are only served when their secrets are configured.
+	if cfg.OktaWebhookSecret != "" {
+		http.Handle("/webhooks/okta", webhook.Okta(users, cfg.OktaWebhookSecret, logger))
+	}
+	if cfg.StripeWebhookSecret != "" {
+		http.Handle("/webhooks/stripe", webhook.Stripe(orders, payments, cfg.StripeWebhookSecret, orderEvents.Publish, logger))
+	}
+
+	// 5. Response compression.
+	var rootHandler http.Handler = http.DefaultServeMux
+	if cfg.CompressionEnabled {
+		rootHandler = middleware.Compress(cfg.CompressionMinSize)(rootHandler)
+	}
+	rootHandler = middleware.RequestID(rootHandler)
+
+	// 6. Graceful shutdown: drain in-flight requests on SIGINT/SIGTERM before closing the DB.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Release expired stock reservations, forget expired idempotency keys and send outbound
+	// webhooks until shutdown.
+	go inventory.NewSweeper(reservations, cfg.ReservationSweepInterval, logger).Run(ctx)
+	go idempotency.NewSweeper(orders, cfg.IdempotencyKeyTTL, idempotency.DefaultSweepInterval, logger).Run(ctx)
+	go dispatcher.Run(ctx)
+	if payments != nil {
+		go inventory.NewHoldReleaser(orders, payments, orderEvents.Publish, cfg.ReservationSweepInterval, logger).Run(ctx)
+	}
+
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: rootHandler}
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		fatal(logger, "failed to listen", err)
+	}
+
+	if cfg.EnablePlayground {
+		logger.Info("server started", slog.String("playground", "http://localhost:"+cfg.Port+"/"))
+	} else {
+		logger.Info("server started", slog.String("port", cfg.Port))
+	}
+	if err := serve(ctx, server, ln, cfg.ShutdownTimeout); err != nil {
+		logger.Error("server shutdown", slog.Any("error", err))
+	}
+
+	if err := db.Close(); err != nil {
+		logger.Error("failed to close database", slog.Any("error", err))
+	}
+
+	tracingCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		logger.Error("failed to flush traces", slog.Any("error", err))
+	}
+}
+
+// fatal logs err at error level and exits.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
+
+// playgroundHandler serves the GraphQL playground when enabled, and responds 404 otherwise.
+func playgroundHandler(enabled bool) http.Handler {
+	if !enabled {
+		return http.NotFoundHandler()
+	}
+	return playground.Handler("GraphQL playground", "/query")
+}
+
+// serve runs server on ln until ctx is cancelled, then shuts it down, giving in-flight
+// requests up to shutdownTimeout to complete.
+func serve(ctx context.Context, server *http.Server, ln net.Listener, shutdownTimeout time.Duration) error {
+	// Shutdown doesn't track hijacked (websocket) connections, so give them a base
+	// context that is cancelled once the regular requests have drained.
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	server.BaseContext = func(net.Listener) context.Context { return baseCtx }
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	cancelBase()
+
+	if sErr := <-serveErr; !errors.Is(sErr, http.ErrServerClosed) {
+		return errors.Join(err, sErr)
+	}
+	return err
 }
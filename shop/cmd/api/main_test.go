@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, `{"data":{}}`)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, &http.Server{Handler: mux}, ln, 5*time.Second)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := http.Post("http://"+ln.Addr().String()+"/query", "application/json", nil)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		done <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	shutdown()
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("in-flight request failed: %v", res.err)
+	}
+	if res.body != `{"data":{}}` {
+		t.Fatalf("unexpected body %q", res.body)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("serve returned error: %v", err)
+	}
+}
+
+func TestPlaygroundHandler(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		rec := httptest.NewRecorder()
+		playgroundHandler(enabled).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if enabled && (rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "GraphQL playground")) {
+			t.Errorf("expected the enabled playground to be served, got %d %q", rec.Code, rec.Body.String())
+		}
+		if !enabled && rec.Code != http.StatusNotFound {
+			t.Errorf("expected the disabled playground to respond 404, got %d", rec.Code)
+		}
+	}
+}
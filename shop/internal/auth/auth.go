@@ -7,18 +7,132 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/internal/metrics"
+	"github.com/ShoppingDem/backend/shop/internal/validate"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a rate-limited or transiently failing request is retried.
+	DefaultMaxRetries = 3
+
+	// DefaultRetryBaseDelay is the initial backoff delay, doubled on each retry.
+	DefaultRetryBaseDelay = 200 * time.Millisecond
+
+	// DefaultBasePath is the path prefix of the Okta management API.
+	DefaultBasePath = "/api/v1"
+
+	// DefaultMaxIdleConns is how many idle connections the transport keeps open in total.
+	DefaultMaxIdleConns = 100
+
+	// DefaultMaxIdleConnsPerHost is how many idle connections the transport keeps open to
+	// Okta. http.DefaultTransport keeps 2, too few for concurrent logins.
+	DefaultMaxIdleConnsPerHost = 20
+
+	// DefaultIdleConnTimeout is how long an idle connection is kept open before it's closed.
+	DefaultIdleConnTimeout = 90 * time.Second
+
+	// maxLoggedErrorBody bounds how much of an error response is buffered for logging.
+	maxLoggedErrorBody = 64 << 10
+
+	// maxDrainedBody bounds how much of an unread response body is discarded on close so the
+	// connection can be reused. Larger remainders are cheaper to abandon with the connection.
+	maxDrainedBody = 64 << 10
+
+	// maxErrorSnippet bounds how much of a non-JSON error body is kept in an OktaError.
+	maxErrorSnippet = 200
+
+	// validationFailedCode is the Okta error code for a request whose body Okta rejected, e.g.
+	// a profile with an invalid field or a login that's already in use.
+	validationFailedCode = "E0000001"
+
+	// userLockedCode is the Okta error code for a request that fails because the user is
+	// locked out.
+	userLockedCode = "E0000069"
+
+	// userStatusCode is the Okta error code for a lifecycle operation the user's status doesn't
+	// allow, e.g. reactivating a user who isn't pending activation.
+	userStatusCode = "E0000038"
+
+	// authnLockedOut is the primary authentication status of a locked out user.
+	authnLockedOut = "LOCKED_OUT"
+
+	// tracerName is the instrumentation name of the spans created for Okta requests.
+	tracerName = "github.com/ShoppingDem/backend/shop/internal/auth"
+
+	// maxRetryDelay caps the delay between retries, including delays requested via Retry-After.
+	maxRetryDelay = 30 * time.Second
+)
+
+var (
+	// ErrInvalidCredentials is returned when Okta rejects the supplied password or passcode.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrUserNotFound is returned when Okta has no user matching the identifier.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrResendRateLimited is returned when Okta refuses to resend a passcode because one was sent recently.
+	ErrResendRateLimited = errors.New("passcode resend rate limited")
+
+	// ErrWeakPassword is returned when a new password doesn't meet the password policy.
+	ErrWeakPassword = errors.New("password does not meet policy")
+
+	// ErrInvalidRecoveryToken is returned when a password recovery token is unknown, used, or expired.
+	ErrInvalidRecoveryToken = errors.New("invalid recovery token")
+
+	// ErrInvalidProfile is matched by an OktaError reporting that Okta rejected a user profile
+	// as invalid.
+	ErrInvalidProfile = errors.New("invalid profile")
+
+	// ErrLoginTaken is matched by an OktaError reporting that another user already has the
+	// login, email or phone number.
+	ErrLoginTaken = errors.New("login already in use")
+
+	// ErrWrongPassword is returned when changing a password and the current password doesn't match.
+	ErrWrongPassword = errors.New("current password is incorrect")
+
+	// ErrAccountLocked is returned when Okta has locked the user out after too many failed
+	// sign-in attempts. The user can unlock the account by resetting the password.
+	ErrAccountLocked = errors.New("account locked")
+
+	// ErrAlreadyActive is returned when reactivating a user who has already activated their account.
+	ErrAlreadyActive = errors.New("user already active")
 )
 
 // Auth represents a client for interacting with the Auth API.
 type Auth struct {
 	Domain       string       // Your Okta domain (e.g., "your-domain.okta.com").
+	BasePath     string       // The API path prefix appended to Domain (e.g., "/api/v1").
 	APIToken     string       // Your Okta API token.
 	ClientID     string       // Your Okta application's client ID.
 	ClientSecret string       // Your Okta application's client secret.
 	HTTPClient   *http.Client // The HTTP client to use for API requests.
+
+	MaxRetries     int           // How many times to retry 429s, transient 5xx responses and unsent requests (0 disables retries).
+	RetryBaseDelay time.Duration // The initial backoff delay, doubled on each retry.
+
+	Logger   *slog.Logger      // The logger for outbound requests (defaults to slog.Default()).
+	Redactor *logging.Redactor // Masks sensitive fields in logged request and response bodies.
+	Clock    clock.Clock       // The time Retry-After dates are waited for from (defaults to the system clock).
 }
 
 // New creates a new Okta client.
@@ -34,13 +148,92 @@ type Auth struct {
 func New(domain, apiToken, clientID, clientSecret string) *Auth {
 	return &Auth{
 		Domain:       domain,
+		BasePath:     DefaultBasePath,
 		APIToken:     apiToken,
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		HTTPClient: &http.Client{
-			Timeout: 10 * time.Second, // Default timeout of 10 seconds for API requests.
+			Timeout:   10 * time.Second, // Default timeout of 10 seconds for API requests.
+			Transport: NewTransport(TransportOptions{}),
 		},
+		MaxRetries:     DefaultMaxRetries,
+		RetryBaseDelay: DefaultRetryBaseDelay,
+		Logger:         slog.Default(),
+		Redactor:       logging.NewRedactor(logging.DefaultRedactedFields),
+	}
+}
+
+// WithTimeout returns a copy of the client whose requests time out after d.
+// The original client is left unchanged, so callers can use different budgets per operation
+// (e.g., o.WithTimeout(30*time.Second).RegisterUser(ctx, req)).
+//
+// Parameters:
+//   - d: The per-request timeout. Zero disables the client-side timeout.
+//
+// Returns:
+//   - A new Okta client instance sharing the original's configuration and transport.
+func (o *Auth) WithTimeout(d time.Duration) *Auth {
+	c := *o
+	httpClient := http.Client{}
+	if o.HTTPClient != nil {
+		httpClient = *o.HTTPClient
 	}
+	httpClient.Timeout = d
+	c.HTTPClient = &httpClient
+	return &c
+}
+
+// WithTransport returns a copy of the client that sends requests through rt, e.g. to trace
+// or record them. The original client is left unchanged.
+//
+// Parameters:
+//   - rt: The round tripper requests are sent through.
+//
+// Returns:
+//   - A new Okta client instance sharing the original's configuration and timeout.
+func (o *Auth) WithTransport(rt http.RoundTripper) *Auth {
+	c := *o
+	httpClient := http.Client{}
+	if o.HTTPClient != nil {
+		httpClient = *o.HTTPClient
+	}
+	httpClient.Transport = rt
+	c.HTTPClient = &httpClient
+	return &c
+}
+
+// TransportOptions tune the connection pool of the transport created by NewTransport. Zero
+// values are replaced with the defaults.
+type TransportOptions struct {
+	MaxIdleConns        int           // Idle connections kept open in total (defaults to DefaultMaxIdleConns).
+	MaxIdleConnsPerHost int           // Idle connections kept open to Okta (defaults to DefaultMaxIdleConnsPerHost).
+	IdleConnTimeout     time.Duration // How long an idle connection is kept (defaults to DefaultIdleConnTimeout).
+}
+
+// NewTransport creates the transport used for Okta requests: http.DefaultTransport's
+// settings with a connection pool sized by opts.
+//
+// Parameters:
+//   - opts: The connection pool settings.
+//
+// Returns:
+//   - A new transport.
+func NewTransport(opts TransportOptions) *http.Transport {
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost <= 0 {
+		opts.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = opts.MaxIdleConns
+	t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	t.IdleConnTimeout = opts.IdleConnTimeout
+	return t
 }
 
 // RegistrationRequest represents the data needed to register a new user.
@@ -52,12 +245,13 @@ type RegistrationRequest struct {
 }
 
 // UserProfile represents the user's profile information.
+// Empty fields are omitted so the same type can be used for partial profile updates.
 type UserProfile struct {
-	FirstName   string `json:"firstName"`             // The user's first name.
-	LastName    string `json:"lastName"`              // The user's last name.
+	FirstName   string `json:"firstName,omitempty"`   // The user's first name.
+	LastName    string `json:"lastName,omitempty"`    // The user's last name.
 	Email       string `json:"email,omitempty"`       // The user's email address (optional for registration).
 	MobilePhone string `json:"mobilePhone,omitempty"` // The user's mobile phone number (optional for registration).
-	Login       string `json:"login"`                 // The user's login identifier (usually the same as email).
+	Login       string `json:"login,omitempty"`       // The user's login identifier (usually the same as email).
 }
 
 // User represents a simplified Okta user.
@@ -65,6 +259,7 @@ type User struct {
 	ID      string `json:"id"`     // The user's unique ID in Okta.
 	Status  string `json:"status"` // The user's status (e.g., "ACTIVE", "PROVISIONED").
 	Profile struct {
+		Login       string `json:"login"`       // The user's login, used as the username to authenticate.
 		Email       string `json:"email"`       // The user's email address.
 		MobilePhone string `json:"mobilePhone"` // The user's mobile phone number.
 	} `json:"profile"` // The user's profile information.
@@ -81,6 +276,102 @@ type ErrorResponse struct {
 	} `json:"errorCauses"` // An array of error causes.
 }
 
+// OktaError is an error returned by the Okta API.
+// Use errors.As to inspect the Okta error code, e.g. to detect E0000001 (validation failed).
+type OktaError struct {
+	StatusCode int      // The HTTP status code of the response.
+	Code       string   // The Okta error code (e.g., "E0000001").
+	Summary    string   // A summary of the error.
+	ID         string   // The unique ID of the error, useful when contacting Okta support.
+	Causes     []string // The summaries of the individual error causes, if any.
+	Body       string   // The start of the raw body, set when it wasn't a JSON Okta error (e.g. a gateway's HTML page).
+}
+
+// Error implements the error interface.
+func (e *OktaError) Error() string {
+	if e.Code == "" && e.Body != "" {
+		return fmt.Sprintf("okta error (status: %d): unexpected response: %s", e.StatusCode, e.Body)
+	}
+	msg := fmt.Sprintf("okta error %s (status: %d): %s", e.Code, e.StatusCode, e.Summary)
+	if len(e.Causes) > 0 {
+		msg += " (" + strings.Join(e.Causes, "; ") + ")"
+	}
+	return msg
+}
+
+// Is lets errors.Is(err, ErrAccountLocked) match an OktaError reporting a locked out user,
+// and errors.Is(err, ErrLoginTaken) or errors.Is(err, ErrInvalidProfile) one reporting that
+// Okta rejected the request body because a field is already in use or otherwise invalid.
+func (e *OktaError) Is(target error) bool {
+	switch target {
+	case ErrAccountLocked:
+		return e.Code == userLockedCode
+	case ErrLoginTaken:
+		return e.Code == validationFailedCode && e.alreadyExists()
+	case ErrInvalidProfile:
+		return e.Code == validationFailedCode && !e.alreadyExists()
+	}
+	return false
+}
+
+// alreadyExists reports whether one of the error's causes is a field whose value another
+// user already has, which Okta reports as "An object with this field already exists".
+func (e *OktaError) alreadyExists() bool {
+	for _, cause := range e.Causes {
+		if strings.Contains(cause, "already exists") {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeError decodes an Okta error response into an *OktaError.
+//
+// Parameters:
+//   - resp: The error response. The caller remains responsible for closing its body.
+//
+// Returns:
+//   - An *OktaError. If the body isn't JSON, as when a proxy answers with an HTML or
+//     plaintext page, its Body holds a truncated snippet of the raw body instead of a code.
+func (o *Auth) decodeError(resp *http.Response) error {
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxLoggedErrorBody))
+	if err != nil {
+		return fmt.Errorf("failed to read error response (status: %d): %w", resp.StatusCode, err)
+	}
+	var errorResp ErrorResponse
+	if err := json.Unmarshal(raw, &errorResp); err != nil {
+		return &OktaError{StatusCode: resp.StatusCode, Summary: http.StatusText(resp.StatusCode), Body: errorSnippet(raw)}
+	}
+
+	oktaErr := &OktaError{
+		StatusCode: resp.StatusCode,
+		Code:       errorResp.ErrorCode,
+		Summary:    errorResp.ErrorSummary,
+		ID:         errorResp.ErrorID,
+	}
+	for _, cause := range errorResp.ErrorCauses {
+		oktaErr.Causes = append(oktaErr.Causes, cause.ErrorSummary)
+	}
+	return oktaErr
+}
+
+// errorSnippet returns the start of a raw error body, on one line, for use in an error message.
+func errorSnippet(raw []byte) string {
+	snippet := strings.Join(strings.Fields(strings.ToValidUTF8(string(raw), "")), " ")
+	if snippet == "" {
+		return "(empty body)"
+	}
+	if len(snippet) > maxErrorSnippet {
+		// Cut on a rune boundary.
+		cut := maxErrorSnippet
+		for cut > 0 && !utf8.RuneStart(snippet[cut]) {
+			cut--
+		}
+		snippet = snippet[:cut] + "..."
+	}
+	return snippet
+}
+
 // RegisterUser registers a new user with Okta.
 // It supports registration with email, phone, or both.
 //
@@ -92,9 +383,43 @@ type ErrorResponse struct {
 //   - The client ID upon successful registration.
 //   - An error if the registration fails.
 func (o *Auth) RegisterUser(ctx context.Context, req RegistrationRequest) (string, error) {
+	if _, err := o.CreateUser(ctx, req); err != nil {
+		return "", err
+	}
+	// Return the client ID on success.
+	return o.ClientID, nil
+}
+
+// CreateUser registers a new user with Okta and returns the created user.
+// It supports registration with email, phone, or both.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - req: The registration request data.
+//
+// Returns:
+//   - The created Okta user, including its ID.
+//   - An error if the registration fails.
+func (o *Auth) CreateUser(ctx context.Context, req RegistrationRequest) (*User, error) {
 	// Validate that at least one of email or mobilePhone is provided.
 	if req.Profile.Email == "" && req.Profile.MobilePhone == "" {
-		return "", errors.New("at least one of email or mobilePhone must be provided for registration")
+		return nil, errors.New("at least one of email or mobilePhone must be provided for registration")
+	}
+
+	// Reject malformed contact details here rather than letting Okta fail with an opaque error.
+	if req.Profile.Email != "" {
+		email, err := validate.Email(req.Profile.Email)
+		if err != nil {
+			return nil, err
+		}
+		req.Profile.Email = email
+	}
+	if req.Profile.MobilePhone != "" {
+		phone, err := validate.Phone(req.Profile.MobilePhone)
+		if err != nil {
+			return nil, err
+		}
+		req.Profile.MobilePhone = phone
 	}
 
 	// If login is not provided, set it to email (if available) or mobilePhone.
@@ -107,18 +432,18 @@ func (o *Auth) RegisterUser(ctx context.Context, req RegistrationRequest) (strin
 	}
 
 	// Construct the API URL.
-	url := fmt.Sprintf("%s/api/v1/users?activate=%t", o.Domain, req.Activate)
+	url := fmt.Sprintf("%s?activate=%t", o.url("users"), req.Activate)
 
 	// Marshal the request body to JSON.
 	body, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal registration request: %w", err)
+		return nil, fmt.Errorf("failed to marshal registration request: %w", err)
 	}
 
 	// Make the API request.
 	resp, err := o.makeRequest(ctx, http.MethodPost, url, bytes.NewBuffer(body))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -126,18 +451,173 @@ func (o *Auth) RegisterUser(ctx context.Context, req RegistrationRequest) (strin
 	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
 		var user User
 		if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-			return "", fmt.Errorf("failed to decode user response: %w", err)
+			return nil, fmt.Errorf("failed to decode user response: %w", err)
 		}
-		// Return the client ID on success.
-		return o.ClientID, nil
+		return &user, nil
 	}
 
 	// Handle API errors.
-	var errorResp ErrorResponse
-	if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
-		return "", fmt.Errorf("failed to decode error response (status: %d): %w", resp.StatusCode, err)
+	return nil, fmt.Errorf("failed to register user: %w", o.decodeError(resp))
+}
+
+// DeactivateUser deactivates a user in Okta, which ends their sessions and prevents them from
+// signing in but keeps the account. A user that doesn't exist is treated as deactivated.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//
+// Returns:
+//   - An error if the call fails.
+func (o *Auth) DeactivateUser(ctx context.Context, userID string) error {
+	resp, err := o.makeRequest(ctx, http.MethodPost, o.url("users", userID, "lifecycle", "deactivate"), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices || resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return fmt.Errorf("failed to deactivate user: %w", o.decodeError(resp))
+}
+
+// activationResponse represents the response to a user activation or reactivation.
+type activationResponse struct {
+	ActivationURL   string `json:"activationUrl"`   // The activation link, when Okta didn't email it.
+	ActivationToken string `json:"activationToken"` // The token in the activation link, when Okta didn't email it.
+}
+
+// ReactivateUser resends the activation email to a user who was created without being
+// activated and hasn't completed activation, e.g. because the first email got lost. It
+// invalidates the activation links sent before.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//
+// Returns:
+//   - The activation token, if Okta returned one rather than only emailing it.
+//   - ErrAlreadyActive if the user isn't pending activation, or another error if the call fails.
+func (o *Auth) ReactivateUser(ctx context.Context, userID string) (string, error) {
+	// Construct the API URL.
+	url := o.url("users", userID, "lifecycle", "reactivate") + "?sendEmail=true"
+
+	// Make the API request.
+	resp, err := o.makeRequest(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Check for successful status code (200 OK).
+	if resp.StatusCode == http.StatusOK {
+		var activation activationResponse
+		if err := json.NewDecoder(resp.Body).Decode(&activation); err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to decode reactivation response: %w", err)
+		}
+		return activation.ActivationToken, nil
+	}
+
+	// Handle API errors.
+	oktaErr := o.decodeError(resp)
+	var e *OktaError
+	if errors.As(oktaErr, &e) && e.Code == userStatusCode {
+		return "", fmt.Errorf("%w: %w", ErrAlreadyActive, oktaErr)
+	}
+	return "", fmt.Errorf("failed to reactivate user: %w", oktaErr)
+}
+
+// DeleteUser permanently removes a user from Okta.
+// Okta only deletes deactivated users, so this issues two DELETE calls:
+// the first deactivates the user and the second deletes them.
+// It is idempotent: a user that no longer exists is treated as already deleted.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//
+// Returns:
+//   - An error if either call fails.
+func (o *Auth) DeleteUser(ctx context.Context, userID string) error {
+	// Construct the API URL.
+	url := o.url("users", userID)
+
+	for _, step := range []string{"deactivate", "delete"} {
+		// Make the API request.
+		resp, err := o.makeRequest(ctx, http.MethodDelete, url, nil)
+		if err != nil {
+			return err
+		}
+
+		// Check for successful status codes (200-299).
+		if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			resp.Body.Close()
+			continue
+		}
+
+		// The user is already gone (e.g., a previous attempt was interrupted).
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil
+		}
+
+		// Handle API errors.
+		oktaErr := o.decodeError(resp)
+		resp.Body.Close()
+		return fmt.Errorf("failed to %s user: %w", step, oktaErr)
 	}
-	return "", fmt.Errorf("failed to register user (status: %d): %s", resp.StatusCode, errorResp.ErrorSummary)
+	return nil
+}
+
+// updateProfileRequest represents a partial profile update.
+type updateProfileRequest struct {
+	Profile UserProfile `json:"profile"` // The profile fields to change.
+}
+
+// UpdateProfile partially updates a user's Okta profile.
+// Only the non-empty fields of profile are sent, so unchanged attributes are left as they are.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - profile: The profile fields to change.
+//
+// Returns:
+//   - The updated user.
+//   - An error if the update fails.
+func (o *Auth) UpdateProfile(ctx context.Context, userID string, profile UserProfile) (*User, error) {
+	// Construct the API URL.
+	url := o.url("users", userID)
+
+	// Marshal the request body to JSON.
+	body, err := json.Marshal(updateProfileRequest{Profile: profile})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal profile update: %w", err)
+	}
+
+	// Make the API request. A POST (rather than PUT) performs a partial update.
+	resp, err := o.makeRequest(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Check for successful status code (200 OK).
+	if resp.StatusCode == http.StatusOK {
+		var user User
+		if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+			return nil, fmt.Errorf("failed to decode user response: %w", err)
+		}
+		return &user, nil
+	}
+
+	// Handle API errors.
+	oktaErr := o.decodeError(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, oktaErr)
+	}
+	return nil, fmt.Errorf("failed to update profile: %w", oktaErr)
 }
 
 // VerifyFactorRequest represents the request for factor verification
@@ -163,7 +643,7 @@ type VerifyFactorResponse struct {
 //   - An error if the user is not found or if an error occurs.
 func (o *Auth) GetUser(ctx context.Context, identifier string) (*User, error) {
 	// Construct the API URL.
-	url := fmt.Sprintf("%s/api/v1/users/%s", o.Domain, identifier)
+	url := o.url("users", identifier)
 
 	// Make the API request.
 	resp, err := o.makeRequest(ctx, http.MethodGet, url, nil)
@@ -182,11 +662,45 @@ func (o *Auth) GetUser(ctx context.Context, identifier string) (*User, error) {
 	}
 
 	// Handle API errors.
-	var errorResp ErrorResponse
-	if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
-		return nil, fmt.Errorf("failed to decode error response (status: %d): %w", resp.StatusCode, err)
+	oktaErr := o.decodeError(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, oktaErr)
+	}
+	return nil, fmt.Errorf("failed to get user: %w", oktaErr)
+}
+
+// Factor represents a factor enrolled for a user.
+type Factor struct {
+	ID         string        `json:"id"`         // The factor's unique ID.
+	FactorType string        `json:"factorType"` // The factor type (e.g., "email", "sms", "token:software:totp").
+	Provider   string        `json:"provider"`   // The factor provider (e.g., "OKTA", "GOOGLE").
+	Status     string        `json:"status"`     // The factor status (e.g., "ACTIVE", "PENDING_ACTIVATION").
+	Profile    FactorProfile `json:"profile"`    // The contact details the factor delivers to.
+}
+
+// FactorProfile holds the contact details of an email or SMS factor.
+type FactorProfile struct {
+	PhoneNumber string `json:"phoneNumber,omitempty"` // The phone number of an SMS factor.
+	Email       string `json:"email,omitempty"`       // The email address of an email factor.
+}
+
+// findContactFactor picks the Okta email or SMS factor that matches identifier.
+// The identifier may be the user's email, phone number, or ID; an ID matches the first
+// email or SMS factor for which the user has contact details.
+func findContactFactor(user *User, factors []Factor, identifier string) (Factor, bool) {
+	for _, f := range factors {
+		// Only factors provided by Okta deliver passcodes by email or SMS.
+		if f.Provider != "OKTA" {
+			continue
+		}
+
+		// Check if the factor type and identifier match.
+		if (f.FactorType == "email" && user.Profile.Email != "" && (identifier == user.Profile.Email || identifier == user.ID)) ||
+			(f.FactorType == "sms" && user.Profile.MobilePhone != "" && (identifier == user.Profile.MobilePhone || identifier == user.ID)) {
+			return f, true
+		}
 	}
-	return nil, fmt.Errorf("failed to get user (status: %d): %s", resp.StatusCode, errorResp.ErrorSummary)
+	return Factor{}, false
 }
 
 // GetUserFactors gets the factors enrolled for a user.
@@ -198,9 +712,9 @@ func (o *Auth) GetUser(ctx context.Context, identifier string) (*User, error) {
 // Returns:
 //   - A list of factors.
 //   - An error if the request fails.
-func (o *Auth) GetUserFactors(ctx context.Context, userID string) ([]interface{}, error) {
+func (o *Auth) GetUserFactors(ctx context.Context, userID string) ([]Factor, error) {
 	// Construct the API URL.
-	url := fmt.Sprintf("%s/api/v1/users/%s/factors", o.Domain, userID)
+	url := o.url("users", userID, "factors")
 
 	// Make the API request.
 	resp, err := o.makeRequest(ctx, http.MethodGet, url, nil)
@@ -211,7 +725,7 @@ func (o *Auth) GetUserFactors(ctx context.Context, userID string) ([]interface{}
 
 	// Check for successful status code (200 OK).
 	if resp.StatusCode == http.StatusOK {
-		var factors []interface{} // You can define a more specific struct if needed.
+		var factors []Factor
 		if err := json.NewDecoder(resp.Body).Decode(&factors); err != nil {
 			return nil, fmt.Errorf("failed to decode factors response: %w", err)
 		}
@@ -219,11 +733,48 @@ func (o *Auth) GetUserFactors(ctx context.Context, userID string) ([]interface{}
 	}
 
 	// Handle API errors.
-	var errorResp ErrorResponse
-	if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
-		return nil, fmt.Errorf("failed to decode error response (status: %d): %w", resp.StatusCode, err)
+	return nil, fmt.Errorf("failed to get user factors: %w", o.decodeError(resp))
+}
+
+// GetUserGroups gets the names of the groups a user is a member of.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//
+// Returns:
+//   - The group names, or an empty list if the user is in no groups.
+//   - An error if the request fails.
+func (o *Auth) GetUserGroups(ctx context.Context, userID string) ([]string, error) {
+	// Construct the API URL.
+	url := o.url("users", userID, "groups")
+
+	// Make the API request.
+	resp, err := o.makeRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("failed to get user factors (status: %d): %s", resp.StatusCode, errorResp.ErrorSummary)
+	defer resp.Body.Close()
+
+	// Check for successful status code (200 OK).
+	if resp.StatusCode == http.StatusOK {
+		var groups []struct {
+			Profile struct {
+				Name string `json:"name"`
+			} `json:"profile"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+			return nil, fmt.Errorf("failed to decode groups response: %w", err)
+		}
+		names := make([]string, len(groups))
+		for i, g := range groups {
+			names[i] = g.Profile.Name
+		}
+		return names, nil
+	}
+
+	// Handle API errors.
+	return nil, fmt.Errorf("failed to get user groups: %w", o.decodeError(resp))
 }
 
 // VerifyEmailOrPhone initiates the verification process for a user's email or phone.
@@ -249,44 +800,15 @@ func (o *Auth) VerifyEmailOrPhone(ctx context.Context, identifier string) (strin
 		return "", err
 	}
 
-	var factorID string
-	var factorType string
-
-	// Iterate through the factors to find the appropriate email or SMS factor.
-	for _, f := range factors {
-		factorMap, ok := f.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// Check if the factor belongs to the Okta provider.
-		provider, ok := factorMap["provider"].(string)
-		if !ok || provider != "OKTA" {
-			continue
-		}
-
-		// Get the factor type.
-		fType, ok := factorMap["factorType"].(string)
-		if !ok {
-			continue
-		}
-
-		// Check if the factor type and identifier match.
-		if (fType == "email" && user.Profile.Email != "" && (identifier == user.Profile.Email || identifier == user.ID)) ||
-			(fType == "sms" && user.Profile.MobilePhone != "" && (identifier == user.Profile.MobilePhone || identifier == user.ID)) {
-			factorID, _ = factorMap["id"].(string)
-			factorType = fType
-			break
-		}
-	}
-
-	// Check if a suitable factor was found.
-	if factorID == "" {
+	// Find the email or SMS factor matching the identifier.
+	factor, ok := findContactFactor(user, factors, identifier)
+	if !ok {
 		return "", fmt.Errorf("email or SMS factor not found for user")
 	}
+	factorID, factorType := factor.ID, factor.FactorType
 
 	// 3. Trigger verification challenge.
-	challengeURL := fmt.Sprintf("%s/api/v1/users/%s/factors/%s/verify", o.Domain, user.ID, factorID)
+	challengeURL := o.url("users", user.ID, "factors", factorID, "verify")
 
 	// Make the API request to initiate the challenge.
 	resp, err := o.makeRequest(ctx, http.MethodPost, challengeURL, nil)
@@ -297,11 +819,7 @@ func (o *Auth) VerifyEmailOrPhone(ctx context.Context, identifier string) (strin
 
 	// Check for successful status codes.
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		var errorResp ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
-			return "", fmt.Errorf("failed to decode error response (status: %d): %w", resp.StatusCode, err)
-		}
-		return "", fmt.Errorf("failed to trigger %s verification (status: %d): %s", factorType, resp.StatusCode, errorResp.ErrorSummary)
+		return "", fmt.Errorf("failed to trigger %s verification: %w", factorType, o.decodeError(resp))
 	}
 
 	// Decode the verification response to extract the state token.
@@ -330,51 +848,47 @@ func (o *Auth) VerifyPasscode(ctx context.Context, identifier string, passcode s
 	if err != nil {
 		return "", err
 	}
+	return o.verifyContactPasscode(ctx, user, identifier, passcode)
+}
 
-	// 2. Find the email or SMS factor.
-	factors, err := o.GetUserFactors(ctx, user.ID)
+// VerifyUserPasscode verifies the one-time passcode sent to one of a user's contact details.
+// Unlike VerifyPasscode, the user is looked up by ID, so contact doesn't need to be their
+// Okta login: an email address selects the email factor and a phone number the SMS factor.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - contact: The email address or E.164 phone number the passcode was sent to.
+//   - passcode: The one-time passcode entered by the user.
+//
+// Returns:
+//   - The client ID upon successful verification.
+//   - An error if the verification fails.
+func (o *Auth) VerifyUserPasscode(ctx context.Context, userID, contact, passcode string) (string, error) {
+	user, err := o.GetUser(ctx, userID)
 	if err != nil {
 		return "", err
 	}
+	return o.verifyContactPasscode(ctx, user, contact, passcode)
+}
 
-	var factorID string
-	var factorType string
-
-	// Iterate through the factors to find the appropriate email or SMS factor.
-	for _, f := range factors {
-		factorMap, ok := f.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// Check if the factor belongs to the Okta provider.
-		provider, ok := factorMap["provider"].(string)
-		if !ok || provider != "OKTA" {
-			continue
-		}
-
-		// Get the factor type.
-		fType, ok := factorMap["factorType"].(string)
-		if !ok {
-			continue
-		}
-
-		// Check if the factor type and identifier match.
-		if (fType == "email" && user.Profile.Email != "" && (identifier == user.Profile.Email || identifier == user.ID)) ||
-			(fType == "sms" && user.Profile.MobilePhone != "" && (identifier == user.Profile.MobilePhone || identifier == user.ID)) {
-			factorID, _ = factorMap["id"].(string)
-			factorType = fType
-			break
-		}
+// verifyContactPasscode verifies passcode against the user's email or SMS factor matching identifier.
+func (o *Auth) verifyContactPasscode(ctx context.Context, user *User, identifier, passcode string) (string, error) {
+	// 2. Find the email or SMS factor.
+	factors, err := o.GetUserFactors(ctx, user.ID)
+	if err != nil {
+		return "", err
 	}
 
-	// Check if a suitable factor was found.
-	if factorID == "" {
+	// Find the email or SMS factor matching the identifier.
+	factor, ok := findContactFactor(user, factors, identifier)
+	if !ok {
 		return "", fmt.Errorf("email or SMS factor not found for user")
 	}
+	factorID, factorType := factor.ID, factor.FactorType
 
 	// 3. Verify the passcode.
-	verifyURL := fmt.Sprintf("%s/api/v1/users/%s/factors/%s/verify", o.Domain, user.ID, factorID)
+	verifyURL := o.url("users", user.ID, "factors", factorID, "verify")
 
 	// Create the verification request.
 	verifyReq := VerifyFactorRequest{
@@ -401,17 +915,169 @@ func (o *Auth) VerifyPasscode(ctx context.Context, identifier string, passcode s
 	}
 
 	// Handle API errors.
-	var errorResp ErrorResponse
-	if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
-		return "", fmt.Errorf("failed to decode error response (status: %d): %w", resp.StatusCode, err)
+	oktaErr := o.decodeError(resp)
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", fmt.Errorf("%w: failed to verify %s: %w", ErrInvalidCredentials, factorType, oktaErr)
 	}
-	return "", fmt.Errorf("failed to verify %s (status: %d): %s", factorType, resp.StatusCode, errorResp.ErrorSummary)
+	return "", fmt.Errorf("failed to verify %s: %w", factorType, oktaErr)
 }
 
-// makeRequest is a helper function to make HTTP requests to the Okta API.
+// ResendPasscode re-sends the one-time passcode for an email or SMS factor challenge,
+// for when the previous code expired before the user entered it.
 //
 // Parameters:
 //   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - factorID: The ID of the email or SMS factor being verified.
+//
+// Returns:
+//   - ErrResendRateLimited if Okta responds 429, or another error if the resend fails.
+func (o *Auth) ResendPasscode(ctx context.Context, userID, factorID string) error {
+	// Construct the API URL.
+	url := o.url("users", userID, "factors", factorID, "verify", "resend")
+
+	// Retrying a rate-limited resend only extends the lockout, so surface 429 immediately.
+	noRetry := *o
+	noRetry.MaxRetries = 0
+
+	// Make the API request.
+	resp, err := noRetry.makeRequest(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check for successful status codes (200-299).
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+
+	// Handle API errors.
+	oktaErr := o.decodeError(resp)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %w", ErrResendRateLimited, oktaErr)
+	}
+	return fmt.Errorf("failed to resend passcode: %w", oktaErr)
+}
+
+// AuthnRequest represents the primary authentication request.
+type AuthnRequest struct {
+	Username string `json:"username"` // The user's login (email or phone).
+	Password string `json:"password"` // The user's password.
+}
+
+// AuthnResponse represents the primary authentication response.
+type AuthnResponse struct {
+	Status       string `json:"status"`       // The authentication status (e.g., "SUCCESS", "MFA_REQUIRED").
+	SessionToken string `json:"sessionToken"` // The session token issued on success.
+	Embedded     struct {
+		User User `json:"user"` // The authenticated user.
+	} `json:"_embedded"` // Resources embedded in the response.
+}
+
+// Authenticate validates a username and password against Okta's primary authentication API.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - username: The user's login (email or phone).
+//   - password: The user's password.
+//
+// Returns:
+//   - The authentication response upon success.
+//   - ErrAccountLocked if the user is locked out, ErrInvalidCredentials if Okta rejects the
+//     credentials, or another error if the request fails.
+func (o *Auth) Authenticate(ctx context.Context, username, password string) (*AuthnResponse, error) {
+	// Construct the API URL.
+	url := o.url("authn")
+
+	// Marshal the request body to JSON.
+	body, err := json.Marshal(AuthnRequest{Username: username, Password: password})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal authentication request: %w", err)
+	}
+
+	// Make the API request.
+	resp, err := o.makeRequest(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Check for successful status code (200 OK).
+	if resp.StatusCode == http.StatusOK {
+		var authnResp AuthnResponse
+		if err := json.NewDecoder(resp.Body).Decode(&authnResp); err != nil {
+			return nil, fmt.Errorf("failed to decode authentication response: %w", err)
+		}
+		if authnResp.Status == authnLockedOut {
+			return &authnResp, ErrAccountLocked
+		}
+		if authnResp.Status != "SUCCESS" {
+			return &authnResp, fmt.Errorf("authentication not complete (status: %s)", authnResp.Status)
+		}
+		return &authnResp, nil
+	}
+
+	// Handle API errors.
+	oktaErr := o.decodeError(resp)
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, oktaErr)
+	}
+	return nil, fmt.Errorf("failed to authenticate: %w", oktaErr)
+}
+
+// url builds an Okta API URL from the domain, base path, and the given path segments.
+// Duplicate slashes are collapsed, and each segment is escaped so identifiers such as
+// email addresses are safe to use in the path.
+//
+// Parameters:
+//   - parts: The path segments to append after the base path (e.g., "users", userID).
+//
+// Returns:
+//   - The absolute URL string.
+func (o *Auth) url(parts ...string) string {
+	domain := o.Domain
+	if !strings.Contains(domain, "://") {
+		domain = "https://" + domain
+	}
+	u, err := url.Parse(domain)
+	if err != nil {
+		// Fall back to naive joining; the request itself will surface the bad domain.
+		return strings.TrimRight(o.Domain, "/") + "/" + strings.Trim(o.BasePath, "/") + "/" + strings.Join(parts, "/")
+	}
+
+	// The domain path and base path are already URL paths, so only split them on slashes.
+	var segments []string
+	for _, prefix := range []string{u.EscapedPath(), o.BasePath} {
+		for _, seg := range strings.Split(prefix, "/") {
+			if seg != "" {
+				segments = append(segments, seg)
+			}
+		}
+	}
+	// Callers' segments are raw values and must be escaped as a whole.
+	for _, part := range parts {
+		if part != "" {
+			segments = append(segments, strings.ReplaceAll(url.QueryEscape(part), "+", "%20"))
+		}
+	}
+
+	u.RawPath = "/" + strings.Join(segments, "/")
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// makeRequest is a helper function to make HTTP requests to the Okta API.
+// Responses with status 429, transient 5xx responses to idempotent requests, and connection
+// failures before the request was sent are retried up to MaxRetries times with exponential
+// backoff and jitter, honoring the Retry-After header on 429 responses. A 5xx response to a
+// POST isn't retried, since Okta may already have applied it. Each attempt is recorded in
+// metrics.OktaRequestDuration.
+//
+// Parameters:
+//   - ctx: The context for the request. Cancelling it stops any further retries.
 //   - method: The HTTP method (e.g., "GET", "POST").
 //   - urlStr: The URL for the request.
 //   - body: The request body (can be nil for GET requests).
@@ -420,20 +1086,169 @@ func (o *Auth) VerifyPasscode(ctx context.Context, identifier string, passcode s
 //   - The HTTP response.
 //   - An error if the request fails.
 func (o *Auth) makeRequest(ctx context.Context, method, urlStr string, body io.Reader) (*http.Response, error) {
+	// Buffer the body so it can be replayed on retries.
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = io.ReadAll(body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if payload != nil {
+			reqBody = bytes.NewReader(payload)
+		}
+
+		// Note whether the request reached Okta, so a failure before then can be retried.
+		var sent atomic.Bool
+		traceCtx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{WroteHeaders: func() { sent.Store(true) }})
+
+		start := time.Now()
+		resp, err := o.doRequest(traceCtx, method, urlStr, reqBody)
+		if err != nil {
+			metrics.OktaRequestDuration.WithLabelValues(method, metrics.StatusError).Observe(time.Since(start).Seconds())
+			if attempt >= o.MaxRetries || sent.Load() || ctx.Err() != nil {
+				return nil, err
+			}
+		} else {
+			metrics.OktaRequestDuration.WithLabelValues(method, strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
+			if attempt >= o.MaxRetries || !isRetryable(method, resp.StatusCode) {
+				return resp, nil
+			}
+		}
+
+		// Close the failed response; closing drains it so the connection can be reused.
+		delay := o.retryDelay(attempt, resp)
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		// Wait before retrying, unless the context is cancelled first.
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("request cancelled while waiting to retry: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryable reports whether a response status indicates a rate limit, which is safe to
+// retry for any method, or a transient server error in response to an idempotent method.
+// Okta may have applied a POST that failed with a 5xx, so retrying it could create a user
+// twice or count a failed sign-in twice.
+func isRetryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+	}
+	return false
+}
+
+// retryDelay returns how long to wait before the next attempt, given the failed attempt's
+// response, or nil if it failed before getting one. A Retry-After header on a 429 response
+// takes precedence over the exponential backoff.
+func (o *Auth) retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), o.clock().Now()); ok {
+			return min(d, maxRetryDelay)
+		}
+	}
+
+	// Exponential backoff with jitter: a random delay in [d/2, d].
+	d := min(o.RetryBaseDelay<<attempt, maxRetryDelay)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date,
+// which is waited for from now.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// doRequest sends a single HTTP request to the Okta API, traced in a client span whose
+// context is propagated to Okta in the request headers.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - method: The HTTP method (e.g., "GET", "POST").
+//   - urlStr: The URL for the request.
+//   - body: The request body (can be nil for GET requests).
+//
+// Returns:
+//   - The HTTP response.
+//   - An error if the request fails.
+func (o *Auth) doRequest(ctx context.Context, method, urlStr string, body io.Reader) (*http.Response, error) {
+	// Derive the per-call deadline: the client timeout, unless the caller's deadline is sooner.
+	cancel := context.CancelFunc(func() {})
+	if timeout := o.HTTPClient.Timeout; timeout > 0 {
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > timeout {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+	}
+
+	// Trace the call as a child of the caller's span.
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "okta "+method, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
 	// Create a new HTTP request.
 	req, err := http.NewRequestWithContext(ctx, method, urlStr, body)
 	if err != nil {
+		cancel()
+		span.SetStatus(codes.Error, err.Error())
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	span.SetAttributes(semconv.HTTPRequestMethodKey.String(method), semconv.URLPath(req.URL.Path))
 
-	// Set the required headers.
+	// Set the required headers, and propagate the trace context to Okta.
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "SSWS "+o.APIToken)
+	if o.APIToken != "" {
+		req.Header.Set("Authorization", "SSWS "+o.APIToken)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	// Send the request using the Okta client's HTTP client.
+	logger := o.logger().With(slog.String(logging.RequestIDKey, logging.RequestID(ctx)), slog.String("method", method), slog.String("path", req.URL.Path))
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		var payload []byte
+		if req.GetBody != nil {
+			if rc, err := req.GetBody(); err == nil {
+				payload, _ = io.ReadAll(rc)
+			}
+		}
+		logger.DebugContext(ctx, "sending okta request",
+			slog.Any("headers", o.redactor().Header(req.Header)),
+			slog.String("body", string(o.redactor().JSON(payload))),
+		)
+	}
+	start := time.Now()
 	resp, err := o.HTTPClient.Do(req)
 	if err != nil {
+		cancel()
+		logger.ErrorContext(ctx, "okta request failed", slog.Any("error", err), slog.Duration("duration", time.Since(start)))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		// Handle network errors, timeouts, etc.
 		var urlErr *url.Error
 		if errors.As(err, &urlErr) {
@@ -444,5 +1259,70 @@ func (o *Auth) makeRequest(ctx context.Context, method, urlStr string, body io.R
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		// Peek at the error body so the Okta error code can be logged, then put it back for the caller.
+		orig := resp.Body
+		raw, _ := io.ReadAll(io.LimitReader(orig, maxLoggedErrorBody))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(raw), orig), orig}
+
+		var errorResp ErrorResponse
+		json.Unmarshal(raw, &errorResp)
+		logger.ErrorContext(ctx, "okta request returned an error",
+			slog.Int("status", resp.StatusCode),
+			slog.String("error_code", errorResp.ErrorCode),
+			slog.String("error_id", errorResp.ErrorID),
+			slog.Duration("duration", time.Since(start)),
+		)
+		logger.DebugContext(ctx, "okta error response", slog.String("body", string(o.redactor().JSON(raw))))
+		span.SetAttributes(attribute.String("okta.error_code", errorResp.ErrorCode), attribute.String("okta.error_id", errorResp.ErrorID))
+		span.SetStatus(codes.Error, fmt.Sprintf("okta error %s (status: %d)", errorResp.ErrorCode, resp.StatusCode))
+	} else {
+		logger.DebugContext(ctx, "okta request", slog.Int("status", resp.StatusCode), slog.Duration("duration", time.Since(start)))
+	}
+
+	// The deadline must outlive this call so the caller can still read the body.
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
 	return resp, nil
 }
+
+// logger returns the configured logger, falling back to slog.Default().
+func (o *Auth) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return slog.Default()
+}
+
+// clock returns the configured clock, falling back to the system clock.
+func (o *Auth) clock() clock.Clock {
+	if o.Clock != nil {
+		return o.Clock
+	}
+	return clock.Real{}
+}
+
+// redactor returns the configured redactor, falling back to one for DefaultRedactedFields.
+func (o *Auth) redactor() *logging.Redactor {
+	if o.Redactor != nil {
+		return o.Redactor
+	}
+	return logging.NewRedactor(logging.DefaultRedactedFields)
+}
+
+// cancelOnClose releases a request's derived context once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close drains what's left of the body so the connection can be reused, then closes it and
+// releases the context.
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	io.Copy(io.Discard, io.LimitReader(c.ReadCloser, maxDrainedBody))
+	return c.ReadCloser.Close()
+}
@@ -1,12 +1,44 @@
 package auth
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/internal/validate"
 )
 
+// newTestAuth returns an Auth client pointed at a fake Okta server with fast retries.
+func newTestAuth(t *testing.T, handler http.HandlerFunc) *Auth {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	o := New(srv.URL, "token", "client-id", "secret")
+	o.RetryBaseDelay = time.Millisecond
+	return o
+}
+
 func ExampleAuth_RegisterUser() {
 	// Set your Auth configuration as environment variables
 	AuthDomain := os.Getenv("Auth_DOMAIN")
@@ -78,3 +110,977 @@ func ExampleAuth_VerifyEmailOrPhone() {
 
 	fmt.Printf("Email/phone verified successfully. Client ID: %s\n", clientID)
 }
+
+func TestMakeRequestRetriesRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE"}`))
+	})
+
+	user, err := o.GetUser(context.Background(), "00u1")
+	if err != nil {
+		t.Fatalf("GetUser returned error: %v", err)
+	}
+	if user.ID != "00u1" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("expected 3 calls, got %d", got)
+	}
+}
+
+func TestMakeRequestStopsRetryingOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	o.RetryBaseDelay = time.Minute
+
+	start := time.Now()
+	_, err := o.GetUser(ctx, "00u1")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("retry loop did not stop promptly after cancellation")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected 1 call, got %d", got)
+	}
+}
+
+func TestMakeRequestRetriesServerErrorsOnlyWhenIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE","sessionToken":"session"}`))
+	})
+
+	if _, err := o.GetUser(context.Background(), "00u1"); err != nil {
+		t.Fatalf("expected GetUser to be retried, got %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected 2 calls, got %d", got)
+	}
+
+	// Okta may already have counted the attempt, so a POST isn't sent again.
+	calls.Store(0)
+	if _, err := o.Authenticate(context.Background(), "john.doe@example.com", "secret"); err == nil {
+		t.Fatal("expected the 503 to be returned")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected 1 call, got %d", got)
+	}
+}
+
+// failingTransport fails the first failures requests, after writing their headers if sent
+// is set, and sends the rest.
+type failingTransport struct {
+	failures int32
+	sent     bool
+	requests atomic.Int32
+}
+
+func (t *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.requests.Add(1) > t.failures {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	if trace := httptrace.ContextClientTrace(req.Context()); t.sent && trace != nil && trace.WroteHeaders != nil {
+		trace.WroteHeaders()
+	}
+	return nil, errors.New("connection reset")
+}
+
+func TestMakeRequestRetriesUnsentRequests(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"SUCCESS","sessionToken":"session"}`))
+	})
+
+	unsent := &failingTransport{failures: 2}
+	if _, err := o.WithTransport(unsent).Authenticate(context.Background(), "john.doe@example.com", "secret"); err != nil {
+		t.Fatalf("expected a POST that never reached Okta to be retried, got %v", err)
+	}
+	if got := unsent.requests.Load(); got != 3 {
+		t.Fatalf("expected 3 requests, got %d", got)
+	}
+
+	sent := &failingTransport{failures: 1, sent: true}
+	if _, err := o.WithTransport(sent).Authenticate(context.Background(), "john.doe@example.com", "secret"); err == nil {
+		t.Fatal("expected a POST that failed after it was sent to fail")
+	}
+	if got := sent.requests.Load(); got != 1 {
+		t.Fatalf("expected 1 request, got %d", got)
+	}
+}
+
+// trackingTransport records whether every response body it returns is read to the end and closed.
+type trackingTransport struct {
+	mu     sync.Mutex
+	bodies []*trackedBody
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	drained, closed atomic.Bool
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.drained.Store(true)
+	}
+	return n, err
+}
+
+func (b *trackedBody) Close() error {
+	b.closed.Store(true)
+	return b.ReadCloser.Close()
+}
+
+func (t *trackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body := &trackedBody{ReadCloser: resp.Body}
+	t.mu.Lock()
+	t.bodies = append(t.bodies, body)
+	t.mu.Unlock()
+	resp.Body = body
+	return resp, nil
+}
+
+// check fails the test if any response body was left open or unread.
+func (t *trackingTransport) check(tb testing.TB, name string) {
+	tb.Helper()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.bodies) == 0 {
+		tb.Errorf("%s: no requests were sent", name)
+	}
+	for i, body := range t.bodies {
+		if !body.closed.Load() || !body.drained.Load() {
+			tb.Errorf("%s: response %d: closed %v, drained %v", name, i, body.closed.Load(), body.drained.Load())
+		}
+	}
+	t.bodies = nil
+}
+
+func TestResponseBodiesAreDrainedAndClosed(t *testing.T) {
+	// Every response carries a trailing field the decoders never read.
+	statuses := []int{http.StatusOK, http.StatusNoContent, http.StatusNotFound, http.StatusForbidden, http.StatusTooManyRequests, http.StatusBadGateway}
+	for _, status := range statuses {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(status)
+				switch {
+				case status == http.StatusBadGateway:
+					w.Write([]byte("<html><body>Bad Gateway</body></html>"))
+				case status >= http.StatusBadRequest:
+					w.Write([]byte(`{"errorCode":"E0000006","errorSummary":"Error"}` + "\n" + strings.Repeat(" ", 1024)))
+				case status == http.StatusOK && strings.HasSuffix(r.URL.Path, "/factors"):
+					w.Write([]byte(`[{"id":"sms1","factorType":"sms","status":"ACTIVE","profile":{"phoneNumber":"+15555550100"}}]` + "\n" + strings.Repeat(" ", 1024)))
+				case status == http.StatusOK && r.URL.Path == "/api/v1/users" && r.Method == http.MethodGet:
+					w.Write([]byte(`[{"id":"00u1","profile":{"login":"john.doe@example.com"}}]` + "\n" + strings.Repeat(" ", 1024)))
+				case status == http.StatusOK:
+					w.Write([]byte(`{"id":"00u1","status":"ACTIVE","profile":{"login":"john.doe@example.com"}}` + "\n" + strings.Repeat(" ", 1024)))
+				}
+			})
+			o.MaxRetries = 1
+			transport := &trackingTransport{}
+			o.HTTPClient.Transport = transport
+			ctx := context.Background()
+
+			calls := map[string]func(){
+				"CreateUser": func() {
+					o.CreateUser(ctx, RegistrationRequest{Profile: UserProfile{Email: "john.doe@example.com"}})
+				},
+				"DeactivateUser":     func() { o.DeactivateUser(ctx, "00u1") },
+				"DeleteUser":         func() { o.DeleteUser(ctx, "00u1") },
+				"UpdateProfile":      func() { o.UpdateProfile(ctx, "00u1", UserProfile{FirstName: "John"}) },
+				"GetUser":            func() { o.GetUser(ctx, "00u1") },
+				"GetUsers":           func() { o.GetUsers(ctx, []string{"00u1", "00u2"}) },
+				"GetUserFactors":     func() { o.GetUserFactors(ctx, "00u1") },
+				"GetUserGroups":      func() { o.GetUserGroups(ctx, "00u1") },
+				"VerifyEmailOrPhone": func() { o.VerifyEmailOrPhone(ctx, "+15555550100") },
+				"ResendPasscode":     func() { o.ResendPasscode(ctx, "00u1", "sms1") },
+				"Authenticate":       func() { o.Authenticate(ctx, "john.doe@example.com", "hunter2") },
+				"StartPasswordReset": func() { o.StartPasswordReset(ctx, "john.doe@example.com") },
+				"ChangePassword":     func() { o.ChangePassword(ctx, "00u1", "Old-Horse-1", "Correct-Horse-9") },
+				"EnrollTOTPFactor":   func() { o.EnrollTOTPFactor(ctx, "00u1") },
+				"ActivateTOTPFactor": func() { o.ActivateTOTPFactor(ctx, "00u1", "totp1", "123456") },
+			}
+			for name, call := range calls {
+				call()
+				transport.check(t, name)
+			}
+		})
+	}
+}
+
+func TestCancelledRequestReleasesConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan struct{})
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		// The cancellation reaches the server as a closed request context.
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	})
+	transport := &trackingTransport{}
+	o.HTTPClient.Transport = transport
+
+	if _, err := o.GetUser(ctx, "00u1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the cancellation to propagate to the server")
+	}
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	for i, body := range transport.bodies {
+		if !body.closed.Load() {
+			t.Errorf("response %d was left open", i)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if d, ok := parseRetryAfter("2", now); !ok || d != 2*time.Second {
+		t.Fatalf("parseRetryAfter(\"2\") = %v, %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Fatal("expected invalid Retry-After to be rejected")
+	}
+	date := now.Add(time.Hour).Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(date, now); !ok || d != time.Hour {
+		t.Fatalf("parseRetryAfter(%q) = %v, %v", date, d, ok)
+	}
+	if d, ok := parseRetryAfter(date, now.Add(2*time.Hour)); !ok || d != 0 {
+		t.Fatalf("expected a past date not to be waited for, got %v, %v", d, ok)
+	}
+}
+
+func TestRetryDelayUsesClock(t *testing.T) {
+	now := clock.NewFake(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	o := New("https://example.okta.com", "token", "client-id", "secret")
+	o.Clock = now
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", now.Now().Add(5*time.Second).Format(http.TimeFormat))
+
+	if d := o.retryDelay(0, resp); d != 5*time.Second {
+		t.Fatalf("expected a 5s delay, got %v", d)
+	}
+	now.Advance(3 * time.Second)
+	if d := o.retryDelay(0, resp); d != 2*time.Second {
+		t.Fatalf("expected a 2s delay once the clock moved on, got %v", d)
+	}
+}
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		basePath string
+		parts    []string
+		want     string
+	}{
+		{"no trailing slash", "https://example.okta.com", DefaultBasePath, []string{"users", "00u1"}, "https://example.okta.com/api/v1/users/00u1"},
+		{"trailing slash", "https://example.okta.com/", DefaultBasePath, []string{"users", "00u1"}, "https://example.okta.com/api/v1/users/00u1"},
+		{"no scheme", "example.okta.com", DefaultBasePath, []string{"authn"}, "https://example.okta.com/api/v1/authn"},
+		{"proxy prefix", "https://proxy.internal/okta/", "/v2/", []string{"users"}, "https://proxy.internal/okta/v2/users"},
+		{"email identifier", "https://example.okta.com", DefaultBasePath, []string{"users", "john.doe@example.com"}, "https://example.okta.com/api/v1/users/john.doe%40example.com"},
+		{"plus identifier", "https://example.okta.com", DefaultBasePath, []string{"users", "john+shop@example.com"}, "https://example.okta.com/api/v1/users/john%2Bshop%40example.com"},
+		{"slash in identifier", "https://example.okta.com", DefaultBasePath, []string{"users", "a/b"}, "https://example.okta.com/api/v1/users/a%2Fb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Auth{Domain: tt.domain, BasePath: tt.basePath}
+			if got := o.url(tt.parts...); got != tt.want {
+				t.Fatalf("url(%q) = %q, want %q", tt.parts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetUserEscapesIdentifier(t *testing.T) {
+	var gotPath string
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		w.Write([]byte(`{"id":"00u1"}`))
+	})
+
+	if _, err := o.GetUser(context.Background(), "john+shop@example.com"); err != nil {
+		t.Fatalf("GetUser returned error: %v", err)
+	}
+	if want := "/api/v1/users/john%2Bshop%40example.com"; gotPath != want {
+		t.Fatalf("request path = %q, want %q", gotPath, want)
+	}
+}
+
+// newSlowAuth returns an Auth client pointed at a server that stalls until the request is abandoned.
+func newSlowAuth(t *testing.T) *Auth {
+	return newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+}
+
+func TestMakeRequestContextDeadlineWins(t *testing.T) {
+	o := newSlowAuth(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := o.GetUser(ctx, "00u1")
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request took %v, expected it to stop near the 50ms deadline", elapsed)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	o := newSlowAuth(t)
+	fast := o.WithTimeout(50 * time.Millisecond)
+
+	if o.HTTPClient.Timeout == fast.HTTPClient.Timeout {
+		t.Fatal("WithTimeout modified the original client")
+	}
+
+	start := time.Now()
+	if _, err := fast.GetUser(context.Background(), "00u1"); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request took %v, expected it to stop near the 50ms timeout", elapsed)
+	}
+}
+
+// countingTransport counts the requests sent through it.
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithTransport(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE"}`))
+	})
+	transport := &countingTransport{}
+	counted := o.WithTransport(transport)
+
+	if o.HTTPClient.Transport == counted.HTTPClient.Transport {
+		t.Fatal("WithTransport modified the original client")
+	}
+	if counted.HTTPClient.Timeout != o.HTTPClient.Timeout {
+		t.Fatalf("expected the timeout to be kept, got %v", counted.HTTPClient.Timeout)
+	}
+
+	for range 3 {
+		if _, err := counted.GetUser(context.Background(), "00u1"); err != nil {
+			t.Fatalf("GetUser returned error: %v", err)
+		}
+	}
+	if _, err := o.GetUser(context.Background(), "00u1"); err != nil {
+		t.Fatalf("GetUser returned error: %v", err)
+	}
+	if n := transport.requests.Load(); n != 3 {
+		t.Fatalf("expected 3 requests through the transport, got %d", n)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	transport := NewTransport(TransportOptions{MaxIdleConnsPerHost: 50, IdleConnTimeout: time.Minute})
+	if transport.MaxIdleConns != DefaultMaxIdleConns || transport.MaxIdleConnsPerHost != 50 || transport.IdleConnTimeout != time.Minute {
+		t.Fatalf("unexpected pool settings: %d idle, %d per host, %v timeout", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	if transport.Proxy == nil || transport.TLSHandshakeTimeout == 0 {
+		t.Fatal("expected http.DefaultTransport's other settings to be kept")
+	}
+
+	if o := New("https://example.okta.com", "token", "client-id", "secret"); o.HTTPClient.Transport.(*http.Transport).MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost {
+		t.Fatal("expected New to use a pooled transport")
+	}
+}
+
+const factorsPayload = `[
+  {"id":"ostf1","factorType":"token:software:totp","provider":"GOOGLE","status":"ACTIVE","profile":{"credentialId":"john.doe@example.com"}},
+  {"id":"opf1","factorType":"push","provider":"OKTA","status":"ACTIVE","profile":{"deviceType":"SmartPhone_IPhone"}},
+  {"id":"sms1","factorType":"sms","provider":"OKTA","status":"ACTIVE","profile":{"phoneNumber":"+15555550100"}},
+  {"id":"emf1","factorType":"email","provider":"OKTA","status":"ACTIVE","profile":{"email":"john.doe@example.com"}}
+]`
+
+func TestVerifyEmailOrPhoneSelectsFactor(t *testing.T) {
+	var verified string
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case path == "/api/v1/users/00u1/factors":
+			w.Write([]byte(factorsPayload))
+		case strings.HasPrefix(path, "/api/v1/users/00u1/factors/") && strings.HasSuffix(path, "/verify"):
+			verified = strings.Split(path, "/")[6]
+			w.Write([]byte(`{"status":"WAITING"}`))
+		case strings.HasPrefix(path, "/api/v1/users/"):
+			w.Write([]byte(`{"id":"00u1","status":"ACTIVE","profile":{"email":"john.doe@example.com","mobilePhone":"+15555550100"}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, path)
+		}
+	})
+
+	tests := map[string]string{
+		"john.doe@example.com": "emf1",
+		"+15555550100":         "sms1",
+	}
+	for identifier, want := range tests {
+		verified = ""
+		if _, err := o.VerifyEmailOrPhone(context.Background(), identifier); err != nil {
+			t.Fatalf("VerifyEmailOrPhone(%q) returned error: %v", identifier, err)
+		}
+		if verified != want {
+			t.Fatalf("VerifyEmailOrPhone(%q) verified factor %q, want %q", identifier, verified, want)
+		}
+	}
+}
+
+func TestVerifyUserPasscodeSelectsFactor(t *testing.T) {
+	var verified, passcode string
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case path == "/api/v1/users/00u1/factors":
+			w.Write([]byte(factorsPayload))
+		case strings.HasPrefix(path, "/api/v1/users/00u1/factors/") && strings.HasSuffix(path, "/verify"):
+			var req VerifyFactorRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			verified, passcode = strings.Split(path, "/")[6], req.PassCode
+			w.Write([]byte(`{"factorResult":"SUCCESS"}`))
+		case path == "/api/v1/users/00u1":
+			w.Write([]byte(`{"id":"00u1","status":"ACTIVE","profile":{"login":"john.doe@example.com","email":"john.doe@example.com","mobilePhone":"+15555550100"}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, path)
+		}
+	})
+
+	// The phone number isn't the user's login, so the user is looked up by ID.
+	for contact, want := range map[string]string{"john.doe@example.com": "emf1", "+15555550100": "sms1"} {
+		verified = ""
+		if _, err := o.VerifyUserPasscode(context.Background(), "00u1", contact, "123456"); err != nil {
+			t.Fatalf("VerifyUserPasscode(%q) returned error: %v", contact, err)
+		}
+		if verified != want || passcode != "123456" {
+			t.Fatalf("VerifyUserPasscode(%q) verified factor %q with %q, want %q", contact, verified, passcode, want)
+		}
+	}
+
+	if _, err := o.VerifyUserPasscode(context.Background(), "00u1", "+15555550199", "123456"); err == nil {
+		t.Fatal("expected an error for a phone number without a factor")
+	}
+}
+
+func TestGetUserFactorsDecodesTypedFactors(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(factorsPayload))
+	})
+
+	factors, err := o.GetUserFactors(context.Background(), "00u1")
+	if err != nil {
+		t.Fatalf("GetUserFactors returned error: %v", err)
+	}
+	if len(factors) != 4 {
+		t.Fatalf("expected 4 factors, got %d", len(factors))
+	}
+	if f := factors[2]; f.FactorType != "sms" || f.Provider != "OKTA" || f.Profile.PhoneNumber != "+15555550100" {
+		t.Fatalf("unexpected sms factor %+v", f)
+	}
+	if f := factors[3]; f.Profile.Email != "john.doe@example.com" || f.Status != "ACTIVE" {
+		t.Fatalf("unexpected email factor %+v", f)
+	}
+}
+
+func TestGetUserGroups(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/users/00u1/groups":
+			w.Write([]byte(`[
+  {"id":"00g1","type":"BUILT_IN","profile":{"name":"Everyone","description":"All users in your organization"}},
+  {"id":"00g2","type":"OKTA_GROUP","profile":{"name":"Shop Admins","description":null}}
+]`))
+		case "/api/v1/users/00u2/groups":
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"E0000007","errorSummary":"Not found: Resource not found: 00u3 (User)"}`))
+		}
+	})
+
+	groups, err := o.GetUserGroups(context.Background(), "00u1")
+	if err != nil {
+		t.Fatalf("GetUserGroups returned error: %v", err)
+	}
+	if len(groups) != 2 || groups[0] != "Everyone" || groups[1] != "Shop Admins" {
+		t.Fatalf("unexpected groups %q", groups)
+	}
+
+	if groups, err := o.GetUserGroups(context.Background(), "00u2"); err != nil || len(groups) != 0 {
+		t.Fatalf("expected no groups, got (%q, %v)", groups, err)
+	}
+	if _, err := o.GetUserGroups(context.Background(), "00u3"); err == nil {
+		t.Fatal("expected an error for an unknown user")
+	}
+}
+
+func TestResendPasscode(t *testing.T) {
+	var calls atomic.Int32
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/users/00u1/factors/sms1/verify/resend" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if calls.Add(1) > 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"errorCode":"E0000109","errorSummary":"An SMS message was recently sent. Please wait 30 seconds before trying again."}`))
+			return
+		}
+		w.Write([]byte(`{"factorResult":"CHALLENGE"}`))
+	})
+
+	if err := o.ResendPasscode(context.Background(), "00u1", "sms1"); err != nil {
+		t.Fatalf("ResendPasscode returned error: %v", err)
+	}
+
+	err := o.ResendPasscode(context.Background(), "00u1", "sms1")
+	if !errors.Is(err, ErrResendRateLimited) {
+		t.Fatalf("expected ErrResendRateLimited, got %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected rate-limited resend not to be retried, got %d calls", got)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	t.Run("deactivate and delete", func(t *testing.T) {
+		var calls atomic.Int32
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodDelete || r.URL.Path != "/api/v1/users/00u1" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			calls.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		if err := o.DeleteUser(context.Background(), "00u1"); err != nil {
+			t.Fatalf("DeleteUser returned error: %v", err)
+		}
+		if got := calls.Load(); got != 2 {
+			t.Fatalf("expected 2 DELETE calls, got %d", got)
+		}
+	})
+
+	t.Run("delete fails", func(t *testing.T) {
+		var calls atomic.Int32
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000006","errorSummary":"You do not have permission to perform the requested action"}`))
+		})
+
+		err := o.DeleteUser(context.Background(), "00u1")
+		if err == nil || !strings.Contains(err.Error(), "failed to delete user") {
+			t.Fatalf("expected delete failure, got %v", err)
+		}
+	})
+
+	t.Run("already deleted", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"E0000007","errorSummary":"Not found: Resource not found: 00u1 (User)"}`))
+		})
+
+		if err := o.DeleteUser(context.Background(), "00u1"); err != nil {
+			t.Fatalf("expected deleting a missing user to succeed, got %v", err)
+		}
+	})
+}
+
+func TestDeactivateUser(t *testing.T) {
+	t.Run("deactivate", func(t *testing.T) {
+		var calls atomic.Int32
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/api/v1/users/00u1/lifecycle/deactivate" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			calls.Add(1)
+			w.Write([]byte(`{}`))
+		})
+
+		if err := o.DeactivateUser(context.Background(), "00u1"); err != nil {
+			t.Fatalf("DeactivateUser returned error: %v", err)
+		}
+		if got := calls.Load(); got != 1 {
+			t.Fatalf("expected 1 call, got %d", got)
+		}
+	})
+
+	t.Run("missing user", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"E0000007","errorSummary":"Not found: Resource not found: 00u1 (User)"}`))
+		})
+
+		if err := o.DeactivateUser(context.Background(), "00u1"); err != nil {
+			t.Fatalf("expected deactivating a missing user to succeed, got %v", err)
+		}
+	})
+
+	t.Run("fails", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000006","errorSummary":"You do not have permission to perform the requested action"}`))
+		})
+
+		var oktaErr *OktaError
+		if err := o.DeactivateUser(context.Background(), "00u1"); !errors.As(err, &oktaErr) || oktaErr.Code != "E0000006" {
+			t.Fatalf("expected Okta error E0000006, got %v", err)
+		}
+	})
+}
+
+func TestReactivateUser(t *testing.T) {
+	t.Run("reactivate", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/api/v1/users/00u1/lifecycle/reactivate" || r.URL.Query().Get("sendEmail") != "true" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			}
+			w.Write([]byte(`{"activationUrl":"https://example.okta.com/welcome/act-1","activationToken":"act-1"}`))
+		})
+
+		token, err := o.ReactivateUser(context.Background(), "00u1")
+		if err != nil {
+			t.Fatalf("ReactivateUser returned error: %v", err)
+		}
+		if token != "act-1" {
+			t.Fatalf("expected activation token act-1, got %q", token)
+		}
+	})
+
+	t.Run("emailed", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{}`))
+		})
+
+		if token, err := o.ReactivateUser(context.Background(), "00u1"); err != nil || token != "" {
+			t.Fatalf("expected (\"\", nil), got (%q, %v)", token, err)
+		}
+	})
+
+	t.Run("already active", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000038","errorSummary":"This operation is not allowed in the user's current status."}`))
+		})
+
+		if _, err := o.ReactivateUser(context.Background(), "00u1"); !errors.Is(err, ErrAlreadyActive) {
+			t.Fatalf("expected ErrAlreadyActive, got %v", err)
+		}
+	})
+
+	t.Run("fails", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"E0000007","errorSummary":"Not found: Resource not found: 00u404 (User)"}`))
+		})
+
+		_, err := o.ReactivateUser(context.Background(), "00u404")
+		if errors.Is(err, ErrAlreadyActive) {
+			t.Fatalf("expected a missing user not to be reported as active, got %v", err)
+		}
+		var oktaErr *OktaError
+		if !errors.As(err, &oktaErr) || oktaErr.Code != "E0000007" {
+			t.Fatalf("expected Okta error E0000007, got %v", err)
+		}
+	})
+}
+
+func TestUpdateProfileSendsOnlyChangedFields(t *testing.T) {
+	var body map[string]map[string]any
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/users/00u1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE","profile":{"email":"new@example.com"}}`))
+	})
+
+	user, err := o.UpdateProfile(context.Background(), "00u1", UserProfile{Email: "new@example.com"})
+	if err != nil {
+		t.Fatalf("UpdateProfile returned error: %v", err)
+	}
+	if user.Profile.Email != "new@example.com" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	profile := body["profile"]
+	if len(profile) != 1 || profile["email"] != "new@example.com" {
+		t.Fatalf("expected only email in patch body, got %v", profile)
+	}
+}
+
+func TestMakeRequestLogsOktaErrorCode(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errorCode":"E0000007","errorSummary":"Not found: Resource not found: 00u1 (User)"}`))
+	})
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Logger = logger
+
+	ctx := logging.WithRequestID(context.Background(), "req-123")
+	if _, err := o.GetUser(ctx, "00u1"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{`"level":"ERROR"`, `"error_code":"E0000007"`, `"request_id":"req-123"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log output to contain %s, got %s", want, out)
+		}
+	}
+}
+
+func TestMakeRequestRedactsLoggedBodies(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errorCode":"E0000004","errorSummary":"Authentication failed"}`))
+	})
+	o.APIToken = "00secret-token"
+	o.MaxRetries = 0
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Logger = logger
+
+	if _, err := o.Authenticate(context.Background(), "john.doe@example.com", "hunter2"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+
+	out := buf.String()
+	for _, secret := range []string{"john.doe@example.com", "hunter2", "00secret-token"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q to be redacted from the logs, got %s", secret, out)
+		}
+	}
+	for _, want := range []string{`"msg":"sending okta request"`, `[REDACTED]`, `E0000004`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log output to contain %s, got %s", want, out)
+		}
+	}
+}
+
+func TestMakeRequestPropagatesTraceContext(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	var traceparent string
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE"}`))
+	})
+
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "parent")
+	defer span.End()
+	if _, err := o.GetUser(ctx, "00u1"); err != nil {
+		t.Fatalf("GetUser returned error: %v", err)
+	}
+
+	// traceparent is "00-<trace ID>-<span ID>-<flags>".
+	if !strings.HasPrefix(traceparent, "00-"+span.SpanContext().TraceID().String()+"-") {
+		t.Fatalf("expected traceparent in trace %s, got %q", span.SpanContext().TraceID(), traceparent)
+	}
+}
+
+func TestCreateUserReturnsTypedOktaError(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{
+			"errorCode": "E0000001",
+			"errorSummary": "Api validation failed: login",
+			"errorLink": "E0000001",
+			"errorId": "oaeHfmOAx1iRLa0H10DeMz5fQ",
+			"errorCauses": [{"errorSummary": "login: An object with this field already exists in the current organization"}]
+		}`))
+	})
+
+	_, err := o.CreateUser(context.Background(), RegistrationRequest{Profile: UserProfile{Email: "john.doe@example.com"}})
+	var oktaErr *OktaError
+	if !errors.As(err, &oktaErr) {
+		t.Fatalf("expected *OktaError, got %T: %v", err, err)
+	}
+	if oktaErr.StatusCode != http.StatusBadRequest || oktaErr.Code != "E0000001" || oktaErr.Summary != "Api validation failed: login" || oktaErr.ID != "oaeHfmOAx1iRLa0H10DeMz5fQ" {
+		t.Fatalf("unexpected error fields: %+v", oktaErr)
+	}
+	if len(oktaErr.Causes) != 1 || !strings.Contains(oktaErr.Causes[0], "already exists") {
+		t.Fatalf("unexpected causes: %v", oktaErr.Causes)
+	}
+	if !errors.Is(err, ErrLoginTaken) || errors.Is(err, ErrInvalidProfile) {
+		t.Fatalf("expected ErrLoginTaken, got %v", err)
+	}
+
+	invalid := &OktaError{StatusCode: http.StatusBadRequest, Code: "E0000001", Causes: []string{"mobilePhone: Does not match required pattern"}}
+	if !errors.Is(invalid, ErrInvalidProfile) || errors.Is(invalid, ErrLoginTaken) {
+		t.Fatalf("expected ErrInvalidProfile, got %v", invalid)
+	}
+	if errors.Is(&OktaError{StatusCode: http.StatusInternalServerError, Code: "E0000009"}, ErrInvalidProfile) {
+		t.Fatal("expected other Okta errors not to match ErrInvalidProfile")
+	}
+}
+
+func TestGetUserNotFoundKeepsOktaError(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errorCode":"E0000007","errorSummary":"Not found: Resource not found: nobody (User)"}`))
+	})
+
+	_, err := o.GetUser(context.Background(), "nobody")
+	var oktaErr *OktaError
+	if !errors.Is(err, ErrUserNotFound) || !errors.As(err, &oktaErr) || oktaErr.Code != "E0000007" {
+		t.Fatalf("expected ErrUserNotFound wrapping an E0000007 OktaError, got %v", err)
+	}
+}
+
+func TestAccountLocked(t *testing.T) {
+	t.Run("authenticate", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"status":"LOCKED_OUT","_embedded":{"user":{"id":"00u1"}}}`))
+		})
+
+		if _, err := o.Authenticate(context.Background(), "john.doe@example.com", "hunter2"); !errors.Is(err, ErrAccountLocked) || errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("expected ErrAccountLocked, got %v", err)
+		}
+	})
+
+	t.Run("passcode", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			switch path := r.URL.Path; {
+			case path == "/api/v1/users/00u1":
+				w.Write([]byte(`{"id":"00u1","status":"LOCKED_OUT","profile":{"login":"john.doe@example.com","email":"john.doe@example.com"}}`))
+			case path == "/api/v1/users/00u1/factors":
+				w.Write([]byte(factorsPayload))
+			default:
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errorCode":"E0000069","errorSummary":"User Locked"}`))
+			}
+		})
+
+		_, err := o.VerifyUserPasscode(context.Background(), "00u1", "john.doe@example.com", "123456")
+		var oktaErr *OktaError
+		if !errors.Is(err, ErrAccountLocked) || !errors.As(err, &oktaErr) || oktaErr.Code != "E0000069" {
+			t.Fatalf("expected ErrAccountLocked matching an E0000069 OktaError, got %v", err)
+		}
+	})
+
+	if errors.Is(&OktaError{StatusCode: http.StatusUnauthorized, Code: "E0000004"}, ErrAccountLocked) {
+		t.Fatal("expected other Okta errors not to match ErrAccountLocked")
+	}
+}
+
+func TestNonJSONErrorBodies(t *testing.T) {
+	html := "<html>\n<head><title>502 Bad Gateway</title></head>\n<body>" + strings.Repeat("<p>upstream unavailable</p>", 20) + "</body>\n</html>"
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		snippet string
+	}{
+		{"HTML 502", http.StatusBadGateway, html, "<html> <head><title>502 Bad Gateway</title></head>"},
+		{"plaintext 503", http.StatusServiceUnavailable, "upstream connect error or disconnect/reset before headers\n", "upstream connect error or disconnect/reset before headers"},
+		{"empty 502", http.StatusBadGateway, "", "(empty body)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			o.MaxRetries = 0
+
+			_, err := o.GetUser(context.Background(), "00u1")
+			var oktaErr *OktaError
+			if !errors.As(err, &oktaErr) {
+				t.Fatalf("expected *OktaError, got %T: %v", err, err)
+			}
+			if oktaErr.StatusCode != tt.status || oktaErr.Code != "" || !strings.HasPrefix(oktaErr.Body, tt.snippet) {
+				t.Fatalf("unexpected error fields: %+v", oktaErr)
+			}
+			if len(oktaErr.Body) > maxErrorSnippet+len("...") {
+				t.Fatalf("expected the snippet to be truncated, got %d bytes", len(oktaErr.Body))
+			}
+			if msg := err.Error(); !strings.Contains(msg, strconv.Itoa(tt.status)) || strings.Contains(msg, "decode") {
+				t.Fatalf("expected the status without a decoding error, got %q", msg)
+			}
+		})
+	}
+}
+
+func TestCreateUserValidatesContact(t *testing.T) {
+	var body RegistrationRequest
+	var calls atomic.Int32
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE"}`))
+	})
+
+	if _, err := o.CreateUser(context.Background(), RegistrationRequest{Profile: UserProfile{MobilePhone: "+44 20 7946 0958"}}); err != nil {
+		t.Fatalf("CreateUser returned error: %v", err)
+	}
+	if body.Profile.MobilePhone != "+442079460958" || body.Profile.Login != "+442079460958" {
+		t.Fatalf("expected normalized phone to be sent, got %+v", body.Profile)
+	}
+
+	if _, err := o.CreateUser(context.Background(), RegistrationRequest{Profile: UserProfile{Email: "john.doe"}}); !errors.Is(err, validate.ErrInvalidEmail) {
+		t.Fatalf("expected ErrInvalidEmail, got %v", err)
+	}
+	if _, err := o.CreateUser(context.Background(), RegistrationRequest{Profile: UserProfile{MobilePhone: "5550100"}}); !errors.Is(err, validate.ErrInvalidPhone) {
+		t.Fatalf("expected ErrInvalidPhone, got %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected malformed contacts to be rejected before calling Okta, got %d calls", got)
+	}
+}
@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MinPasswordLength is the shortest password, in characters, ValidatePassword accepts.
+const MinPasswordLength = 8
+
+// recoveryRequest represents the request to start a self-service password recovery.
+type recoveryRequest struct {
+	Username   string `json:"username"`   // The user's login (email or phone).
+	FactorType string `json:"factorType"` // How the recovery token is delivered (e.g., "EMAIL").
+}
+
+// recoveryTokenRequest represents the request to redeem a recovery token.
+type recoveryTokenRequest struct {
+	RecoveryToken string `json:"recoveryToken"` // The recovery token from the reset link.
+}
+
+// resetPasswordRequest represents the request to set a new password in a recovery transaction.
+type resetPasswordRequest struct {
+	StateToken  string `json:"stateToken"`  // The state token of the recovery transaction.
+	NewPassword string `json:"newPassword"` // The new password.
+}
+
+// passwordValue wraps a password in the shape Okta's credential APIs expect.
+type passwordValue struct {
+	Value string `json:"value"` // The password.
+}
+
+// changePasswordRequest represents the request to change a user's password.
+type changePasswordRequest struct {
+	OldPassword passwordValue `json:"oldPassword"` // The user's current password.
+	NewPassword passwordValue `json:"newPassword"` // The new password.
+}
+
+// recoveryResponse represents an Okta recovery transaction.
+type recoveryResponse struct {
+	Status     string `json:"status"`     // The transaction status (e.g., "RECOVERY_CHALLENGE", "PASSWORD_RESET").
+	StateToken string `json:"stateToken"` // The state token of the transaction, if one was issued.
+}
+
+// ValidatePassword checks a new password against the password policy: at least
+// MinPasswordLength characters, with an upper-case letter, a lower-case letter, and a digit.
+//
+// Parameters:
+//   - password: The password to check.
+//
+// Returns:
+//   - ErrWeakPassword describing the first unmet requirement, or nil if the password is acceptable.
+func ValidatePassword(password string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, MinPasswordLength)
+	}
+	var upper, lower, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	switch {
+	case !upper:
+		return fmt.Errorf("%w: must contain an upper-case letter", ErrWeakPassword)
+	case !lower:
+		return fmt.Errorf("%w: must contain a lower-case letter", ErrWeakPassword)
+	case !digit:
+		return fmt.Errorf("%w: must contain a digit", ErrWeakPassword)
+	}
+	return nil
+}
+
+// StartPasswordReset starts a self-service password recovery for a user. Okta emails the user
+// a reset link carrying the recovery token, which is then passed to CompletePasswordReset.
+//
+// The request is sent without the API token: with it Okta treats us as a trusted application
+// and hands the recovery token back to the caller instead of emailing the user.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - identifier: The user's login (email or phone).
+//
+// Returns:
+//   - The state token of the recovery transaction, if Okta issued one.
+//   - ErrUserNotFound if Okta has no such user, or another error if the request fails.
+func (o *Auth) StartPasswordReset(ctx context.Context, identifier string) (string, error) {
+	// Construct the API URL.
+	url := o.url("authn", "recovery", "password")
+
+	// Marshal the request body to JSON.
+	body, err := json.Marshal(recoveryRequest{Username: identifier, FactorType: "EMAIL"})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal recovery request: %w", err)
+	}
+
+	// Make the API request.
+	public := *o
+	public.APIToken = ""
+	resp, err := public.makeRequest(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Check for successful status code (200 OK).
+	if resp.StatusCode == http.StatusOK {
+		var recoveryResp recoveryResponse
+		if err := json.NewDecoder(resp.Body).Decode(&recoveryResp); err != nil {
+			return "", fmt.Errorf("failed to decode recovery response: %w", err)
+		}
+		return recoveryResp.StateToken, nil
+	}
+
+	// Handle API errors.
+	oktaErr := o.decodeError(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %w", ErrUserNotFound, oktaErr)
+	}
+	return "", fmt.Errorf("failed to start password reset: %w", oktaErr)
+}
+
+// CompletePasswordReset sets a new password using the recovery token from a reset link.
+// The password is checked with ValidatePassword before Okta is called.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - recoveryToken: The recovery token from the reset link.
+//   - newPassword: The new password.
+//
+// Returns:
+//   - ErrWeakPassword if the password doesn't meet our or Okta's policy, ErrInvalidRecoveryToken
+//     if the token is rejected, or another error if the reset fails.
+func (o *Auth) CompletePasswordReset(ctx context.Context, recoveryToken, newPassword string) error {
+	if err := ValidatePassword(newPassword); err != nil {
+		return err
+	}
+
+	// 1. Exchange the recovery token for the transaction's state token.
+	var transaction recoveryResponse
+	if err := o.recoveryCall(ctx, recoveryTokenRequest{RecoveryToken: recoveryToken}, &transaction, "authn", "recovery", "token"); err != nil {
+		return err
+	}
+
+	// 2. Set the new password.
+	return o.recoveryCall(ctx, resetPasswordRequest{StateToken: transaction.StateToken, NewPassword: newPassword}, nil, "authn", "credentials", "reset_password")
+}
+
+// recoveryCall posts a step of a recovery transaction and decodes the response into out.
+// Rejected tokens are reported as ErrInvalidRecoveryToken and password policy violations as ErrWeakPassword.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - reqBody: The request to marshal as the JSON body.
+//   - out: Where to decode the response, or nil to discard it.
+//   - path: The API path segments.
+//
+// Returns:
+//   - An error if the call fails.
+func (o *Auth) recoveryCall(ctx context.Context, reqBody, out any, path ...string) error {
+	// Marshal the request body to JSON.
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recovery request: %w", err)
+	}
+
+	// Make the API request.
+	public := *o
+	public.APIToken = ""
+	resp, err := public.makeRequest(ctx, http.MethodPost, o.url(path...), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check for successful status code (200 OK).
+	if resp.StatusCode == http.StatusOK {
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode recovery response: %w", err)
+		}
+		return nil
+	}
+
+	// Handle API errors.
+	oktaErr := o.decodeError(resp)
+	switch {
+	case isPasswordPolicyError(oktaErr):
+		return fmt.Errorf("%w: %w", ErrWeakPassword, oktaErr)
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden, resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrInvalidRecoveryToken, oktaErr)
+	}
+	return fmt.Errorf("failed to reset password: %w", oktaErr)
+}
+
+// ChangePassword changes a user's password after checking their current one.
+// The new password is checked with ValidatePassword before Okta is called.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user in Okta.
+//   - oldPassword: The user's current password.
+//   - newPassword: The new password.
+//
+// Returns:
+//   - ErrWrongPassword if the current password is incorrect, ErrWeakPassword if the new password
+//     doesn't meet our or Okta's policy, or another error if the change fails.
+func (o *Auth) ChangePassword(ctx context.Context, userID, oldPassword, newPassword string) error {
+	if err := ValidatePassword(newPassword); err != nil {
+		return err
+	}
+
+	// Construct the API URL.
+	url := o.url("users", userID, "credentials", "change_password")
+
+	// Marshal the request body to JSON.
+	body, err := json.Marshal(changePasswordRequest{
+		OldPassword: passwordValue{Value: oldPassword},
+		NewPassword: passwordValue{Value: newPassword},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal change password request: %w", err)
+	}
+
+	// Make the API request.
+	resp, err := o.makeRequest(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check for successful status code (200 OK).
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// Handle API errors. Okta reports both a wrong current password and a rejected new one as
+	// E0000014, so tell them apart by which field the cause names.
+	oktaErr := o.decodeError(resp)
+	switch {
+	case hasCause(oktaErr, "oldPassword"):
+		return fmt.Errorf("%w: %w", ErrWrongPassword, oktaErr)
+	case isPasswordPolicyError(oktaErr):
+		return fmt.Errorf("%w: %w", ErrWeakPassword, oktaErr)
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrUserNotFound, oktaErr)
+	}
+	return fmt.Errorf("failed to change password: %w", oktaErr)
+}
+
+// hasCause reports whether err is an *OktaError with a cause mentioning substr.
+func hasCause(err error, substr string) bool {
+	var oktaErr *OktaError
+	if !errors.As(err, &oktaErr) {
+		return false
+	}
+	for _, cause := range oktaErr.Causes {
+		if strings.Contains(cause, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPasswordPolicyError reports whether err is Okta rejecting a password for violating its policy.
+func isPasswordPolicyError(err error) bool {
+	var oktaErr *OktaError
+	if errors.As(err, &oktaErr) && oktaErr.Code == "E0000080" {
+		return true
+	}
+	return hasCause(err, "password")
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	tests := map[string]bool{
+		"Sh0rt":           false,
+		"alllowercase1":   false,
+		"ALLUPPERCASE1":   false,
+		"NoDigitsHere":    false,
+		"Correct-Horse-9": true,
+	}
+	for password, ok := range tests {
+		err := ValidatePassword(password)
+		if ok && err != nil {
+			t.Errorf("ValidatePassword(%q) returned error: %v", password, err)
+		}
+		if !ok && !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("ValidatePassword(%q) = %v, want ErrWeakPassword", password, err)
+		}
+	}
+}
+
+func TestStartPasswordReset(t *testing.T) {
+	var body recoveryRequest
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/authn/recovery/password" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("expected recovery to be requested without the API token, got %q", auth)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"status":"RECOVERY_CHALLENGE","factorResult":"WAITING","factorType":"EMAIL","recoveryType":"PASSWORD"}`))
+	})
+
+	if _, err := o.StartPasswordReset(context.Background(), "john.doe@example.com"); err != nil {
+		t.Fatalf("StartPasswordReset returned error: %v", err)
+	}
+	if body.Username != "john.doe@example.com" || body.FactorType != "EMAIL" {
+		t.Fatalf("unexpected recovery request %+v", body)
+	}
+}
+
+func TestCompletePasswordReset(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var reset resetPasswordRequest
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v1/authn/recovery/token":
+				var req recoveryTokenRequest
+				json.NewDecoder(r.Body).Decode(&req)
+				if req.RecoveryToken != "VBQ0gwBp5LyJJFdbmWCM" {
+					t.Errorf("unexpected recovery token %q", req.RecoveryToken)
+				}
+				w.Write([]byte(`{"status":"PASSWORD_RESET","stateToken":"00lMJySRYNz3u_rKQrsLvLrzxiARgivP8FB_1gpmVb"}`))
+			case "/api/v1/authn/credentials/reset_password":
+				json.NewDecoder(r.Body).Decode(&reset)
+				w.Write([]byte(`{"status":"SUCCESS","sessionToken":"okta-session"}`))
+			default:
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+		})
+
+		if err := o.CompletePasswordReset(context.Background(), "VBQ0gwBp5LyJJFdbmWCM", "Correct-Horse-9"); err != nil {
+			t.Fatalf("CompletePasswordReset returned error: %v", err)
+		}
+		if reset.StateToken != "00lMJySRYNz3u_rKQrsLvLrzxiARgivP8FB_1gpmVb" || reset.NewPassword != "Correct-Horse-9" {
+			t.Fatalf("unexpected reset request %+v", reset)
+		}
+	})
+
+	t.Run("weak password", func(t *testing.T) {
+		var calls atomic.Int32
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+		})
+
+		err := o.CompletePasswordReset(context.Background(), "VBQ0gwBp5LyJJFdbmWCM", "password")
+		if !errors.Is(err, ErrWeakPassword) {
+			t.Fatalf("expected ErrWeakPassword, got %v", err)
+		}
+		if got := calls.Load(); got != 0 {
+			t.Fatalf("expected weak password to be rejected before calling Okta, got %d calls", got)
+		}
+	})
+
+	t.Run("rejected by Okta policy", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/v1/authn/recovery/token" {
+				w.Write([]byte(`{"status":"PASSWORD_RESET","stateToken":"state"}`))
+				return
+			}
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000080","errorSummary":"Password requirements were not met. Password requirements: at least 8 characters."}`))
+		})
+
+		err := o.CompletePasswordReset(context.Background(), "VBQ0gwBp5LyJJFdbmWCM", "Correct-Horse-9")
+		if !errors.Is(err, ErrWeakPassword) {
+			t.Fatalf("expected ErrWeakPassword, got %v", err)
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errorCode":"E0000011","errorSummary":"Invalid token provided"}`))
+		})
+
+		err := o.CompletePasswordReset(context.Background(), "expired", "Correct-Horse-9")
+		if !errors.Is(err, ErrInvalidRecoveryToken) {
+			t.Fatalf("expected ErrInvalidRecoveryToken, got %v", err)
+		}
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var body changePasswordRequest
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/api/v1/users/00u1/credentials/change_password" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Write([]byte(`{"password":{},"provider":{"type":"OKTA","name":"OKTA"}}`))
+		})
+
+		if err := o.ChangePassword(context.Background(), "00u1", "Old-Horse-1", "Correct-Horse-9"); err != nil {
+			t.Fatalf("ChangePassword returned error: %v", err)
+		}
+		if body.OldPassword.Value != "Old-Horse-1" || body.NewPassword.Value != "Correct-Horse-9" {
+			t.Fatalf("unexpected change password request %+v", body)
+		}
+	})
+
+	t.Run("wrong old password", func(t *testing.T) {
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000014","errorSummary":"Update of credentials failed","errorCauses":[{"errorSummary":"oldPassword: The credentials provided were incorrect."}]}`))
+		})
+
+		err := o.ChangePassword(context.Background(), "00u1", "wrong", "Correct-Horse-9")
+		if !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("expected ErrWrongPassword, got %v", err)
+		}
+	})
+
+	t.Run("new password violates policy", func(t *testing.T) {
+		var calls atomic.Int32
+		o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000014","errorSummary":"Update of credentials failed","errorCauses":[{"errorSummary":"password: Password has been used too recently"}]}`))
+		})
+
+		if err := o.ChangePassword(context.Background(), "00u1", "Old-Horse-1", "short"); !errors.Is(err, ErrWeakPassword) {
+			t.Fatalf("expected ErrWeakPassword, got %v", err)
+		}
+		if got := calls.Load(); got != 0 {
+			t.Fatalf("expected weak password to be rejected before calling Okta, got %d calls", got)
+		}
+
+		err := o.ChangePassword(context.Background(), "00u1", "Old-Horse-1", "Old-Horse-1")
+		if !errors.Is(err, ErrWeakPassword) || errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("expected ErrWeakPassword from Okta, got %v", err)
+		}
+	})
+}
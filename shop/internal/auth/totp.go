@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// FactorTypeTOTP is Okta's factor type for software TOTP authenticators.
+	FactorTypeTOTP = "token:software:totp"
+
+	// ProviderGoogle is the factor provider for Google Authenticator.
+	ProviderGoogle = "GOOGLE"
+)
+
+// FactorEnrollment holds what a user needs to add a TOTP factor to their authenticator app.
+type FactorEnrollment struct {
+	ID           string // The ID of the enrolled factor, needed to activate it.
+	FactorType   string // The factor type (e.g., "token:software:totp").
+	Provider     string // The factor provider (e.g., "GOOGLE").
+	Status       string // The factor status (e.g., "PENDING_ACTIVATION").
+	SharedSecret string // The base32-encoded shared secret for manual entry.
+	QRCodeURL    string // The URL of the QR code image encoding the provisioning URI.
+}
+
+// enrollFactorRequest represents the request to enroll a factor.
+type enrollFactorRequest struct {
+	FactorType string `json:"factorType"` // The factor type to enroll.
+	Provider   string `json:"provider"`   // The factor provider.
+}
+
+// enrollFactorResponse represents Okta's factor enrollment response.
+type enrollFactorResponse struct {
+	ID         string `json:"id"`         // The ID of the enrolled factor.
+	FactorType string `json:"factorType"` // The factor type.
+	Provider   string `json:"provider"`   // The factor provider.
+	Status     string `json:"status"`     // The factor status.
+	Embedded   struct {
+		Activation struct {
+			SharedSecret string `json:"sharedSecret"` // The shared secret.
+			Links        struct {
+				QRCode struct {
+					Href string `json:"href"` // The QR code image URL.
+				} `json:"qrcode"`
+			} `json:"_links"`
+		} `json:"activation"`
+	} `json:"_embedded"`
+}
+
+// activateFactorRequest represents the request to activate an enrolled factor.
+type activateFactorRequest struct {
+	PassCode string `json:"passCode"` // The passcode generated by the user's authenticator.
+}
+
+// EnrollTOTPFactor enrolls a Google Authenticator TOTP factor for a user.
+// The factor stays pending until it is activated with ActivateTOTPFactor.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//
+// Returns:
+//   - The enrollment, including the shared secret and QR code URL.
+//   - An error if the enrollment fails.
+func (o *Auth) EnrollTOTPFactor(ctx context.Context, userID string) (FactorEnrollment, error) {
+	// Construct the API URL.
+	url := o.url("users", userID, "factors")
+
+	// Marshal the request body to JSON.
+	body, err := json.Marshal(enrollFactorRequest{FactorType: FactorTypeTOTP, Provider: ProviderGoogle})
+	if err != nil {
+		return FactorEnrollment{}, fmt.Errorf("failed to marshal enrollment request: %w", err)
+	}
+
+	// Make the API request.
+	resp, err := o.makeRequest(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return FactorEnrollment{}, err
+	}
+	defer resp.Body.Close()
+
+	// Check for successful status codes (200-299).
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		var enrollResp enrollFactorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&enrollResp); err != nil {
+			return FactorEnrollment{}, fmt.Errorf("failed to decode enrollment response: %w", err)
+		}
+		return FactorEnrollment{
+			ID:           enrollResp.ID,
+			FactorType:   enrollResp.FactorType,
+			Provider:     enrollResp.Provider,
+			Status:       enrollResp.Status,
+			SharedSecret: enrollResp.Embedded.Activation.SharedSecret,
+			QRCodeURL:    enrollResp.Embedded.Activation.Links.QRCode.Href,
+		}, nil
+	}
+
+	// Handle API errors.
+	return FactorEnrollment{}, fmt.Errorf("failed to enroll TOTP factor: %w", o.decodeError(resp))
+}
+
+// ActivateTOTPFactor activates a pending TOTP factor using a passcode from the user's authenticator.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - userID: The ID of the user.
+//   - factorID: The ID of the enrolled factor.
+//   - passcode: The passcode currently shown by the authenticator app.
+//
+// Returns:
+//   - ErrInvalidCredentials if the passcode is rejected, or another error if the activation fails.
+func (o *Auth) ActivateTOTPFactor(ctx context.Context, userID, factorID, passcode string) error {
+	// Construct the API URL.
+	url := o.url("users", userID, "factors", factorID, "lifecycle", "activate")
+
+	// Marshal the request body to JSON.
+	body, err := json.Marshal(activateFactorRequest{PassCode: passcode})
+	if err != nil {
+		return fmt.Errorf("failed to marshal activation request: %w", err)
+	}
+
+	// Make the API request.
+	resp, err := o.makeRequest(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check for successful status codes (200-299).
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+
+	// Handle API errors.
+	oktaErr := o.decodeError(resp)
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: failed to activate TOTP factor: %w", ErrInvalidCredentials, oktaErr)
+	}
+	return fmt.Errorf("failed to activate TOTP factor: %w", oktaErr)
+}
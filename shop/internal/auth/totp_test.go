@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+const enrollmentPayload = `{
+  "id": "uftm3iHSGFQXHCUSDAND",
+  "factorType": "token:software:totp",
+  "provider": "GOOGLE",
+  "status": "PENDING_ACTIVATION",
+  "_embedded": {
+    "activation": {
+      "timeStep": 30,
+      "sharedSecret": "HE64TMLL2IUZW2ZLB",
+      "encoding": "base32",
+      "keyLength": 16,
+      "_links": {
+        "qrcode": {
+          "href": "https://example.okta.com/api/v1/users/00u1/factors/uftm3iHSGFQXHCUSDAND/qr/00fukNElRS_Tz6k-CFhg3pH4KO2dj2guhmaapXWbc4",
+          "type": "image/png"
+        }
+      }
+    }
+  }
+}`
+
+func TestEnrollTOTPFactor(t *testing.T) {
+	var got enrollFactorRequest
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/users/00u1/factors" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(enrollmentPayload))
+	})
+
+	enrollment, err := o.EnrollTOTPFactor(context.Background(), "00u1")
+	if err != nil {
+		t.Fatalf("EnrollTOTPFactor returned error: %v", err)
+	}
+	if got.FactorType != FactorTypeTOTP || got.Provider != ProviderGoogle {
+		t.Fatalf("unexpected enrollment request %+v", got)
+	}
+	if enrollment.ID != "uftm3iHSGFQXHCUSDAND" || enrollment.Status != "PENDING_ACTIVATION" {
+		t.Fatalf("unexpected enrollment %+v", enrollment)
+	}
+	if enrollment.SharedSecret != "HE64TMLL2IUZW2ZLB" {
+		t.Fatalf("unexpected shared secret %q", enrollment.SharedSecret)
+	}
+	if enrollment.QRCodeURL == "" {
+		t.Fatal("expected a QR code URL")
+	}
+}
+
+func TestActivateTOTPFactor(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/users/00u1/factors/uftm3iHSGFQXHCUSDAND/lifecycle/activate" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req activateFactorRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.PassCode != "123456" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000068","errorSummary":"Invalid Passcode/Answer"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"uftm3iHSGFQXHCUSDAND","status":"ACTIVE"}`))
+	})
+
+	if err := o.ActivateTOTPFactor(context.Background(), "00u1", "uftm3iHSGFQXHCUSDAND", "123456"); err != nil {
+		t.Fatalf("ActivateTOTPFactor returned error: %v", err)
+	}
+	err := o.ActivateTOTPFactor(context.Background(), "00u1", "uftm3iHSGFQXHCUSDAND", "000000")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// maxSearchIdentifiers is how many identifiers are looked up per search request, keeping
+	// the search expression well within URL length limits.
+	maxSearchIdentifiers = 20
+
+	// maxConcurrentLookups bounds the GetUser calls made at once for identifiers that can't
+	// be searched for, so a large batch doesn't trip Okta's rate limits.
+	maxConcurrentLookups = 4
+)
+
+// GetUsersError reports the identifiers GetUsers couldn't look up. It unwraps to the
+// individual errors, so errors.Is(err, ErrUserNotFound) reports whether any user was missing.
+type GetUsersError struct {
+	Errs []error // The error for each input identifier, at the same index; nil if it was found.
+}
+
+// Error implements the error interface.
+func (e *GetUsersError) Error() string {
+	failed := e.Unwrap()
+	if len(failed) == 0 {
+		return "failed to get users"
+	}
+	return fmt.Sprintf("failed to get %d of %d users: %v", len(failed), len(e.Errs), failed[0])
+}
+
+// Unwrap returns the errors of the identifiers that failed.
+func (e *GetUsersError) Unwrap() []error {
+	var failed []error
+	for _, err := range e.Errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// GetUsers gets several users by ID or login (email or phone) at once.
+// Identifiers are looked up in batches with Okta's user search, and any the search doesn't
+// find or can't express are looked up one by one with GetUser, a few at a time.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - identifiers: The users' IDs or logins.
+//
+// Returns:
+//   - The users in the order of identifiers, with a zero User for each identifier that failed.
+//   - A *GetUsersError if any identifier failed, or nil if all users were found.
+func (o *Auth) GetUsers(ctx context.Context, identifiers []string) ([]User, error) {
+	users := make([]User, len(identifiers))
+	errs := make([]error, len(identifiers))
+	found := make([]bool, len(identifiers))
+
+	// 1. Search for the identifiers that fit in a search expression.
+	var searchable []int
+	for i, id := range identifiers {
+		switch {
+		case id == "":
+			errs[i] = fmt.Errorf("%w: empty identifier", ErrUserNotFound)
+		case !strings.ContainsAny(id, `"\`):
+			searchable = append(searchable, i)
+		}
+	}
+	for start := 0; start < len(searchable); start += maxSearchIdentifiers {
+		batch := searchable[start:min(start+maxSearchIdentifiers, len(searchable))]
+		results, err := o.searchUsers(ctx, identifiers, batch)
+		if err != nil {
+			// The lookups below retry each identifier individually.
+			o.logger().WarnContext(ctx, "okta user search failed, falling back to individual lookups", slog.Any("error", err))
+			continue
+		}
+		for _, i := range batch {
+			if user, ok := matchUser(results, identifiers[i]); ok {
+				users[i], found[i] = user, true
+			}
+		}
+	}
+
+	// 2. Look up the rest one by one.
+	var g errgroup.Group
+	g.SetLimit(maxConcurrentLookups)
+	for i, id := range identifiers {
+		if found[i] || errs[i] != nil {
+			continue
+		}
+		g.Go(func() error {
+			user, err := o.GetUser(ctx, id)
+			if err != nil {
+				errs[i] = err
+				return nil
+			}
+			users[i] = *user
+			return nil
+		})
+	}
+	g.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return users, &GetUsersError{Errs: errs}
+		}
+	}
+	return users, nil
+}
+
+// searchUsers runs a single user search matching the identifiers at the given indexes by ID
+// or login.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - identifiers: The identifiers passed to GetUsers.
+//   - batch: The indexes of the identifiers to search for.
+//
+// Returns:
+//   - The users matching any of the identifiers.
+//   - An error if the search fails.
+func (o *Auth) searchUsers(ctx context.Context, identifiers []string, batch []int) ([]User, error) {
+	terms := make([]string, 0, 2*len(batch))
+	for _, i := range batch {
+		terms = append(terms, `id eq "`+identifiers[i]+`"`, `profile.login eq "`+identifiers[i]+`"`)
+	}
+	query := url.Values{}
+	query.Set("search", strings.Join(terms, " or "))
+	// Each identifier matches at most one user by ID and one by login.
+	query.Set("limit", strconv.Itoa(2*len(batch)))
+
+	resp, err := o.makeRequest(ctx, http.MethodGet, o.url("users")+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		var users []User
+		if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+			return nil, fmt.Errorf("failed to decode users response: %w", err)
+		}
+		return users, nil
+	}
+	return nil, fmt.Errorf("failed to search users: %w", o.decodeError(resp))
+}
+
+// matchUser finds the user identified by identifier, preferring a match by ID. Okta logins
+// are case-insensitive.
+func matchUser(users []User, identifier string) (User, bool) {
+	for _, u := range users {
+		if u.ID == identifier {
+			return u, true
+		}
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.Profile.Login, identifier) {
+			return u, true
+		}
+	}
+	return User{}, false
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// oktaUsers is the directory of a fake Okta server, keyed by user ID.
+var oktaUsers = map[string]string{
+	"00u1": "john.doe@example.com",
+	"00u2": "+15555550100",
+	"00u3": "jane.roe@example.com",
+}
+
+// writeUser writes the JSON for a user in oktaUsers.
+func writeUser(w http.ResponseWriter, id string) {
+	fmt.Fprintf(w, `{"id":%q,"status":"ACTIVE","profile":{"login":%q}}`, id, oktaUsers[id])
+}
+
+func TestGetUsersSearchesInBatch(t *testing.T) {
+	var searches, lookups atomic.Int32
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/users" {
+			lookups.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		searches.Add(1)
+		search := r.URL.Query().Get("search")
+		var matches []string
+		for id, login := range oktaUsers {
+			if strings.Contains(search, `id eq "`+id+`"`) || strings.Contains(search, `profile.login eq "`+login+`"`) {
+				matches = append(matches, id)
+			}
+		}
+		w.Write([]byte("["))
+		for i, id := range matches {
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			writeUser(w, id)
+		}
+		w.Write([]byte("]"))
+	})
+
+	users, err := o.GetUsers(context.Background(), []string{"jane.roe@example.com", "00u1", "+15555550100"})
+	if err != nil {
+		t.Fatalf("GetUsers returned error: %v", err)
+	}
+	if got := []string{users[0].ID, users[1].ID, users[2].ID}; got[0] != "00u3" || got[1] != "00u1" || got[2] != "00u2" {
+		t.Fatalf("expected users in input order, got %v", got)
+	}
+	if searches.Load() != 1 || lookups.Load() != 0 {
+		t.Fatalf("expected a single search, got %d searches and %d lookups", searches.Load(), lookups.Load())
+	}
+}
+
+func TestGetUsersReportsPartialFailures(t *testing.T) {
+	o := newTestAuth(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/users":
+			// Search is unavailable, so every identifier is looked up on its own.
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorCode":"E0000031","errorSummary":"Invalid search criteria."}`))
+		case "/api/v1/users/00u1", "/api/v1/users/00u3":
+			writeUser(w, strings.TrimPrefix(r.URL.Path, "/api/v1/users/"))
+		case "/api/v1/users/00u500":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"errorCode":"E0000009","errorSummary":"Internal Server Error"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"E0000007","errorSummary":"Not found"}`))
+		}
+	})
+	o.MaxRetries = 0
+
+	users, err := o.GetUsers(context.Background(), []string{"00u1", "nobody", "00u500", "00u3", ""})
+	var batchErr *GetUsersError
+	if !errors.As(err, &batchErr) || !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected a *GetUsersError wrapping ErrUserNotFound, got %v", err)
+	}
+	if users[0].ID != "00u1" || users[3].ID != "00u3" {
+		t.Fatalf("expected the found users at their input positions, got %+v", users)
+	}
+	if users[1].ID != "" || users[2].ID != "" || users[4].ID != "" {
+		t.Fatalf("expected zero users for the failed identifiers, got %+v", users)
+	}
+
+	errs := batchErr.Errs
+	if errs[0] != nil || errs[3] != nil {
+		t.Errorf("expected no errors for the found users, got %v and %v", errs[0], errs[3])
+	}
+	if !errors.Is(errs[1], ErrUserNotFound) || !errors.Is(errs[4], ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound for the unknown identifiers, got %v and %v", errs[1], errs[4])
+	}
+	var oktaErr *OktaError
+	if !errors.As(errs[2], &oktaErr) || oktaErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected the server error for 00u500, got %v", errs[2])
+	}
+}
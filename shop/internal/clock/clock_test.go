@@ -0,0 +1,33 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := NewFake(start)
+	if !c.Now().Equal(start) {
+		t.Fatalf("expected %v, got %v", start, c.Now())
+	}
+
+	c.Advance(90 * time.Second)
+	if want := start.Add(90 * time.Second); !c.Now().Equal(want) {
+		t.Fatalf("expected %v after Advance, got %v", want, c.Now())
+	}
+
+	later := start.Add(24 * time.Hour)
+	c.Set(later)
+	if !c.Now().Equal(later) {
+		t.Fatalf("expected %v after Set, got %v", later, c.Now())
+	}
+}
+
+func TestReal(t *testing.T) {
+	before := time.Now()
+	now := Real{}.Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Fatalf("expected the current time, got %v", now)
+	}
+}
@@ -0,0 +1,483 @@
+// Package config loads the API server's configuration from environment variables.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/auth"
+	"github.com/ShoppingDem/backend/shop/internal/database"
+	"github.com/ShoppingDem/backend/shop/internal/idempotency"
+	"github.com/ShoppingDem/backend/shop/internal/inventory"
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/internal/middleware"
+	"github.com/ShoppingDem/backend/shop/internal/roles"
+	"github.com/ShoppingDem/backend/shop/internal/signup"
+	"github.com/ShoppingDem/backend/shop/internal/storage"
+	"github.com/ShoppingDem/backend/shop/internal/tax"
+	"github.com/ShoppingDem/backend/shop/internal/token"
+	"github.com/ShoppingDem/backend/shop/internal/webhook"
+)
+
+const (
+	// DefaultPort is the port the server listens on when PORT isn't set.
+	DefaultPort = "8080"
+
+	// DefaultDBPort is the database port used when DB_PORT isn't set.
+	DefaultDBPort = "5432"
+
+	// DefaultShutdownTimeout is how long in-flight requests are given to complete on
+	// shutdown when SHUTDOWN_TIMEOUT isn't set.
+	DefaultShutdownTimeout = 30 * time.Second
+
+	// DefaultComplexityLimit is the query complexity cap used when GQL_COMPLEXITY_LIMIT
+	// isn't set.
+	DefaultComplexityLimit = 200
+
+	// DefaultRecommendationCacheTTL is how long frequentlyBoughtTogether results are cached
+	// when RECOMMENDATION_CACHE_TTL isn't set.
+	DefaultRecommendationCacheTTL = time.Hour
+)
+
+// ErrMissing is reported for a required environment variable that isn't set.
+var ErrMissing = errors.New("must be set")
+
+// Config is the API server's configuration. Each field is read from the environment
+// variable named in its comment; an unset or empty variable takes the default.
+type Config struct {
+	Port     string           // PORT, DefaultPort by default.
+	AppEnv   string           // APP_ENV; "production" turns the development tools off by default.
+	LogLevel string           // LOG_LEVEL: debug, info (the default), warn or error.
+	DB       database.Options // DB_HOST and DB_USER (required), DB_PORT and DB_PASSWORD.
+
+	RunMigrations bool // RUN_MIGRATIONS: apply pending schema migrations before serving.
+
+	OktaOrgURL       string // OKTA_ORG_URL (required).
+	OktaAPIToken     string // OKTA_API_TOKEN (required).
+	OktaClientID     string // OKTA_CLIENT_ID (required).
+	OktaClientSecret string // OKTA_CLIENT_SECRET (required).
+
+	// OktaTransport (OKTA_MAX_IDLE_CONNS, OKTA_MAX_IDLE_CONNS_PER_HOST and
+	// OKTA_IDLE_CONN_TIMEOUT) sizes the pool of connections kept open to Okta.
+	OktaTransport auth.TransportOptions
+
+	// OktaWebhookSecret (OKTA_WEBHOOK_SECRET) is the Authorization header value configured on
+	// the Okta event hook that reports user lifecycle changes; the hook is disabled without it.
+	OktaWebhookSecret string
+
+	// LogRedactFields (LOG_REDACT_FIELDS, comma-separated) are the JSON fields and headers
+	// masked in logged Okta requests, logging.DefaultRedactedFields by default.
+	LogRedactFields []string
+
+	JWTSecret          string        // JWT_SECRET (required), the HMAC secret session tokens are signed with.
+	JWTExpiry          time.Duration // JWT_EXPIRY, token.DefaultExpiry by default.
+	RefreshTokenExpiry time.Duration // REFRESH_TOKEN_EXPIRY, token.DefaultRefreshExpiry by default.
+
+	// AdminUserIDs (ADMIN_USER_IDS, comma-separated) are users treated as admins whatever
+	// their stored role, so the first admin can be set up.
+	AdminUserIDs []string
+
+	// GroupRoles (OKTA_GROUP_ROLES) map Okta groups to the roles of their members, e.g.
+	// "Shop Admins=ADMIN", synced at sign-in; roles aren't synced when it isn't set.
+	GroupRoles roles.GroupRoles
+
+	ReservationTTL           time.Duration // RESERVATION_TTL, how long reserveStock holds stock.
+	ReservationSweepInterval time.Duration // RESERVATION_SWEEP_INTERVAL, how often expired reservations and payment holds are released.
+	PaymentGracePeriod       time.Duration // PAYMENT_GRACE_PERIOD, how long checkout holds stock while the payment is collected.
+	IdempotencyKeyTTL        time.Duration // IDEMPOTENCY_KEY_TTL, how long a checkout idempotency key is remembered.
+
+	// RegistrationWindow (REGISTRATION_WINDOW), RegistrationLimitPerIP
+	// (REGISTRATION_LIMIT_PER_IP) and RegistrationLimitPerDomain
+	// (REGISTRATION_LIMIT_PER_DOMAIN) throttle createUser; a limit of 0 turns that check off.
+	// LookupLimitPerIP (LOOKUP_LIMIT_PER_IP) throttles isIdentifierAvailable over the same
+	// window.
+	RegistrationWindow         time.Duration
+	RegistrationLimitPerIP     int
+	RegistrationLimitPerDomain int
+	LookupLimitPerIP           int
+
+	// StripeSecretKey (STRIPE_SECRET_KEY) enables collecting payment at checkout through
+	// Stripe, and StripeWebhookSecret (STRIPE_WEBHOOK_SECRET) the webhook reporting whether
+	// payments succeeded. Without a key orders stay PENDING until an admin updates them.
+	StripeSecretKey     string
+	StripeWebhookSecret string
+
+	// WebhookSigningSecret (WEBHOOK_SIGNING_SECRET) signs outbound webhook deliveries, which
+	// are sent unsigned without it. WebhookRetry (WEBHOOK_MAX_ATTEMPTS,
+	// WEBHOOK_RETRY_BASE_DELAY and WEBHOOK_RETRY_MAX_DELAY) is how failed deliveries are
+	// retried before they're marked dead, and WebhookDispatchInterval
+	// (WEBHOOK_DISPATCH_INTERVAL) how often due deliveries are sent.
+	WebhookSigningSecret    string
+	WebhookRetry            webhook.RetryPolicy
+	WebhookDispatchInterval time.Duration
+
+	// AccountingWebhookURL (ACCOUNTING_WEBHOOK_URL) is the accounting system's endpoint,
+	// which is sent an order.completed webhook for every delivered order. None are sent
+	// when it's unset.
+	AccountingWebhookURL string
+
+	// S3 stores uploaded avatars in an S3 bucket when S3_BUCKET is set. Otherwise they're
+	// stored in UploadDir (UPLOAD_DIR, "uploads" by default) and served from UploadBaseURL
+	// (UPLOAD_BASE_URL, "/uploads" by default).
+	S3            S3
+	UploadDir     string
+	UploadBaseURL string
+
+	// TaxRates (TAX_RATES) are the rates charged at checkout by the region an order ships
+	// to, e.g. "US-CA=7.25,GB=20", or nil to charge no tax.
+	TaxRates *tax.RegionRates
+
+	MaxBodySize   int64 // MAX_BODY_SIZE, the largest /query request body in bytes.
+	MaxUploadSize int64 // MAX_UPLOAD_SIZE, the largest multipart/form-data (file upload) body in bytes.
+
+	// AllowedOrigins (ALLOWED_ORIGINS) is a comma-separated list of origins allowed to call
+	// /query from a browser.
+	AllowedOrigins string
+
+	// EnablePlayground (ENABLE_PLAYGROUND) and EnableIntrospection (ENABLE_INTROSPECTION) turn
+	// the playground at / and introspection queries on or off. Both default to on, except
+	// when AppEnv is "production".
+	EnablePlayground    bool
+	EnableIntrospection bool
+
+	// PersistedQueriesOnly (PERSISTED_QUERIES_ONLY) rejects operations that aren't in the
+	// persisted query manifest, read from PersistedQueriesFile (PERSISTED_QUERIES_FILE) or,
+	// if that's empty, embedded in the binary. Ad-hoc queries are allowed by default.
+	PersistedQueriesOnly bool
+	PersistedQueriesFile string
+
+	ComplexityLimit int  // GQL_COMPLEXITY_LIMIT, DefaultComplexityLimit by default.
+	ExposeErrors    bool // GQL_EXPOSE_ERRORS: send internal error details to clients, for development.
+
+	// RecommendationCacheTTL (RECOMMENDATION_CACHE_TTL) is how long frequentlyBoughtTogether
+	// results are cached, DefaultRecommendationCacheTTL by default.
+	RecommendationCacheTTL time.Duration
+
+	// RateLimitRPS (RATE_LIMIT_RPS) and RateLimitBurst (RATE_LIMIT_BURST) limit /query
+	// requests per client. RateLimitTrustProxy (RATE_LIMIT_TRUST_PROXY) identifies clients
+	// by X-Forwarded-For, for running behind a proxy.
+	RateLimitRPS        float64
+	RateLimitBurst      int
+	RateLimitTrustProxy bool
+
+	CompressionEnabled bool // COMPRESSION_ENABLED, on by default.
+	CompressionMinSize int  // COMPRESSION_MIN_SIZE, the smallest response compressed, in bytes.
+
+	ShutdownTimeout time.Duration // SHUTDOWN_TIMEOUT, DefaultShutdownTimeout by default.
+}
+
+// S3 configures an S3-compatible bucket for uploads.
+type S3 struct {
+	Bucket          string // S3_BUCKET
+	Region          string // S3_REGION, storage.DefaultS3Region by default.
+	Endpoint        string // S3_ENDPOINT, for S3-compatible services such as MinIO; AWS's for Region by default.
+	AccessKeyID     string // S3_ACCESS_KEY_ID, required with S3_BUCKET.
+	SecretAccessKey string // S3_SECRET_ACCESS_KEY, required with S3_BUCKET.
+	PublicURL       string // S3_PUBLIC_URL, where objects are served from when a CDN fronts the bucket.
+}
+
+// VarError is a missing or invalid environment variable.
+type VarError struct {
+	Name string // The environment variable, e.g. "OKTA_ORG_URL".
+	Err  error  // Why it's invalid; ErrMissing if it isn't set.
+}
+
+func (e *VarError) Error() string {
+	return e.Name + ": " + e.Err.Error()
+}
+
+func (e *VarError) Unwrap() error {
+	return e.Err
+}
+
+// Error lists every missing or invalid environment variable found by Load.
+type Error struct {
+	Vars []*VarError
+}
+
+func (e *Error) Error() string {
+	problems := make([]string, len(e.Vars))
+	for i, v := range e.Vars {
+		problems[i] = v.Error()
+	}
+	return "invalid configuration: " + strings.Join(problems, "; ")
+}
+
+func (e *Error) Unwrap() []error {
+	errs := make([]error, len(e.Vars))
+	for i, v := range e.Vars {
+		errs[i] = v
+	}
+	return errs
+}
+
+// Load reads the configuration from the environment and applies defaults.
+//
+// Returns:
+//   - The configuration.
+//   - An *Error listing every required variable that's missing and every variable whose
+//     value is invalid.
+func Load() (*Config, error) {
+	return load(os.Getenv)
+}
+
+// load reads the configuration from the variables returned by getenv.
+func load(getenv func(string) string) (*Config, error) {
+	e := &env{getenv: getenv}
+	cfg := &Config{
+		Port:   e.string("PORT", DefaultPort),
+		AppEnv: e.string("APP_ENV", ""),
+		DB: database.Options{
+			Host:     e.required("DB_HOST"),
+			Port:     e.string("DB_PORT", DefaultDBPort),
+			User:     e.required("DB_USER"),
+			Password: e.string("DB_PASSWORD", ""),
+		},
+		RunMigrations: e.bool("RUN_MIGRATIONS", false),
+
+		OktaOrgURL:        e.url("OKTA_ORG_URL"),
+		OktaAPIToken:      e.required("OKTA_API_TOKEN"),
+		OktaClientID:      e.required("OKTA_CLIENT_ID"),
+		OktaClientSecret:  e.required("OKTA_CLIENT_SECRET"),
+		OktaWebhookSecret: e.string("OKTA_WEBHOOK_SECRET", ""),
+		OktaTransport: auth.TransportOptions{
+			MaxIdleConns:        e.int("OKTA_MAX_IDLE_CONNS", auth.DefaultMaxIdleConns, 1),
+			MaxIdleConnsPerHost: e.int("OKTA_MAX_IDLE_CONNS_PER_HOST", auth.DefaultMaxIdleConnsPerHost, 1),
+			IdleConnTimeout:     e.duration("OKTA_IDLE_CONN_TIMEOUT", auth.DefaultIdleConnTimeout),
+		},
+		LogRedactFields: e.list("LOG_REDACT_FIELDS", logging.DefaultRedactedFields),
+
+		JWTSecret:          e.required("JWT_SECRET"),
+		JWTExpiry:          e.duration("JWT_EXPIRY", token.DefaultExpiry),
+		RefreshTokenExpiry: e.duration("REFRESH_TOKEN_EXPIRY", token.DefaultRefreshExpiry),
+
+		AdminUserIDs: e.list("ADMIN_USER_IDS", nil),
+
+		ReservationTTL:           e.duration("RESERVATION_TTL", inventory.DefaultReservationTTL),
+		ReservationSweepInterval: e.duration("RESERVATION_SWEEP_INTERVAL", inventory.DefaultSweepInterval),
+		PaymentGracePeriod:       e.duration("PAYMENT_GRACE_PERIOD", inventory.DefaultPaymentGracePeriod),
+		IdempotencyKeyTTL:        e.duration("IDEMPOTENCY_KEY_TTL", idempotency.DefaultTTL),
+
+		RegistrationWindow:         e.duration("REGISTRATION_WINDOW", signup.DefaultWindow),
+		RegistrationLimitPerIP:     e.int("REGISTRATION_LIMIT_PER_IP", signup.DefaultLimitPerIP, 0),
+		RegistrationLimitPerDomain: e.int("REGISTRATION_LIMIT_PER_DOMAIN", signup.DefaultLimitPerDomain, 0),
+		LookupLimitPerIP:           e.int("LOOKUP_LIMIT_PER_IP", signup.DefaultLookupLimitPerIP, 0),
+
+		StripeSecretKey:     e.string("STRIPE_SECRET_KEY", ""),
+		StripeWebhookSecret: e.string("STRIPE_WEBHOOK_SECRET", ""),
+
+		WebhookSigningSecret: e.string("WEBHOOK_SIGNING_SECRET", ""),
+		WebhookRetry: webhook.RetryPolicy{
+			MaxAttempts: e.int("WEBHOOK_MAX_ATTEMPTS", webhook.DefaultMaxAttempts, 1),
+			BaseDelay:   e.duration("WEBHOOK_RETRY_BASE_DELAY", webhook.DefaultRetryBaseDelay),
+			MaxDelay:    e.duration("WEBHOOK_RETRY_MAX_DELAY", webhook.DefaultRetryMaxDelay),
+		},
+		WebhookDispatchInterval: e.duration("WEBHOOK_DISPATCH_INTERVAL", webhook.DefaultDispatchInterval),
+		AccountingWebhookURL:    e.optionalURL("ACCOUNTING_WEBHOOK_URL"),
+
+		UploadDir:     e.string("UPLOAD_DIR", "uploads"),
+		UploadBaseURL: e.string("UPLOAD_BASE_URL", "/uploads"),
+
+		MaxBodySize:    int64(e.int("MAX_BODY_SIZE", middleware.DefaultMaxBodySize, 1)),
+		MaxUploadSize:  int64(e.int("MAX_UPLOAD_SIZE", middleware.DefaultMaxUploadSize, 1)),
+		AllowedOrigins: e.string("ALLOWED_ORIGINS", ""),
+
+		PersistedQueriesOnly: e.bool("PERSISTED_QUERIES_ONLY", false),
+		PersistedQueriesFile: e.string("PERSISTED_QUERIES_FILE", ""),
+
+		ComplexityLimit: e.int("GQL_COMPLEXITY_LIMIT", DefaultComplexityLimit, 1),
+		ExposeErrors:    e.bool("GQL_EXPOSE_ERRORS", false),
+
+		RecommendationCacheTTL: e.duration("RECOMMENDATION_CACHE_TTL", DefaultRecommendationCacheTTL),
+
+		RateLimitRPS:        e.positiveFloat("RATE_LIMIT_RPS", middleware.DefaultRateLimit),
+		RateLimitBurst:      e.int("RATE_LIMIT_BURST", middleware.DefaultRateBurst, 1),
+		RateLimitTrustProxy: e.bool("RATE_LIMIT_TRUST_PROXY", false),
+
+		CompressionEnabled: e.bool("COMPRESSION_ENABLED", true),
+		CompressionMinSize: e.int("COMPRESSION_MIN_SIZE", middleware.DefaultCompressionMinSize, 0),
+
+		ShutdownTimeout: e.duration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout),
+	}
+
+	var level slog.Level
+	if cfg.LogLevel = getenv("LOG_LEVEL"); cfg.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			e.fail("LOG_LEVEL", fmt.Errorf("unknown level %q", cfg.LogLevel))
+		}
+	}
+
+	// The development tools are on by default everywhere but in production.
+	devTools := cfg.AppEnv != "production"
+	cfg.EnablePlayground = e.bool("ENABLE_PLAYGROUND", devTools)
+	cfg.EnableIntrospection = e.bool("ENABLE_INTROSPECTION", devTools)
+
+	if bucket := getenv("S3_BUCKET"); bucket != "" {
+		region := e.string("S3_REGION", storage.DefaultS3Region)
+		cfg.S3 = S3{
+			Bucket:          bucket,
+			Region:          region,
+			Endpoint:        e.string("S3_ENDPOINT", "https://s3."+region+".amazonaws.com"),
+			AccessKeyID:     e.required("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: e.required("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       e.string("S3_PUBLIC_URL", ""),
+		}
+	}
+
+	if v := getenv("TAX_RATES"); v != "" {
+		rates, err := tax.ParseRegionRates(v)
+		if err != nil {
+			e.fail("TAX_RATES", err)
+		}
+		cfg.TaxRates = rates
+	}
+
+	if v := getenv("OKTA_GROUP_ROLES"); v != "" {
+		groups, err := roles.ParseGroupRoles(v)
+		if err != nil {
+			e.fail("OKTA_GROUP_ROLES", err)
+		}
+		cfg.GroupRoles = groups
+	}
+
+	if len(e.errs) > 0 {
+		return nil, &Error{Vars: e.errs}
+	}
+	return cfg, nil
+}
+
+// env reads environment variables, collecting the problems found rather than stopping at
+// the first, so they can all be reported at once.
+type env struct {
+	getenv func(string) string
+	errs   []*VarError
+}
+
+// fail records that the variable name is invalid.
+func (e *env) fail(name string, err error) {
+	e.errs = append(e.errs, &VarError{Name: name, Err: err})
+}
+
+// string returns the value of name, or def if it's unset.
+func (e *env) string(name, def string) string {
+	if v := e.getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// required returns the value of name, recording ErrMissing if it's unset.
+func (e *env) required(name string) string {
+	v := e.getenv(name)
+	if v == "" {
+		e.fail(name, ErrMissing)
+	}
+	return v
+}
+
+// url returns the value of name, which is required and must be an http or https URL.
+func (e *env) url(name string) string {
+	if e.required(name) == "" {
+		return ""
+	}
+	return e.optionalURL(name)
+}
+
+// optionalURL returns the value of name, which must be an http or https URL, or "" if it's
+// unset.
+func (e *env) optionalURL(name string) string {
+	v := e.getenv(name)
+	if v == "" {
+		return ""
+	}
+	if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		e.fail(name, fmt.Errorf("%q is not an http or https URL", v))
+	}
+	return v
+}
+
+// bool returns the value of name parsed with strconv.ParseBool, or def if it's unset.
+func (e *env) bool(name string, def bool) bool {
+	v := e.getenv(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail(name, fmt.Errorf("%q is not a boolean", v))
+	}
+	return b
+}
+
+// int returns the value of name, which must be an integer of at least min, or def if it's
+// unset.
+func (e *env) int(name string, def, min int) int {
+	v := e.getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	switch {
+	case err != nil:
+		e.fail(name, fmt.Errorf("%q is not an integer", v))
+	case n < min:
+		e.fail(name, fmt.Errorf("must be at least %d", min))
+	}
+	return n
+}
+
+// positiveFloat returns the value of name, which must be a positive number, or def if it's
+// unset.
+func (e *env) positiveFloat(name string, def float64) float64 {
+	v := e.getenv(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	switch {
+	case err != nil:
+		e.fail(name, fmt.Errorf("%q is not a number", v))
+	case f <= 0:
+		e.fail(name, errors.New("must be positive"))
+	}
+	return f
+}
+
+// duration returns the value of name, which must be a positive time.ParseDuration
+// duration such as "15m", or def if it's unset.
+func (e *env) duration(name string, def time.Duration) time.Duration {
+	v := e.getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	switch {
+	case err != nil:
+		e.fail(name, fmt.Errorf("%q is not a duration", v))
+	case d <= 0:
+		e.fail(name, errors.New("must be positive"))
+	}
+	return d
+}
+
+// list returns the non-empty entries of the comma-separated value of name, or def if it's
+// unset.
+func (e *env) list(name string, def []string) []string {
+	v := e.getenv(name)
+	if v == "" {
+		return def
+	}
+	var entries []string
+	for _, entry := range strings.Split(v, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/auth"
+	"github.com/ShoppingDem/backend/shop/internal/inventory"
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/internal/middleware"
+	"github.com/ShoppingDem/backend/shop/internal/token"
+	"github.com/ShoppingDem/backend/shop/internal/webhook"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// requiredEnv sets every required variable.
+var requiredEnv = map[string]string{
+	"DB_HOST":            "db.internal",
+	"DB_USER":            "shop",
+	"OKTA_ORG_URL":       "https://example.okta.com",
+	"OKTA_API_TOKEN":     "api-token",
+	"OKTA_CLIENT_ID":     "client-id",
+	"OKTA_CLIENT_SECRET": "client-secret",
+	"JWT_SECRET":         "jwt-secret",
+}
+
+// loadEnv loads the configuration from required plus vars, ignoring the process environment.
+func loadEnv(vars map[string]string) (*Config, error) {
+	env := maps.Clone(requiredEnv)
+	maps.Copy(env, vars)
+	return load(func(name string) string { return env[name] })
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := loadEnv(map[string]string{
+		"PORT":                         "9090",
+		"APP_ENV":                      "production",
+		"LOG_LEVEL":                    "debug",
+		"DB_PORT":                      "6543",
+		"DB_PASSWORD":                  "secret",
+		"RUN_MIGRATIONS":               "true",
+		"ADMIN_USER_IDS":               " 1, ,7",
+		"JWT_EXPIRY":                   "15m",
+		"RESERVATION_TTL":              "5m",
+		"PAYMENT_GRACE_PERIOD":         "10m",
+		"REGISTRATION_LIMIT_PER_IP":    "0",
+		"S3_BUCKET":                    "avatars",
+		"S3_REGION":                    "eu-west-1",
+		"S3_ACCESS_KEY_ID":             "key",
+		"S3_SECRET_ACCESS_KEY":         "secret",
+		"TAX_RATES":                    "US-CA=7.25",
+		"OKTA_GROUP_ROLES":             "Shop Admins=ADMIN",
+		"OKTA_MAX_IDLE_CONNS_PER_HOST": "50",
+		"OKTA_IDLE_CONN_TIMEOUT":       "1m",
+		"MAX_BODY_SIZE":                "2048",
+		"ENABLE_PLAYGROUND":            "true",
+		"PERSISTED_QUERIES_ONLY":       "true",
+		"PERSISTED_QUERIES_FILE":       "/etc/shop/queries.json",
+		"GQL_COMPLEXITY_LIMIT":         "50",
+		"RECOMMENDATION_CACHE_TTL":     "10m",
+		"RATE_LIMIT_RPS":               "2.5",
+		"COMPRESSION_ENABLED":          "false",
+		"SHUTDOWN_TIMEOUT":             "5s",
+		"WEBHOOK_MAX_ATTEMPTS":         "3",
+		"WEBHOOK_RETRY_MAX_DELAY":      "1h",
+	})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.Port != "9090" || cfg.LogLevel != "debug" || !cfg.RunMigrations {
+		t.Errorf("unexpected server settings: port %q, log level %q, migrations %v", cfg.Port, cfg.LogLevel, cfg.RunMigrations)
+	}
+	if cfg.DB.Host != "db.internal" || cfg.DB.Port != "6543" || cfg.DB.User != "shop" || cfg.DB.Password != "secret" {
+		t.Errorf("unexpected database options: %+v", cfg.DB)
+	}
+	if cfg.OktaOrgURL != "https://example.okta.com" || cfg.OktaClientSecret != "client-secret" || cfg.JWTSecret != "jwt-secret" {
+		t.Errorf("unexpected credentials: %+v", cfg)
+	}
+	if !slices.Equal(cfg.AdminUserIDs, []string{"1", "7"}) {
+		t.Errorf("expected admins 1 and 7, got %q", cfg.AdminUserIDs)
+	}
+	if cfg.JWTExpiry != 15*time.Minute || cfg.ReservationTTL != 5*time.Minute || cfg.PaymentGracePeriod != 10*time.Minute || cfg.ShutdownTimeout != 5*time.Second || cfg.RecommendationCacheTTL != 10*time.Minute {
+		t.Errorf("unexpected durations: JWT %v, reservation %v, payment grace %v, shutdown %v, recommendations %v", cfg.JWTExpiry, cfg.ReservationTTL, cfg.PaymentGracePeriod, cfg.ShutdownTimeout, cfg.RecommendationCacheTTL)
+	}
+	if cfg.RegistrationLimitPerIP != 0 || cfg.MaxBodySize != 2048 || cfg.ComplexityLimit != 50 || cfg.RateLimitRPS != 2.5 {
+		t.Errorf("unexpected limits: %+v", cfg)
+	}
+	want := S3{Bucket: "avatars", Region: "eu-west-1", Endpoint: "https://s3.eu-west-1.amazonaws.com", AccessKeyID: "key", SecretAccessKey: "secret"}
+	if cfg.S3 != want {
+		t.Errorf("expected S3 settings %+v, got %+v", want, cfg.S3)
+	}
+	if cfg.TaxRates == nil {
+		t.Error("expected tax rates")
+	}
+	if want := (auth.TransportOptions{MaxIdleConns: auth.DefaultMaxIdleConns, MaxIdleConnsPerHost: 50, IdleConnTimeout: time.Minute}); cfg.OktaTransport != want {
+		t.Errorf("expected Okta transport options %+v, got %+v", want, cfg.OktaTransport)
+	}
+	if cfg.GroupRoles["Shop Admins"] != models.RoleAdmin {
+		t.Errorf("expected Shop Admins to be admins, got %v", cfg.GroupRoles)
+	}
+	if !cfg.EnablePlayground || cfg.EnableIntrospection {
+		t.Errorf("expected only the playground to be enabled in production, got playground %v, introspection %v", cfg.EnablePlayground, cfg.EnableIntrospection)
+	}
+	if !cfg.PersistedQueriesOnly || cfg.PersistedQueriesFile != "/etc/shop/queries.json" {
+		t.Errorf("expected only persisted queries from the file, got only %v, file %q", cfg.PersistedQueriesOnly, cfg.PersistedQueriesFile)
+	}
+	if cfg.CompressionEnabled {
+		t.Error("expected compression to be disabled")
+	}
+	if want := (webhook.RetryPolicy{MaxAttempts: 3, BaseDelay: webhook.DefaultRetryBaseDelay, MaxDelay: time.Hour}); cfg.WebhookRetry != want {
+		t.Errorf("expected webhook retry policy %+v, got %+v", want, cfg.WebhookRetry)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := loadEnv(nil)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.Port != DefaultPort || cfg.DB.Port != DefaultDBPort || cfg.ShutdownTimeout != DefaultShutdownTimeout {
+		t.Errorf("unexpected defaults: port %q, database port %q, shutdown timeout %v", cfg.Port, cfg.DB.Port, cfg.ShutdownTimeout)
+	}
+	if cfg.JWTExpiry != token.DefaultExpiry || cfg.RefreshTokenExpiry != token.DefaultRefreshExpiry || cfg.ReservationTTL != inventory.DefaultReservationTTL || cfg.PaymentGracePeriod != inventory.DefaultPaymentGracePeriod || cfg.ComplexityLimit != DefaultComplexityLimit {
+		t.Errorf("unexpected defaults: JWT expiry %v, refresh token expiry %v, reservation TTL %v, payment grace period %v, complexity limit %d", cfg.JWTExpiry, cfg.RefreshTokenExpiry, cfg.ReservationTTL, cfg.PaymentGracePeriod, cfg.ComplexityLimit)
+	}
+	if cfg.MaxBodySize != middleware.DefaultMaxBodySize || cfg.MaxUploadSize != middleware.DefaultMaxUploadSize || cfg.RateLimitBurst != middleware.DefaultRateBurst {
+		t.Errorf("unexpected default limits: %+v", cfg)
+	}
+	if cfg.WebhookRetry != webhook.DefaultRetryPolicy() || cfg.WebhookDispatchInterval != webhook.DefaultDispatchInterval || cfg.AccountingWebhookURL != "" {
+		t.Errorf("unexpected webhook defaults: retry %+v, dispatch interval %v, accounting URL %q", cfg.WebhookRetry, cfg.WebhookDispatchInterval, cfg.AccountingWebhookURL)
+	}
+	if !slices.Equal(cfg.LogRedactFields, logging.DefaultRedactedFields) {
+		t.Errorf("expected the default redacted fields, got %q", cfg.LogRedactFields)
+	}
+	if cfg.S3.Bucket != "" || cfg.UploadDir != "uploads" || cfg.UploadBaseURL != "/uploads" {
+		t.Errorf("expected local uploads, got S3 %+v, directory %q, URL %q", cfg.S3, cfg.UploadDir, cfg.UploadBaseURL)
+	}
+	if cfg.TaxRates != nil || cfg.RunMigrations || cfg.ExposeErrors || cfg.RateLimitTrustProxy || cfg.PersistedQueriesOnly {
+		t.Errorf("expected optional features to be off: %+v", cfg)
+	}
+	if !cfg.EnablePlayground || !cfg.EnableIntrospection || !cfg.CompressionEnabled {
+		t.Errorf("expected the playground, introspection and compression to be on: %+v", cfg)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	t.Run("missing required", func(t *testing.T) {
+		_, err := load(func(string) string { return "" })
+
+		var cfgErr *Error
+		if !errors.As(err, &cfgErr) {
+			t.Fatalf("expected an *Error, got %v", err)
+		}
+		var missing []string
+		for _, v := range cfgErr.Vars {
+			if !errors.Is(v, ErrMissing) {
+				t.Errorf("%s: expected ErrMissing, got %v", v.Name, v.Err)
+			}
+			missing = append(missing, v.Name)
+		}
+		slices.Sort(missing)
+		want := slices.Sorted(maps.Keys(requiredEnv))
+		if !slices.Equal(missing, want) {
+			t.Fatalf("expected every required variable to be reported, got %q", missing)
+		}
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		vars := map[string]string{
+			"OKTA_ORG_URL":                  "example.okta.com",
+			"LOG_LEVEL":                     "loud",
+			"RUN_MIGRATIONS":                "yes please",
+			"JWT_EXPIRY":                    "soon",
+			"RESERVATION_TTL":               "-1m",
+			"REGISTRATION_LIMIT_PER_DOMAIN": "-1",
+			"MAX_UPLOAD_SIZE":               "0",
+			"GQL_COMPLEXITY_LIMIT":          "lots",
+			"RECOMMENDATION_CACHE_TTL":      "0s",
+			"RATE_LIMIT_RPS":                "0",
+			"TAX_RATES":                     "US-CA=200",
+			"OKTA_GROUP_ROLES":              "Shop Admins=OWNER",
+			"OKTA_MAX_IDLE_CONNS_PER_HOST":  "0",
+			"S3_BUCKET":                     "avatars",
+			"S3_ACCESS_KEY_ID":              "key",
+			"ENABLE_INTROSPECTION":          "sometimes",
+			"WEBHOOK_MAX_ATTEMPTS":          "0",
+			"WEBHOOK_RETRY_BASE_DELAY":      "later",
+			"ACCOUNTING_WEBHOOK_URL":        "ledger.example.com",
+		}
+		_, err := loadEnv(vars)
+
+		var cfgErr *Error
+		if !errors.As(err, &cfgErr) {
+			t.Fatalf("expected an *Error, got %v", err)
+		}
+		got := map[string]bool{}
+		for _, v := range cfgErr.Vars {
+			got[v.Name] = true
+		}
+		delete(vars, "S3_BUCKET")
+		delete(vars, "S3_ACCESS_KEY_ID")
+		vars["S3_SECRET_ACCESS_KEY"] = ""
+		for name := range vars {
+			if !got[name] {
+				t.Errorf("expected %s to be reported, got %v", name, err)
+			}
+		}
+		if len(cfgErr.Vars) != len(vars) {
+			t.Errorf("expected %d problems, got %d: %v", len(vars), len(cfgErr.Vars), err)
+		}
+	})
+}
+
+func TestLoadDevTools(t *testing.T) {
+	for _, tc := range []struct {
+		appEnv, flag string
+		want         bool
+	}{
+		{"", "", true},
+		{"development", "", true},
+		{"production", "", false},
+		{"production", "true", true},
+		{"development", "false", false},
+		{"", "0", false},
+	} {
+		cfg, err := loadEnv(map[string]string{"APP_ENV": tc.appEnv, "ENABLE_PLAYGROUND": tc.flag})
+		if err != nil || cfg.EnablePlayground != tc.want {
+			t.Errorf("APP_ENV=%q ENABLE_PLAYGROUND=%q: got (%v, %v), want (%v, nil)", tc.appEnv, tc.flag, cfg != nil && cfg.EnablePlayground, err, tc.want)
+		}
+	}
+}
@@ -3,20 +3,23 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"os"
 
 	_ "github.com/lib/pq"
 )
 
-func Connect() (*sql.DB, error) {
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
+// Options are the settings for connecting to the Postgres database.
+type Options struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+}
+
+func Connect(opts Options) (*sql.DB, error) {
 	dbName := "shopping_bag"
 
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+		opts.Host, opts.Port, opts.User, opts.Password, dbName)
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db, mock
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0010_add_index.sql":      {Data: []byte("CREATE INDEX b_idx ON b (id);")},
+		"migrations/0002_create_b.sql":       {Data: []byte("CREATE TABLE b (id INT);")},
+		"migrations/0001_create_a.sql":       {Data: []byte("CREATE TABLE a (id INT);")},
+		"migrations/README.md":               {Data: []byte("not a migration")},
+		"migrations/0003_unfinished.sql.swp": {Data: []byte("")},
+	}
+	migrations, err := loadMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations returned error: %v", err)
+	}
+	var got []int
+	for _, m := range migrations {
+		got = append(got, m.Version)
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 10 {
+		t.Fatalf("expected versions [1 2 10], got %v", got)
+	}
+	if migrations[2].Name != "add_index" || migrations[2].SQL != "CREATE INDEX b_idx ON b (id);" {
+		t.Fatalf("unexpected migration %+v", migrations[2])
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"no version": {"migrations/create_a.sql": {}},
+		"duplicate":  {"migrations/0001_create_a.sql": {}, "migrations/1_create_b.sql": {}},
+	} {
+		if _, err := loadMigrations(fsys, "migrations"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations returned error: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Name != "create_users" {
+		t.Fatalf("expected the first migration to create users, got %+v", migrations)
+	}
+}
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "create_a", SQL: "CREATE TABLE a (id INT);"},
+	{Version: 2, Name: "create_b", SQL: "CREATE TABLE b (id INT);"},
+	{Version: 3, Name: "create_c", SQL: "CREATE TABLE c (id INT);"},
+}
+
+// expectMigrationStart expects the lock and the lookup of applied versions.
+func expectMigrationStart(mock sqlmock.Sqlmock, applied ...int) {
+	mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version"})
+	for _, v := range applied {
+		rows.AddRow(v)
+	}
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).WillReturnRows(rows)
+}
+
+func expectApply(mock sqlmock.Sqlmock, m Migration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(m.SQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations \(version, name\)`).WithArgs(m.Version, m.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestMigrateAppliesInOrder(t *testing.T) {
+	db, mock := newMock(t)
+	expectMigrationStart(mock)
+	for _, m := range testMigrations {
+		expectApply(mock, m)
+	}
+	expectUnlock(mock)
+
+	applied, err := migrate(context.Background(), db, testMigrations)
+	if err != nil {
+		t.Fatalf("migrate returned error: %v", err)
+	}
+	if len(applied) != 3 {
+		t.Fatalf("expected 3 migrations applied, got %d", len(applied))
+	}
+}
+
+func TestMigrateSkipsApplied(t *testing.T) {
+	t.Run("pending", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectMigrationStart(mock, 1, 2)
+		expectApply(mock, testMigrations[2])
+		expectUnlock(mock)
+
+		applied, err := migrate(context.Background(), db, testMigrations)
+		if err != nil {
+			t.Fatalf("migrate returned error: %v", err)
+		}
+		if len(applied) != 1 || applied[0].Version != 3 {
+			t.Fatalf("expected only migration 3 applied, got %+v", applied)
+		}
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectMigrationStart(mock, 1, 2, 3)
+		expectUnlock(mock)
+
+		applied, err := migrate(context.Background(), db, testMigrations)
+		if err != nil {
+			t.Fatalf("migrate returned error: %v", err)
+		}
+		if len(applied) != 0 {
+			t.Fatalf("expected nothing applied, got %+v", applied)
+		}
+	})
+}
+
+func TestMigrateStopsOnFailure(t *testing.T) {
+	db, mock := newMock(t)
+	expectMigrationStart(mock)
+	expectApply(mock, testMigrations[0])
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(testMigrations[1].SQL)).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	applied, err := migrate(context.Background(), db, testMigrations)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(applied) != 1 || applied[0].Version != 1 {
+		t.Fatalf("expected migration 1 to be kept, got %+v", applied)
+	}
+}
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS users (
+    id           BIGSERIAL PRIMARY KEY,
+    phone_number TEXT UNIQUE,
+    email        TEXT UNIQUE,
+    okta_id      TEXT NOT NULL UNIQUE
+);
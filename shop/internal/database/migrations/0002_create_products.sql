@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS products (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    description TEXT,
+    price_cents BIGINT NOT NULL CHECK (price_cents >= 0),
+    currency    CHAR(3) NOT NULL,
+    sku         TEXT NOT NULL UNIQUE,
+    stock_qty   INTEGER NOT NULL DEFAULT 0 CHECK (stock_qty >= 0),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS products_created_at_idx ON products (created_at, id);
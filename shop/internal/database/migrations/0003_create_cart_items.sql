@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS cart_items (
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    qty        INTEGER NOT NULL CHECK (qty > 0),
+    added_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, product_id)
+);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS orders (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT NOT NULL REFERENCES users (id),
+    status      TEXT NOT NULL CHECK (status IN ('PENDING', 'PAID', 'SHIPPED', 'CANCELLED')),
+    total_cents BIGINT NOT NULL,
+    currency    CHAR(3) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS orders_user_id_created_at_idx ON orders (user_id, created_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id         BIGINT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    product_id       BIGINT NOT NULL REFERENCES products (id),
+    name             TEXT NOT NULL,
+    sku              TEXT NOT NULL,
+    qty              INTEGER NOT NULL CHECK (qty > 0),
+    unit_price_cents BIGINT NOT NULL,
+    PRIMARY KEY (order_id, product_id)
+);
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- A soft-deleted user keeps its email and phone number, so only active users need to be unique.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_phone_number_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_active_key ON users (email) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_number_active_key ON users (phone_number) WHERE deleted_at IS NULL;
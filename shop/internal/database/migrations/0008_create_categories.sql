@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS categories (
+    id        BIGSERIAL PRIMARY KEY,
+    name      TEXT NOT NULL,
+    slug      TEXT NOT NULL UNIQUE,
+    parent_id BIGINT REFERENCES categories (id) ON DELETE SET NULL CHECK (parent_id <> id)
+);
+
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id BIGINT REFERENCES categories (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS products_category_id_idx ON products (category_id, created_at, id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS reservations (
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    qty        INTEGER NOT NULL CHECK (qty > 0),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS reservations_expires_at_idx ON reservations (expires_at);
@@ -0,0 +1,3 @@
+-- Incremented by every stock change so that concurrent read-modify-write updates can detect
+-- that the row changed under them.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- status mirrors the user's lifecycle state in Okta, kept in sync by the Okta event hook.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'ACTIVE'
+    CHECK (status IN ('ACTIVE', 'SUSPENDED', 'DEACTIVATED'));
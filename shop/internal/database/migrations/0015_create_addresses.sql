@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS addresses (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    line1       TEXT NOT NULL,
+    line2       TEXT NOT NULL DEFAULT '',
+    city        TEXT NOT NULL,
+    region      TEXT NOT NULL DEFAULT '',
+    postal_code TEXT NOT NULL,
+    country     CHAR(2) NOT NULL,
+    is_default  BOOLEAN NOT NULL DEFAULT false,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS addresses_user_id_idx ON addresses (user_id);
+
+-- A user has at most one default address.
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_user_id_default_idx ON addresses (user_id) WHERE is_default;
@@ -0,0 +1,3 @@
+-- A snapshot of the address the order ships to, taken at checkout. Orders placed before
+-- addresses existed have none.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_address JSONB;
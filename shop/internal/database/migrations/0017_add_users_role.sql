@@ -0,0 +1,4 @@
+-- role is what the user is allowed to do. Admins are promoted by hand, or listed in
+-- ADMIN_USER_IDS.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'CUSTOMER'
+    CHECK (role IN ('CUSTOMER', 'ADMIN'));
@@ -0,0 +1,2 @@
+-- The carrier's tracking number, set when the order ships.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_number TEXT;
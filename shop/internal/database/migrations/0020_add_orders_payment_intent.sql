@@ -0,0 +1,8 @@
+-- The payment provider's ID for the payment collecting the order, set at checkout.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_intent_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS orders_payment_intent_id_idx ON orders (payment_intent_id);
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('PENDING', 'PENDING_PAYMENT', 'PAID', 'SHIPPED', 'DELIVERED', 'CANCELLED'));
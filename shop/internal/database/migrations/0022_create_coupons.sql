@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS coupons (
+    id               BIGSERIAL PRIMARY KEY,
+    code             TEXT NOT NULL UNIQUE CHECK (code = upper(code)),
+    percent_off      INTEGER CHECK (percent_off BETWEEN 1 AND 100),
+    amount_off_cents BIGINT CHECK (amount_off_cents > 0),
+    currency         CHAR(3),
+    expires_at       TIMESTAMPTZ,
+    max_redemptions  INTEGER CHECK (max_redemptions > 0),
+    times_redeemed   INTEGER NOT NULL DEFAULT 0,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- A coupon takes off either a percentage or a fixed amount, and a fixed amount has a currency.
+    CHECK ((percent_off IS NULL) <> (amount_off_cents IS NULL)),
+    CHECK ((amount_off_cents IS NULL) = (currency IS NULL))
+);
+
+-- total_cents is what the shopper pays, after discount_cents was taken off by coupon_code.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount_cents BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS coupon_code TEXT;
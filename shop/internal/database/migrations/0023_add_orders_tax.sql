@@ -0,0 +1,5 @@
+-- total_cents is subtotal_cents less discount_cents, plus tax_cents. Orders placed before
+-- tax was charged had none, so their subtotal is what was paid before the discount.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS subtotal_cents BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_cents BIGINT NOT NULL DEFAULT 0;
+UPDATE orders SET subtotal_cents = total_cents + discount_cents WHERE subtotal_cents = 0;
@@ -0,0 +1,4 @@
+-- email_verified and phone_verified record whether the user proved they receive passcodes at
+-- email and phone_number. Changing either clears its flag.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- avatar_url is where the user's uploaded avatar is served from, or NULL without one.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url TEXT;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS product_images (
+    id         BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    url        TEXT NOT NULL,
+    position   INTEGER NOT NULL CHECK (position >= 0),
+    -- Deferred so reordering can swap positions within a transaction.
+    CONSTRAINT product_images_product_id_position_key UNIQUE (product_id, position) DEFERRABLE INITIALLY DEFERRED
+);
@@ -0,0 +1,3 @@
+-- frequentlyBoughtTogether finds the orders containing a product, which the (order_id,
+-- product_id) primary key can't look up by product.
+CREATE INDEX IF NOT EXISTS order_items_product_id_idx ON order_items (product_id);
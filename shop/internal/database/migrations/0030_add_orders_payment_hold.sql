@@ -0,0 +1,6 @@
+-- When the stock of an order awaiting payment stops being held for it. Unpaid orders are
+-- cancelled, and their stock released, once it passes.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_held_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS orders_payment_held_until_idx ON orders (payment_held_until)
+    WHERE status IN ('PENDING_PAYMENT', 'PAYMENT_FAILED');
@@ -0,0 +1,3 @@
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS max_per_order INTEGER CHECK (max_per_order > 0),
+    ADD COLUMN IF NOT EXISTS max_per_customer INTEGER CHECK (max_per_customer > 0);
@@ -0,0 +1,21 @@
+-- Flash sales take percent_off off the price of their products while they run, from
+-- starts_at until ends_at. Where sales of a product overlap, the deepest discount applies.
+CREATE TABLE IF NOT EXISTS flash_sales (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    percent_off INTEGER NOT NULL CHECK (percent_off BETWEEN 1 AND 100),
+    starts_at   TIMESTAMPTZ NOT NULL,
+    ends_at     TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS flash_sales_ends_at_idx ON flash_sales (ends_at);
+
+CREATE TABLE IF NOT EXISTS flash_sale_products (
+    flash_sale_id BIGINT NOT NULL REFERENCES flash_sales (id) ON DELETE CASCADE,
+    product_id    BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    PRIMARY KEY (flash_sale_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS flash_sale_products_product_id_idx ON flash_sale_products (product_id);
@@ -0,0 +1,2 @@
+-- Keyset pagination of products by price, cheapest or most expensive first.
+CREATE INDEX IF NOT EXISTS products_price_cents_idx ON products (price_cents, id);
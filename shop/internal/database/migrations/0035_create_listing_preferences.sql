@@ -0,0 +1,9 @@
+-- The defaults a user's product listings use for the arguments they leave out. A NULL
+-- column falls back to the global default.
+CREATE TABLE IF NOT EXISTS listing_preferences (
+    user_id       BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    sort          TEXT,
+    page_size     INTEGER CHECK (page_size > 0),
+    category_slug TEXT,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// WithTx runs fn in a transaction, committing it if fn returns nil and rolling it back
+// otherwise. If fn panics, the transaction is rolled back and the panic is re-raised.
+//
+// Parameters:
+//   - ctx: The context for the transaction.
+//   - db: The database to begin the transaction on.
+//   - fn: The statements to run in the transaction.
+//
+// Returns:
+//   - An error if the transaction can't begin or commit, or fn's error. If rolling back
+//     after fn's error also fails, the returned error wraps both.
+func WithTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to roll back transaction: %w", rbErr))
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWithTxCommits(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE products`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := WithTx(context.Background(), db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE products SET stock = stock - 1 WHERE id = 1`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx returned error: %v", err)
+	}
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	failure := errors.New("out of stock")
+	err := WithTx(context.Background(), db, func(tx *sql.Tx) error { return failure })
+	if err != failure {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+}
+
+func TestWithTxReportsRollbackFailure(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback().WillReturnError(sql.ErrConnDone)
+
+	failure := errors.New("out of stock")
+	err := WithTx(context.Background(), db, func(tx *sql.Tx) error { return failure })
+	if !errors.Is(err, failure) || !errors.Is(err, sql.ErrConnDone) {
+		t.Fatalf("expected both fn's and the rollback's errors, got %v", err)
+	}
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Fatalf("expected the panic to be re-raised, got %v", p)
+		}
+	}()
+	WithTx(context.Background(), db, func(tx *sql.Tx) error { panic("boom") })
+	t.Fatal("expected WithTx to panic")
+}
+
+func TestWithTxBeginFailure(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectBegin().WillReturnError(sql.ErrConnDone)
+
+	called := false
+	err := WithTx(context.Background(), db, func(tx *sql.Tx) error { called = true; return nil })
+	if !errors.Is(err, sql.ErrConnDone) || called {
+		t.Fatalf("expected the begin error without calling fn, got %v (called %v)", err, called)
+	}
+}
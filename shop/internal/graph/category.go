@@ -0,0 +1,45 @@
+package graph
+
+import "github.com/ShoppingDem/backend/shop/pkg/models"
+
+// categoryTree links categories into a tree through their parent IDs and returns the roots, in
+// the order the categories were given. A category whose parent doesn't exist is treated as a
+// root. Categories in a parent cycle can't be reached from any root; they are left out of the
+// tree, along with their descendants, and returned as detached so the caller can report them.
+func categoryTree(categories []*models.Category) (roots, detached []*models.Category) {
+	byID := make(map[string]*models.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+	children := map[string][]*models.Category{}
+	for _, c := range categories {
+		c.Children = []*models.Category{}
+		if c.ParentID == nil || byID[*c.ParentID] == nil {
+			roots = append(roots, c)
+			continue
+		}
+		children[*c.ParentID] = append(children[*c.ParentID], c)
+	}
+
+	// Walk down from the roots. Every reachable category is visited once, so the walk ends
+	// even if the input has cycles.
+	visited := make(map[string]bool, len(categories))
+	queue := append([]*models.Category{}, roots...)
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		visited[c.ID] = true
+		c.Children = append(c.Children, children[c.ID]...)
+		queue = append(queue, children[c.ID]...)
+	}
+
+	for _, c := range categories {
+		if !visited[c.ID] {
+			detached = append(detached, c)
+		}
+	}
+	if roots == nil {
+		roots = []*models.Category{}
+	}
+	return roots, detached
+}
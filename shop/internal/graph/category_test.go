@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestCategoryTree(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	t.Run("nested", func(t *testing.T) {
+		roots, detached := categoryTree([]*models.Category{
+			{ID: "1", Slug: "bags"},
+			{ID: "2", Slug: "totes", ParentID: strPtr("1")},
+			{ID: "3", Slug: "canvas-totes", ParentID: strPtr("2")},
+			{ID: "4", Slug: "backpacks", ParentID: strPtr("1")},
+			{ID: "5", Slug: "kitchen"},
+			{ID: "6", Slug: "orphan", ParentID: strPtr("99")},
+		})
+		if len(detached) != 0 {
+			t.Fatalf("expected nothing detached, got %+v", detached)
+		}
+		if len(roots) != 3 || roots[0].Slug != "bags" || roots[1].Slug != "kitchen" || roots[2].Slug != "orphan" {
+			t.Fatalf("unexpected roots: %+v", roots)
+		}
+		bags := roots[0]
+		if len(bags.Children) != 2 || bags.Children[0].Slug != "totes" || bags.Children[1].Slug != "backpacks" {
+			t.Fatalf("unexpected children of bags: %+v", bags.Children)
+		}
+		if totes := bags.Children[0]; len(totes.Children) != 1 || totes.Children[0].Slug != "canvas-totes" {
+			t.Fatalf("unexpected children of totes: %+v", totes.Children)
+		}
+		if roots[1].Children == nil || len(roots[1].Children) != 0 {
+			t.Fatalf("expected an empty non-nil children slice for a leaf, got %v", roots[1].Children)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		roots, detached := categoryTree([]*models.Category{
+			{ID: "1", Slug: "bags"},
+			{ID: "2", Slug: "a", ParentID: strPtr("3")},
+			{ID: "3", Slug: "b", ParentID: strPtr("2")},
+			{ID: "4", Slug: "under-cycle", ParentID: strPtr("3")},
+			{ID: "5", Slug: "self", ParentID: strPtr("5")},
+		})
+		if len(roots) != 1 || roots[0].Slug != "bags" || len(roots[0].Children) != 0 {
+			t.Fatalf("unexpected roots: %+v", roots)
+		}
+		var slugs []string
+		for _, c := range detached {
+			slugs = append(slugs, c.Slug)
+		}
+		if len(slugs) != 4 || slugs[0] != "a" || slugs[1] != "b" || slugs[2] != "under-cycle" || slugs[3] != "self" {
+			t.Fatalf("expected the cycles and their descendants to be detached, got %v", slugs)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		roots, detached := categoryTree(nil)
+		if roots == nil || len(roots) != 0 || len(detached) != 0 {
+			t.Fatalf("expected no categories, got %v %v", roots, detached)
+		}
+	})
+}
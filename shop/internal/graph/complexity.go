@@ -0,0 +1,49 @@
+package graph
+
+import "github.com/ShoppingDem/backend/shop/pkg/models"
+
+// NewConfig returns the executable schema config for resolver, with the access control
+// directives implemented. Paginated list fields are weighted by their page size, so a
+// query's complexity grows with the number of rows it can return rather than just the
+// number of fields it selects.
+func NewConfig(resolver *Resolver) Config {
+	cfg := Config{Resolvers: resolver}
+	cfg.Directives.Authenticated = authenticated
+	cfg.Directives.HasRole = resolver.hasRole
+	cfg.Complexity.Query.Products = func(childComplexity int, limit *int, offset *int, categorySlug *string, sort *models.ProductSort) int {
+		return pageComplexity(childComplexity, limit)
+	}
+	cfg.Complexity.Query.ProductsConnection = func(childComplexity int, first *int, after *string, categorySlug *string, sort *models.ProductSort) int {
+		return pageComplexity(childComplexity, first)
+	}
+	cfg.Complexity.Query.SearchProducts = func(childComplexity int, query string, limit *int, offset *int) int {
+		return pageComplexity(childComplexity, limit)
+	}
+	cfg.Complexity.Query.FrequentlyBoughtTogether = func(childComplexity int, productID string, limit *int) int {
+		n := defaultRecommendations
+		if limit != nil {
+			n = *limit
+		}
+		return 1 + n*childComplexity
+	}
+	cfg.Complexity.Query.Reviews = func(childComplexity int, productID string, limit *int, offset *int) int {
+		return pageComplexity(childComplexity, limit)
+	}
+	cfg.Complexity.Query.Orders = func(childComplexity int, status *models.OrderStatus, limit *int, offset *int) int {
+		return pageComplexity(childComplexity, limit)
+	}
+	cfg.Complexity.Query.DeadWebhookDeliveries = func(childComplexity int, limit *int, offset *int) int {
+		return pageComplexity(childComplexity, limit)
+	}
+	return cfg
+}
+
+// pageComplexity is the cost of a paginated list: one unit for the field plus the cost of
+// each item times the page size the resolver will use.
+func pageComplexity(childComplexity int, limit *int) int {
+	var page models.PageArgs
+	if limit != nil {
+		page.Limit = *limit
+	}
+	return 1 + page.Normalize(maxPageLimit).Limit*childComplexity
+}
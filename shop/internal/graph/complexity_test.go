@@ -0,0 +1,67 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestComplexityLimit(t *testing.T) {
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products = &fakeProductRepository{products: []*models.Product{{ID: "1", Name: "Tote bag"}}}
+	srv := handler.New(NewExecutableSchema(NewConfig(r)))
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.FixedComplexityLimit(50))
+
+	query := func(q string) map[string]any {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"query": q})
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		var resp map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+		}
+		return resp
+	}
+
+	t.Run("below limit", func(t *testing.T) {
+		// 1 + 10 * 2 fields = 21.
+		resp := query(`{ products(limit: 10) { id name } }`)
+		if resp["errors"] != nil {
+			t.Fatalf("unexpected errors: %v", resp["errors"])
+		}
+	})
+
+	t.Run("above limit", func(t *testing.T) {
+		// 1 + 30 * 2 fields = 61.
+		resp := query(`{ products(limit: 30) { id name } }`)
+		errs, _ := resp["errors"].([]any)
+		if len(errs) != 1 {
+			t.Fatalf("expected a complexity error, got %v", resp)
+		}
+		ext, _ := errs[0].(map[string]any)["extensions"].(map[string]any)
+		if ext["code"] != "COMPLEXITY_LIMIT_EXCEEDED" {
+			t.Fatalf("expected COMPLEXITY_LIMIT_EXCEEDED, got %v", errs[0])
+		}
+	})
+
+	t.Run("default page size counts", func(t *testing.T) {
+		// Without a limit the default page size applies: 1 + 20 * 3 fields = 61.
+		resp := query(`{ products { id name sku } }`)
+		if resp["errors"] == nil {
+			t.Fatal("expected the default page size to count towards the limit")
+		}
+	})
+}
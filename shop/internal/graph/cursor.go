@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// priceCursorPrefix starts the cursors of the orders by price, so that a cursor can't be used
+// with an order it doesn't point into.
+const priceCursorPrefix = "p"
+
+// encodeProductCursor returns the opaque cursor pointing at p in the product list in sort
+// order.
+func encodeProductCursor(p *models.Product, sort models.ProductSort) string {
+	key := strconv.FormatInt(p.CreatedAt.UnixNano(), 10)
+	if sort.ByPrice() {
+		key = priceCursorPrefix + strconv.FormatInt(p.PriceCents, 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(key + ":" + p.ID))
+}
+
+// decodeProductCursor parses a cursor produced by encodeProductCursor for sort, returning
+// ErrInvalidArgument if it is malformed or was produced for an order of another kind.
+func decodeProductCursor(cursor string, sort models.ProductSort) (*models.ProductCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidArgument)
+	}
+	key, id, ok := strings.Cut(string(raw), ":")
+	if !ok || validateID("product", id) != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidArgument)
+	}
+	if sort.ByPrice() {
+		price, ok := strings.CutPrefix(key, priceCursorPrefix)
+		cents, err := strconv.ParseInt(price, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidArgument)
+		}
+		return &models.ProductCursor{PriceCents: cents, ID: id}, nil
+	}
+	n, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidArgument)
+	}
+	return &models.ProductCursor{CreatedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
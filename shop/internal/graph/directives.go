@@ -0,0 +1,27 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// authenticated implements the @authenticated directive: the field resolves only for an
+// authenticated user, and fails with ErrUnauthenticated otherwise.
+func authenticated(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+	if _, err := currentUser(ctx); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+// hasRole implements the @hasRole directive with requireRole, so the field fails with
+// ErrUnauthenticated for an unauthenticated request and ErrForbidden for a user without role.
+func (r *Resolver) hasRole(ctx context.Context, obj any, next graphql.Resolver, role models.Role) (any, error) {
+	if err := r.requireRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
@@ -0,0 +1,130 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestAuthenticatedDirective(t *testing.T) {
+	var calls int
+	next := func(ctx context.Context) (any, error) {
+		calls++
+		return "resolved", nil
+	}
+
+	if _, err := authenticated(context.Background(), nil, next); !errors.Is(err, ErrUnauthenticated) || calls != 0 {
+		t.Fatalf("expected ErrUnauthenticated without resolving, got %v after %d calls", err, calls)
+	}
+	if res, err := authenticated(asUser("42"), nil, next); err != nil || res != "resolved" || calls != 1 {
+		t.Fatalf("expected the field to resolve, got (%v, %v) after %d calls", res, err, calls)
+	}
+}
+
+func TestHasRoleDirective(t *testing.T) {
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository(
+		&models.User{ID: "42", Role: models.RoleCustomer},
+		&models.User{ID: "43", Role: models.RoleAdmin},
+	))
+	r.Admins = map[string]bool{"1": true}
+
+	for name, tc := range map[string]struct {
+		ctx  context.Context
+		role models.Role
+		want error
+	}{
+		"unauthenticated":         {context.Background(), models.RoleAdmin, ErrUnauthenticated},
+		"customer":                {asUser("42"), models.RoleAdmin, ErrForbidden},
+		"stored admin role":       {asUser("43"), models.RoleAdmin, nil},
+		"configured admin":        {asUser("1"), models.RoleAdmin, nil},
+		"customer role":           {asUser("42"), models.RoleCustomer, nil},
+		"admin isn't a customer":  {asUser("43"), models.RoleCustomer, ErrForbidden},
+		"user that doesn't exist": {asUser("404"), models.RoleCustomer, ErrForbidden},
+	} {
+		resolved := false
+		_, err := r.hasRole(tc.ctx, nil, func(ctx context.Context) (any, error) {
+			resolved = true
+			return nil, nil
+		}, tc.role)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+		if resolved != (tc.want == nil) {
+			t.Errorf("%s: expected the field to resolve only when allowed, resolved %v", name, resolved)
+		}
+	}
+}
+
+func TestDirectivesInSchema(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "7", Name: "Mug", PriceCents: 899}}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository(&models.User{ID: "42", Role: models.RoleCustomer}))
+	r.Admins = map[string]bool{"1": true}
+	r.Carts = newFakeCartRepository(products)
+	images := &fakeProductImageRepository{products: products, images: []*models.ProductImage{{ID: "1", ProductID: "7", URL: "https://cdn.example.com/mug.png"}}}
+	r.ProductImages = images
+	srv := handler.New(NewExecutableSchema(NewConfig(r)))
+	srv.AddTransport(transport.POST{})
+	srv.SetErrorPresenter(ErrorPresenter(slog.Default(), false))
+
+	// query runs q as the user with the given ID, or unauthenticated if it's empty, and
+	// returns the error code, or an empty string if it succeeded.
+	query := func(userID, q string) string {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"query": q})
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if userID != "" {
+			req = req.WithContext(asUser(userID))
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		var resp struct {
+			Errors []struct {
+				Extensions map[string]any `json:"extensions"`
+			} `json:"errors"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+		}
+		if len(resp.Errors) == 0 {
+			return ""
+		}
+		code, _ := resp.Errors[0].Extensions["code"].(string)
+		return code
+	}
+
+	deleteImage := `mutation { deleteProductImage(id: "1") }`
+	for name, tc := range map[string]struct {
+		userID, query, want string
+	}{
+		"authenticated field without a user": {"", `{ cart { subtotalCents } }`, CodeUnauthenticated},
+		"authenticated field with a user":    {"42", `{ cart { subtotalCents } }`, ""},
+		"role field without a user":          {"", deleteImage, CodeUnauthenticated},
+		"role field without the role":        {"42", deleteImage, CodeForbidden},
+	} {
+		if got := query(tc.userID, tc.query); got != tc.want {
+			t.Errorf("%s: expected code %q, got %q", name, tc.want, got)
+		}
+	}
+	if len(images.images) != 1 {
+		t.Fatal("expected denied requests not to reach the resolver")
+	}
+
+	if got := query("1", deleteImage); got != "" {
+		t.Fatalf("expected the admin to delete the image, got code %q", got)
+	}
+	if len(images.images) != 0 {
+		t.Fatal("expected the image to be deleted")
+	}
+}
@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrOkta wraps failures returned by the Okta identity provider.
+	ErrOkta = errors.New("identity provider error")
+
+	// ErrPayment wraps failures returned by the payment provider.
+	ErrPayment = errors.New("payment provider error")
+
+	// ErrDatabase wraps failures returned by the database.
+	ErrDatabase = errors.New("database error")
+
+	// ErrUnauthenticated is returned when login credentials are rejected or don't match a known user.
+	ErrUnauthenticated = errors.New("unauthenticated")
+
+	// ErrForbidden is returned when an authenticated user tries to access another user's data.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrInvalidArgument is returned when an argument fails validation before reaching a backend.
+	ErrInvalidArgument = errors.New("invalid argument")
+
+	// ErrNotAnImage is returned when an uploaded avatar isn't a PNG, JPEG, GIF or WebP image.
+	ErrNotAnImage = errors.New("not an image")
+
+	// ErrFileTooLarge is returned when an uploaded file is over the size limit.
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+// FieldError is an ErrInvalidArgument caused by a single input field. The field's path is
+// reported to clients in the "field" error extension.
+type FieldError struct {
+	Field string // The path of the invalid field, e.g. "input.identifier".
+	Err   error  // Why the field is invalid.
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%v: %s: %v", ErrInvalidArgument, e.Field, e.Err)
+}
+
+// Unwrap returns ErrInvalidArgument and the underlying error.
+func (e *FieldError) Unwrap() []error {
+	return []error{ErrInvalidArgument, e.Err}
+}
+
+// ValidationError is an ErrInvalidArgument caused by several input fields, so that all of them
+// can be fixed at once. The fields are reported to clients in the "fields" error extension, as
+// a list of {field, message} objects, and the first one in the "field" extension.
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+// add records that field is invalid because of err.
+func (e *ValidationError) add(field string, err error) {
+	e.Fields = append(e.Fields, &FieldError{Field: field, Err: err})
+}
+
+// err returns e if any field is invalid, or nil.
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	causes := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		causes[i] = fmt.Sprintf("%s: %v", f.Field, f.Err)
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidArgument, strings.Join(causes, "; "))
+}
+
+// Unwrap returns ErrInvalidArgument and the field errors.
+func (e *ValidationError) Unwrap() []error {
+	errs := []error{ErrInvalidArgument}
+	for _, f := range e.Fields {
+		errs = append(errs, f)
+	}
+	return errs
+}
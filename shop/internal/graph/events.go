@@ -0,0 +1,64 @@
+package graph
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// orderEventBuffer is how many undelivered updates a subscriber can fall behind by before
+// further updates to it are dropped.
+const orderEventBuffer = 8
+
+// OrderEvents is an in-process pub/sub of order updates, keyed by order ID. It only reaches
+// subscribers connected to the same process.
+type OrderEvents struct {
+	mu   sync.Mutex
+	subs map[string]map[chan *models.Order]struct{}
+}
+
+// NewOrderEvents creates an empty OrderEvents.
+func NewOrderEvents() *OrderEvents {
+	return &OrderEvents{subs: map[string]map[chan *models.Order]struct{}{}}
+}
+
+// Subscribe returns a channel of updates to the order with the given ID. The subscription
+// ends, and the channel is closed, when ctx is done.
+func (e *OrderEvents) Subscribe(ctx context.Context, orderID string) <-chan *models.Order {
+	ch := make(chan *models.Order, orderEventBuffer)
+
+	e.mu.Lock()
+	if e.subs[orderID] == nil {
+		e.subs[orderID] = map[chan *models.Order]struct{}{}
+	}
+	e.subs[orderID][ch] = struct{}{}
+	e.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subs[orderID], ch)
+		if len(e.subs[orderID]) == 0 {
+			delete(e.subs, orderID)
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// Publish sends order to the subscribers of its ID. It never blocks: a subscriber whose
+// buffer is full misses the update.
+func (e *OrderEvents) Publish(order *models.Order) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs[order.ID] {
+		// Each subscriber gets its own copy, since resolvers may fill in fields like Items.
+		copied := *order
+		select {
+		case ch <- &copied:
+		default:
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const (
+	// loaderWait is how long a loader collects keys before fetching them as one batch.
+	loaderWait = 2 * time.Millisecond
+
+	// loaderMaxBatch caps the number of keys fetched in one batch.
+	loaderMaxBatch = 100
+)
+
+type loaderKey struct{}
+
+// loaders holds the per-request batch loaders.
+type loaders struct {
+	users   *batchLoader[*models.User]
+	ratings *batchLoader[float64]
+	images  *batchLoader[[]*models.ProductImage]
+	stats   *batchLoader[*models.CustomerStats]
+	sales   *batchLoader[*models.FlashSale] // Products' deepest flash sale running when the request started.
+}
+
+// Loaders is a middleware that installs per-request batch loaders, so resolvers that look up
+// the same kind of record for every item of a list (like each order's user) share one query.
+func Loaders(users models.UserRepository, reviews models.ReviewRepository, images models.ProductImageRepository, orders models.OrderRepository, sales models.FlashSaleRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := withLoaders(r.Context(), users, reviews, images, orders, sales)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// withLoaders returns a copy of ctx carrying new loaders backed by the given repositories.
+func withLoaders(ctx context.Context, users models.UserRepository, reviews models.ReviewRepository, images models.ProductImageRepository, orders models.OrderRepository, sales models.FlashSaleRepository) context.Context {
+	now := time.Now()
+	return context.WithValue(ctx, loaderKey{}, &loaders{
+		users: newBatchLoader(ctx, func(ctx context.Context, ids []string) (map[string]*models.User, error) {
+			found, err := users.GetByIDs(ctx, ids)
+			byID := make(map[string]*models.User, len(found))
+			for _, user := range found {
+				byID[user.ID] = user
+			}
+			return byID, err
+		}),
+		ratings: newBatchLoader(ctx, reviews.AverageRatings),
+		images:  newBatchLoader(ctx, images.ListByProducts),
+		stats:   newBatchLoader(ctx, orders.CustomerStats),
+		sales: newBatchLoader(ctx, func(ctx context.Context, ids []string) (map[string]*models.FlashSale, error) {
+			return sales.ActiveByProducts(ctx, ids, now)
+		}),
+	})
+}
+
+// loadUser loads a user through the request's loader, or directly from users when no
+// loader is installed. It returns models.ErrNotFound if the user doesn't exist.
+func loadUser(ctx context.Context, users models.UserRepository, id string) (*models.User, error) {
+	if l, ok := ctx.Value(loaderKey{}).(*loaders); ok {
+		return l.users.Load(ctx, id)
+	}
+	return users.GetByID(ctx, id)
+}
+
+// loadAverageRating loads a product's average rating through the request's loader, or
+// directly from reviews when no loader is installed. It returns models.ErrNotFound if the
+// product has no reviews.
+func loadAverageRating(ctx context.Context, reviews models.ReviewRepository, productID string) (float64, error) {
+	if l, ok := ctx.Value(loaderKey{}).(*loaders); ok {
+		return l.ratings.Load(ctx, productID)
+	}
+	ratings, err := reviews.AverageRatings(ctx, []string{productID})
+	if err != nil {
+		return 0, err
+	}
+	rating, ok := ratings[productID]
+	if !ok {
+		return 0, models.ErrNotFound
+	}
+	return rating, nil
+}
+
+// loadProductImages loads a product's images, ordered by position, through the request's
+// loader, or directly from images when no loader is installed.
+func loadProductImages(ctx context.Context, images models.ProductImageRepository, productID string) ([]*models.ProductImage, error) {
+	if l, ok := ctx.Value(loaderKey{}).(*loaders); ok {
+		loaded, err := l.images.Load(ctx, productID)
+		if errors.Is(err, models.ErrNotFound) {
+			return []*models.ProductImage{}, nil
+		}
+		return loaded, err
+	}
+	return images.ListByProduct(ctx, productID)
+}
+
+// loadCustomerStats loads the stats of a user's delivered orders through the request's
+// loader, or directly from orders when no loader is installed. A user without any gets
+// zero stats.
+func loadCustomerStats(ctx context.Context, orders models.OrderRepository, userID string) (*models.CustomerStats, error) {
+	var (
+		stats *models.CustomerStats
+		err   error
+	)
+	if l, ok := ctx.Value(loaderKey{}).(*loaders); ok {
+		stats, err = l.stats.Load(ctx, userID)
+	} else {
+		var byUser map[string]*models.CustomerStats
+		if byUser, err = orders.CustomerStats(ctx, []string{userID}); err == nil {
+			if stats = byUser[userID]; stats == nil {
+				err = models.ErrNotFound
+			}
+		}
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		return &models.CustomerStats{}, nil
+	}
+	return stats, err
+}
+
+// loadActiveFlashSale loads the running flash sale with the deepest discount on a product
+// through the request's loader, or directly from sales at now when no loader is installed.
+// It returns nil if the product isn't on sale.
+func loadActiveFlashSale(ctx context.Context, sales models.FlashSaleRepository, productID string, now time.Time) (*models.FlashSale, error) {
+	var (
+		sale *models.FlashSale
+		err  error
+	)
+	if l, ok := ctx.Value(loaderKey{}).(*loaders); ok {
+		sale, err = l.sales.Load(ctx, productID)
+	} else {
+		var byProduct map[string]*models.FlashSale
+		if byProduct, err = sales.ActiveByProducts(ctx, []string{productID}, now); err == nil {
+			sale = byProduct[productID]
+		}
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	return sale, err
+}
+
+// batchLoader batches and caches lookups by ID for the lifetime of a request.
+type batchLoader[V any] struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, ids []string) (map[string]V, error)
+
+	mu    sync.Mutex
+	batch *batch[V]
+	cache map[string]*batch[V] // The batch that fetched (or is fetching) each ID.
+}
+
+// batch is a set of IDs fetched together. done is closed once values and err are set.
+type batch[V any] struct {
+	ids    []string
+	done   chan struct{}
+	values map[string]V
+	err    error
+}
+
+// newBatchLoader creates a batchLoader. fetch returns the values found for the given IDs,
+// keyed by ID, and leaves out the IDs that don't exist.
+func newBatchLoader[V any](ctx context.Context, fetch func(ctx context.Context, ids []string) (map[string]V, error)) *batchLoader[V] {
+	return &batchLoader[V]{ctx: ctx, fetch: fetch, cache: map[string]*batch[V]{}}
+}
+
+// Load returns the value with the given ID, waiting for the batch it's part of to be
+// fetched. It returns models.ErrNotFound if the ID doesn't exist.
+func (l *batchLoader[V]) Load(ctx context.Context, id string) (V, error) {
+	l.mu.Lock()
+	b, ok := l.cache[id]
+	if !ok {
+		if l.batch == nil {
+			next := &batch[V]{done: make(chan struct{})}
+			l.batch = next
+			time.AfterFunc(loaderWait, func() { l.dispatch(next) })
+		}
+		b = l.batch
+		b.ids = append(b.ids, id)
+		l.cache[id] = b
+		if len(b.ids) >= loaderMaxBatch {
+			go l.dispatch(b)
+		}
+	}
+	l.mu.Unlock()
+
+	var zero V
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+	if b.err != nil {
+		return zero, b.err
+	}
+	value, ok := b.values[id]
+	if !ok {
+		return zero, models.ErrNotFound
+	}
+	return value, nil
+}
+
+// dispatch fetches b unless it has already been dispatched.
+func (l *batchLoader[V]) dispatch(b *batch[V]) {
+	l.mu.Lock()
+	if l.batch != b {
+		l.mu.Unlock()
+		return
+	}
+	l.batch = nil
+	l.mu.Unlock()
+
+	b.values, b.err = l.fetch(l.ctx, b.ids)
+	if b.err != nil {
+		// Let a later request for the same IDs try again.
+		l.mu.Lock()
+		for _, id := range b.ids {
+			delete(l.cache, id)
+		}
+		l.mu.Unlock()
+	}
+	close(b.done)
+}
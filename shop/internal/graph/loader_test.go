@@ -0,0 +1,253 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// resolveOrderUsers resolves the user of every order concurrently, as gqlgen does for a list.
+func resolveOrderUsers(ctx context.Context, r *Resolver, orders []*models.Order) ([]*models.User, []error) {
+	users := make([]*models.User, len(orders))
+	errs := make([]error, len(orders))
+	var wg sync.WaitGroup
+	for i, order := range orders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			users[i], errs[i] = r.Order().User(ctx, order)
+		}()
+	}
+	wg.Wait()
+	return users, errs
+}
+
+func TestLoaderBatchesUserLookups(t *testing.T) {
+	users := newFakeUserRepository()
+	var orders []*models.Order
+	for i := range 20 {
+		id := strconv.Itoa(i % 5)
+		users.users[id] = &models.User{ID: id}
+		orders = append(orders, &models.Order{ID: strconv.Itoa(i), UserID: id})
+	}
+	r := newTestResolver("http://okta.invalid", users)
+	ctx := withLoaders(context.Background(), users, &fakeReviewRepository{}, &fakeProductImageRepository{}, &fakeOrderRepository{}, &fakeFlashSaleRepository{})
+
+	got, errs := resolveOrderUsers(ctx, r, orders)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("order %d: User returned error: %v", i, err)
+		}
+		if got[i].ID != orders[i].UserID {
+			t.Fatalf("order %d: got user %s, want %s", i, got[i].ID, orders[i].UserID)
+		}
+	}
+	if users.batchLoads != 1 {
+		t.Fatalf("expected 1 batched lookup for %d orders, got %d", len(orders), users.batchLoads)
+	}
+
+	// Already-loaded users are served from the request's cache.
+	if _, err := r.Order().User(ctx, orders[0]); err != nil || users.batchLoads != 1 {
+		t.Fatalf("expected a cached lookup, got err %v after %d loads", err, users.batchLoads)
+	}
+}
+
+func TestLoaderMissingUser(t *testing.T) {
+	users := newFakeUserRepository()
+	ctx := withLoaders(context.Background(), users, &fakeReviewRepository{}, &fakeProductImageRepository{}, &fakeOrderRepository{}, &fakeFlashSaleRepository{})
+
+	l := ctx.Value(loaderKey{}).(*loaders)
+	if _, err := l.users.Load(ctx, "404"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestOrderUserDeleted(t *testing.T) {
+	deletedAt := time.Now()
+	users := newFakeUserRepository(&models.User{ID: "42", DeletedAt: &deletedAt})
+	r := newTestResolver("http://okta.invalid", users)
+	ctx := withLoaders(context.Background(), users, &fakeReviewRepository{}, &fakeProductImageRepository{}, &fakeOrderRepository{}, &fakeFlashSaleRepository{})
+
+	user, err := r.Order().User(ctx, &models.Order{ID: "1", UserID: "42"})
+	if err != nil || user.ID != "42" {
+		t.Fatalf("expected the deleted user 42, got %+v, %v", user, err)
+	}
+
+	_, err = r.Order().User(ctx, &models.Order{ID: "2", UserID: "404"})
+	if !errors.Is(err, models.ErrNotFound) || errors.Is(err, ErrDatabase) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	users.err = errors.New("connection refused")
+	if _, err := r.Order().User(context.Background(), &models.Order{ID: "3", UserID: "43"}); !errors.Is(err, ErrDatabase) {
+		t.Fatalf("expected ErrDatabase, got %v", err)
+	}
+}
+
+func TestLoaderBatchesAverageRatings(t *testing.T) {
+	products := &fakeProductRepository{}
+	for i := range 10 {
+		products.products = append(products.products, &models.Product{ID: strconv.Itoa(i)})
+	}
+	reviews := &fakeReviewRepository{products: products}
+	for i := range 5 {
+		reviews.reviews = append(reviews.reviews, &models.Review{ProductID: strconv.Itoa(i), Rating: i + 1})
+	}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Reviews = reviews
+	ctx := withLoaders(context.Background(), r.Users, reviews, &fakeProductImageRepository{}, &fakeOrderRepository{}, &fakeFlashSaleRepository{})
+
+	ratings := make([]*float64, len(products.products))
+	errs := make([]error, len(products.products))
+	var wg sync.WaitGroup
+	for i, product := range products.products {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ratings[i], errs[i] = r.Product().AverageRating(ctx, product)
+		}()
+	}
+	wg.Wait()
+	for i := range products.products {
+		if errs[i] != nil {
+			t.Fatalf("product %d: AverageRating returned error: %v", i, errs[i])
+		}
+		if i < 5 && (ratings[i] == nil || *ratings[i] != float64(i+1)) {
+			t.Fatalf("product %d: expected a rating of %d, got %v", i, i+1, ratings[i])
+		}
+		if i >= 5 && ratings[i] != nil {
+			t.Fatalf("product %d: expected no rating, got %v", i, *ratings[i])
+		}
+	}
+	if reviews.averageLoads != 1 {
+		t.Fatalf("expected 1 batched lookup for %d products, got %d", len(products.products), reviews.averageLoads)
+	}
+}
+
+func TestLoaderBatchesProductImages(t *testing.T) {
+	products := &fakeProductRepository{}
+	for i := range 10 {
+		products.products = append(products.products, &models.Product{ID: strconv.Itoa(i)})
+	}
+	images := &fakeProductImageRepository{products: products}
+	for i := range 5 {
+		for range i + 1 {
+			if err := images.Add(context.Background(), &models.ProductImage{ProductID: strconv.Itoa(i), URL: "https://cdn.example.com/" + strconv.Itoa(i) + ".png"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.ProductImages = images
+	ctx := withLoaders(context.Background(), r.Users, &fakeReviewRepository{}, images, &fakeOrderRepository{}, &fakeFlashSaleRepository{})
+
+	got := make([][]*models.ProductImage, len(products.products))
+	errs := make([]error, len(products.products))
+	var wg sync.WaitGroup
+	for i, product := range products.products {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i], errs[i] = r.Product().Images(ctx, product)
+		}()
+	}
+	wg.Wait()
+	for i := range products.products {
+		if errs[i] != nil {
+			t.Fatalf("product %d: Images returned error: %v", i, errs[i])
+		}
+		want := 0
+		if i < 5 {
+			want = i + 1
+		}
+		if got[i] == nil || len(got[i]) != want {
+			t.Fatalf("product %d: expected %d images, got %v", i, want, got[i])
+		}
+	}
+	if images.batchLoads != 1 {
+		t.Fatalf("expected 1 batched lookup for %d products, got %d", len(products.products), images.batchLoads)
+	}
+}
+
+func TestLoaderBatchesCustomerStats(t *testing.T) {
+	users := newFakeUserRepository()
+	orders := &fakeOrderRepository{}
+	for i := range 10 {
+		id := strconv.Itoa(100 + i)
+		users.users[id] = &models.User{ID: id}
+		// Only delivered orders count.
+		for _, status := range []models.OrderStatus{models.OrderStatusDelivered, models.OrderStatusDelivered, models.OrderStatusCancelled} {
+			if i < 5 {
+				orders.orders = append(orders.orders, &models.Order{ID: strconv.Itoa(len(orders.orders) + 1), UserID: id, Status: status, TotalCents: 1000})
+			}
+		}
+	}
+	r := newTestResolver("http://okta.invalid", users)
+	r.Orders = orders
+	r.Admins = map[string]bool{"1": true}
+	ctx := withLoaders(asUser("1"), users, &fakeReviewRepository{}, &fakeProductImageRepository{}, orders, &fakeFlashSaleRepository{})
+
+	counts := make([]int, 10)
+	values := make([]int, 10)
+	errs := make([]error, 10)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := users.users[strconv.Itoa(100+i)]
+			counts[i], errs[i] = r.User().OrderCount(ctx, user)
+			if errs[i] == nil {
+				values[i], errs[i] = r.User().LifetimeValueCents(ctx, user)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range 10 {
+		if errs[i] != nil {
+			t.Fatalf("user %d: returned error: %v", i, errs[i])
+		}
+		wantCount, wantValue := 0, 0
+		if i < 5 {
+			wantCount, wantValue = 2, 2000
+		}
+		if counts[i] != wantCount || values[i] != wantValue {
+			t.Fatalf("user %d: expected %d orders worth %d, got %d worth %d", i, wantCount, wantValue, counts[i], values[i])
+		}
+	}
+	if orders.statsLoads != 1 {
+		t.Fatalf("expected 1 batched lookup for 10 users, got %d", orders.statsLoads)
+	}
+
+	// Customers see their own stats but nobody else's.
+	if count, err := r.User().OrderCount(asUser("100"), users.users["100"]); err != nil || count != 2 {
+		t.Fatalf("expected the user to see their own 2 orders, got %d, %v", count, err)
+	}
+	if _, err := r.User().OrderCount(asUser("100"), users.users["101"]); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden for another user's stats, got %v", err)
+	}
+	if _, err := r.User().LifetimeValueCents(context.Background(), users.users["100"]); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+}
+
+func BenchmarkOrderUsers(b *testing.B) {
+	users := newFakeUserRepository()
+	var orders []*models.Order
+	for i := range 100 {
+		id := strconv.Itoa(i)
+		users.users[id] = &models.User{ID: id}
+		orders = append(orders, &models.Order{ID: id, UserID: id})
+	}
+	r := newTestResolver("http://okta.invalid", users)
+
+	for i := 0; i < b.N; i++ {
+		resolveOrderUsers(withLoaders(context.Background(), users, &fakeReviewRepository{}, &fakeProductImageRepository{}, &fakeOrderRepository{}, &fakeFlashSaleRepository{}), r, orders)
+	}
+	b.ReportMetric(float64(users.batchLoads)/float64(b.N), "queries/op")
+}
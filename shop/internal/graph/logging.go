@@ -0,0 +1,49 @@
+package graph
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+)
+
+// OperationLogger returns an operation middleware that logs each GraphQL operation at debug
+// level, and operations that return errors at error level, tagged with the request ID.
+func OperationLogger(logger *slog.Logger) graphql.OperationMiddleware {
+	return func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		ctx, requestID := logging.EnsureRequestID(ctx)
+		oc := graphql.GetOperationContext(ctx)
+		opLogger := logger.With(
+			slog.String(logging.RequestIDKey, requestID),
+			slog.String("operation", oc.OperationName),
+		)
+		start := time.Now()
+		opLogger.DebugContext(ctx, "graphql operation started")
+
+		handler := next(ctx)
+		return func(ctx context.Context) *graphql.Response {
+			resp := handler(ctx)
+			if resp != nil && len(resp.Errors) > 0 {
+				opLogger.ErrorContext(ctx, "graphql operation failed",
+					slog.String("errors", resp.Errors.Error()),
+					slog.Duration("duration", time.Since(start)),
+				)
+			} else {
+				opLogger.DebugContext(ctx, "graphql operation completed", slog.Duration("duration", time.Since(start)))
+			}
+			return resp
+		}
+	}
+}
+
+// logger returns the resolver's logger tagged with the request ID, falling back to slog.Default().
+func (r *Resolver) logger(ctx context.Context) *slog.Logger {
+	logger := r.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With(slog.String(logging.RequestIDKey, logging.RequestID(ctx)))
+}
@@ -0,0 +1,60 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/ShoppingDem/backend/shop/internal/metrics"
+)
+
+// anonymousOperation is the operation label of operations without a name.
+const anonymousOperation = "anonymous"
+
+// Metrics is a gqlgen extension that records the duration and status of each GraphQL
+// operation in metrics.GraphQLOperationDuration.
+type Metrics struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = Metrics{}
+
+// ExtensionName implements graphql.HandlerExtension.
+func (Metrics) ExtensionName() string {
+	return "Metrics"
+}
+
+// Validate implements graphql.HandlerExtension.
+func (Metrics) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptOperation implements graphql.OperationInterceptor.
+func (Metrics) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	operation := operationName(graphql.GetOperationContext(ctx))
+	start := time.Now()
+
+	handler := next(ctx)
+	return func(ctx context.Context) *graphql.Response {
+		resp := handler(ctx)
+		status := metrics.StatusOK
+		if resp != nil && len(resp.Errors) > 0 {
+			status = metrics.StatusError
+		}
+		metrics.GraphQLOperationDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+		return resp
+	}
+}
+
+// operationName returns the name of the operation being run, or anonymousOperation.
+func operationName(oc *graphql.OperationContext) string {
+	if oc.OperationName != "" {
+		return oc.OperationName
+	}
+	if oc.Operation != nil && oc.Operation.Name != "" {
+		return oc.Operation.Name
+	}
+	return anonymousOperation
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+
+	"github.com/ShoppingDem/backend/shop/internal/metrics"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// scrape fetches the metrics endpoint and returns the value of the given series, or 0 if
+// it isn't exported yet.
+func scrape(t *testing.T, series string) float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 from /metrics, got %d", rec.Code)
+	}
+
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == series {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("invalid value for %s: %v", series, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	okta := newOktaServer(t, new(int))
+	users := newFakeUserRepository(&models.User{ID: "42", Email: "john.doe@example.com", OktaID: "00u1"})
+	r := newTestResolver(okta.URL, users)
+	r.Auth.MaxRetries = 0
+	r.Products = &fakeProductRepository{products: []*models.Product{{ID: "1", Name: "Tote bag"}}}
+	srv := handler.New(NewExecutableSchema(NewConfig(r)))
+	srv.AddTransport(transport.POST{})
+	srv.Use(Metrics{})
+
+	query := func(q string) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"query": q})
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	const (
+		listOK      = `shop_graphql_operation_duration_seconds_count{operation="ListProducts",status="ok"}`
+		anonymousOK = `shop_graphql_operation_duration_seconds_count{operation="anonymous",status="ok"}`
+		signInError = `shop_graphql_operation_duration_seconds_count{operation="SignIn",status="error"}`
+		okta401     = `shop_okta_request_duration_seconds_count{method="POST",status="401"}`
+	)
+	before := map[string]float64{}
+	for _, series := range []string{listOK, anonymousOK, signInError, okta401} {
+		before[series] = scrape(t, series)
+	}
+
+	query(`query ListProducts { products { id } }`)
+	query(`query ListProducts { products { id } }`)
+	query(`{ products { id } }`)
+	query(`mutation SignIn { login(input: {identifier: "john.doe@example.com", password: "wrong"}) }`)
+
+	for series, want := range map[string]float64{listOK: 2, anonymousOK: 1, signInError: 1, okta401: 1} {
+		if got := scrape(t, series) - before[series]; got != want {
+			t.Errorf("%s: expected increment of %v, got %v", series, want, got)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package graph
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// embeddedPersistedQueries is the manifest used when PERSISTED_QUERIES_FILE isn't set.
+//
+//go:embed persisted_queries.json
+var embeddedPersistedQueries []byte
+
+// LoadPersistedQueries reads a persisted query manifest: a JSON object mapping the hex
+// SHA-256 hash of each query to the query. It reads the file at path, or the embedded
+// manifest if path is empty, and fails if a hash isn't the hash of its query.
+func LoadPersistedQueries(path string) (map[string]string, error) {
+	data := embeddedPersistedQueries
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var queries map[string]string
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("invalid persisted query manifest: %w", err)
+	}
+	for hash, query := range queries {
+		sum := sha256.Sum256([]byte(query))
+		if hex.EncodeToString(sum[:]) != hash {
+			return nil, fmt.Errorf("persisted query %s doesn't match its hash", hash)
+		}
+	}
+	return queries, nil
+}
+
+// PersistedQueries is a gqlgen extension that serves the queries of a manifest by the hash
+// sent in extensions.persistedQuery.sha256Hash, as with automatic persisted queries. With
+// Only set it also rejects every other operation, ad-hoc queries included, with a
+// PERSISTED_QUERY_NOT_ALLOWED error, so production only runs queries the clients shipped
+// with. It must be added before extension.AutomaticPersistedQuery.
+type PersistedQueries struct {
+	Queries map[string]string
+	Only    bool
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = PersistedQueries{}
+
+// ExtensionName implements graphql.HandlerExtension.
+func (PersistedQueries) ExtensionName() string {
+	return "PersistedQueries"
+}
+
+// Validate implements graphql.HandlerExtension.
+func (PersistedQueries) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationParameters implements graphql.OperationParameterMutator.
+func (p PersistedQueries) MutateOperationParameters(ctx context.Context, params *graphql.RawParams) *gqlerror.Error {
+	if query, ok := p.Queries[persistedQueryHash(params)]; ok {
+		params.Query = query
+		return nil
+	}
+	if !p.Only {
+		return nil
+	}
+	return &gqlerror.Error{
+		Message:    "only persisted queries are allowed",
+		Extensions: map[string]any{"code": CodePersistedQueryNotAllowed},
+	}
+}
+
+// persistedQueryHash returns the hash in extensions.persistedQuery.sha256Hash, or an empty
+// string if the request has none.
+func persistedQueryHash(params *graphql.RawParams) string {
+	persisted, _ := params.Extensions["persistedQuery"].(map[string]any)
+	hash, _ := persisted["sha256Hash"].(string)
+	return hash
+}
@@ -0,0 +1,125 @@
+package graph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestPersistedQueries(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "7", Name: "Mug", PriceCents: 899}}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products = products
+
+	registered := `{ product(id: "7") { name } }`
+	adHoc := `{ product(id: "7") { priceCents } }`
+	queries := map[string]string{queryHash(registered): registered}
+
+	// post sends body to a server that allows only persisted queries if only is set, and
+	// returns the error code, or an empty string if it succeeded.
+	post := func(only bool, body map[string]any) string {
+		t.Helper()
+		srv := handler.New(NewExecutableSchema(NewConfig(r)))
+		srv.AddTransport(transport.POST{})
+		srv.Use(PersistedQueries{Queries: queries, Only: only})
+		srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New[string](100)})
+		srv.SetErrorPresenter(ErrorPresenter(slog.Default(), false))
+
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		var resp struct {
+			Data   map[string]any `json:"data"`
+			Errors []struct {
+				Extensions map[string]any `json:"extensions"`
+			} `json:"errors"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+		}
+		if len(resp.Errors) == 0 {
+			if resp.Data["product"] == nil {
+				t.Fatalf("expected the product, got %s", rec.Body.String())
+			}
+			return ""
+		}
+		code, _ := resp.Errors[0].Extensions["code"].(string)
+		return code
+	}
+	persisted := func(hash string) map[string]any {
+		return map[string]any{"extensions": map[string]any{
+			"persistedQuery": map[string]any{"version": 1, "sha256Hash": hash},
+		}}
+	}
+
+	for name, tc := range map[string]struct {
+		only bool
+		body map[string]any
+		want string
+	}{
+		"registered hash":                  {true, persisted(queryHash(registered)), ""},
+		"ad-hoc query":                     {true, map[string]any{"query": adHoc}, CodePersistedQueryNotAllowed},
+		"unregistered hash":                {true, persisted(queryHash(adHoc)), CodePersistedQueryNotAllowed},
+		"registered hash in dev mode":      {false, persisted(queryHash(registered)), ""},
+		"ad-hoc query in dev mode":         {false, map[string]any{"query": adHoc}, ""},
+		"automatic persisted query in dev": {false, map[string]any{"query": adHoc, "extensions": persisted(queryHash(adHoc))["extensions"]}, ""},
+	} {
+		if got := post(tc.only, tc.body); got != tc.want {
+			t.Errorf("%s: expected code %q, got %q", name, tc.want, got)
+		}
+	}
+}
+
+func TestLoadPersistedQueries(t *testing.T) {
+	if _, err := LoadPersistedQueries(""); err != nil {
+		t.Fatalf("failed to load the embedded manifest: %v", err)
+	}
+
+	query := `{ categories { slug } }`
+	write := func(manifest map[string]string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "queries.json")
+		data, _ := json.Marshal(manifest)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	queries, err := LoadPersistedQueries(write(map[string]string{queryHash(query): query}))
+	if err != nil {
+		t.Fatalf("LoadPersistedQueries returned error: %v", err)
+	}
+	if queries[queryHash(query)] != query {
+		t.Fatalf("expected the query by its hash, got %v", queries)
+	}
+
+	if _, err := LoadPersistedQueries(write(map[string]string{queryHash("{ cart { subtotalCents } }"): query})); err == nil {
+		t.Fatal("expected a query that doesn't match its hash to be rejected")
+	}
+	if _, err := LoadPersistedQueries(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("expected a missing file to be an error")
+	}
+}
@@ -0,0 +1,139 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"github.com/ShoppingDem/backend/shop/internal/auth"
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/internal/signup"
+	"github.com/ShoppingDem/backend/shop/internal/validate"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// Error codes set in the "code" extension of errors returned to clients.
+const (
+	CodeUnauthenticated = "UNAUTHENTICATED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeValidation      = "VALIDATION"
+	CodeConflict        = "CONFLICT"
+	CodeRateLimited     = "RATE_LIMITED"
+	CodeAccountLocked   = "ACCOUNT_LOCKED"
+	CodeInternal        = "INTERNAL"
+
+	// CodeUpstreamUnavailable reports that the identity or payment provider failed, as
+	// opposed to an INTERNAL failure of the API itself, such as a database error.
+	CodeUpstreamUnavailable = "UPSTREAM_UNAVAILABLE"
+
+	// CodePersistedQueryNotAllowed rejects operations that aren't in the persisted query
+	// manifest when only persisted queries are allowed.
+	CodePersistedQueryNotAllowed = "PERSISTED_QUERY_NOT_ALLOWED"
+)
+
+// internalErrorMessage replaces the message of INTERNAL errors when details are hidden.
+const internalErrorMessage = "internal server error"
+
+// ErrorPresenter returns an error presenter that sets extensions.code on resolver errors
+// according to the sentinel or typed error they wrap, extensions.field on a FieldError, and
+// extensions.fields on a ValidationError.
+// Okta rejecting a profile is a VALIDATION or CONFLICT error like any other; other Okta and
+// payment provider failures are UPSTREAM_UNAVAILABLE. Errors that match no known error are
+// INTERNAL. Upstream and internal errors are logged with the request ID and, unless
+// exposeInternal is set, their message is replaced so SQL and provider details don't reach
+// clients.
+//
+// Errors raised by gqlgen itself, such as parse or complexity errors, are passed through as-is.
+//
+// Parameters:
+//   - logger: The logger for internal errors.
+//   - exposeInternal: Whether to return internal error messages to clients (for development).
+//
+// Returns:
+//   - An error presenter for handler.Server.SetErrorPresenter.
+func ErrorPresenter(logger *slog.Logger, exposeInternal bool) graphql.ErrorPresenterFunc {
+	return func(ctx context.Context, err error) *gqlerror.Error {
+		gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+		if gqlErr.Err == nil {
+			return gqlErr
+		}
+
+		code := errorCode(err)
+		if code == CodeInternal || code == CodeUpstreamUnavailable {
+			msg := "graphql internal error"
+			if code == CodeUpstreamUnavailable {
+				msg = "graphql upstream error"
+			}
+			logger.ErrorContext(ctx, msg,
+				slog.String(logging.RequestIDKey, logging.RequestID(ctx)),
+				slog.String("path", gqlErr.Path.String()),
+				slog.Any("error", err),
+			)
+			if !exposeInternal {
+				gqlErr.Message = hiddenMessage(err)
+			}
+		}
+		if gqlErr.Extensions == nil {
+			gqlErr.Extensions = map[string]any{}
+		}
+		gqlErr.Extensions["code"] = code
+		var fieldErr *FieldError
+		if errors.As(err, &fieldErr) {
+			gqlErr.Extensions["field"] = fieldErr.Field
+		}
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			fields := make([]map[string]any, len(validationErr.Fields))
+			for i, f := range validationErr.Fields {
+				fields[i] = map[string]any{"field": f.Field, "message": f.Err.Error()}
+			}
+			gqlErr.Extensions["fields"] = fields
+		}
+		return gqlErr
+	}
+}
+
+// errorCode maps err to the code reported to clients.
+func errorCode(err error) string {
+	var insufficient *models.InsufficientStockError
+	switch {
+	case errors.Is(err, ErrUnauthenticated), errors.Is(err, auth.ErrInvalidRecoveryToken):
+		return CodeUnauthenticated
+	case errors.Is(err, ErrForbidden):
+		return CodeForbidden
+	case errors.Is(err, auth.ErrAccountLocked):
+		return CodeAccountLocked
+	case errors.Is(err, signup.ErrTooManyRegistrations), errors.Is(err, signup.ErrTooManyLookups):
+		return CodeRateLimited
+	case errors.Is(err, models.ErrNotFound), errors.Is(err, models.ErrNotInCart), errors.Is(err, models.ErrNotSaved):
+		return CodeNotFound
+	case errors.As(err, &insufficient), errors.Is(err, models.ErrPurchaseLimit), errors.Is(err, models.ErrDuplicateSKU), errors.Is(err, auth.ErrLoginTaken),
+		errors.Is(err, models.ErrExceedsStock), errors.Is(err, models.ErrEmptyCart),
+		errors.Is(err, models.ErrConcurrentModification), errors.Is(err, models.ErrAlreadyReviewed),
+		errors.Is(err, models.ErrOrderNotCancellable), errors.Is(err, models.ErrOrderNotShippable),
+		errors.Is(err, models.ErrDeliveryNotDead):
+		return CodeConflict
+	case errors.Is(err, ErrInvalidArgument), errors.Is(err, auth.ErrWeakPassword), errors.Is(err, auth.ErrWrongPassword),
+		errors.Is(err, validate.ErrInvalidEmail), errors.Is(err, validate.ErrInvalidPhone), errors.Is(err, auth.ErrInvalidProfile):
+		return CodeValidation
+	case errors.Is(err, ErrOkta), errors.Is(err, ErrPayment):
+		return CodeUpstreamUnavailable
+	}
+	return CodeInternal
+}
+
+// hiddenMessage returns the message sent to clients in place of an upstream or internal
+// error's: the provider that failed, or internalErrorMessage.
+func hiddenMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrOkta):
+		return ErrOkta.Error()
+	case errors.Is(err, ErrPayment):
+		return ErrPayment.Error()
+	}
+	return internalErrorMessage
+}
@@ -0,0 +1,145 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"github.com/ShoppingDem/backend/shop/internal/auth"
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/internal/signup"
+	"github.com/ShoppingDem/backend/shop/internal/validate"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestErrorPresenter(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	present := ErrorPresenter(logger, false)
+	ctx := logging.WithRequestID(context.Background(), "req-123")
+
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{ErrUnauthenticated, CodeUnauthenticated},
+		{auth.ErrInvalidRecoveryToken, CodeUnauthenticated},
+		{ErrForbidden, CodeForbidden},
+		{auth.ErrAccountLocked, CodeAccountLocked},
+		{fmt.Errorf("product 7: %w", models.ErrNotFound), CodeNotFound},
+		{fmt.Errorf("product 7: %w", models.ErrNotInCart), CodeNotFound},
+		{fmt.Errorf("%w: qty must be at least 1", ErrInvalidArgument), CodeValidation},
+		{fmt.Errorf("%w: %w", ErrInvalidArgument, auth.ErrWeakPassword), CodeValidation},
+		{auth.ErrWrongPassword, CodeValidation},
+		{validate.ErrInvalidPhone, CodeValidation},
+		{&models.InsufficientStockError{ProductIDs: []string{"7"}}, CodeConflict},
+		{fmt.Errorf("sku %q: %w", "MUG-1", models.ErrDuplicateSKU), CodeConflict},
+		{models.ErrEmptyCart, CodeConflict},
+		{models.ErrConcurrentModification, CodeConflict},
+		{fmt.Errorf("product 7: %w", models.ErrAlreadyReviewed), CodeConflict},
+		{fmt.Errorf("order 100: %w", models.ErrOrderNotCancellable), CodeConflict},
+		{fmt.Errorf("webhook delivery 3: %w", models.ErrDeliveryNotDead), CodeConflict},
+		{signup.ErrTooManyRegistrations, CodeRateLimited},
+		{signup.ErrTooManyLookups, CodeRateLimited},
+		{fmt.Errorf("%w: %w", ErrOkta, &auth.OktaError{StatusCode: 400, Code: "E0000001", Summary: "Api validation failed: login",
+			Causes: []string{"login: An object with this field already exists in the current organization"}}), CodeConflict},
+		{fmt.Errorf("%w: %w", ErrOkta, &auth.OktaError{StatusCode: 400, Code: "E0000001", Summary: "Api validation failed: mobilePhone",
+			Causes: []string{"mobilePhone: Does not match required pattern"}}), CodeValidation},
+	}
+	for _, tt := range tests {
+		gqlErr := present(ctx, tt.err)
+		if got := gqlErr.Extensions["code"]; got != tt.code {
+			t.Errorf("%v: got code %v, want %s", tt.err, got, tt.code)
+		}
+		if gqlErr.Message != tt.err.Error() {
+			t.Errorf("%v: expected message to be kept, got %q", tt.err, gqlErr.Message)
+		}
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("expected client errors not to be logged, got %s", logs.String())
+	}
+
+	t.Run("field errors name the field", func(t *testing.T) {
+		gqlErr := present(ctx, &FieldError{Field: "input.identifier", Err: errors.New("must be provided")})
+		if gqlErr.Extensions["code"] != CodeValidation || gqlErr.Extensions["field"] != "input.identifier" {
+			t.Fatalf("expected a VALIDATION error for input.identifier, got %v", gqlErr.Extensions)
+		}
+	})
+
+	t.Run("validation errors list every field", func(t *testing.T) {
+		var invalid ValidationError
+		invalid.add("input.email", errors.New("invalid email address"))
+		invalid.add("input.phoneNumber", errors.New("invalid phone number"))
+		gqlErr := present(ctx, invalid.err())
+		fields, _ := gqlErr.Extensions["fields"].([]map[string]any)
+		if gqlErr.Extensions["code"] != CodeValidation || len(fields) != 2 {
+			t.Fatalf("expected a VALIDATION error with two fields, got %v", gqlErr.Extensions)
+		}
+		if fields[1]["field"] != "input.phoneNumber" || fields[1]["message"] != "invalid phone number" {
+			t.Fatalf("unexpected field %v", fields[1])
+		}
+	})
+
+	t.Run("internal details are hidden", func(t *testing.T) {
+		for _, err := range []error{
+			fmt.Errorf("%w: pq: relation \"orders\" does not exist", ErrDatabase),
+			errors.New("something unexpected"),
+		} {
+			logs.Reset()
+			gqlErr := present(ctx, err)
+			if gqlErr.Extensions["code"] != CodeInternal || gqlErr.Message != internalErrorMessage {
+				t.Fatalf("%v: expected sanitized INTERNAL error, got %q (%v)", err, gqlErr.Message, gqlErr.Extensions)
+			}
+			out := logs.String()
+			for _, want := range []string{`"level":"ERROR"`, `"request_id":"req-123"`, err.Error()[:10]} {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected log output to contain %s, got %s", want, out)
+				}
+			}
+		}
+	})
+
+	t.Run("upstream failures are told apart from internal ones", func(t *testing.T) {
+		for _, tt := range []struct {
+			err     error
+			message string
+		}{
+			{fmt.Errorf("%w: %w", ErrOkta, &auth.OktaError{StatusCode: 500, Code: "E0000009", Summary: "Internal Server Error"}), ErrOkta.Error()},
+			{fmt.Errorf("%w: request timed out: context deadline exceeded", ErrOkta), ErrOkta.Error()},
+			{fmt.Errorf("%w: stripe: api_connection_error", ErrPayment), ErrPayment.Error()},
+		} {
+			logs.Reset()
+			gqlErr := present(ctx, tt.err)
+			if gqlErr.Extensions["code"] != CodeUpstreamUnavailable || gqlErr.Message != tt.message {
+				t.Fatalf("%v: expected sanitized UPSTREAM_UNAVAILABLE error, got %q (%v)", tt.err, gqlErr.Message, gqlErr.Extensions)
+			}
+			if out := logs.String(); !strings.Contains(out, `"level":"ERROR"`) || !strings.Contains(out, `"request_id":"req-123"`) {
+				t.Errorf("expected the upstream error to be logged, got %s", out)
+			}
+		}
+	})
+
+	t.Run("internal details exposed in development", func(t *testing.T) {
+		err := fmt.Errorf("%w: connection reset", ErrDatabase)
+		gqlErr := ErrorPresenter(logger, true)(ctx, err)
+		if gqlErr.Extensions["code"] != CodeInternal || gqlErr.Message != err.Error() {
+			t.Fatalf("expected unsanitized INTERNAL error, got %q (%v)", gqlErr.Message, gqlErr.Extensions)
+		}
+	})
+
+	t.Run("gqlgen errors pass through", func(t *testing.T) {
+		orig := &gqlerror.Error{Message: "operation has complexity 300, which exceeds the limit of 200", Extensions: map[string]any{"code": "COMPLEXITY_LIMIT_EXCEEDED"}}
+		gqlErr := present(ctx, orig)
+		if gqlErr.Extensions["code"] != "COMPLEXITY_LIMIT_EXCEEDED" || gqlErr.Message != orig.Message {
+			t.Fatalf("expected gqlgen error to be unchanged, got %q (%v)", gqlErr.Message, gqlErr.Extensions)
+		}
+	})
+}
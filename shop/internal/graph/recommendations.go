@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const (
+	// defaultRecommendations is how many products frequentlyBoughtTogether returns when no
+	// limit is asked for.
+	defaultRecommendations = 5
+
+	// maxRecommendations is the most products frequentlyBoughtTogether returns.
+	maxRecommendations = 20
+)
+
+// RecommendationCache keeps frequentlyBoughtTogether results, which scan every delivered order
+// containing the product, for a while instead of computing them on every request. Cached
+// results can be up to the TTL old, so a product that sold out since may still be listed. It's
+// safe for concurrent use.
+type RecommendationCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[recommendationKey]recommendationEntry
+}
+
+// recommendationKey identifies a frequentlyBoughtTogether result.
+type recommendationKey struct {
+	productID string
+	limit     int
+}
+
+// recommendationEntry is a cached frequentlyBoughtTogether result.
+type recommendationEntry struct {
+	products  []*models.Product
+	expiresAt time.Time
+}
+
+// NewRecommendationCache creates a RecommendationCache.
+//
+// Parameters:
+//   - ttl: How long a result is served from the cache after it was computed.
+//
+// Returns:
+//   - An empty RecommendationCache.
+func NewRecommendationCache(ttl time.Duration) *RecommendationCache {
+	return &RecommendationCache{ttl: ttl, entries: map[recommendationKey]recommendationEntry{}}
+}
+
+// get returns the result cached for key unless it expired by now. A nil cache caches nothing.
+func (c *RecommendationCache) get(key recommendationKey, now time.Time) ([]*models.Product, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.products, true
+}
+
+// put caches the result for key, computed at now, and drops the results that have expired so
+// the cache only grows with the products recently asked about.
+func (c *RecommendationCache) put(key recommendationKey, products []*models.Product, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = recommendationEntry{products: products, expiresAt: now.Add(c.ttl)}
+}
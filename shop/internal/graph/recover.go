@@ -0,0 +1,39 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+)
+
+// RecoverFunc returns a recover function that logs a resolver panic, with its value, type and
+// stack trace, and reports a generic INTERNAL error to the client in its place.
+//
+// Parameters:
+//   - logger: The logger for recovered panics.
+//
+// Returns:
+//   - A recover function for handler.Server.SetRecoverFunc.
+func RecoverFunc(logger *slog.Logger) graphql.RecoverFunc {
+	return func(ctx context.Context, p any) error {
+		// A runtime.Error (nil dereference, index out of range...) is logged through its
+		// Error method, so the details stay in the logs.
+		logger.ErrorContext(ctx, "graphql resolver panic",
+			slog.String(logging.RequestIDKey, logging.RequestID(ctx)),
+			slog.String("path", graphql.GetPath(ctx).String()),
+			slog.String("panic", fmt.Sprint(p)),
+			slog.String("panic_type", fmt.Sprintf("%T", p)),
+			slog.String("stack", string(debug.Stack())),
+		)
+		return &gqlerror.Error{
+			Message:    internalErrorMessage,
+			Extensions: map[string]any{"code": CodeInternal},
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// panickingProductRepository dereferences a nil product when listed.
+type panickingProductRepository struct {
+	fakeProductRepository
+}
+
+func (p *panickingProductRepository) List(ctx context.Context, sort models.ProductSort, page models.PageArgs) (*models.PageResult[*models.Product], error) {
+	var product *models.Product
+	return &models.PageResult[*models.Product]{Items: []*models.Product{{ID: product.ID}}}, nil
+}
+
+func TestRecoverFunc(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products = &panickingProductRepository{}
+	srv := handler.New(NewExecutableSchema(NewConfig(r)))
+	srv.AddTransport(transport.POST{})
+	srv.SetErrorPresenter(ErrorPresenter(logger, false))
+	srv.SetRecoverFunc(RecoverFunc(logger))
+
+	body, _ := json.Marshal(map[string]string{"query": `{ products { id } }`})
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-123"))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	var resp struct {
+		Errors []struct {
+			Message    string         `json:"message"`
+			Extensions map[string]any `json:"extensions"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+	if len(resp.Errors) != 1 {
+		t.Fatalf("expected one error, got %s", rec.Body.String())
+	}
+	if resp.Errors[0].Message != internalErrorMessage || resp.Errors[0].Extensions["code"] != CodeInternal {
+		t.Fatalf("expected sanitized INTERNAL error, got %s", rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "nil pointer") {
+		t.Fatalf("expected panic details to stay out of the response, got %s", rec.Body.String())
+	}
+
+	out := logs.String()
+	for _, want := range []string{
+		`"msg":"graphql resolver panic"`,
+		`"request_id":"req-123"`,
+		"runtime error: invalid memory address or nil pointer dereference",
+		`"panic_type":"runtime.`,
+		"goroutine",
+		"panickingProductRepository",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log output to contain %s, got %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,4542 @@
+package graph
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+
+	"github.com/ShoppingDem/backend/shop/internal/auth"
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/internal/inventory"
+	"github.com/ShoppingDem/backend/shop/internal/middleware"
+	"github.com/ShoppingDem/backend/shop/internal/orders"
+	"github.com/ShoppingDem/backend/shop/internal/roles"
+	"github.com/ShoppingDem/backend/shop/internal/signup"
+	"github.com/ShoppingDem/backend/shop/internal/token"
+	"github.com/ShoppingDem/backend/shop/internal/validate"
+	"github.com/ShoppingDem/backend/shop/internal/webhook"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// fakeUserRepository is an in-memory models.UserRepository. When err is set every call fails with it.
+type fakeUserRepository struct {
+	users      map[string]*models.User
+	batchLoads int // Number of GetByIDs calls.
+	err        error
+}
+
+func newFakeUserRepository(users ...*models.User) *fakeUserRepository {
+	repo := &fakeUserRepository{users: map[string]*models.User{}}
+	for _, u := range users {
+		repo.users[u.ID] = u
+	}
+	return repo
+}
+
+func (f *fakeUserRepository) Create(ctx context.Context, user *models.User) error {
+	if f.err != nil {
+		return f.err
+	}
+	user.ID = strconv.Itoa(len(f.users) + 1)
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	f.users[user.ID] = user
+	return nil
+}
+
+func (f *fakeUserRepository) Update(ctx context.Context, user *models.User) error {
+	if f.err != nil {
+		return f.err
+	}
+	old, ok := f.users[user.ID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	user.EmailVerified = old.EmailVerified && old.Email == user.Email
+	user.PhoneVerified = old.PhoneVerified && old.PhoneNumber == user.PhoneNumber
+	user.UpdatedAt = time.Now()
+	f.users[user.ID] = user
+	return nil
+}
+
+func (f *fakeUserRepository) Delete(ctx context.Context, id string) error {
+	if f.err != nil {
+		return f.err
+	}
+	if u, ok := f.users[id]; ok && u.DeletedAt == nil {
+		now := time.Now()
+		u.DeletedAt = &now
+	}
+	return nil
+}
+
+func (f *fakeUserRepository) Restore(ctx context.Context, id string) error {
+	if f.err != nil {
+		return f.err
+	}
+	u, ok := f.users[id]
+	if !ok || u.DeletedAt == nil {
+		return models.ErrNotFound
+	}
+	u.DeletedAt = nil
+	return nil
+}
+
+func (f *fakeUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	return f.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (f *fakeUserRepository) GetByIDIncludingDeleted(ctx context.Context, id string) (*models.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if u, ok := f.users[id]; ok {
+		return u, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeUserRepository) GetByIDs(ctx context.Context, ids []string) ([]*models.User, error) {
+	f.batchLoads++
+	if f.err != nil {
+		return nil, f.err
+	}
+	var users []*models.User
+	for _, id := range ids {
+		if u, ok := f.users[id]; ok && u.DeletedAt == nil {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return f.find(func(u *models.User) bool { return u.Email == email })
+}
+
+func (f *fakeUserRepository) GetByPhone(ctx context.Context, phone string) (*models.User, error) {
+	return f.find(func(u *models.User) bool { return u.PhoneNumber == phone })
+}
+
+func (f *fakeUserRepository) GetByOktaID(ctx context.Context, oktaID string) (*models.User, error) {
+	return f.find(func(u *models.User) bool { return u.OktaID == oktaID })
+}
+
+func (f *fakeUserRepository) SetStatusByOktaID(ctx context.Context, oktaID string, status models.UserStatus) error {
+	user, err := f.GetByOktaID(ctx, oktaID)
+	if err != nil {
+		return err
+	}
+	user.Status = status
+	return nil
+}
+
+func (f *fakeUserRepository) MarkVerified(ctx context.Context, id, contact string) error {
+	user, err := f.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.EmailVerified = user.EmailVerified || user.Email == contact
+	user.PhoneVerified = user.PhoneVerified || user.PhoneNumber == contact
+	return nil
+}
+
+func (f *fakeUserRepository) SetAvatarURL(ctx context.Context, id, url string) error {
+	user, err := f.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.AvatarURL = url
+	return nil
+}
+
+func (f *fakeUserRepository) SetRole(ctx context.Context, id string, role models.Role) error {
+	user, err := f.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.Role = role
+	return nil
+}
+
+func (f *fakeUserRepository) find(match func(*models.User) bool) (*models.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, u := range f.users {
+		if u.DeletedAt == nil && match(u) {
+			return u, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+// newOktaServer starts a fake Okta API that accepts registrations, authenticates the
+// password "correct-horse" and the SMS passcode "123456", has a user with the login
+// "okta.only@example.com", and counts user deactivations and deletions.
+func newOktaServer(t *testing.T, deletes *int) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE","profile":{"email":"john.doe@example.com"}}`))
+	})
+	mux.HandleFunc("POST /api/v1/authn", func(w http.ResponseWriter, r *http.Request) {
+		var req auth.AuthnRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		if req.Password == "locked-out" {
+			// Okta answers for a locked out user with a status rather than an error.
+			w.Write([]byte(`{"status":"LOCKED_OUT","_embedded":{"user":{"id":"00u1"}}}`))
+			return
+		}
+		if req.Password != "correct-horse" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errorCode":"E0000004","errorSummary":"Authentication failed"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"SUCCESS","sessionToken":"okta-session","_embedded":{"user":{"id":"00u1"}}}`))
+	})
+	mux.HandleFunc("GET /api/v1/users/00u1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE","profile":{"login":"john.doe@example.com","email":"john.doe@example.com","mobilePhone":"+15555550100"}}`))
+	})
+	mux.HandleFunc("GET /api/v1/users/00u1/factors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"id":"emf1","factorType":"email","provider":"OKTA","status":"ACTIVE"},{"id":"sms1","factorType":"sms","provider":"OKTA","status":"ACTIVE"}]`))
+	})
+	mux.HandleFunc("GET /api/v1/users/{login}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.PathValue("login") != "okta.only@example.com" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"E0000007","errorSummary":"Not found: Resource not found"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"00u2","status":"ACTIVE","profile":{"login":"okta.only@example.com","email":"okta.only@example.com"}}`))
+	})
+	mux.HandleFunc("GET /api/v1/users/00u1/groups", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"id":"00g1","profile":{"name":"Everyone"}},{"id":"00g2","profile":{"name":"Shop Admins"}}]`))
+	})
+	mux.HandleFunc("POST /api/v1/users/00u1/factors/{factor}/verify", func(w http.ResponseWriter, r *http.Request) {
+		var req auth.VerifyFactorRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		// Only the SMS factor accepts a passcode, so tests can tell which factor was used.
+		if r.PathValue("factor") != "sms1" || req.PassCode != "123456" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000068","errorSummary":"Invalid Passcode/Answer"}`))
+			return
+		}
+		w.Write([]byte(`{"factorResult":"SUCCESS"}`))
+	})
+	mux.HandleFunc("DELETE /api/v1/users/00u1", func(w http.ResponseWriter, r *http.Request) {
+		*deletes++
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /api/v1/users/00u1/lifecycle/deactivate", func(w http.ResponseWriter, r *http.Request) {
+		*deletes++
+		w.Write([]byte(`{}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestResolver(oktaURL string, users models.UserRepository) *Resolver {
+	return &Resolver{
+		Users:       users,
+		Auth:        auth.New(oktaURL, "token", "client-id", "secret"),
+		Tokens:      token.New([]byte("test-secret"), time.Hour),
+		OrderEvents: NewOrderEvents(),
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	var deletes int
+	okta := newOktaServer(t, &deletes)
+	users := newFakeUserRepository()
+	r := newTestResolver(okta.URL, users)
+
+	email := "john.doe@example.com"
+	user, err := r.Mutation().CreateUser(context.Background(), models.CreateUserInput{Email: &email})
+	if err != nil {
+		t.Fatalf("CreateUser returned error: %v", err)
+	}
+	if user.ID == "" || user.OktaID != "00u1" || user.Email != email {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if _, ok := users.users[user.ID]; !ok {
+		t.Fatal("expected user to be persisted")
+	}
+	if deletes != 0 {
+		t.Fatalf("expected no Okta deletes, got %d", deletes)
+	}
+}
+
+func TestCreateUserRollsBackOktaOnDBFailure(t *testing.T) {
+	var deletes int
+	okta := newOktaServer(t, &deletes)
+	users := newFakeUserRepository()
+	users.err = errors.New("connection reset")
+	r := newTestResolver(okta.URL, users)
+
+	email := "john.doe@example.com"
+	_, err := r.Mutation().CreateUser(context.Background(), models.CreateUserInput{Email: &email})
+	if !errors.Is(err, ErrDatabase) {
+		t.Fatalf("expected ErrDatabase, got %v", err)
+	}
+	if deletes != 2 {
+		t.Fatalf("expected deactivate and delete calls, got %d", deletes)
+	}
+}
+
+func TestCreateUserRequiresContact(t *testing.T) {
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+
+	if _, err := r.Mutation().CreateUser(context.Background(), models.CreateUserInput{}); err == nil {
+		t.Fatal("expected error when neither email nor phone is provided")
+	}
+}
+
+func TestCreateUserThrottled(t *testing.T) {
+	okta := newOktaServer(t, new(int))
+	users := newFakeUserRepository()
+	r := newTestResolver(okta.URL, users)
+	r.Registrations = signup.NewThrottle(signup.NewMemoryStore(), time.Hour, 1, 0)
+	ctx := middleware.WithClientIP(context.Background(), "203.0.113.7")
+
+	email := "john.doe@example.com"
+	if _, err := r.Mutation().CreateUser(ctx, models.CreateUserInput{Email: &email}); err != nil {
+		t.Fatalf("CreateUser returned error: %v", err)
+	}
+	other := "jane.doe@example.com"
+	if _, err := r.Mutation().CreateUser(ctx, models.CreateUserInput{Email: &other}); !errors.Is(err, signup.ErrTooManyRegistrations) {
+		t.Fatalf("expected ErrTooManyRegistrations, got %v", err)
+	}
+	if len(users.users) != 1 {
+		t.Fatalf("expected the throttled registration not to be persisted, got %d users", len(users.users))
+	}
+}
+
+func TestCreateUserValidatesContact(t *testing.T) {
+	var deletes int
+	okta := newOktaServer(t, &deletes)
+	users := newFakeUserRepository()
+	r := newTestResolver(okta.URL, users)
+
+	t.Run("valid", func(t *testing.T) {
+		phone := "+1 (555) 555-0100"
+		user, err := r.Mutation().CreateUser(context.Background(), models.CreateUserInput{PhoneNumber: &phone})
+		if err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+		if user.PhoneNumber != "+15555550100" {
+			t.Fatalf("expected phone number normalized to E.164, got %q", user.PhoneNumber)
+		}
+	})
+
+	t.Run("malformed email", func(t *testing.T) {
+		email := "john.doe@"
+		_, err := r.Mutation().CreateUser(context.Background(), models.CreateUserInput{Email: &email})
+		if !errors.Is(err, ErrInvalidArgument) || !errors.Is(err, validate.ErrInvalidEmail) {
+			t.Fatalf("expected ErrInvalidArgument wrapping ErrInvalidEmail, got %v", err)
+		}
+	})
+
+	t.Run("non-E.164 phone", func(t *testing.T) {
+		phone := "555-0100"
+		_, err := r.Mutation().CreateUser(context.Background(), models.CreateUserInput{PhoneNumber: &phone})
+		if !errors.Is(err, ErrInvalidArgument) || !errors.Is(err, validate.ErrInvalidPhone) {
+			t.Fatalf("expected ErrInvalidArgument wrapping ErrInvalidPhone, got %v", err)
+		}
+	})
+
+	t.Run("every invalid field is reported", func(t *testing.T) {
+		email, phone := "john.doe@", "555-0100"
+		_, err := r.Mutation().CreateUser(context.Background(), models.CreateUserInput{Email: &email, PhoneNumber: &phone})
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || len(validationErr.Fields) != 2 {
+			t.Fatalf("expected a ValidationError on both fields, got %v", err)
+		}
+		if validationErr.Fields[0].Field != "input.email" || validationErr.Fields[1].Field != "input.phoneNumber" {
+			t.Fatalf("unexpected fields %v", err)
+		}
+		if !errors.Is(err, validate.ErrInvalidEmail) || !errors.Is(err, validate.ErrInvalidPhone) {
+			t.Fatalf("expected both causes to be wrapped, got %v", err)
+		}
+	})
+}
+
+func TestRegistrationErrors(t *testing.T) {
+	oktaErr := &auth.OktaError{
+		Code:    "E0000001",
+		Summary: "Api validation failed: login",
+		Causes:  []string{"login: An object with this field already exists in the current organization", "mobilePhone: Does not match required pattern"},
+	}
+	var validationErr *ValidationError
+	if !errors.As(registrationErrors(oktaErr, true), &validationErr) || len(validationErr.Fields) != 2 {
+		t.Fatalf("expected a ValidationError with both causes, got %v", validationErr)
+	}
+	if f := validationErr.Fields[0]; f.Field != "input.email" || f.Err.Error() != "An object with this field already exists in the current organization" {
+		t.Errorf("expected the login cause on the email, got %s: %v", f.Field, f.Err)
+	}
+	if f := validationErr.Fields[1]; f.Field != "input.phoneNumber" {
+		t.Errorf("expected the mobilePhone cause on the phone number, got %s", f.Field)
+	}
+}
+
+func TestIsIdentifierAvailable(t *testing.T) {
+	okta := newOktaServer(t, new(int))
+	users := newFakeUserRepository(&models.User{ID: "42", Email: "john.doe@example.com", PhoneNumber: "+15555550100"})
+	r := newTestResolver(okta.URL, users)
+	ctx := middleware.WithClientIP(context.Background(), "203.0.113.7")
+
+	for _, tc := range []struct {
+		name, email, phone string
+		want               bool
+	}{
+		{"free", "jane.doe@example.com", "+15555550199", true},
+		{"email in the database", "John.Doe@example.com", "", false},
+		{"phone in the database", "", "+1 555 555 0100", false},
+		{"login in Okta", "okta.only@example.com", "", false},
+		{"either taken", "jane.doe@example.com", "+15555550100", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			available, err := r.Query().IsIdentifierAvailable(ctx, &tc.email, &tc.phone)
+			if err != nil {
+				t.Fatalf("IsIdentifierAvailable returned error: %v", err)
+			}
+			if available != tc.want {
+				t.Fatalf("expected available %t, got %t", tc.want, available)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		email := "john.doe@"
+		if _, err := r.Query().IsIdentifierAvailable(ctx, &email, nil); !errors.Is(err, validate.ErrInvalidEmail) {
+			t.Fatalf("expected ErrInvalidEmail, got %v", err)
+		}
+	})
+
+	t.Run("failures don't name the system", func(t *testing.T) {
+		users.err = errors.New("connection reset")
+		defer func() { users.err = nil }()
+		email := "jane.doe@example.com"
+		_, err := r.Query().IsIdentifierAvailable(ctx, &email, nil)
+		if err == nil || errorCode(err) != CodeInternal {
+			t.Fatalf("expected an INTERNAL error, got %v", err)
+		}
+	})
+
+	t.Run("throttled", func(t *testing.T) {
+		r.Lookups = signup.NewLookupThrottle(signup.NewMemoryStore(), time.Hour, 1)
+		email := "jane.doe@example.com"
+		if _, err := r.Query().IsIdentifierAvailable(ctx, &email, nil); err != nil {
+			t.Fatalf("IsIdentifierAvailable returned error: %v", err)
+		}
+		if _, err := r.Query().IsIdentifierAvailable(ctx, &email, nil); !errors.Is(err, signup.ErrTooManyLookups) {
+			t.Fatalf("expected ErrTooManyLookups, got %v", err)
+		}
+	})
+}
+
+func TestUserQuery(t *testing.T) {
+	stored := &models.User{ID: "42", Email: "john.doe@example.com", OktaID: "00u1"}
+	users := newFakeUserRepository(stored)
+	r := newTestResolver("http://okta.invalid", users)
+
+	t.Run("found", func(t *testing.T) {
+		user, err := r.Query().User(asUser("42"), "42")
+		if err != nil {
+			t.Fatalf("User returned error: %v", err)
+		}
+		if user != stored {
+			t.Fatalf("got %+v, want %+v", user, stored)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		user, err := r.Query().User(asUser("404"), "404")
+		if err != nil || user != nil {
+			t.Fatalf("expected (nil, nil), got (%+v, %v)", user, err)
+		}
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		users.err = errors.New("connection reset")
+		defer func() { users.err = nil }()
+
+		if _, err := r.Query().User(asUser("42"), "42"); !errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrDatabase, got %v", err)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Query().User(context.Background(), "42"); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+
+	t.Run("other user", func(t *testing.T) {
+		if _, err := r.Query().User(asUser("7"), "42"); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("expected ErrForbidden, got %v", err)
+		}
+	})
+}
+
+func TestLogin(t *testing.T) {
+	var deletes int
+	okta := newOktaServer(t, &deletes)
+	users := newFakeUserRepository()
+	r := newTestResolver(okta.URL, users)
+	email := "john.doe@example.com"
+	login := func(identifier, password, passcode string) (string, error) {
+		input := models.LoginInput{Identifier: &identifier}
+		if password != "" {
+			input.Password = &password
+		}
+		if passcode != "" {
+			input.Passcode = &passcode
+		}
+		return r.Mutation().Login(context.Background(), input)
+	}
+
+	t.Run("unknown user", func(t *testing.T) {
+		if _, err := login(email, "correct-horse", ""); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+
+	users.users["42"] = &models.User{ID: "42", Email: email, PhoneNumber: "+15555550100", OktaID: "00u1"}
+
+	t.Run("email", func(t *testing.T) {
+		signed, err := login(" "+email, "correct-horse", "")
+		if err != nil {
+			t.Fatalf("Login returned error: %v", err)
+		}
+		if claims, err := r.Tokens.Parse(signed); err != nil || claims.UserID != "42" {
+			t.Fatalf("expected a session token for user 42, got (%+v, %v)", claims, err)
+		}
+	})
+
+	t.Run("phone", func(t *testing.T) {
+		// The phone number isn't the Okta login; it is normalized and resolved to the user.
+		for _, phone := range []string{"+15555550100", "+1 (555) 555-0100", "0015555550100"} {
+			signed, err := login(phone, "correct-horse", "")
+			if err != nil {
+				t.Fatalf("Login(%q) returned error: %v", phone, err)
+			}
+			if claims, err := r.Tokens.Parse(signed); err != nil || claims.UserID != "42" {
+				t.Fatalf("Login(%q): expected a session token for user 42, got (%+v, %v)", phone, claims, err)
+			}
+		}
+	})
+
+	t.Run("phone passcode uses SMS factor", func(t *testing.T) {
+		if _, err := login("+1 555 555 0100", "", "123456"); err != nil {
+			t.Fatalf("Login returned error: %v", err)
+		}
+		if _, err := login(email, "", "123456"); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected the email factor to reject the SMS passcode, got %v", err)
+		}
+	})
+
+	t.Run("deprecated email field", func(t *testing.T) {
+		password := "correct-horse"
+		if _, err := r.Mutation().Login(context.Background(), models.LoginInput{Email: &email, Password: &password}); err != nil {
+			t.Fatalf("Login returned error: %v", err)
+		}
+	})
+
+	t.Run("invalid identifier", func(t *testing.T) {
+		for _, identifier := range []string{"", "john.doe@", "john@+15555550100", "555-0100", "not a phone"} {
+			if _, err := login(identifier, "correct-horse", ""); !errors.Is(err, ErrInvalidArgument) {
+				t.Fatalf("Login(%q): expected ErrInvalidArgument, got %v", identifier, err)
+			}
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		if _, err := login("+15555550100", "wrong", ""); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+
+	t.Run("locked out", func(t *testing.T) {
+		_, err := login(email, "locked-out", "")
+		if !errors.Is(err, auth.ErrAccountLocked) || errors.Is(err, ErrOkta) {
+			t.Fatalf("expected ErrAccountLocked, got %v", err)
+		}
+		if code := errorCode(err); code != CodeAccountLocked {
+			t.Fatalf("expected code %s, got %s", CodeAccountLocked, code)
+		}
+	})
+}
+
+func TestLoginPasscodeVerifiesContact(t *testing.T) {
+	var deletes int
+	okta := newOktaServer(t, &deletes)
+	users := newFakeUserRepository(&models.User{ID: "42", Email: "john.doe@example.com", PhoneNumber: "+15555550100", OktaID: "00u1"})
+	r := newTestResolver(okta.URL, users)
+	phone, passcode := "+1 555 555 0100", "wrong"
+
+	if _, err := r.Mutation().Login(context.Background(), models.LoginInput{Identifier: &phone, Passcode: &passcode}); err == nil {
+		t.Fatal("expected the wrong passcode to be rejected")
+	}
+	if user, _ := r.Query().User(asUser("42"), "42"); user.PhoneVerified {
+		t.Fatal("expected a rejected passcode to leave the phone number unverified")
+	}
+
+	passcode = "123456"
+	if _, err := r.Mutation().Login(context.Background(), models.LoginInput{Identifier: &phone, Passcode: &passcode}); err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	user, err := r.Query().User(asUser("42"), "42")
+	if err != nil {
+		t.Fatalf("User returned error: %v", err)
+	}
+	if !user.PhoneVerified || user.EmailVerified {
+		t.Fatalf("expected only the phone number to be verified, got %+v", user)
+	}
+
+	updated := *user
+	updated.PhoneNumber = "+15555550199"
+	if err := users.Update(context.Background(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.PhoneVerified {
+		t.Fatal("expected changing the phone number to clear its verification")
+	}
+}
+
+func TestLoginSyncsVerification(t *testing.T) {
+	var factorRequests int
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/users/00u1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE","profile":{"login":"john.doe@example.com"}}`))
+	})
+	mux.HandleFunc("POST /api/v1/authn", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"SUCCESS","sessionToken":"okta-session","_embedded":{"user":{"id":"00u1"}}}`))
+	})
+	mux.HandleFunc("GET /api/v1/users/00u1/factors", func(w http.ResponseWriter, r *http.Request) {
+		factorRequests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"id":"emf1","factorType":"email","provider":"OKTA","status":"ACTIVE","profile":{"email":"John.Doe@example.com"}},{"id":"sms1","factorType":"sms","provider":"OKTA","status":"PENDING_ACTIVATION","profile":{"phoneNumber":"+15555550100"}}]`))
+	})
+	okta := httptest.NewServer(mux)
+	t.Cleanup(okta.Close)
+
+	users := newFakeUserRepository(&models.User{ID: "42", Email: "john.doe@example.com", PhoneNumber: "+15555550100", OktaID: "00u1"})
+	r := newTestResolver(okta.URL, users)
+
+	if user, err := r.Query().User(asUser("42"), "42"); err != nil || user.EmailVerified {
+		t.Fatalf("expected the unverified user, got %+v, %v", user, err)
+	}
+	if factorRequests != 0 {
+		t.Fatalf("expected reading the user not to call Okta, got %d factor requests", factorRequests)
+	}
+
+	email, password := "john.doe@example.com", "correct-horse"
+	if _, err := r.Mutation().Login(context.Background(), models.LoginInput{Identifier: &email, Password: &password}); err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	user, _ := r.Query().User(asUser("42"), "42")
+	if !user.EmailVerified || user.PhoneVerified {
+		t.Fatalf("expected only the email address, whose factor is active, to be verified, got %+v", user)
+	}
+	if factorRequests != 1 {
+		t.Fatalf("expected one factor request, got %d", factorRequests)
+	}
+}
+
+// fakeRefreshTokenRepository is an in-memory models.RefreshTokenRepository.
+type fakeRefreshTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]*models.RefreshToken // By hash.
+}
+
+func newFakeRefreshTokenRepository() *fakeRefreshTokenRepository {
+	return &fakeRefreshTokenRepository{tokens: map[string]*models.RefreshToken{}}
+}
+
+func (f *fakeRefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token.ID = strconv.Itoa(len(f.tokens) + 1)
+	token.FamilyID = token.ID
+	f.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (f *fakeRefreshTokenRepository) Rotate(ctx context.Context, hash string, next *models.RefreshToken, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	old, ok := f.tokens[hash]
+	switch {
+	case !ok:
+		return models.ErrNotFound
+	case old.RevokedAt != nil:
+		f.revokeFamily(old.FamilyID, now)
+		return models.ErrRefreshTokenRevoked
+	case !now.Before(old.ExpiresAt):
+		return models.ErrRefreshTokenExpired
+	}
+	old.RevokedAt = &now
+	next.ID = strconv.Itoa(len(f.tokens) + 1)
+	next.UserID = old.UserID
+	next.FamilyID = old.FamilyID
+	f.tokens[next.TokenHash] = next
+	return nil
+}
+
+func (f *fakeRefreshTokenRepository) Revoke(ctx context.Context, hash string, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token, ok := f.tokens[hash]
+	if !ok {
+		return models.ErrNotFound
+	}
+	f.revokeFamily(token.FamilyID, now)
+	return nil
+}
+
+func (f *fakeRefreshTokenRepository) revokeFamily(familyID string, now time.Time) {
+	for _, t := range f.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	var deletes int
+	okta := newOktaServer(t, &deletes)
+	users := newFakeUserRepository(&models.User{ID: "42", Email: "john.doe@example.com", OktaID: "00u1", Status: models.UserStatusActive})
+	r := newTestResolver(okta.URL, users)
+	r.RefreshTokens = newFakeRefreshTokenRepository()
+	r.RefreshTokenTTL = 24 * time.Hour
+	now := clock.NewFake(time.Now())
+	r.Clock = now
+	r.Tokens = r.Tokens.WithClock(now)
+	signIn := func(t *testing.T) *models.TokenPair {
+		t.Helper()
+		email, password := "john.doe@example.com", "correct-horse"
+		pair, err := r.Mutation().SignIn(context.Background(), models.LoginInput{Identifier: &email, Password: &password})
+		if err != nil {
+			t.Fatalf("SignIn returned error: %v", err)
+		}
+		return pair
+	}
+
+	t.Run("rotates", func(t *testing.T) {
+		pair := signIn(t)
+		if claims, err := r.Tokens.Parse(pair.AccessToken); err != nil || claims.UserID != "42" {
+			t.Fatalf("expected a session token for user 42, got (%+v, %v)", claims, err)
+		}
+
+		refreshed, err := r.Mutation().RefreshToken(context.Background(), pair.RefreshToken)
+		if err != nil {
+			t.Fatalf("RefreshToken returned error: %v", err)
+		}
+		if refreshed.RefreshToken == pair.RefreshToken {
+			t.Fatal("expected a new refresh token")
+		}
+		if claims, err := r.Tokens.Parse(refreshed.AccessToken); err != nil || claims.UserID != "42" {
+			t.Fatalf("expected a session token for user 42, got (%+v, %v)", claims, err)
+		}
+		if _, err := r.Mutation().RefreshToken(context.Background(), refreshed.RefreshToken); err != nil {
+			t.Fatalf("expected the new refresh token to work, got %v", err)
+		}
+	})
+
+	t.Run("reusing a revoked token ends the session", func(t *testing.T) {
+		pair := signIn(t)
+		refreshed, err := r.Mutation().RefreshToken(context.Background(), pair.RefreshToken)
+		if err != nil {
+			t.Fatalf("RefreshToken returned error: %v", err)
+		}
+
+		_, err = r.Mutation().RefreshToken(context.Background(), pair.RefreshToken)
+		if !errors.Is(err, models.ErrRefreshTokenRevoked) || errorCode(err) != CodeUnauthenticated {
+			t.Fatalf("expected an unauthenticated ErrRefreshTokenRevoked, got %v", err)
+		}
+		if _, err := r.Mutation().RefreshToken(context.Background(), refreshed.RefreshToken); !errors.Is(err, models.ErrRefreshTokenRevoked) {
+			t.Fatalf("expected the reuse to revoke the rotated token too, got %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		pair := signIn(t)
+		now.Advance(24*time.Hour - time.Second)
+		refreshed, err := r.Mutation().RefreshToken(context.Background(), pair.RefreshToken)
+		if err != nil {
+			t.Fatalf("expected the token to work until it expires, got %v", err)
+		}
+
+		now.Advance(24 * time.Hour)
+		_, err = r.Mutation().RefreshToken(context.Background(), refreshed.RefreshToken)
+		if !errors.Is(err, models.ErrRefreshTokenExpired) || errorCode(err) != CodeUnauthenticated {
+			t.Fatalf("expected an unauthenticated ErrRefreshTokenExpired, got %v", err)
+		}
+		if _, err := r.Tokens.Parse(refreshed.AccessToken); !errors.Is(err, token.ErrExpired) {
+			t.Fatalf("expected the session token to have expired on the same clock, got %v", err)
+		}
+	})
+
+	t.Run("with an expired session token", func(t *testing.T) {
+		pair := signIn(t)
+		now.Advance(2 * time.Hour)
+
+		srv := handler.New(NewExecutableSchema(NewConfig(r)))
+		srv.AddTransport(transport.POST{})
+		h := middleware.Authenticate(r.Tokens)(srv)
+		body, _ := json.Marshal(map[string]any{
+			"query":     `mutation($token: String!) { refreshToken(token: $token) { accessToken refreshToken } }`,
+			"variables": map[string]string{"token": pair.RefreshToken},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var resp struct {
+			Data struct {
+				RefreshToken *models.TokenPair `json:"refreshToken"`
+			} `json:"data"`
+			Errors []any `json:"errors"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || len(resp.Errors) != 0 {
+			t.Fatalf("expected the refresh to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if claims, err := r.Tokens.Parse(resp.Data.RefreshToken.AccessToken); err != nil || claims.UserID != "42" {
+			t.Fatalf("expected a fresh session token for user 42, got (%+v, %v)", claims, err)
+		}
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		pair := signIn(t)
+		refreshed, err := r.Mutation().RefreshToken(context.Background(), pair.RefreshToken)
+		if err != nil {
+			t.Fatalf("RefreshToken returned error: %v", err)
+		}
+
+		if ok, err := r.Mutation().Logout(context.Background(), refreshed.RefreshToken); err != nil || !ok {
+			t.Fatalf("Logout returned (%v, %v)", ok, err)
+		}
+		if _, err := r.Mutation().RefreshToken(context.Background(), refreshed.RefreshToken); !errors.Is(err, models.ErrRefreshTokenRevoked) {
+			t.Fatalf("expected the logged out token to be revoked, got %v", err)
+		}
+		if _, err := r.Mutation().Logout(context.Background(), "unknown"); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated for an unknown token, got %v", err)
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		if _, err := r.Mutation().RefreshToken(context.Background(), "unknown"); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+		if _, err := r.Mutation().RefreshToken(context.Background(), ""); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("deactivated user", func(t *testing.T) {
+		pair := signIn(t)
+		users.users["42"].Status = models.UserStatusDeactivated
+		defer func() { users.users["42"].Status = models.UserStatusActive }()
+
+		if _, err := r.Mutation().RefreshToken(context.Background(), pair.RefreshToken); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+func TestLoginSyncsRoleFromGroups(t *testing.T) {
+	var deletes int
+	okta := newOktaServer(t, &deletes)
+	users := newFakeUserRepository(&models.User{ID: "42", Email: "john.doe@example.com", OktaID: "00u1", Role: models.RoleCustomer})
+	r := newTestResolver(okta.URL, users)
+	email, password := "john.doe@example.com", "correct-horse"
+	login := func(t *testing.T) {
+		t.Helper()
+		if _, err := r.Mutation().Login(context.Background(), models.LoginInput{Identifier: &email, Password: &password}); err != nil {
+			t.Fatalf("Login returned error: %v", err)
+		}
+	}
+
+	t.Run("not synced without group roles", func(t *testing.T) {
+		login(t)
+		if users.users["42"].Role != models.RoleCustomer {
+			t.Fatalf("expected the stored role to be kept, got %s", users.users["42"].Role)
+		}
+	})
+
+	t.Run("admin group", func(t *testing.T) {
+		r.GroupRoles = roles.GroupRoles{"Shop Admins": models.RoleAdmin}
+		login(t)
+		if users.users["42"].Role != models.RoleAdmin {
+			t.Fatalf("expected user 42 to be an admin, got %s", users.users["42"].Role)
+		}
+		if err := r.requireRole(asUser("42"), models.RoleAdmin); err != nil {
+			t.Fatalf("expected the admin guard to pass, got %v", err)
+		}
+	})
+
+	t.Run("removed from admin group", func(t *testing.T) {
+		r.GroupRoles = roles.GroupRoles{"Support": models.RoleAdmin}
+		login(t)
+		if users.users["42"].Role != models.RoleCustomer {
+			t.Fatalf("expected user 42 to be a customer again, got %s", users.users["42"].Role)
+		}
+		if err := r.requireRole(asUser("42"), models.RoleAdmin); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("expected ErrForbidden, got %v", err)
+		}
+	})
+}
+
+func TestValidateLoginInput(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name  string
+		input models.LoginInput
+		field string // The invalid field, or empty if the input is valid.
+	}{
+		{"password", models.LoginInput{Identifier: str("john.doe@example.com"), Password: str("correct-horse")}, ""},
+		{"passcode", models.LoginInput{Identifier: str("+15555550100"), Passcode: str("123456")}, ""},
+		{"deprecated phone field", models.LoginInput{PhoneNumber: str("+15555550100"), Passcode: str("123456")}, ""},
+		{"no identifier", models.LoginInput{Password: str("correct-horse")}, "input.identifier"},
+		{"blank identifier", models.LoginInput{Identifier: str("  "), Email: str(""), Password: str("correct-horse")}, "input.identifier"},
+		{"no credential", models.LoginInput{Identifier: str("john.doe@example.com")}, "input.password"},
+		{"empty credentials", models.LoginInput{Identifier: str("john.doe@example.com"), Password: str(""), Passcode: str("")}, "input.password"},
+		{"both credentials", models.LoginInput{Identifier: str("john.doe@example.com"), Password: str("correct-horse"), Passcode: str("123456")}, "input.passcode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := validateLoginInput(tt.input)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("expected valid input, got %v", err)
+				}
+				return
+			}
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field || !errors.Is(err, ErrInvalidArgument) {
+				t.Fatalf("expected an invalid %s, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	t.Run("deactivates Okta user and soft-deletes row", func(t *testing.T) {
+		var deactivations int
+		okta := newOktaServer(t, &deactivations)
+		users := newFakeUserRepository(&models.User{ID: "42", OktaID: "00u1"})
+		r := newTestResolver(okta.URL, users)
+
+		ok, err := r.Mutation().DeleteUser(asUser("42"), "42")
+		if err != nil || !ok {
+			t.Fatalf("DeleteUser = (%v, %v), want (true, nil)", ok, err)
+		}
+		if deactivations != 1 {
+			t.Fatalf("expected a single deactivate call, got %d", deactivations)
+		}
+		if _, err := users.GetByID(context.Background(), "42"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected the deleted user to be hidden, got %v", err)
+		}
+		if user, err := users.GetByIDIncludingDeleted(context.Background(), "42"); err != nil || user.DeletedAt == nil {
+			t.Fatalf("expected the user row to be kept with DeletedAt set, got (%+v, %v)", user, err)
+		}
+
+		// Deleting again is a no-op.
+		ok, err = r.Mutation().DeleteUser(asUser("42"), "42")
+		if err != nil || !ok {
+			t.Fatalf("repeat DeleteUser = (%v, %v), want (true, nil)", ok, err)
+		}
+		if deactivations != 1 {
+			t.Fatalf("expected no further Okta calls, got %d", deactivations)
+		}
+	})
+
+	t.Run("Okta deactivate fails", func(t *testing.T) {
+		okta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorCode":"E0000001","errorSummary":"Api validation failed"}`))
+		}))
+		defer okta.Close()
+		users := newFakeUserRepository(&models.User{ID: "42", OktaID: "00u1"})
+		r := newTestResolver(okta.URL, users)
+
+		if _, err := r.Mutation().DeleteUser(asUser("42"), "42"); !errors.Is(err, ErrOkta) {
+			t.Fatalf("expected ErrOkta, got %v", err)
+		}
+		if users.users["42"].DeletedAt != nil {
+			t.Fatal("expected user to be kept so the deletion can be retried")
+		}
+	})
+}
+
+func TestPasswordReset(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/authn/recovery/password", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["username"] != "john.doe@example.com" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"E0000007","errorSummary":"Not found: Resource not found"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"RECOVERY_CHALLENGE","factorType":"EMAIL"}`))
+	})
+	mux.HandleFunc("POST /api/v1/authn/recovery/token", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["recoveryToken"] != "recovery-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errorCode":"E0000011","errorSummary":"Invalid token provided"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"PASSWORD_RESET","stateToken":"state-token"}`))
+	})
+	mux.HandleFunc("POST /api/v1/authn/credentials/reset_password", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"SUCCESS"}`))
+	})
+	okta := httptest.NewServer(mux)
+	defer okta.Close()
+	r := newTestResolver(okta.URL, newFakeUserRepository())
+
+	t.Run("start", func(t *testing.T) {
+		for _, identifier := range []string{"john.doe@example.com", "nobody@example.com"} {
+			ok, err := r.Mutation().StartPasswordReset(context.Background(), identifier)
+			if err != nil || !ok {
+				t.Fatalf("StartPasswordReset(%q) = (%v, %v), want (true, nil)", identifier, ok, err)
+			}
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		ok, err := r.Mutation().ResetPassword(context.Background(), "recovery-token", "Correct-Horse-9")
+		if err != nil || !ok {
+			t.Fatalf("ResetPassword = (%v, %v), want (true, nil)", ok, err)
+		}
+	})
+
+	t.Run("weak password", func(t *testing.T) {
+		_, err := r.Mutation().ResetPassword(context.Background(), "recovery-token", "password")
+		if !errors.Is(err, ErrInvalidArgument) || !errors.Is(err, auth.ErrWeakPassword) {
+			t.Fatalf("expected ErrInvalidArgument wrapping ErrWeakPassword, got %v", err)
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, err := r.Mutation().ResetPassword(context.Background(), "expired", "Correct-Horse-9")
+		if !errors.Is(err, auth.ErrInvalidRecoveryToken) {
+			t.Fatalf("expected ErrInvalidRecoveryToken, got %v", err)
+		}
+	})
+}
+
+func TestResendActivationEmail(t *testing.T) {
+	var reactivated []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/users/{id}/lifecycle/reactivate", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "00u2" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000038","errorSummary":"This operation is not allowed in the user's current status."}`))
+			return
+		}
+		reactivated = append(reactivated, r.PathValue("id"))
+		w.Write([]byte(`{}`))
+	})
+	okta := httptest.NewServer(mux)
+	defer okta.Close()
+	r := newTestResolver(okta.URL, newFakeUserRepository(
+		&models.User{ID: "42", Email: "john.doe@example.com", OktaID: "00u1"},
+		&models.User{ID: "43", PhoneNumber: "+15555550100", OktaID: "00u2"},
+	))
+
+	t.Run("pending activation", func(t *testing.T) {
+		ok, err := r.Mutation().ResendActivationEmail(context.Background(), " john.doe@example.com")
+		if err != nil || !ok {
+			t.Fatalf("ResendActivationEmail = (%v, %v), want (true, nil)", ok, err)
+		}
+		if !slices.Equal(reactivated, []string{"00u1"}) {
+			t.Fatalf("expected 00u1 to be reactivated, got %v", reactivated)
+		}
+	})
+
+	t.Run("already active or unknown", func(t *testing.T) {
+		for _, identifier := range []string{"+1 555 555 0100", "nobody@example.com"} {
+			ok, err := r.Mutation().ResendActivationEmail(context.Background(), identifier)
+			if err != nil || !ok {
+				t.Fatalf("ResendActivationEmail(%q) = (%v, %v), want (true, nil)", identifier, ok, err)
+			}
+		}
+		if len(reactivated) != 1 {
+			t.Fatalf("expected no more reactivations, got %v", reactivated)
+		}
+	})
+
+	t.Run("invalid identifier", func(t *testing.T) {
+		_, err := r.Mutation().ResendActivationEmail(context.Background(), "not a phone")
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != "identifier" {
+			t.Fatalf("expected a FieldError for identifier, got %v", err)
+		}
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	okta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/users/00u1/credentials/change_password" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var body map[string]map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["oldPassword"]["value"] != "Old-Horse-1" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":"E0000014","errorSummary":"Update of credentials failed","errorCauses":[{"errorSummary":"oldPassword: The credentials provided were incorrect."}]}`))
+			return
+		}
+		w.Write([]byte(`{"password":{}}`))
+	}))
+	defer okta.Close()
+	r := newTestResolver(okta.URL, newFakeUserRepository(&models.User{ID: "42", OktaID: "00u1"}))
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := r.Mutation().ChangePassword(context.Background(), "Old-Horse-1", "Correct-Horse-9")
+		if !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		ok, err := r.Mutation().ChangePassword(asUser("42"), "Old-Horse-1", "Correct-Horse-9")
+		if err != nil || !ok {
+			t.Fatalf("ChangePassword = (%v, %v), want (true, nil)", ok, err)
+		}
+	})
+
+	t.Run("wrong old password", func(t *testing.T) {
+		_, err := r.Mutation().ChangePassword(asUser("42"), "wrong", "Correct-Horse-9")
+		if !errors.Is(err, auth.ErrWrongPassword) {
+			t.Fatalf("expected ErrWrongPassword, got %v", err)
+		}
+	})
+
+	t.Run("weak new password", func(t *testing.T) {
+		_, err := r.Mutation().ChangePassword(asUser("42"), "Old-Horse-1", "password")
+		if !errors.Is(err, ErrInvalidArgument) || !errors.Is(err, auth.ErrWeakPassword) {
+			t.Fatalf("expected ErrInvalidArgument wrapping ErrWeakPassword, got %v", err)
+		}
+	})
+}
+
+func TestUpdateUser(t *testing.T) {
+	var patches []map[string]map[string]string
+	okta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		patches = append(patches, body)
+		w.Write([]byte(`{"id":"00u1","status":"ACTIVE"}`))
+	}))
+	defer okta.Close()
+
+	createdAt := time.Now().Add(-time.Hour)
+	users := newFakeUserRepository(&models.User{ID: "42", Email: "john.doe@example.com", PhoneNumber: "+15555550100", OktaID: "00u1", CreatedAt: createdAt, UpdatedAt: createdAt})
+	r := newTestResolver(okta.URL, users)
+
+	t.Run("name only", func(t *testing.T) {
+		patches = nil
+		first, email := "Johnny", "john.doe@example.com"
+		payload, err := r.Mutation().UpdateUser(asUser("42"), models.UpdateUserInput{ID: "42", FirstName: &first, Email: &email})
+		if err != nil {
+			t.Fatalf("UpdateUser returned error: %v", err)
+		}
+		if payload.NeedsVerification {
+			t.Fatal("unchanged email should not need verification")
+		}
+		if len(patches) != 1 || len(patches[0]["profile"]) != 1 || patches[0]["profile"]["firstName"] != "Johnny" {
+			t.Fatalf("expected patch with only firstName, got %v", patches)
+		}
+	})
+
+	t.Run("new email", func(t *testing.T) {
+		patches = nil
+		email := "johnny@example.com"
+		payload, err := r.Mutation().UpdateUser(asUser("42"), models.UpdateUserInput{ID: "42", Email: &email})
+		if err != nil {
+			t.Fatalf("UpdateUser returned error: %v", err)
+		}
+		if !payload.NeedsVerification {
+			t.Fatal("changed email should need verification")
+		}
+		if payload.User.Email != email || users.users["42"].Email != email {
+			t.Fatalf("expected stored email to be updated, got %+v", users.users["42"])
+		}
+		if !payload.User.UpdatedAt.After(createdAt) || !payload.User.CreatedAt.Equal(createdAt) {
+			t.Fatalf("expected UpdatedAt to move past CreatedAt %v, got %+v", createdAt, payload.User)
+		}
+		if len(patches) != 1 || len(patches[0]["profile"]) != 1 || patches[0]["profile"]["email"] != email {
+			t.Fatalf("expected patch with only email, got %v", patches)
+		}
+	})
+
+	t.Run("contact details are normalized", func(t *testing.T) {
+		patches = nil
+		email, phone := " Johnny@Example.com ", "+1 (555) 555-0100"
+		payload, err := r.Mutation().UpdateUser(asUser("42"), models.UpdateUserInput{ID: "42", Email: &email, PhoneNumber: &phone})
+		if err != nil {
+			t.Fatalf("UpdateUser returned error: %v", err)
+		}
+		if payload.NeedsVerification || len(patches) != 0 {
+			t.Fatalf("expected the normalized details to match the stored ones, got patches %v", patches)
+		}
+	})
+
+	t.Run("invalid contact details", func(t *testing.T) {
+		patches = nil
+		email, phone := "johnny@", "555-0100"
+		for field, input := range map[string]models.UpdateUserInput{
+			"input.email":       {ID: "42", Email: &email},
+			"input.phoneNumber": {ID: "42", PhoneNumber: &phone},
+		} {
+			_, err := r.Mutation().UpdateUser(asUser("42"), input)
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != field || !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("expected a FieldError for %s, got %v", field, err)
+			}
+		}
+		if len(patches) != 0 || users.users["42"].PhoneNumber != "+15555550100" {
+			t.Fatalf("expected invalid details to reach neither Okta nor the database, got patches %v", patches)
+		}
+	})
+
+	t.Run("db failure reverts Okta", func(t *testing.T) {
+		patches = nil
+		r := newTestResolver(okta.URL, &failingUpdateRepository{fakeUserRepository: users})
+
+		phone := "+15555550199"
+		if _, err := r.Mutation().UpdateUser(asUser("42"), models.UpdateUserInput{ID: "42", PhoneNumber: &phone}); !errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrDatabase, got %v", err)
+		}
+		if len(patches) != 2 || patches[1]["profile"]["mobilePhone"] != "+15555550100" {
+			t.Fatalf("expected the phone change to be reverted, got %v", patches)
+		}
+	})
+}
+
+// failingUpdateRepository fails every Update while delegating reads.
+type failingUpdateRepository struct {
+	*fakeUserRepository
+}
+
+func (f *failingUpdateRepository) Update(ctx context.Context, user *models.User) error {
+	return errors.New("connection reset")
+}
+
+// fakeObjectStore is an in-memory models.ObjectStore.
+type fakeObjectStore struct {
+	objects      map[string][]byte
+	contentTypes map[string]string
+}
+
+func (f *fakeObjectStore) Delete(ctx context.Context, key string) error {
+	delete(f.objects, key)
+	return nil
+}
+
+func (f *fakeObjectStore) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "/uploads/" + key + "?expires=" + expires.String(), nil
+}
+
+func (f *fakeObjectStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if f.objects == nil {
+		f.objects, f.contentTypes = map[string][]byte{}, map[string]string{}
+	}
+	f.objects[key], f.contentTypes[key] = data, contentType
+	return "/uploads/" + key, nil
+}
+
+// pngImage returns a 1x1 PNG image.
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadAvatar(t *testing.T) {
+	users := newFakeUserRepository(&models.User{ID: "42", Email: "john.doe@example.com", OktaID: "00u1"})
+	avatars := &fakeObjectStore{}
+	r := newTestResolver("http://okta.invalid", users)
+	r.Avatars = avatars
+	upload := func(data []byte, contentType string) graphql.Upload {
+		return graphql.Upload{File: bytes.NewReader(data), Filename: "avatar", Size: int64(len(data)), ContentType: contentType}
+	}
+
+	t.Run("png", func(t *testing.T) {
+		data := pngImage(t)
+		user, err := r.Mutation().UploadAvatar(asUser("42"), upload(data, "image/png"))
+		if err != nil {
+			t.Fatalf("UploadAvatar returned error: %v", err)
+		}
+		key, ok := strings.CutPrefix(user.AvatarURL, "/uploads/")
+		if !ok || !strings.HasPrefix(key, "avatars/42/") || !strings.HasSuffix(key, ".png") {
+			t.Fatalf("expected a PNG avatar URL for user 42, got %q", user.AvatarURL)
+		}
+		if !bytes.Equal(avatars.objects[key], data) || avatars.contentTypes[key] != "image/png" {
+			t.Fatalf("expected the whole image to be stored as image/png, got %d bytes of %q", len(avatars.objects[key]), avatars.contentTypes[key])
+		}
+		if users.users["42"].AvatarURL != user.AvatarURL {
+			t.Fatalf("expected the avatar URL to be saved, got %q", users.users["42"].AvatarURL)
+		}
+	})
+
+	t.Run("replaces previous", func(t *testing.T) {
+		previous := strings.TrimPrefix(users.users["42"].AvatarURL, "/uploads/")
+		user, err := r.Mutation().UploadAvatar(asUser("42"), upload(pngImage(t), "image/png"))
+		if err != nil {
+			t.Fatalf("UploadAvatar returned error: %v", err)
+		}
+		if _, ok := avatars.objects[previous]; ok || user.AvatarURL == "/uploads/"+previous {
+			t.Fatalf("expected the previous avatar %s to be replaced and deleted", previous)
+		}
+		if len(avatars.objects) != 1 {
+			t.Fatalf("expected only the new avatar to be stored, got %d objects", len(avatars.objects))
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		data := append(pngImage(t), make([]byte, maxAvatarSize)...)
+		_, err := r.Mutation().UploadAvatar(asUser("42"), upload(data, "image/png"))
+		if !errors.Is(err, ErrFileTooLarge) || errorCode(err) != CodeValidation {
+			t.Fatalf("expected a VALIDATION ErrFileTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		for name, file := range map[string]graphql.Upload{
+			"declared text":   upload([]byte("hello, world"), "text/plain"),
+			"disguised text":  upload([]byte("hello, world"), "image/png"),
+			"undeclared html": upload([]byte("<html><script>alert(1)</script></html>"), ""),
+		} {
+			_, err := r.Mutation().UploadAvatar(asUser("42"), file)
+			var fieldErr *FieldError
+			if !errors.Is(err, ErrNotAnImage) || !errors.As(err, &fieldErr) || fieldErr.Field != "file" {
+				t.Fatalf("%s: expected ErrNotAnImage for file, got %v", name, err)
+			}
+		}
+		if len(avatars.objects) != 1 {
+			t.Fatalf("expected rejected uploads not to be stored, got %d objects", len(avatars.objects))
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Mutation().UploadAvatar(context.Background(), upload(pngImage(t), "image/png")); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+// asUser returns a context authenticated as the given user.
+func asUser(userID string) context.Context {
+	return middleware.WithUser(context.Background(), userID)
+}
+
+// fakeProductRepository is an in-memory models.ProductRepository that records the page and
+// order it was asked for. Only ListAfter sorts.
+type fakeProductRepository struct {
+	products      []*models.Product
+	categories    []*models.Category  // Used by ListByCategory and ListAfter to find subcategories.
+	together      map[string][]string // Product IDs ranked by FrequentlyBoughtTogether, by product ID.
+	limit, offset int
+	sort          models.ProductSort
+	computed      int // How many times FrequentlyBoughtTogether was called.
+	err           error
+}
+
+// fakePage returns the page of items that page selects.
+func fakePage[T any](items []T, page models.PageArgs) *models.PageResult[T] {
+	if page.Offset >= len(items) {
+		return &models.PageResult[T]{Items: []T{}}
+	}
+	return &models.PageResult[T]{Items: items[page.Offset:min(page.Offset+page.Limit, len(items))], Total: len(items)}
+}
+
+func (f *fakeProductRepository) List(ctx context.Context, sort models.ProductSort, page models.PageArgs) (*models.PageResult[*models.Product], error) {
+	f.limit, f.offset, f.sort = page.Limit, page.Offset, sort
+	if f.err != nil {
+		return nil, f.err
+	}
+	return fakePage(f.products, page), nil
+}
+
+func (f *fakeProductRepository) ListByCategory(ctx context.Context, slug string, sort models.ProductSort, page models.PageArgs) (*models.PageResult[*models.Product], error) {
+	f.limit, f.offset, f.sort = page.Limit, page.Offset, sort
+	if f.err != nil {
+		return nil, f.err
+	}
+	return fakePage(f.inCategory(slug), page), nil
+}
+
+// inCategory returns the products in the category with the given slug or its descendants.
+func (f *fakeProductRepository) inCategory(slug string) []*models.Product {
+	ids := map[string]bool{}
+	for _, c := range f.categories {
+		if c.Slug == slug {
+			ids[c.ID] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, c := range f.categories {
+			if c.ParentID != nil && ids[*c.ParentID] && !ids[c.ID] {
+				ids[c.ID], changed = true, true
+			}
+		}
+	}
+	matches := []*models.Product{}
+	for _, p := range f.products {
+		if p.CategoryID != nil && ids[*p.CategoryID] {
+			matches = append(matches, p)
+		}
+	}
+	return matches
+}
+
+// compareProducts orders a and b in sort order.
+func compareProducts(a, b *models.Product, sort models.ProductSort) int {
+	c := a.CreatedAt.Compare(b.CreatedAt)
+	if sort.ByPrice() {
+		c = cmp.Compare(a.PriceCents, b.PriceCents)
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	if sort == models.ProductSortNewest || sort == models.ProductSortPriceDesc {
+		return -c
+	}
+	return c
+}
+
+func (f *fakeProductRepository) ListAfter(ctx context.Context, slug string, sort models.ProductSort, after *models.ProductCursor, limit int) ([]*models.Product, error) {
+	f.limit, f.offset, f.sort = limit, 0, sort
+	if f.err != nil {
+		return nil, f.err
+	}
+	sorted := slices.Clone(f.products)
+	if slug != "" {
+		sorted = f.inCategory(slug)
+	}
+	slices.SortFunc(sorted, func(a, b *models.Product) int { return compareProducts(a, b, sort) })
+	products := []*models.Product{}
+	for _, p := range sorted {
+		if after != nil {
+			at := &models.Product{ID: after.ID, CreatedAt: after.CreatedAt, PriceCents: after.PriceCents}
+			if compareProducts(p, at, sort) <= 0 {
+				continue
+			}
+		}
+		if len(products) == limit {
+			break
+		}
+		products = append(products, p)
+	}
+	return products, nil
+}
+
+func (f *fakeProductRepository) Search(ctx context.Context, query string, page models.PageArgs) (*models.PageResult[*models.Product], error) {
+	f.limit, f.offset = page.Limit, page.Offset
+	if f.err != nil {
+		return nil, f.err
+	}
+	var matches []*models.Product
+	for _, p := range f.products {
+		text := strings.ToLower(p.Name + " " + p.Description)
+		missing := func(word string) bool { return !strings.Contains(text, word) }
+		if !slices.ContainsFunc(strings.Fields(strings.ToLower(query)), missing) {
+			matches = append(matches, p)
+		}
+	}
+	return fakePage(matches, page), nil
+}
+
+func (f *fakeProductRepository) Create(ctx context.Context, product *models.Product) error {
+	if f.err != nil {
+		return f.err
+	}
+	for _, p := range f.products {
+		if p.SKU == product.SKU {
+			return models.ErrDuplicateSKU
+		}
+	}
+	product.ID = strconv.Itoa(len(f.products) + 1)
+	product.CreatedAt = time.Now()
+	f.products = append(f.products, product)
+	return nil
+}
+
+func (f *fakeProductRepository) Import(ctx context.Context, products []*models.Product) ([]*models.Product, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var duplicates []*models.Product
+	for _, product := range products {
+		if err := f.Create(ctx, product); errors.Is(err, models.ErrDuplicateSKU) {
+			duplicates = append(duplicates, product)
+		}
+	}
+	return duplicates, nil
+}
+
+func (f *fakeProductRepository) GetByID(ctx context.Context, id string) (*models.Product, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, p := range f.products {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeProductRepository) FrequentlyBoughtTogether(ctx context.Context, productID string, limit int) ([]*models.Product, error) {
+	f.computed++
+	f.limit = limit
+	if f.err != nil {
+		return nil, f.err
+	}
+	products := []*models.Product{}
+	for _, id := range f.together[productID] {
+		for _, p := range f.products {
+			if p.ID == id && p.StockQty > 0 && len(products) < limit {
+				products = append(products, p)
+			}
+		}
+	}
+	return products, nil
+}
+
+func TestProductsQuery(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{
+		{ID: "1", Name: "Tote bag", PriceCents: 1999, Currency: "USD"},
+		{ID: "2", Name: "Mug", PriceCents: 899, Currency: "USD"},
+	}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products = products
+	intPtr := func(n int) *int { return &n }
+
+	t.Run("defaults", func(t *testing.T) {
+		got, err := r.Query().Products(context.Background(), nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("Products returned error: %v", err)
+		}
+		if len(got) != 2 || products.limit != models.DefaultPageLimit || products.offset != 0 {
+			t.Fatalf("got %d products with limit %d offset %d", len(got), products.limit, products.offset)
+		}
+	})
+
+	t.Run("limit capped", func(t *testing.T) {
+		if _, err := r.Query().Products(context.Background(), intPtr(1000), intPtr(1), nil, nil); err != nil {
+			t.Fatalf("Products returned error: %v", err)
+		}
+		if products.limit != maxPageLimit || products.offset != 1 {
+			t.Fatalf("expected limit %d offset 1, got limit %d offset %d", maxPageLimit, products.limit, products.offset)
+		}
+	})
+
+	t.Run("invalid bounds", func(t *testing.T) {
+		if _, err := r.Query().Products(context.Background(), intPtr(0), nil, nil, nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for zero limit, got %v", err)
+		}
+		if _, err := r.Query().Products(context.Background(), nil, intPtr(-1), nil, nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for negative offset, got %v", err)
+		}
+	})
+
+	t.Run("by category", func(t *testing.T) {
+		strPtr := func(s string) *string { return &s }
+		r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+		r.Products = &fakeProductRepository{
+			categories: []*models.Category{
+				{ID: "1", Slug: "bags"},
+				{ID: "2", Slug: "totes", ParentID: strPtr("1")},
+				{ID: "3", Slug: "kitchen"},
+			},
+			products: []*models.Product{
+				{ID: "1", Name: "Backpack", CategoryID: strPtr("1")},
+				{ID: "2", Name: "Tote bag", CategoryID: strPtr("2")},
+				{ID: "3", Name: "Mug", CategoryID: strPtr("3")},
+				{ID: "4", Name: "Gift card"},
+			},
+		}
+
+		for slug, want := range map[string][]string{"bags": {"1", "2"}, "totes": {"2"}, "kitchen": {"3"}, "garden": nil} {
+			got, err := r.Query().Products(context.Background(), nil, nil, &slug, nil)
+			if err != nil {
+				t.Fatalf("Products(%q) returned error: %v", slug, err)
+			}
+			var ids []string
+			for _, p := range got {
+				ids = append(ids, p.ID)
+			}
+			if !slices.Equal(ids, want) {
+				t.Errorf("Products(%q): expected %v, got %v", slug, want, ids)
+			}
+		}
+		if _, err := r.Query().Products(context.Background(), nil, nil, strPtr(" "), nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for a blank slug, got %v", err)
+		}
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		products.err = errors.New("connection reset")
+		defer func() { products.err = nil }()
+
+		if _, err := r.Query().Products(context.Background(), nil, nil, nil, nil); !errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrDatabase, got %v", err)
+		}
+	})
+}
+
+func TestProductsConnectionQuery(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	products := &fakeProductRepository{}
+	for i := 1; i <= 5; i++ {
+		products.products = append(products.products, &models.Product{ID: strconv.Itoa(i), Name: "Product " + strconv.Itoa(i), CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+	}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products = products
+	intPtr := func(n int) *int { return &n }
+
+	t.Run("walks forward without duplicates", func(t *testing.T) {
+		var seen []string
+		var after *string
+		for page := 0; ; page++ {
+			conn, err := r.Query().ProductsConnection(context.Background(), intPtr(2), after, nil, nil)
+			if err != nil {
+				t.Fatalf("ProductsConnection returned error: %v", err)
+			}
+			if products.limit != 3 {
+				t.Fatalf("expected the repository to be asked for one extra product, got limit %d", products.limit)
+			}
+			for _, edge := range conn.Edges {
+				seen = append(seen, edge.Node.ID)
+			}
+			if page == 0 {
+				// A product added after the walk started sorts last and must still be reached.
+				products.products = append(products.products, &models.Product{ID: "6", Name: "Product 6", CreatedAt: base.Add(time.Hour)})
+			}
+			if !conn.PageInfo.HasNextPage {
+				if conn.PageInfo.EndCursor == nil || *conn.PageInfo.EndCursor != conn.Edges[len(conn.Edges)-1].Cursor {
+					t.Fatalf("expected endCursor to point at the last edge, got %v", conn.PageInfo.EndCursor)
+				}
+				break
+			}
+			after = conn.PageInfo.EndCursor
+		}
+		if want := []string{"1", "2", "3", "4", "5", "6"}; !slices.Equal(seen, want) {
+			t.Fatalf("expected products %v, got %v", want, seen)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+		r.Products = &fakeProductRepository{}
+		conn, err := r.Query().ProductsConnection(context.Background(), nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("ProductsConnection returned error: %v", err)
+		}
+		if len(conn.Edges) != 0 || conn.PageInfo.HasNextPage || conn.PageInfo.EndCursor != nil {
+			t.Fatalf("expected an empty connection, got %+v", conn)
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		if _, err := r.Query().ProductsConnection(context.Background(), intPtr(0), nil, nil, nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for zero first, got %v", err)
+		}
+		for _, cursor := range []string{"not base64!", "bm8tY29sb24", "MTIzOmFiYw", "YWJjOjE"} {
+			if _, err := r.Query().ProductsConnection(context.Background(), nil, &cursor, nil, nil); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("cursor %q: expected ErrInvalidArgument, got %v", cursor, err)
+			}
+		}
+		blank := "  "
+		if _, err := r.Query().ProductsConnection(context.Background(), nil, nil, &blank, nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for a blank categorySlug, got %v", err)
+		}
+	})
+
+	t.Run("in a category", func(t *testing.T) {
+		bags, totes := "c1", "c2"
+		products := &fakeProductRepository{categories: []*models.Category{
+			{ID: bags, Slug: "bags"},
+			{ID: totes, Slug: "totes", ParentID: &bags},
+		}}
+		for i, category := range []*string{&bags, nil, &totes, &bags, nil} {
+			products.products = append(products.products, &models.Product{ID: strconv.Itoa(i + 1), CategoryID: category, CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+		}
+		r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+		r.Products = products
+
+		var seen []string
+		slug := " bags "
+		var after *string
+		for {
+			conn, err := r.Query().ProductsConnection(context.Background(), intPtr(2), after, &slug, nil)
+			if err != nil {
+				t.Fatalf("ProductsConnection returned error: %v", err)
+			}
+			for _, edge := range conn.Edges {
+				seen = append(seen, edge.Node.ID)
+			}
+			if !conn.PageInfo.HasNextPage {
+				break
+			}
+			after = conn.PageInfo.EndCursor
+		}
+		if want := []string{"1", "3", "4"}; !slices.Equal(seen, want) {
+			t.Fatalf("expected products %v, got %v", want, seen)
+		}
+	})
+
+	t.Run("by price", func(t *testing.T) {
+		products := &fakeProductRepository{}
+		for i, price := range []int64{899, 4999, 1999, 899, 2450} {
+			products.products = append(products.products, &models.Product{ID: strconv.Itoa(i + 1), PriceCents: price, CreatedAt: base})
+		}
+		r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+		r.Products = products
+
+		var seen []string
+		sort := models.ProductSortPriceDesc
+		var after *string
+		for {
+			conn, err := r.Query().ProductsConnection(context.Background(), intPtr(2), after, nil, &sort)
+			if err != nil {
+				t.Fatalf("ProductsConnection returned error: %v", err)
+			}
+			for _, edge := range conn.Edges {
+				seen = append(seen, edge.Node.ID)
+			}
+			if !conn.PageInfo.HasNextPage {
+				break
+			}
+			after = conn.PageInfo.EndCursor
+		}
+		if want := []string{"2", "5", "3", "4", "1"}; !slices.Equal(seen, want) {
+			t.Fatalf("expected products %v, got %v", want, seen)
+		}
+
+		// A cursor points into the order it came from only.
+		if _, err := r.Query().ProductsConnection(context.Background(), nil, after, nil, nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for a price cursor in the default order, got %v", err)
+		}
+	})
+}
+
+// fakeListingPreferencesRepository is an in-memory models.ListingPreferencesRepository.
+type fakeListingPreferencesRepository struct {
+	prefs map[string]*models.ListingPreferences
+	err   error
+}
+
+func (f *fakeListingPreferencesRepository) Get(ctx context.Context, userID string) (*models.ListingPreferences, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if prefs, ok := f.prefs[userID]; ok {
+		return prefs, nil
+	}
+	return &models.ListingPreferences{}, nil
+}
+
+func (f *fakeListingPreferencesRepository) Save(ctx context.Context, userID string, prefs *models.ListingPreferences) error {
+	f.prefs[userID] = prefs
+	return nil
+}
+
+func TestListingPreferences(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "1"}}}
+	prefs := &fakeListingPreferencesRepository{prefs: map[string]*models.ListingPreferences{}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products, r.Preferences = products, prefs
+	intPtr := func(n int) *int { return &n }
+	ctx := asUser("42")
+
+	t.Run("invalid", func(t *testing.T) {
+		blank := " "
+		_, err := r.Mutation().SavePreferences(ctx, models.ListingPreferencesInput{PageSize: intPtr(maxPreferredPageSize + 1), CategorySlug: &blank})
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || len(validationErr.Fields) != 2 {
+			t.Fatalf("expected a ValidationError on pageSize and categorySlug, got %v", err)
+		}
+	})
+
+	sort, slug := models.ProductSortPriceAsc, " bags "
+	saved, err := r.Mutation().SavePreferences(ctx, models.ListingPreferencesInput{Sort: &sort, PageSize: intPtr(10), CategorySlug: &slug})
+	if err != nil {
+		t.Fatalf("SavePreferences returned error: %v", err)
+	}
+	if *saved.CategorySlug != "bags" {
+		t.Fatalf("expected the category slug to be trimmed, got %q", *saved.CategorySlug)
+	}
+	if got, err := r.Query().ListingPreferences(ctx); err != nil || got != prefs.prefs["42"] {
+		t.Fatalf("expected the saved preferences, got (%+v, %v)", got, err)
+	}
+
+	t.Run("defaults for left out arguments", func(t *testing.T) {
+		if _, err := r.Query().Products(ctx, nil, nil, nil, nil); err != nil {
+			t.Fatalf("Products returned error: %v", err)
+		}
+		if products.sort != models.ProductSortPriceAsc || products.limit != 10 {
+			t.Fatalf("expected the saved sort and page size, got %s and %d", products.sort, products.limit)
+		}
+
+		newest, all := models.ProductSortNewest, "shoes"
+		if _, err := r.Query().Products(ctx, intPtr(5), nil, &all, &newest); err != nil {
+			t.Fatalf("Products returned error: %v", err)
+		}
+		if products.sort != models.ProductSortNewest || products.limit != 5 {
+			t.Fatalf("expected the arguments to win, got %s and %d", products.sort, products.limit)
+		}
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		if _, err := r.Query().ProductsConnection(context.Background(), nil, nil, nil, nil); err != nil {
+			t.Fatalf("ProductsConnection returned error: %v", err)
+		}
+		if products.sort != models.DefaultProductSort || products.limit != models.DefaultPageLimit+1 {
+			t.Fatalf("expected the global defaults, got %s and %d", products.sort, products.limit)
+		}
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		prefs.err = errors.New("connection reset")
+		defer func() { prefs.err = nil }()
+		if _, err := r.Query().Products(ctx, nil, nil, nil, nil); err != nil {
+			t.Fatalf("expected the listing to fall back to the global defaults, got %v", err)
+		}
+		if products.sort != models.DefaultProductSort || products.limit != models.DefaultPageLimit {
+			t.Fatalf("expected the global defaults, got %s and %d", products.sort, products.limit)
+		}
+	})
+}
+
+func TestSearchProductsQuery(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{
+		{ID: "1", Name: "Tote bag", Description: "Canvas, 15L"},
+		{ID: "2", Name: "Canvas sneakers"},
+		{ID: "3", Name: "Mug", Description: "Ceramic"},
+	}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products = products
+	intPtr := func(n int) *int { return &n }
+
+	t.Run("multi-word", func(t *testing.T) {
+		got, err := r.Query().SearchProducts(context.Background(), "  canvas TOTE ", nil, nil)
+		if err != nil {
+			t.Fatalf("SearchProducts returned error: %v", err)
+		}
+		if len(got) != 1 || got[0].ID != "1" || products.limit != models.DefaultPageLimit || products.offset != 0 {
+			t.Fatalf("got %+v with limit %d offset %d", got, products.limit, products.offset)
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		for _, query := range []string{"", "   ", strings.Repeat("a", maxSearchQueryLength+1)} {
+			if _, err := r.Query().SearchProducts(context.Background(), query, nil, nil); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("query %q: expected ErrInvalidArgument, got %v", query, err)
+			}
+		}
+		if _, err := r.Query().SearchProducts(context.Background(), "mug", intPtr(0), nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for zero limit, got %v", err)
+		}
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		products.err = errors.New("connection reset")
+		defer func() { products.err = nil }()
+
+		if _, err := r.Query().SearchProducts(context.Background(), "mug", nil, nil); !errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrDatabase, got %v", err)
+		}
+	})
+}
+
+func TestFrequentlyBoughtTogetherQuery(t *testing.T) {
+	products := &fakeProductRepository{
+		products: []*models.Product{
+			{ID: "1", Name: "Tote bag", StockQty: 3},
+			{ID: "2", Name: "Mug", StockQty: 0},
+			{ID: "3", Name: "Coaster", StockQty: 12},
+		},
+		together: map[string][]string{"1": {"2", "3"}},
+	}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products = products
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake := clock.NewFake(now)
+	r.Clock = fake
+	r.Recommendations = NewRecommendationCache(time.Hour)
+	intPtr := func(n int) *int { return &n }
+
+	t.Run("cached", func(t *testing.T) {
+		for range 2 {
+			got, err := r.Query().FrequentlyBoughtTogether(context.Background(), "1", nil)
+			if err != nil {
+				t.Fatalf("FrequentlyBoughtTogether returned error: %v", err)
+			}
+			if len(got) != 1 || got[0].ID != "3" || products.limit != defaultRecommendations {
+				t.Fatalf("expected only the in-stock product, got %+v with limit %d", got, products.limit)
+			}
+		}
+		if products.computed != 1 {
+			t.Fatalf("expected the second query to be served from the cache, computed %d times", products.computed)
+		}
+
+		if _, err := r.Query().FrequentlyBoughtTogether(context.Background(), "1", intPtr(1)); err != nil {
+			t.Fatalf("FrequentlyBoughtTogether returned error: %v", err)
+		}
+		if products.computed != 2 {
+			t.Fatalf("expected another limit to be computed separately, computed %d times", products.computed)
+		}
+
+		fake.Advance(time.Hour)
+		if _, err := r.Query().FrequentlyBoughtTogether(context.Background(), "1", nil); err != nil {
+			t.Fatalf("FrequentlyBoughtTogether returned error: %v", err)
+		}
+		if products.computed != 3 {
+			t.Fatalf("expected an expired result to be recomputed, computed %d times", products.computed)
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		if _, err := r.Query().FrequentlyBoughtTogether(context.Background(), "abc", nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for a malformed ID, got %v", err)
+		}
+		for _, limit := range []int{0, maxRecommendations + 1} {
+			if _, err := r.Query().FrequentlyBoughtTogether(context.Background(), "1", intPtr(limit)); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("limit %d: expected ErrInvalidArgument, got %v", limit, err)
+			}
+		}
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		products.err = errors.New("connection reset")
+		defer func() { products.err = nil }()
+
+		if _, err := r.Query().FrequentlyBoughtTogether(context.Background(), "3", nil); !errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrDatabase, got %v", err)
+		}
+	})
+}
+
+// fakeFlashSaleRepository is an in-memory models.FlashSaleRepository.
+type fakeFlashSaleRepository struct {
+	sales    []*models.FlashSale
+	products map[string][]*models.Product // sale ID -> products on the sale
+}
+
+func (f *fakeFlashSaleRepository) running(sale *models.FlashSale, now time.Time) bool {
+	return !now.Before(sale.StartsAt) && now.Before(sale.EndsAt)
+}
+
+func (f *fakeFlashSaleRepository) Active(ctx context.Context, now time.Time) ([]*models.FlashSale, error) {
+	active := []*models.FlashSale{}
+	for _, sale := range f.sales {
+		if f.running(sale, now) {
+			active = append(active, sale)
+		}
+	}
+	slices.SortFunc(active, func(a, b *models.FlashSale) int { return a.EndsAt.Compare(b.EndsAt) })
+	return active, nil
+}
+
+func (f *fakeFlashSaleRepository) ActiveByProducts(ctx context.Context, productIDs []string, now time.Time) (map[string]*models.FlashSale, error) {
+	deepest := map[string]*models.FlashSale{}
+	for _, sale := range f.sales {
+		if !f.running(sale, now) {
+			continue
+		}
+		for _, p := range f.products[sale.ID] {
+			if best := deepest[p.ID]; slices.Contains(productIDs, p.ID) && (best == nil || sale.PercentOff > best.PercentOff) {
+				deepest[p.ID] = sale
+			}
+		}
+	}
+	return deepest, nil
+}
+
+func (f *fakeFlashSaleRepository) Products(ctx context.Context, saleID string) ([]*models.Product, error) {
+	return f.products[saleID], nil
+}
+
+func TestFlashSales(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mug := &models.Product{ID: "7", Name: "Mug", PriceCents: 899}
+	tote := &models.Product{ID: "8", Name: "Tote bag", PriceCents: 1999}
+	sales := &fakeFlashSaleRepository{
+		sales: []*models.FlashSale{
+			{ID: "1", Name: "Weekend", PercentOff: 10, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(48 * time.Hour)},
+			{ID: "2", Name: "Lunch deals", PercentOff: 20, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)},
+			{ID: "3", Name: "Tomorrow", PercentOff: 50, StartsAt: now.Add(24 * time.Hour), EndsAt: now.Add(25 * time.Hour)},
+		},
+		products: map[string][]*models.Product{"1": {mug, tote}, "2": {mug}, "3": {mug, tote}},
+	}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.FlashSales = sales
+	fake := clock.NewFake(now)
+	r.Clock = fake
+
+	t.Run("active sales", func(t *testing.T) {
+		active, err := r.Query().ActiveFlashSales(context.Background())
+		if err != nil {
+			t.Fatalf("ActiveFlashSales returned error: %v", err)
+		}
+		if len(active) != 2 || active[0].ID != "2" || active[1].ID != "1" {
+			t.Fatalf("expected the running sales, soonest to end first, got %+v", active)
+		}
+		products, err := r.FlashSale().Products(context.Background(), active[1])
+		if err != nil || len(products) != 2 {
+			t.Fatalf("expected the sale's 2 products, got %+v (%v)", products, err)
+		}
+	})
+
+	t.Run("deepest discount wins", func(t *testing.T) {
+		sale, err := r.Product().ActiveFlashSale(context.Background(), mug)
+		if err != nil {
+			t.Fatalf("ActiveFlashSale returned error: %v", err)
+		}
+		if sale == nil || sale.ID != "2" || !sale.EndsAt.Equal(now.Add(time.Hour)) {
+			t.Fatalf("expected the 20%% sale with its end time, got %+v", sale)
+		}
+		price, err := r.Product().SalePriceCents(context.Background(), mug)
+		if err != nil || price == nil || *price != 720 {
+			t.Fatalf("expected a sale price of 720, got %v (%v)", price, err)
+		}
+	})
+
+	t.Run("outside the window", func(t *testing.T) {
+		fake.Advance(72 * time.Hour)
+		sale, err := r.Product().ActiveFlashSale(context.Background(), tote)
+		if err != nil || sale != nil {
+			t.Fatalf("expected no sale once every sale ended, got %+v (%v)", sale, err)
+		}
+		if price, err := r.Product().SalePriceCents(context.Background(), tote); err != nil || price != nil {
+			t.Fatalf("expected no sale price, got %v (%v)", price, err)
+		}
+	})
+}
+
+// fakeCategoryRepository is an in-memory models.CategoryRepository.
+type fakeCategoryRepository struct {
+	categories []*models.Category
+	err        error
+}
+
+func (f *fakeCategoryRepository) List(ctx context.Context) ([]*models.Category, error) {
+	return f.categories, f.err
+}
+
+func TestCategoriesQuery(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+	categories := &fakeCategoryRepository{categories: []*models.Category{
+		{ID: "1", Name: "Bags", Slug: "bags"},
+		{ID: "2", Name: "Totes", Slug: "totes", ParentID: strPtr("1")},
+	}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Categories = categories
+
+	got, err := r.Query().Categories(context.Background())
+	if err != nil {
+		t.Fatalf("Categories returned error: %v", err)
+	}
+	if len(got) != 1 || got[0].Slug != "bags" || len(got[0].Children) != 1 || got[0].Children[0].Slug != "totes" {
+		t.Fatalf("unexpected tree: %+v", got)
+	}
+
+	categories.err = errors.New("connection reset")
+	if _, err := r.Query().Categories(context.Background()); !errors.Is(err, ErrDatabase) {
+		t.Fatalf("expected ErrDatabase, got %v", err)
+	}
+}
+
+func TestProductQuery(t *testing.T) {
+	stored := &models.Product{ID: "1", Name: "Tote bag", PriceCents: 1999, Currency: "USD"}
+	products := &fakeProductRepository{products: []*models.Product{stored}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products = products
+
+	t.Run("found", func(t *testing.T) {
+		got, err := r.Query().Product(context.Background(), "1")
+		if err != nil || got != stored {
+			t.Fatalf("Product = (%+v, %v), want (%+v, nil)", got, err, stored)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		got, err := r.Query().Product(context.Background(), "404")
+		if err != nil || got != nil {
+			t.Fatalf("expected (nil, nil), got (%+v, %v)", got, err)
+		}
+	})
+
+	t.Run("malformed id", func(t *testing.T) {
+		for _, id := range []string{"", "abc", "-1", "0", "1; DROP TABLE products"} {
+			if _, err := r.Query().Product(context.Background(), id); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("Product(%q): expected ErrInvalidArgument, got %v", id, err)
+			}
+		}
+	})
+}
+
+func TestCreateProduct(t *testing.T) {
+	products := &fakeProductRepository{}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Products = products
+	r.Admins = map[string]bool{"1": true}
+	input := models.CreateProductInput{Name: "Tote bag", PriceCents: 1999, SKU: "TOTE-1"}
+
+	t.Run("valid", func(t *testing.T) {
+		product, err := r.Mutation().CreateProduct(asUser("1"), input)
+		if err != nil {
+			t.Fatalf("CreateProduct returned error: %v", err)
+		}
+		if product.ID == "" || product.CreatedAt.IsZero() || product.Currency != defaultCurrency {
+			t.Fatalf("unexpected product: %+v", product)
+		}
+	})
+
+	t.Run("duplicate SKU", func(t *testing.T) {
+		if _, err := r.Mutation().CreateProduct(asUser("1"), input); !errors.Is(err, models.ErrDuplicateSKU) {
+			t.Fatalf("expected ErrDuplicateSKU, got %v", err)
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		for name, in := range map[string]models.CreateProductInput{
+			"empty name":  {Name: " ", PriceCents: 100, SKU: "X-1"},
+			"long name":   {Name: strings.Repeat("é", maxProductNameLength+1), PriceCents: 100, SKU: "X-1"},
+			"zero price":  {Name: "Mug", SKU: "X-1"},
+			"missing sku": {Name: "Mug", PriceCents: 100},
+			"zero limit":  {Name: "Mug", PriceCents: 100, SKU: "X-1", MaxPerOrder: new(int)},
+		} {
+			if _, err := r.Mutation().CreateProduct(asUser("1"), in); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("%s: expected ErrInvalidArgument, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		if _, err := r.Mutation().CreateProduct(asUser("2"), input); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("expected ErrForbidden, got %v", err)
+		}
+		if _, err := r.Mutation().CreateProduct(context.Background(), input); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+func TestImportProducts(t *testing.T) {
+	csvFile := func(lines ...string) graphql.Upload {
+		data := strings.Join(lines, "\n") + "\n"
+		return graphql.Upload{File: strings.NewReader(data), Filename: "products.csv", Size: int64(len(data)), ContentType: "text/csv"}
+	}
+	newResolver := func(products *fakeProductRepository) *Resolver {
+		r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+		r.Products = products
+		r.Admins = map[string]bool{"1": true}
+		return r
+	}
+
+	t.Run("clean file", func(t *testing.T) {
+		products := &fakeProductRepository{}
+		r := newResolver(products)
+
+		result, err := r.Mutation().ImportProducts(asUser("1"), csvFile(
+			"\uFEFFSKU,Name,priceCents,description,currency,stockQty",
+			"MUG-1,Mug,1299,\"A mug, for coffee\",eur,10",
+			"TOTE-1,Tote bag,1999,,,",
+		))
+		if err != nil {
+			t.Fatalf("ImportProducts returned error: %v", err)
+		}
+		if result.InsertedCount != 2 || result.FailedCount != 0 || len(result.Errors) != 0 {
+			t.Fatalf("expected 2 inserted rows and no errors, got %+v", result)
+		}
+		if len(products.products) != 2 {
+			t.Fatalf("expected 2 products, got %d", len(products.products))
+		}
+		mug, tote := products.products[0], products.products[1]
+		if mug.Description != "A mug, for coffee" || mug.Currency != "EUR" || mug.StockQty != 10 || mug.PriceCents != 1299 {
+			t.Fatalf("unexpected product: %+v", mug)
+		}
+		if tote.Currency != defaultCurrency || tote.StockQty != 0 {
+			t.Fatalf("expected defaults to be filled in, got %+v", tote)
+		}
+	})
+
+	t.Run("invalid rows", func(t *testing.T) {
+		products := &fakeProductRepository{}
+		r := newResolver(products)
+
+		result, err := r.Mutation().ImportProducts(asUser("1"), csvFile(
+			"name,priceCents,sku",
+			"Mug,1299,MUG-1",
+			"Tote bag,free,TOTE-1",
+			",500,CAP-1",
+			"Poster,0,POSTER-1",
+			"Sticker,100",
+			"Mug again,1499,MUG-1",
+			"Pen,199,PEN-1",
+		))
+		if err != nil {
+			t.Fatalf("ImportProducts returned error: %v", err)
+		}
+		if result.InsertedCount != 2 || result.FailedCount != 5 {
+			t.Fatalf("expected 2 inserted and 5 failed rows, got %+v", result)
+		}
+		want := []struct {
+			line    int
+			sku     string
+			message string
+		}{
+			{3, "TOTE-1", "priceCents must be an integer"},
+			{4, "CAP-1", "name must not be empty"},
+			{5, "POSTER-1", "priceCents must be positive"},
+			{6, "", "wrong number of fields"},
+			{7, "MUG-1", "sku is already used on line 2"},
+		}
+		for i, w := range want {
+			got := result.Errors[i]
+			if got.Line != w.line || deref(got.SKU) != w.sku || got.Message != w.message {
+				t.Errorf("error %d: expected line %d, sku %q, %q, got line %d, sku %q, %q", i, w.line, w.sku, w.message, got.Line, deref(got.SKU), got.Message)
+			}
+		}
+		if len(products.products) != 2 || products.products[1].SKU != "PEN-1" {
+			t.Fatalf("expected the valid rows to be inserted, got %d products", len(products.products))
+		}
+	})
+
+	t.Run("duplicate SKU", func(t *testing.T) {
+		products := &fakeProductRepository{products: []*models.Product{{ID: "1", Name: "Mug", SKU: "MUG-1"}}}
+		r := newResolver(products)
+
+		result, err := r.Mutation().ImportProducts(asUser("1"), csvFile(
+			"name,priceCents,sku",
+			"Tote bag,1999,TOTE-1",
+			"Mug,1299,MUG-1",
+		))
+		if err != nil {
+			t.Fatalf("ImportProducts returned error: %v", err)
+		}
+		if result.InsertedCount != 1 || result.FailedCount != 1 {
+			t.Fatalf("expected 1 inserted and 1 failed row, got %+v", result)
+		}
+		if got := result.Errors[0]; got.Line != 3 || deref(got.SKU) != "MUG-1" || got.Message != models.ErrDuplicateSKU.Error() {
+			t.Fatalf("expected a duplicate SKU error on line 3, got %+v", got)
+		}
+		if len(products.products) != 2 || products.products[0].Name != "Mug" {
+			t.Fatalf("expected the existing product to be kept and the tote bag added, got %d products", len(products.products))
+		}
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		r := newResolver(&fakeProductRepository{})
+		for name, file := range map[string]graphql.Upload{
+			"empty":          csvFile(),
+			"unknown column": csvFile("name,priceCents,sku,color"),
+			"missing column": csvFile("name,priceCents"),
+			"repeated":       csvFile("name,priceCents,sku,SKU"),
+		} {
+			_, err := r.Mutation().ImportProducts(asUser("1"), file)
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != "file" {
+				t.Errorf("%s: expected a file FieldError, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("too many rows", func(t *testing.T) {
+		products := &fakeProductRepository{}
+		r := newResolver(products)
+		lines := []string{"name,priceCents,sku"}
+		for i := range maxImportRows + 1 {
+			lines = append(lines, fmt.Sprintf("Mug %d,100,MUG-%d", i, i))
+		}
+		_, err := r.Mutation().ImportProducts(asUser("1"), csvFile(lines...))
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != "file" {
+			t.Fatalf("expected a file FieldError, got %v", err)
+		}
+		if len(products.products) != 0 {
+			t.Fatalf("expected nothing to be inserted, got %d products", len(products.products))
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		r := newResolver(&fakeProductRepository{err: errors.New("connection refused")})
+		_, err := r.Mutation().ImportProducts(asUser("1"), csvFile("name,priceCents,sku", "Mug,1299,MUG-1"))
+		if !errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrDatabase, got %v", err)
+		}
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		r := newResolver(&fakeProductRepository{})
+		if _, err := r.Mutation().ImportProducts(asUser("2"), csvFile("name,priceCents,sku")); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("expected ErrForbidden, got %v", err)
+		}
+	})
+}
+
+// fakeProductImageRepository is an in-memory models.ProductImageRepository over a
+// fakeProductRepository's products.
+type fakeProductImageRepository struct {
+	products   *fakeProductRepository
+	images     []*models.ProductImage
+	nextID     int
+	batchLoads int // Number of ListByProducts calls.
+}
+
+func (f *fakeProductImageRepository) Add(ctx context.Context, image *models.ProductImage) error {
+	if _, err := f.products.GetByID(ctx, image.ProductID); err != nil {
+		return err
+	}
+	f.nextID++
+	image.ID = strconv.Itoa(f.nextID)
+	image.Position = len(f.byProduct(image.ProductID))
+	f.images = append(f.images, image)
+	return nil
+}
+
+func (f *fakeProductImageRepository) ListByProduct(ctx context.Context, productID string) ([]*models.ProductImage, error) {
+	return f.byProduct(productID), nil
+}
+
+func (f *fakeProductImageRepository) ListByProducts(ctx context.Context, productIDs []string) (map[string][]*models.ProductImage, error) {
+	f.batchLoads++
+	images := map[string][]*models.ProductImage{}
+	for _, id := range productIDs {
+		if found := f.byProduct(id); len(found) > 0 {
+			images[id] = found
+		}
+	}
+	return images, nil
+}
+
+func (f *fakeProductImageRepository) Reorder(ctx context.Context, productID string, positions map[string]int) ([]*models.ProductImage, error) {
+	if _, err := f.products.GetByID(ctx, productID); err != nil {
+		return nil, err
+	}
+	images := f.byProduct(productID)
+	if len(images) != len(positions) {
+		return nil, models.ErrImagesMismatch
+	}
+	for _, image := range images {
+		if _, ok := positions[image.ID]; !ok {
+			return nil, models.ErrImagesMismatch
+		}
+	}
+	for _, image := range images {
+		image.Position = positions[image.ID]
+	}
+	return f.byProduct(productID), nil
+}
+
+func (f *fakeProductImageRepository) Delete(ctx context.Context, id string) error {
+	i := slices.IndexFunc(f.images, func(image *models.ProductImage) bool { return image.ID == id })
+	if i < 0 {
+		return models.ErrNotFound
+	}
+	deleted := f.images[i]
+	f.images = slices.Delete(f.images, i, i+1)
+	for _, image := range f.images {
+		if image.ProductID == deleted.ProductID && image.Position > deleted.Position {
+			image.Position--
+		}
+	}
+	return nil
+}
+
+// byProduct returns a product's images ordered by position.
+func (f *fakeProductImageRepository) byProduct(productID string) []*models.ProductImage {
+	images := []*models.ProductImage{}
+	for _, image := range f.images {
+		if image.ProductID == productID {
+			images = append(images, image)
+		}
+	}
+	slices.SortFunc(images, func(a, b *models.ProductImage) int { return a.Position - b.Position })
+	return images
+}
+
+// imageIDs returns the IDs of images in order.
+func imageIDs(images []*models.ProductImage) []string {
+	ids := make([]string, len(images))
+	for i, image := range images {
+		ids[i] = image.ID
+	}
+	return ids
+}
+
+func TestAddProductImage(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "7", Name: "Mug"}}}
+	images := &fakeProductImageRepository{products: products}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.ProductImages = images
+	r.Admins = map[string]bool{"1": true}
+
+	t.Run("appends images", func(t *testing.T) {
+		for i, url := range []string{" https://cdn.example.com/a.png ", "http://cdn.example.com/b.png"} {
+			image, err := r.Mutation().AddProductImage(asUser("1"), "7", url)
+			if err != nil {
+				t.Fatalf("AddProductImage returned error: %v", err)
+			}
+			if image.ID == "" || image.ProductID != "7" || image.URL != strings.TrimSpace(url) || image.Position != i {
+				t.Fatalf("unexpected image: %+v", image)
+			}
+		}
+
+		listed, err := r.Product().Images(context.Background(), products.products[0])
+		if err != nil {
+			t.Fatalf("Images returned error: %v", err)
+		}
+		if len(listed) != 2 || listed[0].URL != "https://cdn.example.com/a.png" || listed[1].Position != 1 {
+			t.Fatalf("expected the product's images in order, got %v", imageIDs(listed))
+		}
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		for _, url := range []string{"", "cdn.example.com/a.png", "ftp://cdn.example.com/a.png", "https://", "https://cdn.example.com/" + strings.Repeat("a", maxImageURLLength)} {
+			_, err := r.Mutation().AddProductImage(asUser("1"), "7", url)
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != "url" {
+				t.Errorf("%q: expected a url FieldError, got %v", url, err)
+			}
+		}
+	})
+
+	t.Run("unknown product", func(t *testing.T) {
+		if _, err := r.Mutation().AddProductImage(asUser("1"), "404", "https://cdn.example.com/a.png"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		if _, err := r.Mutation().AddProductImage(asUser("2"), "7", "https://cdn.example.com/a.png"); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("expected ErrForbidden, got %v", err)
+		}
+	})
+}
+
+func TestReorderProductImages(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "7", Name: "Mug"}}}
+	images := &fakeProductImageRepository{products: products}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.ProductImages = images
+	r.Admins = map[string]bool{"1": true}
+	for _, url := range []string{"https://cdn.example.com/a.png", "https://cdn.example.com/b.png", "https://cdn.example.com/c.png"} {
+		if _, err := r.Mutation().AddProductImage(asUser("1"), "7", url); err != nil {
+			t.Fatalf("AddProductImage returned error: %v", err)
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		reordered, err := r.Mutation().ReorderProductImages(asUser("1"), "7", []*models.ProductImagePositionInput{
+			{ID: "1", Position: 2}, {ID: "2", Position: 0}, {ID: "3", Position: 1},
+		})
+		if err != nil {
+			t.Fatalf("ReorderProductImages returned error: %v", err)
+		}
+		if got := imageIDs(reordered); !slices.Equal(got, []string{"2", "3", "1"}) {
+			t.Fatalf("expected images 2, 3, 1, got %v", got)
+		}
+	})
+
+	t.Run("invalid positions", func(t *testing.T) {
+		for name, positions := range map[string][]*models.ProductImagePositionInput{
+			"gap":            {{ID: "1", Position: 0}, {ID: "2", Position: 1}, {ID: "3", Position: 3}},
+			"negative":       {{ID: "1", Position: -1}, {ID: "2", Position: 0}, {ID: "3", Position: 1}},
+			"duplicate":      {{ID: "1", Position: 0}, {ID: "2", Position: 0}, {ID: "3", Position: 1}},
+			"repeated image": {{ID: "1", Position: 0}, {ID: "1", Position: 1}, {ID: "3", Position: 2}},
+			"missing image":  {{ID: "1", Position: 0}, {ID: "2", Position: 1}},
+			"unknown image":  {{ID: "1", Position: 0}, {ID: "2", Position: 1}, {ID: "9", Position: 2}},
+			"image too many": {{ID: "1", Position: 0}, {ID: "2", Position: 1}, {ID: "3", Position: 2}, {ID: "9", Position: 3}},
+		} {
+			_, err := r.Mutation().ReorderProductImages(asUser("1"), "7", positions)
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != "positions" {
+				t.Errorf("%s: expected a positions FieldError, got %v", name, err)
+			}
+		}
+		if got := imageIDs(images.byProduct("7")); !slices.Equal(got, []string{"2", "3", "1"}) {
+			t.Fatalf("expected the order to be unchanged, got %v", got)
+		}
+	})
+
+	t.Run("unknown product", func(t *testing.T) {
+		if _, err := r.Mutation().ReorderProductImages(asUser("1"), "404", nil); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		if _, err := r.Mutation().ReorderProductImages(asUser("2"), "7", nil); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("expected ErrForbidden, got %v", err)
+		}
+	})
+}
+
+func TestDeleteProductImage(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "7", Name: "Mug"}}}
+	images := &fakeProductImageRepository{products: products}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.ProductImages = images
+	r.Admins = map[string]bool{"1": true}
+	for _, url := range []string{"https://cdn.example.com/a.png", "https://cdn.example.com/b.png", "https://cdn.example.com/c.png"} {
+		if _, err := r.Mutation().AddProductImage(asUser("1"), "7", url); err != nil {
+			t.Fatalf("AddProductImage returned error: %v", err)
+		}
+	}
+
+	t.Run("closes the gap", func(t *testing.T) {
+		ok, err := r.Mutation().DeleteProductImage(asUser("1"), "2")
+		if err != nil || !ok {
+			t.Fatalf("DeleteProductImage returned %v, %v", ok, err)
+		}
+		remaining := images.byProduct("7")
+		if got := imageIDs(remaining); !slices.Equal(got, []string{"1", "3"}) {
+			t.Fatalf("expected images 1 and 3 to remain, got %v", got)
+		}
+		if remaining[1].Position != 1 {
+			t.Fatalf("expected image 3 to move up to position 1, got %d", remaining[1].Position)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := r.Mutation().DeleteProductImage(asUser("1"), "2"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		if _, err := r.Mutation().DeleteProductImage(asUser("2"), "1"); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("expected ErrForbidden, got %v", err)
+		}
+		if len(images.byProduct("7")) != 2 {
+			t.Fatal("expected the image to be kept")
+		}
+	})
+}
+
+// fakeCartRepository is an in-memory models.CartRepository over a fakeProductRepository's stock.
+type fakeCartRepository struct {
+	products *fakeProductRepository
+	qty      map[string]map[string]int // user ID -> product ID -> quantity
+	saved    map[string]map[string]int // user ID -> product ID -> saved quantity
+}
+
+func newFakeCartRepository(products *fakeProductRepository) *fakeCartRepository {
+	return &fakeCartRepository{products: products, qty: map[string]map[string]int{}, saved: map[string]map[string]int{}}
+}
+
+func (f *fakeCartRepository) Get(ctx context.Context, userID string) (*models.Cart, error) {
+	cart := &models.Cart{UserID: userID, Items: []*models.CartItem{}}
+	for _, p := range f.products.products {
+		if qty := f.qty[userID][p.ID]; qty > 0 {
+			cart.Items = append(cart.Items, &models.CartItem{Product: p, Qty: qty})
+			cart.SubtotalCents += p.PriceCents * int64(qty)
+		}
+	}
+	return cart, nil
+}
+
+func (f *fakeCartRepository) AddItem(ctx context.Context, userID, productID string, qty int) (*models.Cart, error) {
+	product, err := f.products.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if f.qty[userID] == nil {
+		f.qty[userID] = map[string]int{}
+	}
+	if f.qty[userID][productID]+qty > product.StockQty {
+		return nil, models.ErrExceedsStock
+	}
+	if limit := product.MaxPerOrder; limit != nil && f.qty[userID][productID]+qty > *limit {
+		return nil, &models.PurchaseLimitError{ProductID: productID, Limit: *limit}
+	}
+	f.qty[userID][productID] += qty
+	return f.Get(ctx, userID)
+}
+
+func (f *fakeCartRepository) AddItems(ctx context.Context, userID string, items []*models.CartItemInput, allOrNothing bool) (*models.Cart, []error, error) {
+	before := maps.Clone(f.qty[userID])
+	itemErrs := make([]error, len(items))
+	for i, item := range items {
+		if _, err := f.AddItem(ctx, userID, item.ProductID, item.Qty); err != nil {
+			itemErrs[i] = err
+			if allOrNothing {
+				f.qty[userID] = before
+				return nil, itemErrs, err
+			}
+		}
+	}
+	cart, err := f.Get(ctx, userID)
+	return cart, itemErrs, err
+}
+
+func (f *fakeCartRepository) SetItemQty(ctx context.Context, userID, productID string, qty int) (*models.Cart, error) {
+	if f.qty[userID][productID] == 0 {
+		return nil, models.ErrNotInCart
+	}
+	product, err := f.products.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if qty > product.StockQty {
+		return nil, models.ErrExceedsStock
+	}
+	f.qty[userID][productID] = qty
+	return f.Get(ctx, userID)
+}
+
+func (f *fakeCartRepository) RemoveItem(ctx context.Context, userID, productID string) (*models.Cart, error) {
+	if f.qty[userID][productID] == 0 {
+		return nil, models.ErrNotInCart
+	}
+	delete(f.qty[userID], productID)
+	return f.Get(ctx, userID)
+}
+
+func (f *fakeCartRepository) SaveForLater(ctx context.Context, userID, productID string) (*models.Cart, error) {
+	qty := f.qty[userID][productID]
+	if qty == 0 {
+		return nil, models.ErrNotInCart
+	}
+	delete(f.qty[userID], productID)
+	if f.saved[userID] == nil {
+		f.saved[userID] = map[string]int{}
+	}
+	f.saved[userID][productID] += qty
+	return f.Get(ctx, userID)
+}
+
+func (f *fakeCartRepository) MoveToCart(ctx context.Context, userID, productID string) (*models.Cart, error) {
+	qty := f.saved[userID][productID]
+	if qty == 0 {
+		return nil, models.ErrNotSaved
+	}
+	cart, err := f.AddItem(ctx, userID, productID, qty)
+	if err != nil {
+		return nil, err
+	}
+	delete(f.saved[userID], productID)
+	return cart, nil
+}
+
+func (f *fakeCartRepository) SavedItems(ctx context.Context, userID string) ([]*models.CartItem, error) {
+	items := []*models.CartItem{}
+	for _, p := range f.products.products {
+		if qty := f.saved[userID][p.ID]; qty > 0 {
+			items = append(items, &models.CartItem{Product: p, Qty: qty})
+		}
+	}
+	return items, nil
+}
+
+func TestAddToCart(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "7", Name: "Mug", PriceCents: 899, StockQty: 5}}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Carts = newFakeCartRepository(products)
+
+	t.Run("new item", func(t *testing.T) {
+		cart, err := r.Mutation().AddToCart(asUser("42"), "7", 2)
+		if err != nil {
+			t.Fatalf("AddToCart returned error: %v", err)
+		}
+		if len(cart.Items) != 1 || cart.Items[0].Qty != 2 || cart.SubtotalCents != 2*899 {
+			t.Fatalf("unexpected cart: %+v", cart)
+		}
+	})
+
+	t.Run("existing item increments", func(t *testing.T) {
+		cart, err := r.Mutation().AddToCart(asUser("42"), "7", 3)
+		if err != nil {
+			t.Fatalf("AddToCart returned error: %v", err)
+		}
+		if len(cart.Items) != 1 || cart.Items[0].Qty != 5 {
+			t.Fatalf("expected a single item with qty 5, got %+v", cart.Items)
+		}
+	})
+
+	t.Run("over stock", func(t *testing.T) {
+		if _, err := r.Mutation().AddToCart(asUser("42"), "7", 1); !errors.Is(err, models.ErrExceedsStock) {
+			t.Fatalf("expected ErrExceedsStock, got %v", err)
+		}
+	})
+
+	t.Run("over purchase limit", func(t *testing.T) {
+		limit := 1
+		products.products = append(products.products, &models.Product{ID: "8", Name: "Console", PriceCents: 49999, StockQty: 5, MaxPerOrder: &limit})
+		_, err := r.Mutation().AddToCart(asUser("42"), "8", 2)
+		if errorCode(err) != CodeConflict || err.Error() != "product 8 is limited to 1 per order" {
+			t.Fatalf("expected a conflict stating the limit, got %v", err)
+		}
+	})
+
+	t.Run("invalid qty", func(t *testing.T) {
+		if _, err := r.Mutation().AddToCart(asUser("7"), "7", 0); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Mutation().AddToCart(context.Background(), "7", 1); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+func TestAddItemsToCart(t *testing.T) {
+	limit := 1
+	products := &fakeProductRepository{products: []*models.Product{
+		{ID: "7", Name: "Mug", PriceCents: 899, StockQty: 5},
+		{ID: "8", Name: "Console", PriceCents: 49999, StockQty: 5, MaxPerOrder: &limit},
+		{ID: "9", Name: "Tote bag", PriceCents: 1999, StockQty: 1},
+	}}
+	carts := newFakeCartRepository(products)
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Carts = carts
+	items := []*models.CartItemInput{
+		{ProductID: "7", Qty: 2},
+		{ProductID: "8", Qty: 2},
+		{ProductID: "9", Qty: 3},
+		{ProductID: "404", Qty: 1},
+	}
+
+	t.Run("all or nothing", func(t *testing.T) {
+		allOrNothing := true
+		_, err := r.Mutation().AddItemsToCart(asUser("42"), items, &allOrNothing)
+		if errorCode(err) != CodeConflict || err.Error() != "product 8 is limited to 1 per order" {
+			t.Fatalf("expected the first rejection, got %v", err)
+		}
+		if len(carts.qty["42"]) != 0 {
+			t.Fatalf("expected nothing to be added, got %v", carts.qty["42"])
+		}
+	})
+
+	t.Run("rejected items are reported", func(t *testing.T) {
+		payload, err := r.Mutation().AddItemsToCart(asUser("42"), items, nil)
+		if err != nil {
+			t.Fatalf("AddItemsToCart returned error: %v", err)
+		}
+		if len(payload.Cart.Items) != 1 || payload.Cart.Items[0].Product.ID != "7" || payload.Cart.Items[0].Qty != 2 {
+			t.Fatalf("expected only the mugs to be added, got %+v", payload.Cart.Items)
+		}
+		var reasons []models.CartItemErrorReason
+		for i, itemErr := range payload.Errors {
+			if itemErr.Index != i+1 || itemErr.ProductID != items[i+1].ProductID {
+				t.Fatalf("unexpected error %+v", itemErr)
+			}
+			reasons = append(reasons, itemErr.Reason)
+		}
+		want := []models.CartItemErrorReason{models.CartItemErrorReasonPurchaseLimit, models.CartItemErrorReasonOutOfStock, models.CartItemErrorReasonNotFound}
+		if !slices.Equal(reasons, want) {
+			t.Fatalf("expected reasons %v, got %v", want, reasons)
+		}
+	})
+
+	t.Run("invalid items", func(t *testing.T) {
+		_, err := r.Mutation().AddItemsToCart(asUser("42"), []*models.CartItemInput{{ProductID: "abc", Qty: 1}, {ProductID: "7", Qty: 0}}, nil)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || len(validationErr.Fields) != 2 || validationErr.Fields[1].Field != "items.1.qty" {
+			t.Fatalf("expected a ValidationError on both items, got %v", err)
+		}
+		if _, err := r.Mutation().AddItemsToCart(asUser("42"), nil, nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for no items, got %v", err)
+		}
+	})
+}
+
+func TestSaveForLater(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "7", Name: "Mug", PriceCents: 899, StockQty: 5}}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	carts := newFakeCartRepository(products)
+	r.Carts = carts
+
+	if _, err := r.Mutation().AddToCart(asUser("42"), "7", 3); err != nil {
+		t.Fatalf("AddToCart returned error: %v", err)
+	}
+
+	t.Run("save", func(t *testing.T) {
+		cart, err := r.Mutation().SaveForLater(asUser("42"), "7")
+		if err != nil {
+			t.Fatalf("SaveForLater returned error: %v", err)
+		}
+		if len(cart.Items) != 0 || cart.SubtotalCents != 0 {
+			t.Fatalf("expected the item to leave the cart, got %+v", cart)
+		}
+		saved, err := r.Cart().SavedItems(asUser("42"), cart)
+		if err != nil {
+			t.Fatalf("SavedItems returned error: %v", err)
+		}
+		if len(saved) != 1 || saved[0].Product.ID != "7" || saved[0].Qty != 3 {
+			t.Fatalf("expected the item to be saved with its quantity, got %+v", saved)
+		}
+	})
+
+	t.Run("not in cart", func(t *testing.T) {
+		if _, err := r.Mutation().SaveForLater(asUser("42"), "7"); !errors.Is(err, models.ErrNotInCart) {
+			t.Fatalf("expected ErrNotInCart, got %v", err)
+		}
+	})
+
+	t.Run("move back over stock", func(t *testing.T) {
+		if _, err := r.Mutation().AddToCart(asUser("42"), "7", 3); err != nil {
+			t.Fatalf("AddToCart returned error: %v", err)
+		}
+		if _, err := r.Mutation().MoveToCart(asUser("42"), "7"); !errors.Is(err, models.ErrExceedsStock) {
+			t.Fatalf("expected ErrExceedsStock, got %v", err)
+		}
+		if carts.saved["42"]["7"] != 3 {
+			t.Fatalf("expected the item to stay saved, got %v", carts.saved["42"])
+		}
+	})
+
+	t.Run("move back", func(t *testing.T) {
+		if _, err := r.Mutation().RemoveFromCart(asUser("42"), "7"); err != nil {
+			t.Fatalf("RemoveFromCart returned error: %v", err)
+		}
+		cart, err := r.Mutation().MoveToCart(asUser("42"), "7")
+		if err != nil {
+			t.Fatalf("MoveToCart returned error: %v", err)
+		}
+		if len(cart.Items) != 1 || cart.Items[0].Qty != 3 {
+			t.Fatalf("expected the saved quantity in the cart, got %+v", cart.Items)
+		}
+		if saved, _ := r.Cart().SavedItems(asUser("42"), cart); len(saved) != 0 {
+			t.Fatalf("expected no saved items, got %+v", saved)
+		}
+	})
+
+	t.Run("not saved", func(t *testing.T) {
+		_, err := r.Mutation().MoveToCart(asUser("42"), "7")
+		if !errors.Is(err, models.ErrNotSaved) || errorCode(err) != CodeNotFound {
+			t.Fatalf("expected a not found ErrNotSaved, got %v", err)
+		}
+	})
+}
+
+// fakeWishlistRepository is an in-memory models.WishlistRepository over a fakeProductRepository.
+type fakeWishlistRepository struct {
+	products *fakeProductRepository
+	saved    map[string][]string // user ID -> product IDs, oldest first
+}
+
+func newFakeWishlistRepository(products *fakeProductRepository) *fakeWishlistRepository {
+	return &fakeWishlistRepository{products: products, saved: map[string][]string{}}
+}
+
+func (f *fakeWishlistRepository) Get(ctx context.Context, userID string) (*models.Wishlist, error) {
+	wishlist := &models.Wishlist{UserID: userID, Items: []*models.WishlistItem{}}
+	for _, id := range f.saved[userID] {
+		product, err := f.products.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		wishlist.Items = append(wishlist.Items, &models.WishlistItem{Product: product})
+	}
+	return wishlist, nil
+}
+
+func (f *fakeWishlistRepository) AddItem(ctx context.Context, userID, productID string) (*models.Wishlist, error) {
+	if _, err := f.products.GetByID(ctx, productID); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(f.saved[userID], productID) {
+		f.saved[userID] = append(f.saved[userID], productID)
+	}
+	return f.Get(ctx, userID)
+}
+
+func (f *fakeWishlistRepository) RemoveItem(ctx context.Context, userID, productID string) (*models.Wishlist, error) {
+	f.saved[userID] = slices.DeleteFunc(f.saved[userID], func(id string) bool { return id == productID })
+	return f.Get(ctx, userID)
+}
+
+func TestWishlist(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{
+		{ID: "7", Name: "Mug", PriceCents: 899},
+		{ID: "8", Name: "Tote bag", PriceCents: 1999},
+	}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Wishlists = newFakeWishlistRepository(products)
+
+	t.Run("add", func(t *testing.T) {
+		for _, id := range []string{"8", "7"} {
+			if _, err := r.Mutation().AddToWishlist(asUser("42"), id); err != nil {
+				t.Fatalf("AddToWishlist(%s) returned error: %v", id, err)
+			}
+		}
+	})
+
+	t.Run("duplicate is a no-op", func(t *testing.T) {
+		wishlist, err := r.Mutation().AddToWishlist(asUser("42"), "8")
+		if err != nil {
+			t.Fatalf("AddToWishlist returned error: %v", err)
+		}
+		if len(wishlist.Items) != 2 {
+			t.Fatalf("expected 2 items, got %d", len(wishlist.Items))
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		wishlist, err := r.Query().Wishlist(asUser("42"))
+		if err != nil {
+			t.Fatalf("Wishlist returned error: %v", err)
+		}
+		if len(wishlist.Items) != 2 || wishlist.Items[0].Product.ID != "8" || wishlist.Items[1].Product.ID != "7" {
+			t.Fatalf("expected the tote bag then the mug, got %+v", wishlist.Items)
+		}
+		if other, err := r.Query().Wishlist(asUser("43")); err != nil || len(other.Items) != 0 {
+			t.Fatalf("expected another user's wishlist to be empty, got (%+v, %v)", other, err)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		wishlist, err := r.Mutation().RemoveFromWishlist(asUser("42"), "8")
+		if err != nil {
+			t.Fatalf("RemoveFromWishlist returned error: %v", err)
+		}
+		if len(wishlist.Items) != 1 || wishlist.Items[0].Product.ID != "7" {
+			t.Fatalf("expected only the mug to remain, got %+v", wishlist.Items)
+		}
+	})
+
+	t.Run("missing product", func(t *testing.T) {
+		if _, err := r.Mutation().AddToWishlist(asUser("42"), "404"); !errors.Is(err, models.ErrNotFound) || errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		if _, err := r.Mutation().AddToWishlist(asUser("42"), "abc"); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Query().Wishlist(context.Background()); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+// fakeAddressRepository is an in-memory models.AddressRepository.
+type fakeAddressRepository struct {
+	addresses []*models.Address // Oldest first.
+	nextID    int
+}
+
+func (f *fakeAddressRepository) ListByUser(ctx context.Context, userID string) ([]*models.Address, error) {
+	addresses := []*models.Address{}
+	for _, a := range f.addresses {
+		if a.UserID == userID {
+			copied := *a
+			addresses = append(addresses, &copied)
+		}
+	}
+	slices.SortStableFunc(addresses, func(a, b *models.Address) int {
+		if a.IsDefault != b.IsDefault && a.IsDefault {
+			return -1
+		} else if a.IsDefault != b.IsDefault {
+			return 1
+		}
+		return 0
+	})
+	return addresses, nil
+}
+
+func (f *fakeAddressRepository) GetByID(ctx context.Context, userID, id string) (*models.Address, error) {
+	for _, a := range f.addresses {
+		if a.ID == id && a.UserID == userID {
+			copied := *a
+			return &copied, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeAddressRepository) Create(ctx context.Context, address *models.Address) error {
+	if address.IsDefault {
+		f.unsetDefault(address.UserID)
+	}
+	f.nextID++
+	address.ID = strconv.Itoa(f.nextID)
+	address.CreatedAt = time.Now()
+	copied := *address
+	f.addresses = append(f.addresses, &copied)
+	return nil
+}
+
+func (f *fakeAddressRepository) Update(ctx context.Context, address *models.Address) error {
+	i := slices.IndexFunc(f.addresses, func(a *models.Address) bool { return a.ID == address.ID && a.UserID == address.UserID })
+	if i < 0 {
+		return models.ErrNotFound
+	}
+	if address.IsDefault {
+		f.unsetDefault(address.UserID)
+	}
+	copied := *address
+	f.addresses[i] = &copied
+	return nil
+}
+
+func (f *fakeAddressRepository) Delete(ctx context.Context, userID, id string) error {
+	n := len(f.addresses)
+	f.addresses = slices.DeleteFunc(f.addresses, func(a *models.Address) bool { return a.ID == id && a.UserID == userID })
+	if len(f.addresses) == n {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+func (f *fakeAddressRepository) unsetDefault(userID string) {
+	for _, a := range f.addresses {
+		if a.UserID == userID {
+			a.IsDefault = false
+		}
+	}
+}
+
+// defaultAddresses returns the IDs of the user's default addresses.
+func (f *fakeAddressRepository) defaultAddresses(userID string) []string {
+	var ids []string
+	for _, a := range f.addresses {
+		if a.UserID == userID && a.IsDefault {
+			ids = append(ids, a.ID)
+		}
+	}
+	return ids
+}
+
+func TestAddresses(t *testing.T) {
+	addresses := &fakeAddressRepository{}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Addresses = addresses
+	yes := true
+	home := models.AddAddressInput{Line1: " 1 Main St ", City: "Springfield", PostalCode: "62701", Country: "us", IsDefault: &yes}
+	work := models.AddAddressInput{Line1: "2 Elm St", City: "Springfield", PostalCode: "62702", Country: "US"}
+
+	var homeID, workID, shopID string
+	t.Run("add", func(t *testing.T) {
+		address, err := r.Mutation().AddAddress(asUser("42"), home)
+		if err != nil {
+			t.Fatalf("AddAddress returned error: %v", err)
+		}
+		if address.Line1 != "1 Main St" || address.Country != "US" || !address.IsDefault || address.UserID != "42" {
+			t.Fatalf("unexpected address: %+v", address)
+		}
+		homeID = address.ID
+		if address, err = r.Mutation().AddAddress(asUser("42"), work); err != nil || address.IsDefault {
+			t.Fatalf("expected a non-default address, got (%+v, %v)", address, err)
+		}
+		workID = address.ID
+	})
+
+	t.Run("switch default", func(t *testing.T) {
+		address, err := r.Mutation().UpdateAddress(asUser("42"), models.UpdateAddressInput{ID: workID, IsDefault: &yes})
+		if err != nil {
+			t.Fatalf("UpdateAddress returned error: %v", err)
+		}
+		if !address.IsDefault || address.Line1 != "2 Elm St" {
+			t.Fatalf("expected the work address to become the default unchanged, got %+v", address)
+		}
+		if got := addresses.defaultAddresses("42"); len(got) != 1 || got[0] != workID {
+			t.Fatalf("expected only the work address to be the default, got %v", got)
+		}
+
+		list, err := r.Query().Addresses(asUser("42"))
+		if err != nil {
+			t.Fatalf("Addresses returned error: %v", err)
+		}
+		if len(list) != 2 || list[0].ID != workID || list[1].ID != homeID || list[1].IsDefault {
+			t.Fatalf("expected the new default first, got %+v", list)
+		}
+	})
+
+	t.Run("add default", func(t *testing.T) {
+		address, err := r.Mutation().AddAddress(asUser("42"), models.AddAddressInput{Line1: "3 Oak St", City: "Shelbyville", PostalCode: "62565", Country: "US", IsDefault: &yes})
+		if err != nil {
+			t.Fatalf("AddAddress returned error: %v", err)
+		}
+		if got := addresses.defaultAddresses("42"); len(got) != 1 || got[0] != address.ID {
+			t.Fatalf("expected only the new address to be the default, got %v", got)
+		}
+		shopID = address.ID
+	})
+
+	t.Run("delete default", func(t *testing.T) {
+		if ok, err := r.Mutation().DeleteAddress(asUser("42"), shopID); err != nil || !ok {
+			t.Fatalf("DeleteAddress returned (%v, %v)", ok, err)
+		}
+		list, err := r.Query().Addresses(asUser("42"))
+		if err != nil {
+			t.Fatalf("Addresses returned error: %v", err)
+		}
+		if len(list) != 2 || list[0].ID != homeID || list[1].ID != workID || list[0].IsDefault || list[1].IsDefault {
+			t.Fatalf("expected the other addresses to remain without a default, got %+v", list)
+		}
+		if _, err := r.Mutation().DeleteAddress(asUser("42"), shopID); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound for a deleted address, got %v", err)
+		}
+	})
+
+	t.Run("other users", func(t *testing.T) {
+		if _, err := r.Mutation().UpdateAddress(asUser("43"), models.UpdateAddressInput{ID: homeID, IsDefault: &yes}); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound for another user's address, got %v", err)
+		}
+		if _, err := r.Mutation().DeleteAddress(asUser("43"), homeID); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound for another user's address, got %v", err)
+		}
+		if list, err := r.Query().Addresses(asUser("43")); err != nil || len(list) != 0 {
+			t.Fatalf("expected no addresses for another user, got (%+v, %v)", list, err)
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		blank, long := " ", strings.Repeat("a", maxAddressFieldLength+1)
+		for _, tt := range []struct {
+			input models.AddAddressInput
+			field string
+		}{
+			{models.AddAddressInput{Line1: "", City: "Springfield", PostalCode: "62701", Country: "US"}, "input.line1"},
+			{models.AddAddressInput{Line1: "1 Main St", City: blank, PostalCode: "62701", Country: "US"}, "input.city"},
+			{models.AddAddressInput{Line1: "1 Main St", Line2: &long, City: "Springfield", PostalCode: "62701", Country: "US"}, "input.line2"},
+			{models.AddAddressInput{Line1: "1 Main St", City: "Springfield", PostalCode: "62701", Country: "USA"}, "input.country"},
+			{models.AddAddressInput{Line1: "1 Main St", City: "Springfield", PostalCode: "62701", Country: "U1"}, "input.country"},
+		} {
+			var fieldErr *FieldError
+			_, err := r.Mutation().AddAddress(asUser("42"), tt.input)
+			if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field || !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("%+v: expected a FieldError for %s, got %v", tt.input, tt.field, err)
+			}
+		}
+		if _, err := r.Mutation().UpdateAddress(asUser("42"), models.UpdateAddressInput{ID: homeID, PostalCode: &blank}); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for a blank postal code, got %v", err)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Query().Addresses(context.Background()); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+// fakeReviewRepository is an in-memory models.ReviewRepository over a fakeProductRepository.
+type fakeReviewRepository struct {
+	products     *fakeProductRepository
+	reviews      []*models.Review
+	averageLoads int // Number of AverageRatings calls.
+}
+
+func (f *fakeReviewRepository) Create(ctx context.Context, review *models.Review) error {
+	if _, err := f.products.GetByID(ctx, review.ProductID); err != nil {
+		return err
+	}
+	for _, existing := range f.reviews {
+		if existing.ProductID == review.ProductID && existing.UserID == review.UserID {
+			return models.ErrAlreadyReviewed
+		}
+	}
+	review.ID = strconv.Itoa(len(f.reviews) + 1)
+	review.CreatedAt = time.Now()
+	f.reviews = append(f.reviews, review)
+	return nil
+}
+
+func (f *fakeReviewRepository) ListByProduct(ctx context.Context, productID string, limit, offset int) ([]*models.Review, error) {
+	var reviews []*models.Review
+	for i := len(f.reviews) - 1; i >= 0; i-- {
+		if f.reviews[i].ProductID == productID {
+			reviews = append(reviews, f.reviews[i])
+		}
+	}
+	reviews = reviews[min(offset, len(reviews)):]
+	return reviews[:min(limit, len(reviews))], nil
+}
+
+func (f *fakeReviewRepository) AverageRatings(ctx context.Context, productIDs []string) (map[string]float64, error) {
+	f.averageLoads++
+	sums, counts := map[string]int{}, map[string]int{}
+	for _, review := range f.reviews {
+		if slices.Contains(productIDs, review.ProductID) {
+			sums[review.ProductID] += review.Rating
+			counts[review.ProductID]++
+		}
+	}
+	ratings := map[string]float64{}
+	for id, sum := range sums {
+		ratings[id] = float64(sum) / float64(counts[id])
+	}
+	return ratings, nil
+}
+
+func TestCreateReview(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "7", Name: "Mug"}, {ID: "8", Name: "Tote bag"}}}
+	reviews := &fakeReviewRepository{products: products}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Reviews = reviews
+	body := "  Sturdy mug  "
+
+	t.Run("success", func(t *testing.T) {
+		review, err := r.Mutation().CreateReview(asUser("42"), models.CreateReviewInput{ProductID: "7", Rating: 4, Body: &body})
+		if err != nil {
+			t.Fatalf("CreateReview returned error: %v", err)
+		}
+		if review.ID == "" || review.UserID != "42" || review.Rating != 4 || review.Body != "Sturdy mug" {
+			t.Fatalf("unexpected review: %+v", review)
+		}
+	})
+
+	t.Run("already reviewed", func(t *testing.T) {
+		_, err := r.Mutation().CreateReview(asUser("42"), models.CreateReviewInput{ProductID: "7", Rating: 1})
+		if !errors.Is(err, models.ErrAlreadyReviewed) || errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrAlreadyReviewed, got %v", err)
+		}
+		if len(reviews.reviews) != 1 {
+			t.Fatalf("expected the duplicate not to be saved, got %d reviews", len(reviews.reviews))
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		long := strings.Repeat("a", maxReviewBodyLength+1)
+		for _, input := range []models.CreateReviewInput{
+			{ProductID: "8", Rating: 0},
+			{ProductID: "8", Rating: 6},
+			{ProductID: "8", Rating: 5, Body: &long},
+			{ProductID: "abc", Rating: 5},
+		} {
+			if _, err := r.Mutation().CreateReview(asUser("42"), input); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("%+v: expected ErrInvalidArgument, got %v", input, err)
+			}
+		}
+	})
+
+	t.Run("missing product", func(t *testing.T) {
+		if _, err := r.Mutation().CreateReview(asUser("42"), models.CreateReviewInput{ProductID: "404", Rating: 5}); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Mutation().CreateReview(context.Background(), models.CreateReviewInput{ProductID: "8", Rating: 5}); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+func TestReviewsAndAverageRating(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{{ID: "7", Name: "Mug"}, {ID: "8", Name: "Tote bag"}}}
+	reviews := &fakeReviewRepository{products: products}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Reviews = reviews
+	intPtr := func(n int) *int { return &n }
+	for user, rating := range map[string]int{"41": 5, "42": 4, "43": 2} {
+		if _, err := r.Mutation().CreateReview(asUser(user), models.CreateReviewInput{ProductID: "7", Rating: rating}); err != nil {
+			t.Fatalf("CreateReview returned error: %v", err)
+		}
+	}
+
+	list, err := r.Query().Reviews(context.Background(), "7", nil, nil)
+	if err != nil {
+		t.Fatalf("Reviews returned error: %v", err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("expected 3 reviews, got %d", len(list))
+	}
+	if page, err := r.Query().Reviews(context.Background(), "7", intPtr(1), intPtr(1)); err != nil || len(page) != 1 || page[0].ID != list[1].ID {
+		t.Fatalf("expected the second review, got (%+v, %v)", page, err)
+	}
+
+	rating, err := r.Product().AverageRating(context.Background(), products.products[0])
+	if err != nil {
+		t.Fatalf("AverageRating returned error: %v", err)
+	}
+	if rating == nil || *rating != float64(5+4+2)/3 {
+		t.Fatalf("expected an average of %v, got %v", float64(5+4+2)/3, rating)
+	}
+	if rating, err := r.Product().AverageRating(context.Background(), products.products[1]); err != nil || rating != nil {
+		t.Fatalf("expected no rating for an unreviewed product, got (%v, %v)", rating, err)
+	}
+}
+
+func TestUpdateCartItem(t *testing.T) {
+	products := &fakeProductRepository{products: []*models.Product{
+		{ID: "7", Name: "Mug", PriceCents: 899, StockQty: 5},
+		{ID: "8", Name: "Tote bag", PriceCents: 1999, StockQty: 5},
+	}}
+	carts := newFakeCartRepository(products)
+	carts.qty["42"] = map[string]int{"7": 3, "8": 1}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Carts = carts
+
+	t.Run("decrement", func(t *testing.T) {
+		cart, err := r.Mutation().UpdateCartItem(asUser("42"), "7", 1)
+		if err != nil {
+			t.Fatalf("UpdateCartItem returned error: %v", err)
+		}
+		if cart.SubtotalCents != 899+1999 {
+			t.Fatalf("expected recomputed subtotal %d, got %d", 899+1999, cart.SubtotalCents)
+		}
+	})
+
+	t.Run("zero removes", func(t *testing.T) {
+		cart, err := r.Mutation().UpdateCartItem(asUser("42"), "7", 0)
+		if err != nil {
+			t.Fatalf("UpdateCartItem returned error: %v", err)
+		}
+		if len(cart.Items) != 1 || cart.Items[0].Product.ID != "8" || cart.SubtotalCents != 1999 {
+			t.Fatalf("expected only the tote bag to remain, got %+v", cart)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		cart, err := r.Mutation().RemoveFromCart(asUser("42"), "8")
+		if err != nil {
+			t.Fatalf("RemoveFromCart returned error: %v", err)
+		}
+		if len(cart.Items) != 0 || cart.SubtotalCents != 0 {
+			t.Fatalf("expected an empty cart, got %+v", cart)
+		}
+	})
+
+	t.Run("not in cart", func(t *testing.T) {
+		if _, err := r.Mutation().RemoveFromCart(asUser("42"), "8"); !errors.Is(err, models.ErrNotInCart) {
+			t.Fatalf("expected ErrNotInCart, got %v", err)
+		}
+		if _, err := r.Mutation().UpdateCartItem(asUser("42"), "8", 2); !errors.Is(err, models.ErrNotInCart) {
+			t.Fatalf("expected ErrNotInCart, got %v", err)
+		}
+	})
+
+	t.Run("negative qty", func(t *testing.T) {
+		if _, err := r.Mutation().UpdateCartItem(asUser("42"), "7", -1); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument, got %v", err)
+		}
+	})
+}
+
+// fakeCartTotal is the total of every cart checked out of a fakeOrderRepository.
+const fakeCartTotal = 2500
+
+// fakeOrderRepository is an in-memory models.OrderRepository. When err is set Checkout fails with it.
+type fakeOrderRepository struct {
+	orders     []*models.Order
+	coupons    map[string]*models.Coupon   // Coupons redeemable at checkout, by code.
+	keys       map[[2]string]*models.Order // Orders by user ID and idempotency key.
+	items      map[string][]*models.OrderItem
+	itemLoads  int // Number of Items calls.
+	statsLoads int // Number of CustomerStats calls.
+	lastStatus *models.OrderStatus
+	cancelled  []string             // IDs of the orders passed to Cancel that were cancelled.
+	heldUntil  map[string]time.Time // Payment holds by order ID.
+	err        error
+}
+
+func (f *fakeOrderRepository) List(ctx context.Context, userID string, status *models.OrderStatus, page models.PageArgs) (*models.PageResult[*models.Order], error) {
+	f.lastStatus = status
+	if f.err != nil {
+		return nil, f.err
+	}
+	var orders []*models.Order
+	for i := len(f.orders) - 1; i >= 0; i-- {
+		if o := f.orders[i]; o.UserID == userID && (status == nil || o.Status == *status) {
+			copied := *o
+			copied.Items = nil
+			orders = append(orders, &copied)
+		}
+	}
+	return fakePage(orders, page), nil
+}
+
+func (f *fakeOrderRepository) Items(ctx context.Context, orderIDs []string) (map[string][]*models.OrderItem, error) {
+	f.itemLoads++
+	items := map[string][]*models.OrderItem{}
+	for _, id := range orderIDs {
+		if f.items[id] != nil {
+			items[id] = f.items[id]
+		}
+	}
+	return items, nil
+}
+
+func (f *fakeOrderRepository) CustomerStats(ctx context.Context, userIDs []string) (map[string]*models.CustomerStats, error) {
+	f.statsLoads++
+	if f.err != nil {
+		return nil, f.err
+	}
+	stats := map[string]*models.CustomerStats{}
+	for _, o := range f.orders {
+		if o.Status != models.OrderStatusDelivered || !slices.Contains(userIDs, o.UserID) {
+			continue
+		}
+		if stats[o.UserID] == nil {
+			stats[o.UserID] = &models.CustomerStats{}
+		}
+		stats[o.UserID].OrderCount++
+		stats[o.UserID].LifetimeValueCents += o.TotalCents
+	}
+	return stats, nil
+}
+
+func (f *fakeOrderRepository) Checkout(ctx context.Context, userID, idempotencyKey string, shippingAddress *models.ShippingAddress, couponCode string) (*models.Order, bool, error) {
+	if f.err != nil {
+		return nil, false, f.err
+	}
+	if order := f.keys[[2]string{userID, idempotencyKey}]; idempotencyKey != "" && order != nil {
+		return order, false, nil
+	}
+	order := &models.Order{ID: strconv.Itoa(len(f.orders) + 1), UserID: userID, Status: models.OrderStatusPending, SubtotalCents: fakeCartTotal, TotalCents: fakeCartTotal, Currency: "USD", ShippingAddress: shippingAddress, CreatedAt: time.Now()}
+	if couponCode != "" {
+		coupon, ok := f.coupons[couponCode]
+		if !ok {
+			return nil, false, models.ErrCouponInvalid
+		}
+		if err := coupon.Check(order.Currency, time.Now()); err != nil {
+			return nil, false, err
+		}
+		coupon.TimesRedeemed++
+		order.DiscountCents = coupon.Discount(order.SubtotalCents)
+		order.TotalCents -= order.DiscountCents
+		order.CouponCode = &coupon.Code
+	}
+	f.orders = append(f.orders, order)
+	if idempotencyKey != "" {
+		if f.keys == nil {
+			f.keys = map[[2]string]*models.Order{}
+		}
+		f.keys[[2]string{userID, idempotencyKey}] = order
+	}
+	return order, true, nil
+}
+
+func (f *fakeOrderRepository) Cancel(ctx context.Context, id string) (*models.Order, error) {
+	for _, o := range f.orders {
+		if o.ID != id {
+			continue
+		}
+		if err := orders.CanTransition(o.Status, models.OrderStatusCancelled); err != nil {
+			return nil, fmt.Errorf("%w: %w", models.ErrOrderNotCancellable, err)
+		}
+		o.Status = models.OrderStatusCancelled
+		f.cancelled = append(f.cancelled, id)
+		copied := *o
+		return &copied, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeOrderRepository) SetPaymentIntent(ctx context.Context, id, intentID string, heldUntil time.Time) (*models.Order, error) {
+	for _, o := range f.orders {
+		if o.ID != id {
+			continue
+		}
+		if err := orders.CanTransition(o.Status, models.OrderStatusPendingPayment); err != nil {
+			return nil, err
+		}
+		o.Status = models.OrderStatusPendingPayment
+		o.PaymentIntentID = intentID
+		if f.heldUntil == nil {
+			f.heldUntil = map[string]time.Time{}
+		}
+		f.heldUntil[id] = heldUntil
+		copied := *o
+		return &copied, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeOrderRepository) ConfirmPayment(ctx context.Context, intentID string) (*models.Order, error) {
+	return f.setPaymentStatus(intentID, models.OrderStatusPaid)
+}
+
+func (f *fakeOrderRepository) FailPayment(ctx context.Context, intentID string) (*models.Order, error) {
+	return f.setPaymentStatus(intentID, models.OrderStatusPaymentFailed)
+}
+
+func (f *fakeOrderRepository) setPaymentStatus(intentID string, status models.OrderStatus) (*models.Order, error) {
+	for _, o := range f.orders {
+		if o.PaymentIntentID != intentID {
+			continue
+		}
+		if err := orders.CanTransition(o.Status, status); err != nil {
+			return nil, err
+		}
+		o.Status = status
+		copied := *o
+		return &copied, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeOrderRepository) Ship(ctx context.Context, id, trackingNumber string) (*models.Order, error) {
+	for _, o := range f.orders {
+		if o.ID != id {
+			continue
+		}
+		if err := orders.CanTransition(o.Status, models.OrderStatusShipped); err != nil {
+			return nil, fmt.Errorf("%w: %w", models.ErrOrderNotShippable, err)
+		}
+		o.Status = models.OrderStatusShipped
+		o.TrackingNumber = &trackingNumber
+		copied := *o
+		return &copied, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeOrderRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, maxAge time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeOrderRepository) ExpiredPaymentHolds(ctx context.Context, now time.Time, limit int) ([]*models.Order, error) {
+	return nil, nil
+}
+
+func (f *fakeOrderRepository) GetByID(ctx context.Context, id string) (*models.Order, error) {
+	for _, o := range f.orders {
+		if o.ID == id {
+			copied := *o
+			return &copied, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeOrderRepository) UpdateStatus(ctx context.Context, id string, status models.OrderStatus) (*models.Order, error) {
+	for _, o := range f.orders {
+		if o.ID == id {
+			if err := orders.CanTransition(o.Status, status); err != nil {
+				return nil, err
+			}
+			o.Status = status
+			copied := *o
+			return &copied, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+// fakeReservationRepository is an in-memory models.ReservationRepository over a stock count per product.
+type fakeReservationRepository struct {
+	mu           sync.Mutex
+	stock        map[string]int
+	reservations map[[2]string]int // Reserved quantity by user and product ID.
+	maxPerOrder  map[string]int    // Purchase limits by product ID.
+	expiresAt    time.Time         // When the last reservation expires.
+}
+
+func (f *fakeReservationRepository) Reserve(ctx context.Context, userID, productID string, qty int, expiresAt time.Time) (*models.Reservation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stock, ok := f.stock[productID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	if limit, ok := f.maxPerOrder[productID]; ok && qty > limit {
+		return nil, &models.PurchaseLimitError{ProductID: productID, Limit: limit}
+	}
+	key := [2]string{userID, productID}
+	if qty-f.reservations[key] > stock {
+		return nil, &models.InsufficientStockError{ProductIDs: []string{productID}}
+	}
+	f.stock[productID] -= qty - f.reservations[key]
+	f.reservations[key] = qty
+	f.expiresAt = expiresAt
+	return &models.Reservation{UserID: userID, ProductID: productID, Qty: qty, ExpiresAt: expiresAt}, nil
+}
+
+func (f *fakeReservationRepository) ReleaseExpired(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+func TestReserveStock(t *testing.T) {
+	reservations := &fakeReservationRepository{stock: map[string]int{"7": 3, "8": 1, "9": 5}, reservations: map[[2]string]int{}, maxPerOrder: map[string]int{"9": 1}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Reservations = reservations
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.Clock = clock.NewFake(now)
+
+	t.Run("success", func(t *testing.T) {
+		reservation, err := r.Mutation().ReserveStock(asUser("42"), "7", 2)
+		if err != nil {
+			t.Fatalf("ReserveStock returned error: %v", err)
+		}
+		if reservation.ProductID != "7" || reservation.Qty != 2 || !reservations.expiresAt.Equal(now.Add(inventory.DefaultReservationTTL)) {
+			t.Fatalf("unexpected reservation %+v expiring at %v", reservation, reservations.expiresAt)
+		}
+		if reservations.stock["7"] != 1 {
+			t.Fatalf("expected 1 left in stock, got %d", reservations.stock["7"])
+		}
+	})
+
+	t.Run("concurrent reservations of the last unit", func(t *testing.T) {
+		var (
+			wg   sync.WaitGroup
+			errs = make([]error, 5)
+		)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = r.Mutation().ReserveStock(asUser(strconv.Itoa(100+i)), "8", 1)
+			}()
+		}
+		wg.Wait()
+
+		won := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				won++
+			case !errors.Is(err, models.ErrInsufficientStock) || errors.Is(err, ErrDatabase):
+				t.Fatalf("expected the losers to get ErrInsufficientStock, got %v", err)
+			}
+		}
+		if won != 1 || reservations.stock["8"] != 0 {
+			t.Fatalf("expected exactly one reservation to win, got %d with %d left", won, reservations.stock["8"])
+		}
+	})
+
+	t.Run("over purchase limit", func(t *testing.T) {
+		_, err := r.Mutation().ReserveStock(asUser("42"), "9", 2)
+		if !errors.Is(err, models.ErrPurchaseLimit) || errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrPurchaseLimit, got %v", err)
+		}
+		if reservations.stock["9"] != 5 {
+			t.Fatalf("expected no stock to be held, got %d left", reservations.stock["9"])
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		if _, err := r.Mutation().ReserveStock(asUser("42"), "abc", 1); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for a malformed ID, got %v", err)
+		}
+		if _, err := r.Mutation().ReserveStock(asUser("42"), "7", 0); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for zero qty, got %v", err)
+		}
+		if _, err := r.Mutation().ReserveStock(asUser("42"), "7", maxReservationQty+1); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument for a qty over the cap, got %v", err)
+		}
+		if _, err := r.Mutation().ReserveStock(asUser("42"), "404", 1); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound for an unknown product, got %v", err)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Mutation().ReserveStock(context.Background(), "7", 1); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+func TestCheckout(t *testing.T) {
+	orders := &fakeOrderRepository{}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Orders = orders
+	r.Addresses = &fakeAddressRepository{}
+	if err := r.Addresses.Create(context.Background(), &models.Address{UserID: "42", Line1: "1 Main St", City: "Springfield", PostalCode: "62701", Country: "US", IsDefault: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		order, err := r.Mutation().Checkout(asUser("42"), nil, nil, nil)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.UserID != "42" || order.Status != models.OrderStatusPending {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("idempotency key", func(t *testing.T) {
+		key, other := "3f1c9a", "7d2e4b"
+		first, err := r.Mutation().Checkout(asUser("42"), &key, nil, nil)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		retry, err := r.Mutation().Checkout(asUser("42"), &key, nil, nil)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if retry.ID != first.ID {
+			t.Fatalf("expected the retry to return order %s, got %s", first.ID, retry.ID)
+		}
+		second, err := r.Mutation().Checkout(asUser("42"), &other, nil, nil)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if second.ID == first.ID {
+			t.Fatal("expected a different key to place a new order")
+		}
+	})
+
+	t.Run("invalid idempotency key", func(t *testing.T) {
+		for _, key := range []string{"  ", strings.Repeat("k", maxIdempotencyKeyLength+1)} {
+			if _, err := r.Mutation().Checkout(asUser("42"), &key, nil, nil); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("key of length %d: expected ErrInvalidArgument, got %v", len(key), err)
+			}
+		}
+	})
+
+	t.Run("stock conflict", func(t *testing.T) {
+		orders.err = &models.InsufficientStockError{ProductIDs: []string{"7"}}
+		defer func() { orders.err = nil }()
+
+		_, err := r.Mutation().Checkout(asUser("42"), nil, nil, nil)
+		var stockErr *models.InsufficientStockError
+		if !errors.As(err, &stockErr) || stockErr.ProductIDs[0] != "7" {
+			t.Fatalf("expected *InsufficientStockError for product 7, got %v", err)
+		}
+		if errors.Is(err, ErrDatabase) {
+			t.Fatal("stock conflicts should not be reported as database errors")
+		}
+	})
+
+	t.Run("concurrent modification", func(t *testing.T) {
+		orders.err = fmt.Errorf("product 7: %w", models.ErrConcurrentModification)
+		defer func() { orders.err = nil }()
+
+		if _, err := r.Mutation().Checkout(asUser("42"), nil, nil, nil); !errors.Is(err, models.ErrConcurrentModification) || errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrConcurrentModification, got %v", err)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Mutation().Checkout(context.Background(), nil, nil, nil); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+// fakePaymentProvider is a models.PaymentProvider that records the intents it creates, one
+// per order, and cancels. When err is set CreateIntent fails with it, and when cancelErr is set CancelIntent.
+type fakePaymentProvider struct {
+	intents   map[string]string // Order IDs by intent ID.
+	cancelled []string
+	err       error
+	cancelErr error
+}
+
+func (f *fakePaymentProvider) CreateIntent(ctx context.Context, amountCents int64, currency, orderID string) (string, string, error) {
+	if f.err != nil {
+		return "", "", f.err
+	}
+	if f.intents == nil {
+		f.intents = map[string]string{}
+	}
+	// Like Stripe with the order's idempotency key, another intent for the same order
+	// returns the first one.
+	for intentID, id := range f.intents {
+		if id == orderID {
+			return intentID, intentID + "_secret", nil
+		}
+	}
+	intentID := fmt.Sprintf("pi_%d", len(f.intents)+1)
+	f.intents[intentID] = orderID
+	return intentID, intentID + "_secret", nil
+}
+
+func (f *fakePaymentProvider) ClientSecret(ctx context.Context, intentID string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	if _, ok := f.intents[intentID]; !ok {
+		return "", fmt.Errorf("no such payment intent %s", intentID)
+	}
+	return intentID + "_secret", nil
+}
+
+func (f *fakePaymentProvider) Capture(ctx context.Context, intentID string) error {
+	return nil
+}
+
+func (f *fakePaymentProvider) Refund(ctx context.Context, intentID string) error {
+	return nil
+}
+
+func (f *fakePaymentProvider) CancelIntent(ctx context.Context, intentID string) error {
+	if f.cancelErr != nil {
+		return f.cancelErr
+	}
+	f.cancelled = append(f.cancelled, intentID)
+	return nil
+}
+
+func TestCheckoutPayment(t *testing.T) {
+	orders := &fakeOrderRepository{}
+	payments := &fakePaymentProvider{}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Orders = orders
+	r.Payments = payments
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.Clock = clock.NewFake(now)
+	r.Addresses = &fakeAddressRepository{}
+	if err := r.Addresses.Create(context.Background(), &models.Address{UserID: "42", Line1: "1 Main St", City: "Springfield", PostalCode: "62701", Country: "US", IsDefault: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("awaits payment", func(t *testing.T) {
+		key := "5a7c1e"
+		order, err := r.Mutation().Checkout(asUser("42"), &key, nil, nil)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.Status != models.OrderStatusPendingPayment || order.PaymentClientSecret == nil || *order.PaymentClientSecret != order.PaymentIntentID+"_secret" {
+			t.Fatalf("expected a PENDING_PAYMENT order with the intent's client secret, got %+v", order)
+		}
+		if payments.intents[order.PaymentIntentID] != order.ID {
+			t.Fatalf("expected an intent for order %s, got %v", order.ID, payments.intents)
+		}
+		if held := orders.heldUntil[order.ID]; !held.Equal(now.Add(inventory.DefaultPaymentGracePeriod)) {
+			t.Fatalf("expected the stock to be held for the grace period, got %v", held)
+		}
+
+		// A retry returns the same order and its client secret without starting another
+		// payment or announcing the order again.
+		ctx, cancel := context.WithCancel(asUser("42"))
+		defer cancel()
+		updates := r.OrderEvents.Subscribe(ctx, order.ID)
+		retry, err := r.Mutation().Checkout(asUser("42"), &key, nil, nil)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if retry.ID != order.ID || len(payments.intents) != 1 {
+			t.Fatalf("expected the retry to reuse order %s and its intent, got order %s and intents %v", order.ID, retry.ID, payments.intents)
+		}
+		if retry.PaymentClientSecret == nil || *retry.PaymentClientSecret != *order.PaymentClientSecret {
+			t.Fatalf("expected the retry to return client secret %q, got %v", *order.PaymentClientSecret, retry.PaymentClientSecret)
+		}
+		select {
+		case update := <-updates:
+			t.Fatalf("expected no order event for a retry, got %+v", update)
+		default:
+		}
+
+		// The webhook's confirmation moves the order on to PAID.
+		paid, err := orders.ConfirmPayment(context.Background(), order.PaymentIntentID)
+		if err != nil || paid.Status != models.OrderStatusPaid {
+			t.Fatalf("expected the payment to be confirmed, got %+v, %v", paid, err)
+		}
+	})
+
+	t.Run("retry racing the first attempt", func(t *testing.T) {
+		// The first attempt placed order 50 and started its payment after the retry read the
+		// order, so the retry starts the payment too.
+		payments.intents["pi_race"] = "50"
+		orders.orders = append(orders.orders, &models.Order{ID: "50", UserID: "42", Status: models.OrderStatusPendingPayment, TotalCents: fakeCartTotal, Currency: "USD", PaymentIntentID: "pi_race"})
+		orders.keys[[2]string{"42", "race"}] = &models.Order{ID: "50", UserID: "42", Status: models.OrderStatusPending, TotalCents: fakeCartTotal, Currency: "USD"}
+		cancelled := len(orders.cancelled)
+
+		key := "race"
+		order, err := r.Mutation().Checkout(asUser("42"), &key, nil, nil)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.ID != "50" || order.Status != models.OrderStatusPendingPayment || order.PaymentClientSecret == nil || *order.PaymentClientSecret != "pi_race_secret" {
+			t.Fatalf("expected the order with the first attempt's client secret, got %+v", order)
+		}
+		if len(orders.cancelled) != cancelled {
+			t.Fatalf("expected no order to be cancelled, got %v", orders.cancelled)
+		}
+
+		// A retry whose payment can't be started leaves the order to the first attempt.
+		orders.orders = append(orders.orders, &models.Order{ID: "51", UserID: "42", Status: models.OrderStatusPending, TotalCents: fakeCartTotal, Currency: "USD"})
+		orders.keys[[2]string{"42", "failed"}] = orders.orders[len(orders.orders)-1]
+		payments.err = errors.New("stripe unavailable")
+		defer func() { payments.err = nil }()
+		key = "failed"
+		if _, err := r.Mutation().Checkout(asUser("42"), &key, nil, nil); !errors.Is(err, ErrPayment) {
+			t.Fatalf("expected ErrPayment, got %v", err)
+		}
+		if slices.Contains(orders.cancelled, "51") {
+			t.Fatal("expected a retry not to cancel the order")
+		}
+	})
+
+	t.Run("provider failure", func(t *testing.T) {
+		payments.err = errors.New("stripe unavailable")
+		defer func() { payments.err = nil }()
+
+		_, err := r.Mutation().Checkout(asUser("42"), nil, nil, nil)
+		if !errors.Is(err, ErrPayment) {
+			t.Fatalf("expected ErrPayment, got %v", err)
+		}
+		last := orders.orders[len(orders.orders)-1]
+		if last.Status != models.OrderStatusCancelled || !slices.Contains(orders.cancelled, last.ID) {
+			t.Fatalf("expected the unpaid order to be cancelled, got %+v", last)
+		}
+	})
+}
+
+func TestCheckoutCoupon(t *testing.T) {
+	one, ten, hundred := 1, 10, 100
+	yesterday := time.Now().Add(-24 * time.Hour)
+	orders := &fakeOrderRepository{coupons: map[string]*models.Coupon{
+		"SAVE10":  {ID: "1", Code: "SAVE10", PercentOff: &ten},
+		"ONCE":    {ID: "2", Code: "ONCE", PercentOff: &ten, MaxRedemptions: &one, TimesRedeemed: 1},
+		"EXPIRED": {ID: "3", Code: "EXPIRED", PercentOff: &ten, ExpiresAt: &yesterday},
+		"FREE":    {ID: "4", Code: "FREE", PercentOff: &hundred},
+	}}
+	payments := &fakePaymentProvider{}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Orders = orders
+	r.Payments = payments
+	r.Addresses = &fakeAddressRepository{}
+	if err := r.Addresses.Create(context.Background(), &models.Address{UserID: "42", Line1: "1 Main St", City: "Springfield", PostalCode: "62701", Country: "US", IsDefault: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("discount", func(t *testing.T) {
+		code := " save10 "
+		order, err := r.Mutation().Checkout(asUser("42"), nil, nil, &code)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.DiscountCents != 250 || order.TotalCents != fakeCartTotal-250 || order.CouponCode == nil || *order.CouponCode != "SAVE10" {
+			t.Fatalf("expected 10%% off with SAVE10, got discount %d, total %d", order.DiscountCents, order.TotalCents)
+		}
+		if orders.coupons["SAVE10"].TimesRedeemed != 1 {
+			t.Fatalf("expected the coupon to be redeemed once, got %d", orders.coupons["SAVE10"].TimesRedeemed)
+		}
+	})
+
+	t.Run("fully discounted", func(t *testing.T) {
+		code := "FREE"
+		n := len(payments.intents)
+		order, err := r.Mutation().Checkout(asUser("42"), nil, nil, &code)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.TotalCents != 0 || order.Status != models.OrderStatusPaid || len(payments.intents) != n {
+			t.Fatalf("expected a free order to be PAID without a payment, got %+v", order)
+		}
+	})
+
+	for name, tc := range map[string]struct {
+		code string
+		want error
+	}{
+		"unknown":   {"NOPE", models.ErrCouponInvalid},
+		"exhausted": {"ONCE", models.ErrCouponExhausted},
+		"expired":   {"EXPIRED", models.ErrCouponExpired},
+		"blank":     {"  ", ErrInvalidArgument},
+	} {
+		t.Run(name, func(t *testing.T) {
+			n := len(orders.orders)
+			_, err := r.Mutation().Checkout(asUser("42"), nil, nil, &tc.code)
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != "couponCode" || !errors.Is(err, tc.want) {
+				t.Fatalf("expected a FieldError for couponCode wrapping %v, got %v", tc.want, err)
+			}
+			if len(orders.orders) != n {
+				t.Fatal("expected no order to be placed")
+			}
+		})
+	}
+}
+
+func TestCheckoutShippingAddress(t *testing.T) {
+	orders := &fakeOrderRepository{}
+	addresses := &fakeAddressRepository{}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Orders = orders
+	r.Addresses = addresses
+	yes := true
+	home, err := r.Mutation().AddAddress(asUser("42"), models.AddAddressInput{Line1: "1 Main St", City: "Springfield", PostalCode: "62701", Country: "US", IsDefault: &yes})
+	if err != nil {
+		t.Fatalf("AddAddress returned error: %v", err)
+	}
+	work, err := r.Mutation().AddAddress(asUser("42"), models.AddAddressInput{Line1: "2 Elm St", City: "Springfield", PostalCode: "62702", Country: "US"})
+	if err != nil {
+		t.Fatalf("AddAddress returned error: %v", err)
+	}
+
+	t.Run("explicit address", func(t *testing.T) {
+		order, err := r.Mutation().Checkout(asUser("42"), nil, &work.ID, nil)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.ShippingAddress == nil || order.ShippingAddress.Line1 != "2 Elm St" || order.ShippingAddress.PostalCode != "62702" {
+			t.Fatalf("expected the work address, got %+v", order.ShippingAddress)
+		}
+
+		// The order keeps the address it was placed with.
+		line1 := "3 Oak St"
+		if _, err := r.Mutation().UpdateAddress(asUser("42"), models.UpdateAddressInput{ID: work.ID, Line1: &line1}); err != nil {
+			t.Fatalf("UpdateAddress returned error: %v", err)
+		}
+		if got, _ := orders.GetByID(context.Background(), order.ID); got.ShippingAddress.Line1 != "2 Elm St" {
+			t.Fatalf("expected the order's address to be unchanged, got %+v", got.ShippingAddress)
+		}
+	})
+
+	t.Run("default address", func(t *testing.T) {
+		order, err := r.Mutation().Checkout(asUser("42"), nil, nil, nil)
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.ShippingAddress == nil || order.ShippingAddress.Line1 != home.Line1 {
+			t.Fatalf("expected the default address, got %+v", order.ShippingAddress)
+		}
+	})
+
+	t.Run("not owned", func(t *testing.T) {
+		n := len(orders.orders)
+		if _, err := r.Mutation().Checkout(asUser("43"), nil, &home.ID, nil); !errors.Is(err, models.ErrNotFound) || errors.Is(err, ErrDatabase) {
+			t.Fatalf("expected ErrNotFound for another user's address, got %v", err)
+		}
+		if len(orders.orders) != n {
+			t.Fatal("expected no order to be placed")
+		}
+	})
+
+	t.Run("no default", func(t *testing.T) {
+		var fieldErr *FieldError
+		if _, err := r.Mutation().Checkout(asUser("43"), nil, nil, nil); !errors.As(err, &fieldErr) || fieldErr.Field != "addressId" {
+			t.Fatalf("expected a FieldError for addressId, got %v", err)
+		}
+		if _, err := r.Mutation().DeleteAddress(asUser("42"), home.ID); err != nil {
+			t.Fatalf("DeleteAddress returned error: %v", err)
+		}
+		if _, err := r.Mutation().Checkout(asUser("42"), nil, nil, nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument once the default is deleted, got %v", err)
+		}
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		id := "abc"
+		if _, err := r.Mutation().Checkout(asUser("42"), nil, &id, nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument, got %v", err)
+		}
+	})
+}
+
+func TestCancelOrder(t *testing.T) {
+	orders := &fakeOrderRepository{orders: []*models.Order{
+		{ID: "100", UserID: "42", Status: models.OrderStatusPending},
+		{ID: "101", UserID: "42", Status: models.OrderStatusShipped},
+		{ID: "102", UserID: "43", Status: models.OrderStatusPending},
+		{ID: "103", UserID: "42", Status: models.OrderStatusPaid},
+	}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Orders = orders
+
+	t.Run("pending", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(asUser("42"))
+		defer cancel()
+		updates := r.OrderEvents.Subscribe(ctx, "100")
+
+		order, err := r.Mutation().CancelOrder(asUser("42"), "100")
+		if err != nil {
+			t.Fatalf("CancelOrder returned error: %v", err)
+		}
+		if order.Status != models.OrderStatusCancelled || !slices.Equal(orders.cancelled, []string{"100"}) {
+			t.Fatalf("expected order 100 to be cancelled through the repository, got %+v (cancelled %v)", order, orders.cancelled)
+		}
+		select {
+		case update := <-updates:
+			if update.Status != models.OrderStatusCancelled {
+				t.Fatalf("expected a CANCELLED update, got %s", update.Status)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected subscribers to be notified")
+		}
+	})
+
+	t.Run("no longer pending", func(t *testing.T) {
+		for _, id := range []string{"101", "103"} {
+			_, err := r.Mutation().CancelOrder(asUser("42"), id)
+			if !errors.Is(err, models.ErrOrderNotCancellable) || errors.Is(err, ErrDatabase) {
+				t.Fatalf("order %s: expected ErrOrderNotCancellable, got %v", id, err)
+			}
+		}
+		if _, err := r.Mutation().CancelOrder(asUser("42"), "100"); !errors.Is(err, models.ErrOrderNotCancellable) {
+			t.Fatalf("expected an already cancelled order to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("other user's order", func(t *testing.T) {
+		for _, id := range []string{"102", "999"} {
+			if _, err := r.Mutation().CancelOrder(asUser("42"), id); !errors.Is(err, ErrForbidden) {
+				t.Errorf("order %s: expected ErrForbidden, got %v", id, err)
+			}
+		}
+		if len(orders.cancelled) != 1 {
+			t.Fatalf("expected no other order to be cancelled, got %v", orders.cancelled)
+		}
+	})
+
+	t.Run("admin status update restocks", func(t *testing.T) {
+		r.Admins = map[string]bool{"1": true}
+		order, err := r.Mutation().UpdateOrderStatus(asUser("1"), "102", models.OrderStatusCancelled)
+		if err != nil {
+			t.Fatalf("UpdateOrderStatus returned error: %v", err)
+		}
+		if order.Status != models.OrderStatusCancelled || !slices.Contains(orders.cancelled, "102") {
+			t.Fatalf("expected order 102 to be cancelled through the repository, got %+v (cancelled %v)", order, orders.cancelled)
+		}
+	})
+
+	t.Run("awaiting payment", func(t *testing.T) {
+		orders.orders = append(orders.orders,
+			&models.Order{ID: "104", UserID: "42", Status: models.OrderStatusPendingPayment, PaymentIntentID: "pi_4"},
+			&models.Order{ID: "105", UserID: "42", Status: models.OrderStatusPaymentFailed, PaymentIntentID: "pi_5"},
+		)
+		payments := &fakePaymentProvider{cancelErr: errors.New("stripe unavailable")}
+		r.Payments = payments
+		defer func() { r.Payments = nil }()
+
+		// The order stays open while its payment can still go through.
+		if _, err := r.Mutation().CancelOrder(asUser("42"), "104"); !errors.Is(err, ErrPayment) {
+			t.Fatalf("expected ErrPayment, got %v", err)
+		}
+		if slices.Contains(orders.cancelled, "104") {
+			t.Fatal("expected the order not to be cancelled while its payment intent is live")
+		}
+
+		payments.cancelErr = nil
+		if _, err := r.Mutation().CancelOrder(asUser("42"), "104"); err != nil {
+			t.Fatalf("CancelOrder returned error: %v", err)
+		}
+		if _, err := r.Mutation().UpdateOrderStatus(asUser("1"), "105", models.OrderStatusCancelled); err != nil {
+			t.Fatalf("UpdateOrderStatus returned error: %v", err)
+		}
+		if !slices.Equal(payments.cancelled, []string{"pi_4", "pi_5"}) || !slices.Contains(orders.cancelled, "104") || !slices.Contains(orders.cancelled, "105") {
+			t.Fatalf("expected both payment intents to be cancelled with their orders, got %v (cancelled orders %v)", payments.cancelled, orders.cancelled)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Mutation().CancelOrder(context.Background(), "100"); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+func TestShipOrder(t *testing.T) {
+	orders := &fakeOrderRepository{orders: []*models.Order{
+		{ID: "100", UserID: "42", Status: models.OrderStatusPaid},
+		{ID: "101", UserID: "42", Status: models.OrderStatusPending},
+		{ID: "102", UserID: "42", Status: models.OrderStatusPaid},
+	}}
+	users := newFakeUserRepository(
+		&models.User{ID: "1", Role: models.RoleAdmin},
+		&models.User{ID: "42", Role: models.RoleCustomer},
+	)
+	r := newTestResolver("http://okta.invalid", users)
+	r.Orders = orders
+
+	t.Run("admin", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(asUser("1"))
+		defer cancel()
+		updates := r.OrderEvents.Subscribe(ctx, "100")
+
+		order, err := r.Mutation().ShipOrder(asUser("1"), "100", " 1Z999 ")
+		if err != nil {
+			t.Fatalf("ShipOrder returned error: %v", err)
+		}
+		if order.Status != models.OrderStatusShipped || order.TrackingNumber == nil || *order.TrackingNumber != "1Z999" {
+			t.Fatalf("expected a shipped order with the trimmed tracking number, got %+v", order)
+		}
+		select {
+		case update := <-updates:
+			if update.Status != models.OrderStatusShipped {
+				t.Fatalf("expected a SHIPPED update, got %s", update.Status)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected subscribers to be notified")
+		}
+	})
+
+	t.Run("configured admin", func(t *testing.T) {
+		r.Admins = map[string]bool{"7": true}
+		defer func() { r.Admins = nil }()
+		if _, err := r.Mutation().ShipOrder(asUser("7"), "102", "1Z998"); err != nil {
+			t.Fatalf("ShipOrder returned error: %v", err)
+		}
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		for _, userID := range []string{"42", "999"} {
+			if _, err := r.Mutation().ShipOrder(asUser(userID), "101", "1Z999"); !errors.Is(err, ErrForbidden) {
+				t.Errorf("user %s: expected ErrForbidden, got %v", userID, err)
+			}
+		}
+		if _, err := r.Mutation().ShipOrder(context.Background(), "101", "1Z999"); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+		if orders.orders[1].Status != models.OrderStatusPending {
+			t.Fatalf("expected order 101 to be unchanged, got %s", orders.orders[1].Status)
+		}
+	})
+
+	t.Run("invalid transition", func(t *testing.T) {
+		for _, id := range []string{"100", "101"} {
+			_, err := r.Mutation().ShipOrder(asUser("1"), id, "1Z999")
+			if !errors.Is(err, models.ErrOrderNotShippable) || errors.Is(err, ErrDatabase) {
+				t.Errorf("order %s: expected ErrOrderNotShippable, got %v", id, err)
+			}
+		}
+		if _, err := r.Mutation().ShipOrder(asUser("1"), "999", "1Z999"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("invalid tracking number", func(t *testing.T) {
+		for _, trackingNumber := range []string{"  ", strings.Repeat("1", maxTrackingNumberLength+1)} {
+			_, err := r.Mutation().ShipOrder(asUser("1"), "101", trackingNumber)
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != "trackingNumber" {
+				t.Errorf("tracking number %q: expected a trackingNumber FieldError, got %v", trackingNumber, err)
+			}
+		}
+	})
+}
+
+func TestOrdersQuery(t *testing.T) {
+	orders := &fakeOrderRepository{
+		orders: []*models.Order{
+			{ID: "1", UserID: "42", Status: models.OrderStatusShipped},
+			{ID: "2", UserID: "7", Status: models.OrderStatusPending},
+			{ID: "3", UserID: "42", Status: models.OrderStatusPending},
+		},
+		items: map[string][]*models.OrderItem{
+			"1": {{ProductID: "7", Qty: 1, UnitPriceCents: 899}},
+			"3": {{ProductID: "8", Qty: 2, UnitPriceCents: 1999}},
+		},
+	}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Orders = orders
+
+	t.Run("unfiltered", func(t *testing.T) {
+		orders.itemLoads = 0
+		got, err := r.Query().Orders(asUser("42"), nil, nil, nil)
+		if err != nil {
+			t.Fatalf("Orders returned error: %v", err)
+		}
+		if len(got) != 2 || got[0].ID != "3" || got[1].ID != "1" {
+			t.Fatalf("expected orders 3 and 1 newest first, got %+v", got)
+		}
+		if orders.itemLoads != 1 {
+			t.Fatalf("expected items for all orders to load in one call, got %d", orders.itemLoads)
+		}
+		items, err := r.Order().Items(context.Background(), got[0])
+		if err != nil || len(items) != 1 || items[0].ProductID != "8" {
+			t.Fatalf("unexpected items (%v): %+v", err, items)
+		}
+		if orders.itemLoads != 1 {
+			t.Fatal("items resolver should reuse the preloaded items")
+		}
+	})
+
+	t.Run("filtered by status", func(t *testing.T) {
+		status := models.OrderStatusShipped
+		got, err := r.Query().Orders(asUser("42"), &status, nil, nil)
+		if err != nil {
+			t.Fatalf("Orders returned error: %v", err)
+		}
+		if len(got) != 1 || got[0].ID != "1" || orders.lastStatus == nil || *orders.lastStatus != status {
+			t.Fatalf("expected only shipped order 1, got %+v", got)
+		}
+	})
+
+	t.Run("unknown status", func(t *testing.T) {
+		status := models.OrderStatus("LOST")
+		if _, err := r.Query().Orders(asUser("42"), &status, nil, nil); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Query().Orders(context.Background(), nil, nil, nil); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Orders = &fakeOrderRepository{orders: []*models.Order{
+		{ID: "100", UserID: "42", Status: models.OrderStatusPending},
+		{ID: "101", UserID: "42", Status: models.OrderStatusShipped},
+	}}
+	r.Admins = map[string]bool{"1": true}
+
+	if _, err := r.Mutation().UpdateOrderStatus(asUser("42"), "100", models.OrderStatusPaid); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden for non-admin, got %v", err)
+	}
+
+	order, err := r.Mutation().UpdateOrderStatus(asUser("1"), "100", models.OrderStatusPaid)
+	if err != nil {
+		t.Fatalf("UpdateOrderStatus returned error: %v", err)
+	}
+	if order.Status != models.OrderStatusPaid {
+		t.Fatalf("expected PAID, got %s", order.Status)
+	}
+
+	for _, status := range []models.OrderStatus{models.OrderStatusPending, models.OrderStatusDelivered, models.OrderStatusCancelled} {
+		_, err := r.Mutation().UpdateOrderStatus(asUser("1"), "100", status)
+		if !errors.Is(err, ErrInvalidArgument) || !errors.Is(err, orders.ErrInvalidTransition) {
+			t.Errorf("PAID -> %s: expected ErrInvalidArgument wrapping ErrInvalidTransition, got %v", status, err)
+		}
+	}
+	if order, err := r.Mutation().UpdateOrderStatus(asUser("1"), "101", models.OrderStatusDelivered); err != nil || order.Status != models.OrderStatusDelivered {
+		t.Fatalf("expected a shipped order to be delivered, got %+v, %v", order, err)
+	}
+	if _, err := r.Mutation().UpdateOrderStatus(asUser("1"), "999", models.OrderStatusPaid); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUpdateOrderStatusNotifiesAccounting(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	webhooks := &fakeWebhookDeliveryRepository{}
+	dispatcher := webhook.NewDispatcher(webhooks, http.DefaultClient, "", webhook.DefaultRetryPolicy(), time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Orders = &fakeOrderRepository{
+		orders: []*models.Order{
+			{ID: "100", UserID: "42", Status: models.OrderStatusPaid, SubtotalCents: 2000, TaxCents: 160, TotalCents: 2160, Currency: "USD"},
+		},
+		items: map[string][]*models.OrderItem{"100": {{ProductID: "7", Name: "Mug", SKU: "MUG-1", Qty: 2, UnitPriceCents: 1000}}},
+	}
+	r.Admins = map[string]bool{"1": true}
+	r.Accounting = webhook.NewAccounting(dispatcher, "https://ledger.example.com/orders")
+	r.Clock = clock.NewFake(now)
+
+	if _, err := r.Mutation().UpdateOrderStatus(asUser("1"), "100", models.OrderStatusShipped); err != nil {
+		t.Fatalf("UpdateOrderStatus returned error: %v", err)
+	}
+	if len(webhooks.deliveries) != 0 {
+		t.Fatalf("expected nothing to be sent before the order is delivered, got %+v", webhooks.deliveries)
+	}
+
+	if _, err := r.Mutation().UpdateOrderStatus(asUser("1"), "100", models.OrderStatusDelivered); err != nil {
+		t.Fatalf("UpdateOrderStatus returned error: %v", err)
+	}
+	if len(webhooks.deliveries) != 1 {
+		t.Fatalf("expected one delivery, got %+v", webhooks.deliveries)
+	}
+	delivery := webhooks.deliveries[0]
+	if delivery.EventType != webhook.OrderCompletedEvent || delivery.URL != "https://ledger.example.com/orders" {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+	var payload webhook.OrderCompleted
+	if err := json.Unmarshal(delivery.Payload, &payload); err != nil {
+		t.Fatalf("payload isn't JSON: %v", err)
+	}
+	if payload.SchemaVersion != webhook.OrderCompletedSchemaVersion || payload.OrderID != "100" || payload.TotalCents != 2160 || !payload.CompletedAt.Equal(now) {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	if len(payload.Items) != 1 || payload.Items[0].LineTotalCents != 2000 {
+		t.Errorf("expected the order's items, got %+v", payload.Items)
+	}
+
+	// Setting the status it already has doesn't send the event again.
+	if _, err := r.Mutation().UpdateOrderStatus(asUser("1"), "100", models.OrderStatusDelivered); err != nil {
+		t.Fatalf("UpdateOrderStatus returned error: %v", err)
+	}
+	if len(webhooks.deliveries) != 1 {
+		t.Fatalf("expected the event to be sent once, got %d deliveries", len(webhooks.deliveries))
+	}
+}
+
+func TestOrderStatusChangedSubscription(t *testing.T) {
+	orders := &fakeOrderRepository{orders: []*models.Order{
+		{ID: "100", UserID: "42", Status: models.OrderStatusPending},
+		{ID: "101", UserID: "7", Status: models.OrderStatusPending},
+	}}
+	r := newTestResolver("http://okta.invalid", newFakeUserRepository())
+	r.Orders = orders
+	r.Admins = map[string]bool{"1": true}
+
+	t.Run("owner receives updates", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(asUser("42"))
+		events, err := r.Subscription().OrderStatusChanged(ctx, "100")
+		if err != nil {
+			t.Fatalf("OrderStatusChanged returned error: %v", err)
+		}
+
+		if _, err := r.Mutation().UpdateOrderStatus(asUser("1"), "100", models.OrderStatusPaid); err != nil {
+			t.Fatalf("UpdateOrderStatus returned error: %v", err)
+		}
+		select {
+		case order := <-events:
+			if order.ID != "100" || order.Status != models.OrderStatusPaid {
+				t.Fatalf("unexpected event: %+v", order)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the status change")
+		}
+
+		cancel()
+		select {
+		case _, open := <-events:
+			if open {
+				t.Fatal("expected no further events after unsubscribing")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the channel to be closed after unsubscribing")
+		}
+	})
+
+	t.Run("other users are rejected", func(t *testing.T) {
+		for _, id := range []string{"101", "999"} {
+			if _, err := r.Subscription().OrderStatusChanged(asUser("42"), id); !errors.Is(err, ErrForbidden) {
+				t.Fatalf("OrderStatusChanged(%q): expected ErrForbidden, got %v", id, err)
+			}
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		if _, err := r.Subscription().OrderStatusChanged(context.Background(), "100"); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
+
+// fakeWebhookDeliveryRepository is a models.WebhookDeliveryRepository that keeps deliveries
+// in memory.
+type fakeWebhookDeliveryRepository struct {
+	models.WebhookDeliveryRepository
+	deliveries []*models.WebhookDelivery
+}
+
+func (f *fakeWebhookDeliveryRepository) Enqueue(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.ID = strconv.Itoa(len(f.deliveries) + 1)
+	delivery.Status = models.WebhookDeliveryStatusPending
+	f.deliveries = append(f.deliveries, delivery)
+	return nil
+}
+
+func (f *fakeWebhookDeliveryRepository) ListDead(ctx context.Context, page models.PageArgs) (*models.PageResult[*models.WebhookDelivery], error) {
+	var dead []*models.WebhookDelivery
+	for _, d := range f.deliveries {
+		if d.Status == models.WebhookDeliveryStatusDead {
+			dead = append(dead, d)
+		}
+	}
+	return &models.PageResult[*models.WebhookDelivery]{Items: dead, Total: len(dead)}, nil
+}
+
+func (f *fakeWebhookDeliveryRepository) Requeue(ctx context.Context, id string, now time.Time) (*models.WebhookDelivery, error) {
+	for _, d := range f.deliveries {
+		if d.ID != id {
+			continue
+		}
+		if d.Status != models.WebhookDeliveryStatusDead {
+			return nil, models.ErrDeliveryNotDead
+		}
+		d.Status, d.Attempts, d.LastError, d.NextAttemptAt = models.WebhookDeliveryStatusPending, 0, nil, now
+		return d, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	reason := "endpoint responded 500 Internal Server Error"
+	webhooks := &fakeWebhookDeliveryRepository{deliveries: []*models.WebhookDelivery{
+		{ID: "1", EventType: "order.completed", Status: models.WebhookDeliveryStatusDead, Attempts: 8, LastError: &reason},
+		{ID: "2", EventType: "order.completed", Status: models.WebhookDeliveryStatusFailed, Attempts: 2},
+	}}
+	users := newFakeUserRepository(
+		&models.User{ID: "1", Role: models.RoleAdmin},
+		&models.User{ID: "42", Role: models.RoleCustomer},
+	)
+	r := newTestResolver("http://okta.invalid", users)
+	r.Webhooks = webhooks
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.Clock = clock.NewFake(now)
+
+	t.Run("lists dead deliveries", func(t *testing.T) {
+		dead, err := r.Query().DeadWebhookDeliveries(asUser("1"), nil, nil)
+		if err != nil {
+			t.Fatalf("DeadWebhookDeliveries returned error: %v", err)
+		}
+		if len(dead) != 1 || dead[0].ID != "1" {
+			t.Fatalf("expected only the dead delivery, got %+v", dead)
+		}
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		if _, err := r.Query().DeadWebhookDeliveries(asUser("42"), nil, nil); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("expected ErrForbidden, got %v", err)
+		}
+		if _, err := r.Mutation().RequeueWebhookDelivery(asUser("42"), "1"); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("expected ErrForbidden, got %v", err)
+		}
+		if webhooks.deliveries[0].Status != models.WebhookDeliveryStatusDead {
+			t.Fatal("expected the delivery to stay dead")
+		}
+	})
+
+	t.Run("requeues", func(t *testing.T) {
+		delivery, err := r.Mutation().RequeueWebhookDelivery(asUser("1"), "1")
+		if err != nil {
+			t.Fatalf("RequeueWebhookDelivery returned error: %v", err)
+		}
+		if delivery.Status != models.WebhookDeliveryStatusPending || delivery.Attempts != 0 || !delivery.NextAttemptAt.Equal(now) {
+			t.Fatalf("expected a pending delivery due now, got %+v", delivery)
+		}
+	})
+
+	t.Run("not dead", func(t *testing.T) {
+		for id, want := range map[string]error{"1": models.ErrDeliveryNotDead, "2": models.ErrDeliveryNotDead, "404": models.ErrNotFound} {
+			_, err := r.Mutation().RequeueWebhookDelivery(asUser("1"), id)
+			if !errors.Is(err, want) || errors.Is(err, ErrDatabase) {
+				t.Errorf("delivery %s: expected %v, got %v", id, want, err)
+			}
+		}
+		if _, err := r.Mutation().RequeueWebhookDelivery(asUser("1"), "x"); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans created for GraphQL operations.
+const tracerName = "github.com/ShoppingDem/backend/shop/internal/graph"
+
+// Tracing is a gqlgen extension that wraps each GraphQL operation in an OpenTelemetry span,
+// so the spans of the calls made by its resolvers, such as Okta requests, are its children.
+type Tracing struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = Tracing{}
+
+// ExtensionName implements graphql.HandlerExtension.
+func (Tracing) ExtensionName() string {
+	return "Tracing"
+}
+
+// Validate implements graphql.HandlerExtension.
+func (Tracing) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptOperation implements graphql.OperationInterceptor.
+func (Tracing) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+	operation := operationName(oc)
+	var operationType string
+	if oc.Operation != nil {
+		operationType = string(oc.Operation.Operation)
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "graphql "+operation, trace.WithAttributes(
+		attribute.String("graphql.operation.name", operation),
+		attribute.String("graphql.operation.type", operationType),
+	))
+	handler := next(ctx)
+	return func(ctx context.Context) *graphql.Response {
+		resp := handler(ctx)
+		if resp != nil && len(resp.Errors) > 0 {
+			span.SetStatus(codes.Error, resp.Errors.Error())
+		}
+		span.End()
+		return resp
+	}
+}
@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	okta := newOktaServer(t, new(int))
+	users := newFakeUserRepository(&models.User{ID: "42", Email: "john.doe@example.com", OktaID: "00u1"})
+	r := newTestResolver(okta.URL, users)
+	r.Auth.MaxRetries = 0
+	srv := handler.New(NewExecutableSchema(NewConfig(r)))
+	srv.AddTransport(transport.POST{})
+	srv.Use(Tracing{})
+
+	body, _ := json.Marshal(map[string]string{"query": `mutation SignIn { login(input: {identifier: "john.doe@example.com", password: "wrong"}) }`})
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	var operation, oktaCall sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "graphql SignIn":
+			operation = span
+		case "okta POST":
+			oktaCall = span
+		}
+	}
+	if operation == nil || oktaCall == nil {
+		t.Fatalf("expected an operation span and an Okta span, got %v", recorder.Ended())
+	}
+	if oktaCall.Parent().SpanID() != operation.SpanContext().SpanID() || oktaCall.SpanContext().TraceID() != operation.SpanContext().TraceID() {
+		t.Fatal("expected the Okta span to be a child of the operation span")
+	}
+	if operation.Status().Code != codes.Error {
+		t.Errorf("expected the failed operation span to have status Error, got %v", operation.Status())
+	}
+
+	if oktaCall.Status().Code != codes.Error {
+		t.Errorf("expected the Okta span to have status Error, got %v", oktaCall.Status())
+	}
+	attrs := map[string]string{}
+	for _, kv := range oktaCall.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["okta.error_code"] != "E0000004" || attrs["http.response.status_code"] != "401" {
+		t.Errorf("expected the Okta error code and status on the span, got %v", attrs)
+	}
+}
@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+
+	"github.com/ShoppingDem/backend/shop/internal/middleware"
+	"github.com/ShoppingDem/backend/shop/internal/token"
+)
+
+// WebsocketInit returns a websocket init function that authenticates the connection with the
+// session token sent in the connection_init payload, either as "token" or as an
+// "Authorization: Bearer" value, and stores the user ID in the connection's context.
+//
+// Connections whose upgrade request was already authenticated by middleware.Authenticate may
+// omit the token; any other connection without a valid token is rejected.
+func WebsocketInit(tokens *token.Signer) transport.WebsocketInitFunc {
+	return func(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+		signed := payload.GetString("token")
+		if signed == "" {
+			if scheme, value, found := strings.Cut(payload.Authorization(), " "); found && strings.EqualFold(scheme, "Bearer") {
+				signed = strings.TrimSpace(value)
+			}
+		}
+		if signed == "" {
+			if _, ok := middleware.UserFromContext(ctx); ok {
+				return ctx, nil, nil
+			}
+			return ctx, nil, fmt.Errorf("%w: missing session token", ErrUnauthenticated)
+		}
+
+		claims, err := tokens.Parse(signed)
+		if errors.Is(err, token.ErrExpired) {
+			return ctx, nil, fmt.Errorf("%w: session token expired", ErrUnauthenticated)
+		}
+		if err != nil {
+			return ctx, nil, fmt.Errorf("%w: invalid session token", ErrUnauthenticated)
+		}
+		return middleware.WithUser(ctx, claims.UserID), nil, nil
+	}
+}
@@ -0,0 +1,76 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+
+	"github.com/ShoppingDem/backend/shop/internal/middleware"
+	"github.com/ShoppingDem/backend/shop/internal/token"
+)
+
+func TestWebsocketInit(t *testing.T) {
+	tokens := token.New([]byte("test-secret"), time.Hour)
+	init := WebsocketInit(tokens)
+	signed, err := tokens.Sign("42", "00u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		for _, payload := range []transport.InitPayload{
+			{"token": signed},
+			{"Authorization": "Bearer " + signed},
+			{"authorization": "bearer " + signed},
+		} {
+			ctx, _, err := init(context.Background(), payload)
+			if err != nil {
+				t.Fatalf("init(%v) returned error: %v", payload, err)
+			}
+			if userID, ok := middleware.UserFromContext(ctx); !ok || userID != "42" {
+				t.Fatalf("expected user 42 in context, got %q", userID)
+			}
+		}
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		for _, payload := range []transport.InitPayload{nil, {}, {"Authorization": "Basic Zm9vOmJhcg=="}} {
+			if _, _, err := init(context.Background(), payload); !errors.Is(err, ErrUnauthenticated) {
+				t.Fatalf("init(%v): expected ErrUnauthenticated, got %v", payload, err)
+			}
+		}
+	})
+
+	t.Run("authenticated upgrade request", func(t *testing.T) {
+		ctx, _, err := init(asUser("42"), transport.InitPayload{})
+		if err != nil {
+			t.Fatalf("init returned error: %v", err)
+		}
+		if userID, _ := middleware.UserFromContext(ctx); userID != "42" {
+			t.Fatalf("expected user 42 in context, got %q", userID)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		expired, err := token.New([]byte("test-secret"), -time.Minute).Sign("42", "00u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := init(context.Background(), transport.InitPayload{"token": expired}); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		forged, err := token.New([]byte("other-secret"), time.Hour).Sign("42", "00u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := init(context.Background(), transport.InitPayload{"token": forged}); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// DefaultReadinessTimeout bounds how long the readiness probe waits for the database.
+const DefaultReadinessTimeout = 2 * time.Second
+
+// Pinger is implemented by dependencies that can report whether they are reachable, such as *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// status is the JSON body returned by the probes.
+type status struct {
+	Status string `json:"status"`          // "ok" or "unavailable".
+	Error  string `json:"error,omitempty"` // Why the service is unavailable.
+}
+
+// Liveness returns a handler that always reports the process as alive.
+func Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK, status{Status: "ok"})
+	})
+}
+
+// Readiness returns a handler that reports ready only when the database answers a ping.
+//
+// Parameters:
+//   - db: The database to ping.
+//   - timeout: How long to wait for the ping before reporting unavailable.
+//
+// Returns:
+//   - A handler responding 200 when the ping succeeds and 503 otherwise.
+func Readiness(db Pinger, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err := db.PingContext(ctx); err != nil {
+			writeStatus(w, http.StatusServiceUnavailable, status{Status: "unavailable", Error: "database unreachable"})
+			return
+		}
+		writeStatus(w, http.StatusOK, status{Status: "ok"})
+	})
+}
+
+// writeStatus writes a JSON probe response.
+func writeStatus(w http.ResponseWriter, code int, body status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
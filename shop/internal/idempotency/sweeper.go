@@ -0,0 +1,70 @@
+package idempotency
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const (
+	// DefaultTTL is how long a checkout idempotency key is remembered when
+	// IDEMPOTENCY_KEY_TTL isn't set.
+	DefaultTTL = 24 * time.Hour
+
+	// DefaultSweepInterval is how often expired idempotency keys are deleted.
+	DefaultSweepInterval = time.Hour
+)
+
+// Sweeper periodically deletes expired checkout idempotency keys so that the table doesn't
+// grow without bound. A retry that arrives after its key expired places a new order.
+type Sweeper struct {
+	orders   models.OrderRepository
+	ttl      time.Duration
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewSweeper creates a Sweeper.
+//
+// Parameters:
+//   - orders: The repository whose expired idempotency keys are deleted.
+//   - ttl: How long a key is remembered after it was first used.
+//   - interval: How long to wait between sweeps.
+//   - logger: Where sweep results and failures are logged.
+//
+// Returns:
+//   - A Sweeper that starts sweeping when Run is called.
+func NewSweeper(orders models.OrderRepository, ttl, interval time.Duration, logger *slog.Logger) *Sweeper {
+	return &Sweeper{orders: orders, ttl: ttl, interval: interval, logger: logger}
+}
+
+// Run sweeps once immediately and then every interval until ctx is cancelled. A failed sweep
+// is logged and retried at the next interval.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep deletes the keys older than the TTL.
+func (s *Sweeper) sweep(ctx context.Context) {
+	deleted, err := s.orders.DeleteExpiredIdempotencyKeys(ctx, s.ttl)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "failed to delete expired idempotency keys", slog.Any("error", err))
+		}
+		return
+	}
+	if deleted > 0 {
+		s.logger.InfoContext(ctx, "deleted expired idempotency keys", slog.Int("count", deleted))
+	}
+}
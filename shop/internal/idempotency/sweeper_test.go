@@ -0,0 +1,66 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// fakeOrders is a models.OrderRepository that only remembers idempotency keys.
+type fakeOrders struct {
+	models.OrderRepository
+	now  time.Time
+	keys map[string]time.Time
+	err  error
+}
+
+func (f *fakeOrders) DeleteExpiredIdempotencyKeys(ctx context.Context, maxAge time.Duration) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	deleted := 0
+	for key, createdAt := range f.keys {
+		if !createdAt.After(f.now.Add(-maxAge)) {
+			delete(f.keys, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestSweeperDeletesExpired(t *testing.T) {
+	now := time.Now()
+	orders := &fakeOrders{now: now, keys: map[string]time.Time{
+		"old":   now.Add(-25 * time.Hour),
+		"fresh": now.Add(-time.Hour),
+	}}
+	var logs bytes.Buffer
+	sweeper := NewSweeper(orders, DefaultTTL, time.Hour, slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	sweeper.sweep(context.Background())
+
+	if _, ok := orders.keys["fresh"]; !ok || len(orders.keys) != 1 {
+		t.Fatalf("expected only the expired key to be deleted, got %v", orders.keys)
+	}
+	if !strings.Contains(logs.String(), `"count":1`) {
+		t.Errorf("expected the deletion to be logged, got %s", logs.String())
+	}
+}
+
+func TestSweeperLogsFailure(t *testing.T) {
+	orders := &fakeOrders{err: errors.New("connection reset")}
+	var logs bytes.Buffer
+	sweeper := NewSweeper(orders, DefaultTTL, time.Hour, slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	sweeper.sweep(context.Background())
+
+	if !strings.Contains(logs.String(), "connection reset") {
+		t.Errorf("expected the failure to be logged, got %s", logs.String())
+	}
+}
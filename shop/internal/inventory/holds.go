@@ -0,0 +1,113 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// DefaultPaymentGracePeriod is how long an order's stock is held while its payment is
+// collected when PAYMENT_GRACE_PERIOD isn't set.
+const DefaultPaymentGracePeriod = 30 * time.Minute
+
+// releaseBatchSize is the most expired payment holds released per sweep.
+const releaseBatchSize = 100
+
+// HoldReleaser periodically releases the stock held for orders whose payment didn't succeed
+// within the grace period, failed payments included, so that stock isn't tied up by orders
+// that will never be paid. Each such order's payment intent is cancelled first, so it can't
+// be paid for after its stock went back on sale, and then the order is cancelled.
+type HoldReleaser struct {
+	orders   models.OrderRepository
+	payments models.PaymentProvider
+	publish  func(*models.Order)
+	interval time.Duration
+	logger   *slog.Logger
+	clock    clock.Clock // What hold expiry is measured from.
+}
+
+// NewHoldReleaser creates a HoldReleaser.
+//
+// Parameters:
+//   - orders: The repository whose expired payment holds are released.
+//   - payments: The provider whose payment intents are cancelled.
+//   - publish: Called with each order that was cancelled, e.g. to notify subscribers.
+//   - interval: How long to wait between sweeps.
+//   - logger: Where released holds and failures are logged.
+//
+// Returns:
+//   - A HoldReleaser that starts sweeping when Run is called.
+func NewHoldReleaser(orders models.OrderRepository, payments models.PaymentProvider, publish func(*models.Order), interval time.Duration, logger *slog.Logger) *HoldReleaser {
+	return &HoldReleaser{orders: orders, payments: payments, publish: publish, interval: interval, logger: logger, clock: clock.Real{}}
+}
+
+// WithClock returns a copy of the releaser that releases the holds expired by c's current
+// time. The original releaser is left unchanged.
+//
+// Parameters:
+//   - c: The clock hold expiry is measured from.
+//
+// Returns:
+//   - A new HoldReleaser with the original's repository, provider, interval and logger.
+func (h *HoldReleaser) WithClock(c clock.Clock) *HoldReleaser {
+	copied := *h
+	copied.clock = c
+	return &copied
+}
+
+// Run sweeps once immediately and then every interval until ctx is cancelled. A failed sweep
+// is logged and retried at the next interval.
+func (h *HoldReleaser) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		h.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep cancels the unpaid orders whose hold has expired, releasing their stock. An order
+// whose payment intent can't be cancelled, most likely because the payment succeeded and the
+// webhook saying so hasn't arrived yet, keeps its stock and is tried again next sweep.
+func (h *HoldReleaser) sweep(ctx context.Context) {
+	expired, err := h.orders.ExpiredPaymentHolds(ctx, h.clock.Now(), releaseBatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			h.logger.ErrorContext(ctx, "failed to list expired payment holds", slog.Any("error", err))
+		}
+		return
+	}
+
+	released := 0
+	for _, order := range expired {
+		log := h.logger.With(slog.String("order_id", order.ID), slog.String("payment_intent", order.PaymentIntentID))
+		if err := h.payments.CancelIntent(ctx, order.PaymentIntentID); err != nil {
+			log.WarnContext(ctx, "kept stock held for order whose payment couldn't be cancelled", slog.Any("error", err))
+			continue
+		}
+		cancelled, err := h.orders.Cancel(ctx, order.ID)
+		if errors.Is(err, models.ErrOrderNotCancellable) {
+			// Paid for after all, between the listing and now.
+			continue
+		}
+		if err != nil {
+			log.ErrorContext(ctx, "failed to release expired payment hold", slog.Any("error", err))
+			continue
+		}
+		released++
+		if h.publish != nil {
+			h.publish(cancelled)
+		}
+	}
+	if released > 0 {
+		h.logger.InfoContext(ctx, "released expired payment holds", slog.Int("count", released))
+	}
+}
@@ -0,0 +1,117 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// fakeOrders is a models.OrderRepository that keeps orders awaiting payment in memory, along
+// with the stock their items hold.
+type fakeOrders struct {
+	models.OrderRepository
+	orders    []*models.Order
+	heldUntil map[string]time.Time // Payment holds by order ID.
+	stock     map[string]int
+}
+
+func (f *fakeOrders) ExpiredPaymentHolds(ctx context.Context, now time.Time, limit int) ([]*models.Order, error) {
+	var expired []*models.Order
+	for _, o := range f.orders {
+		unpaid := o.Status == models.OrderStatusPendingPayment || o.Status == models.OrderStatusPaymentFailed
+		if unpaid && !f.heldUntil[o.ID].After(now) && len(expired) < limit {
+			copied := *o
+			expired = append(expired, &copied)
+		}
+	}
+	return expired, nil
+}
+
+func (f *fakeOrders) Cancel(ctx context.Context, id string) (*models.Order, error) {
+	for _, o := range f.orders {
+		if o.ID != id {
+			continue
+		}
+		if o.Status == models.OrderStatusPaid {
+			return nil, models.ErrOrderNotCancellable
+		}
+		o.Status = models.OrderStatusCancelled
+		for _, item := range o.Items {
+			f.stock[item.ProductID] += item.Qty
+		}
+		return o, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+// fakePayments is a models.PaymentProvider that records the intents it cancels. Intents in
+// succeeded can't be cancelled.
+type fakePayments struct {
+	models.PaymentProvider
+	succeeded map[string]bool
+	cancelled []string
+}
+
+func (f *fakePayments) CancelIntent(ctx context.Context, intentID string) error {
+	if f.succeeded[intentID] {
+		return errors.New("payment intent has already succeeded")
+	}
+	f.cancelled = append(f.cancelled, intentID)
+	return nil
+}
+
+func TestHoldReleaserReleasesOnTimeout(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	orders := &fakeOrders{
+		orders: []*models.Order{
+			{ID: "100", Status: models.OrderStatusPendingPayment, PaymentIntentID: "pi_1", Items: []*models.OrderItem{{ProductID: "7", Qty: 2}}},
+			{ID: "101", Status: models.OrderStatusPaymentFailed, PaymentIntentID: "pi_2", Items: []*models.OrderItem{{ProductID: "7", Qty: 1}}},
+			{ID: "102", Status: models.OrderStatusPendingPayment, PaymentIntentID: "pi_3", Items: []*models.OrderItem{{ProductID: "8", Qty: 1}}},
+			{ID: "103", Status: models.OrderStatusPaid, PaymentIntentID: "pi_4", Items: []*models.OrderItem{{ProductID: "8", Qty: 1}}},
+		},
+		heldUntil: map[string]time.Time{
+			"100": now.Add(-time.Minute),
+			"101": now.Add(time.Minute),
+			"102": now.Add(-time.Minute),
+			"103": now.Add(-time.Hour),
+		},
+		stock: map[string]int{"7": 0, "8": 0},
+	}
+	// The payment for order 102 went through, but its webhook hasn't arrived yet.
+	payments := &fakePayments{succeeded: map[string]bool{"pi_3": true}}
+	var published []*models.Order
+	publish := func(o *models.Order) { published = append(published, o) }
+	fake := clock.NewFake(now)
+	releaser := NewHoldReleaser(orders, payments, publish, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil))).WithClock(fake)
+
+	releaser.sweep(context.Background())
+
+	if orders.orders[0].Status != models.OrderStatusCancelled || orders.stock["7"] != 2 {
+		t.Fatalf("expected the expired hold to be released, got %s with stock %d", orders.orders[0].Status, orders.stock["7"])
+	}
+	if len(payments.cancelled) != 1 || payments.cancelled[0] != "pi_1" {
+		t.Fatalf("expected only the expired order's payment intent to be cancelled, got %v", payments.cancelled)
+	}
+	if orders.orders[2].Status != models.OrderStatusPendingPayment || orders.stock["8"] != 0 {
+		t.Fatalf("expected the order whose payment succeeded to keep its stock, got %s with stock %d", orders.orders[2].Status, orders.stock["8"])
+	}
+	if orders.orders[3].Status != models.OrderStatusPaid {
+		t.Fatalf("expected the paid order to be left alone, got %s", orders.orders[3].Status)
+	}
+	if len(published) != 1 || published[0].ID != "100" {
+		t.Fatalf("expected the cancelled order to be published, got %+v", published)
+	}
+
+	// A failed payment keeps its stock until the grace period is over, so it can be retried.
+	fake.Advance(time.Minute)
+	releaser.sweep(context.Background())
+	if orders.orders[1].Status != models.OrderStatusCancelled || orders.stock["7"] != 3 {
+		t.Fatalf("expected the failed payment's hold to be released once it expired, got %s with stock %d", orders.orders[1].Status, orders.stock["7"])
+	}
+}
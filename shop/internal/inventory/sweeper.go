@@ -0,0 +1,85 @@
+package inventory
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const (
+	// DefaultReservationTTL is how long a stock reservation is held when RESERVATION_TTL
+	// isn't set.
+	DefaultReservationTTL = 15 * time.Minute
+
+	// DefaultSweepInterval is how often expired reservations are released when
+	// RESERVATION_SWEEP_INTERVAL isn't set.
+	DefaultSweepInterval = time.Minute
+)
+
+// Sweeper periodically releases expired stock reservations so that stock held by shoppers
+// who never checked out goes back on sale.
+type Sweeper struct {
+	reservations models.ReservationRepository
+	interval     time.Duration
+	logger       *slog.Logger
+	clock        clock.Clock // What expiry is measured from.
+}
+
+// NewSweeper creates a Sweeper.
+//
+// Parameters:
+//   - reservations: The repository whose expired reservations are released.
+//   - interval: How long to wait between sweeps.
+//   - logger: Where sweep results and failures are logged.
+//
+// Returns:
+//   - A Sweeper that starts sweeping when Run is called.
+func NewSweeper(reservations models.ReservationRepository, interval time.Duration, logger *slog.Logger) *Sweeper {
+	return &Sweeper{reservations: reservations, interval: interval, logger: logger, clock: clock.Real{}}
+}
+
+// WithClock returns a copy of the sweeper that releases the reservations expired by c's
+// current time. The original sweeper is left unchanged.
+//
+// Parameters:
+//   - c: The clock expiry is measured from.
+//
+// Returns:
+//   - A new Sweeper with the original's repository, interval and logger.
+func (s *Sweeper) WithClock(c clock.Clock) *Sweeper {
+	copied := *s
+	copied.clock = c
+	return &copied
+}
+
+// Run sweeps once immediately and then every interval until ctx is cancelled. A failed sweep
+// is logged and retried at the next interval.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep releases the reservations that have expired.
+func (s *Sweeper) sweep(ctx context.Context) {
+	released, err := s.reservations.ReleaseExpired(ctx, s.clock.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "failed to release expired reservations", slog.Any("error", err))
+		}
+		return
+	}
+	if released > 0 {
+		s.logger.InfoContext(ctx, "released expired reservations", slog.Int("count", released))
+	}
+}
@@ -0,0 +1,114 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// fakeReservations is a models.ReservationRepository that keeps reservations in memory.
+type fakeReservations struct {
+	mu           sync.Mutex
+	reservations []*models.Reservation
+	stock        map[string]int
+	sweeps       int
+	err          error
+}
+
+func (f *fakeReservations) Reserve(ctx context.Context, userID, productID string, qty int, expiresAt time.Time) (*models.Reservation, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeReservations) ReleaseExpired(ctx context.Context, now time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sweeps++
+	if f.err != nil {
+		return 0, f.err
+	}
+	var kept []*models.Reservation
+	released := 0
+	for _, r := range f.reservations {
+		if r.ExpiresAt.After(now) {
+			kept = append(kept, r)
+			continue
+		}
+		f.stock[r.ProductID] += r.Qty
+		released++
+	}
+	f.reservations = kept
+	return released, nil
+}
+
+func TestSweeperReleasesExpired(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	reservations := &fakeReservations{
+		stock: map[string]int{"7": 0},
+		reservations: []*models.Reservation{
+			{UserID: "42", ProductID: "7", Qty: 2, ExpiresAt: now.Add(-time.Minute)},
+			{UserID: "43", ProductID: "7", Qty: 1, ExpiresAt: now.Add(time.Minute)},
+		},
+	}
+	var logs bytes.Buffer
+	fake := clock.NewFake(now)
+	sweeper := NewSweeper(reservations, time.Hour, slog.New(slog.NewJSONHandler(&logs, nil))).WithClock(fake)
+
+	sweeper.sweep(context.Background())
+
+	if reservations.stock["7"] != 2 || len(reservations.reservations) != 1 || reservations.reservations[0].UserID != "43" {
+		t.Fatalf("expected only the expired reservation to be released, got stock %d and %+v", reservations.stock["7"], reservations.reservations)
+	}
+	if !strings.Contains(logs.String(), `"count":1`) {
+		t.Errorf("expected the release to be logged, got %s", logs.String())
+	}
+
+	fake.Advance(time.Minute)
+	sweeper.sweep(context.Background())
+	if reservations.stock["7"] != 3 || len(reservations.reservations) != 0 {
+		t.Fatalf("expected the reservation expiring a minute later to be released, got stock %d and %+v", reservations.stock["7"], reservations.reservations)
+	}
+}
+
+func TestSweeperRun(t *testing.T) {
+	reservations := &fakeReservations{err: errors.New("connection reset")}
+	var logs bytes.Buffer
+	sweeper := NewSweeper(reservations, time.Millisecond, slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sweeper.Run(ctx)
+		close(done)
+	}()
+
+	// Failures are retried on the next tick.
+	deadline := time.After(time.Second)
+	for {
+		reservations.mu.Lock()
+		sweeps := reservations.sweeps
+		reservations.mu.Unlock()
+		if sweeps >= 3 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("expected repeated sweeps, got %d", sweeps)
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after the context was cancelled")
+	}
+}
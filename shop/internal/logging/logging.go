@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// RequestIDKey is the log attribute key used for request IDs.
+const RequestIDKey = "request_id"
+
+// requestIDKey is the context key for the request ID.
+type requestIDKey struct{}
+
+// New creates a JSON logger writing to w at the given level.
+//
+// Parameters:
+//   - w: Where log records are written.
+//   - level: The minimum level ("debug", "info", "warn", or "error"). Empty means info.
+//
+// Returns:
+//   - A new logger.
+//   - An error if level isn't a known level.
+func New(w io.Writer, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})), nil
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, or an empty string if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// EnsureRequestID returns the request ID stored in ctx, generating and storing a new one
+// if there is none, so logs can be correlated across the resolver and auth layers.
+//
+// Parameters:
+//   - ctx: The request context.
+//
+// Returns:
+//   - A context carrying the request ID.
+//   - The request ID.
+func EnsureRequestID(ctx context.Context) (context.Context, string) {
+	if id := RequestID(ctx); id != "" {
+		return ctx, id
+	}
+	id := NewRequestID()
+	return WithRequestID(ctx, id), id
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNewLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn")
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, `"msg":"shown"`) {
+		t.Fatalf("unexpected log output %q", out)
+	}
+
+	if _, err := New(&buf, "loud"); err == nil {
+		t.Fatal("expected error for an unknown level")
+	}
+}
+
+func TestEnsureRequestID(t *testing.T) {
+	ctx, id := EnsureRequestID(context.Background())
+	if id == "" || RequestID(ctx) != id {
+		t.Fatalf("expected a generated request ID stored in the context, got %q", id)
+	}
+
+	same, again := EnsureRequestID(ctx)
+	if again != id || same != ctx {
+		t.Fatal("expected an existing request ID to be reused")
+	}
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive fields in logged bodies and headers.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedFields are the JSON fields and headers masked when LOG_REDACT_FIELDS isn't
+// set. Okta logins and usernames are emails or phone numbers, so they're masked too.
+var DefaultRedactedFields = []string{"password", "passCode", "email", "mobilePhone", "login", "username", "Authorization"}
+
+// Redactor masks sensitive JSON fields and headers before they're logged. Field names are
+// matched case-insensitively, at any depth.
+type Redactor struct {
+	fields map[string]bool // Lowercased names of the fields to mask.
+}
+
+// NewRedactor creates a Redactor.
+//
+// Parameters:
+//   - fields: The names of the JSON fields and headers to mask.
+//
+// Returns:
+//   - A new Redactor.
+func NewRedactor(fields []string) *Redactor {
+	r := &Redactor{fields: make(map[string]bool, len(fields))}
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			r.fields[strings.ToLower(f)] = true
+		}
+	}
+	return r
+}
+
+// JSON returns a copy of a JSON body with the values of sensitive fields replaced by
+// Redacted, whatever their type. Bodies that aren't valid JSON can't be inspected, so they
+// are replaced as a whole.
+//
+// Parameters:
+//   - body: The JSON body to redact.
+//
+// Returns:
+//   - The redacted body, still valid JSON. Object keys are sorted.
+func (r *Redactor) JSON(body []byte) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return []byte(`"` + Redacted + `"`)
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(r.redact(v)); err != nil {
+		return []byte(`"` + Redacted + `"`)
+	}
+	return bytes.TrimRight(out.Bytes(), "\n")
+}
+
+// redact masks the sensitive fields of a decoded JSON value in place.
+func (r *Redactor) redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if r.fields[strings.ToLower(k)] {
+				v[k] = Redacted
+			} else {
+				v[k] = r.redact(field)
+			}
+		}
+	case []any:
+		for i, elem := range v {
+			v[i] = r.redact(elem)
+		}
+	}
+	return v
+}
+
+// Header returns a copy of h with the values of sensitive headers replaced by Redacted.
+//
+// Parameters:
+//   - h: The headers to redact.
+//
+// Returns:
+//   - The redacted headers; h is left unchanged.
+func (r *Redactor) Header(h http.Header) http.Header {
+	out := h.Clone()
+	for k, values := range out {
+		if r.fields[strings.ToLower(k)] {
+			masked := make([]string, len(values))
+			for i := range masked {
+				masked[i] = Redacted
+			}
+			out[k] = masked
+		}
+	}
+	return out
+}
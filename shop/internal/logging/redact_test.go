@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedactorJSON(t *testing.T) {
+	r := NewRedactor(DefaultRedactedFields)
+	body := `{
+		"profile": {"firstName": "John", "email": "john.doe@example.com", "mobilePhone": "+15555550100"},
+		"credentials": {"password": {"value": "hunter2"}},
+		"factors": [{"passCode": "123456", "factorType": "sms"}],
+		"activate": true,
+		"limit": 20
+	}`
+
+	redacted := r.JSON([]byte(body))
+	var got map[string]any
+	if err := json.Unmarshal(redacted, &got); err != nil {
+		t.Fatalf("redacted body isn't valid JSON: %v: %s", err, redacted)
+	}
+	for _, secret := range []string{"john.doe@example.com", "+15555550100", "hunter2", "123456"} {
+		if strings.Contains(string(redacted), secret) {
+			t.Errorf("expected %q to be masked, got %s", secret, redacted)
+		}
+	}
+	profile := got["profile"].(map[string]any)
+	if profile["email"] != Redacted || profile["firstName"] != "John" {
+		t.Errorf("unexpected profile %v", profile)
+	}
+	if got["credentials"].(map[string]any)["password"] != Redacted {
+		t.Errorf("expected the whole password object to be masked, got %v", got["credentials"])
+	}
+	if factor := got["factors"].([]any)[0].(map[string]any); factor["passCode"] != Redacted || factor["factorType"] != "sms" {
+		t.Errorf("unexpected factor %v", factor)
+	}
+	if got["activate"] != true || got["limit"] != float64(20) {
+		t.Errorf("expected non-sensitive fields to survive, got %v", got)
+	}
+}
+
+func TestRedactorJSONInvalid(t *testing.T) {
+	r := NewRedactor(DefaultRedactedFields)
+	for _, body := range []string{`{"password": "hunter2"`, `{"email": "a@example.com"} {"email": "b@example.com"}`} {
+		if got := string(r.JSON([]byte(body))); got != `"[REDACTED]"` {
+			t.Errorf("%s: expected the whole body to be masked, got %s", body, got)
+		}
+	}
+	if got := r.JSON(nil); len(got) != 0 {
+		t.Errorf("expected an empty body to stay empty, got %s", got)
+	}
+}
+
+func TestRedactorFieldList(t *testing.T) {
+	r := NewRedactor([]string{" ssn ", "X-Api-Key"})
+	got := string(r.JSON([]byte(`{"SSN":"078-05-1120","email":"john.doe@example.com"}`)))
+	if want := `{"SSN":"[REDACTED]","email":"john.doe@example.com"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	h := http.Header{}
+	h.Set("X-Api-Key", "secret")
+	h.Set("Accept", "application/json")
+	masked := r.Header(h)
+	if masked.Get("X-Api-Key") != Redacted || masked.Get("Accept") != "application/json" {
+		t.Errorf("unexpected headers %v", masked)
+	}
+	if h.Get("X-Api-Key") != "secret" {
+		t.Error("expected the original headers to be left unchanged")
+	}
+}
+
+func TestRedactorHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "SSWS 00abc")
+	h.Set("Content-Type", "application/json")
+	masked := NewRedactor(DefaultRedactedFields).Header(h)
+	if masked.Get("Authorization") != Redacted || masked.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", masked)
+	}
+}
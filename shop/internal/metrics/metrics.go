@@ -0,0 +1,47 @@
+// Package metrics defines the Prometheus metrics exported by the API, registered on the
+// default Prometheus registry and served by Handler.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shop"
+
+// Status label values.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+var (
+	// GraphQLOperationDuration observes the duration of GraphQL operations, labeled by
+	// operation name and status ("ok" or "error"). Its _count series counts operations.
+	GraphQLOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of GraphQL operations by operation name and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	// OktaRequestDuration observes the duration of outbound Okta requests, labeled by HTTP
+	// method and response status code ("error" when no response was received). Retries are
+	// observed as separate requests.
+	OktaRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "okta",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of outbound Okta requests by method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "status"})
+)
+
+// Handler returns the handler serving the default registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ShoppingDem/backend/shop/internal/token"
+)
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying the authenticated user's ID.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserFromContext returns the authenticated user's ID stored by Authenticate, if any.
+func UserFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userKey{}).(string)
+	return userID, ok && userID != ""
+}
+
+// Authenticate is a middleware that validates an "Authorization: Bearer" session token and
+// stores the user ID from its claims in the request context. Requests without a valid token
+// are passed through unauthenticated, leaving resolvers and the @authenticated directive to
+// reject them where a user is needed: a client whose token has expired must still be able to
+// call public operations like refreshToken. A malformed, invalid or expired token is reported
+// in a Bearer challenge on the response, so the client knows to refresh it.
+func Authenticate(tokens *token.Signer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scheme, signed, found := strings.Cut(header, " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") || signed == "" {
+				challenge(w, "malformed Authorization header")
+				next.ServeHTTP(w, r)
+				return
+			}
+			claims, err := tokens.Parse(strings.TrimSpace(signed))
+			if errors.Is(err, token.ErrExpired) {
+				challenge(w, "token expired")
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				challenge(w, "invalid token")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), claims.UserID)))
+		})
+	}
+}
+
+// challenge sets a Bearer challenge on the response reporting why the token was rejected.
+func challenge(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+msg+`"`)
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/token"
+)
+
+func TestAuthenticate(t *testing.T) {
+	secret := []byte("test-secret")
+	tokens := token.New(secret, time.Minute)
+	valid, err := tokens.Sign("42", "00u1")
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+	expired, err := token.New(secret, -time.Minute).Sign("42", "00u1")
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+
+	// Requests with a rejected token go through anonymously, with a challenge saying why.
+	tests := []struct {
+		name          string
+		header        string
+		wantUser      string
+		wantChallenge string
+	}{
+		{name: "valid token", header: "Bearer " + valid, wantUser: "42"},
+		{name: "expired token", header: "Bearer " + expired, wantChallenge: "token expired"},
+		{name: "missing token"},
+		{name: "wrong scheme", header: "Basic " + valid, wantChallenge: "malformed Authorization header"},
+		{name: "garbage token", header: "Bearer nope", wantChallenge: "invalid token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser string
+			var called bool
+			h := Authenticate(tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				gotUser, _ = UserFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/query", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK || !called {
+				t.Fatalf("expected the request to reach the next handler, got status %d", rec.Code)
+			}
+			if gotUser != tt.wantUser {
+				t.Errorf("user = %q, want %q", gotUser, tt.wantUser)
+			}
+			challenge := rec.Header().Get("WWW-Authenticate")
+			if tt.wantChallenge == "" && challenge != "" || !strings.Contains(challenge, tt.wantChallenge) {
+				t.Errorf("challenge = %q, want one describing %q", challenge, tt.wantChallenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	var read int
+	h := MaxBodySize(100, 200)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		read = len(body)
+	}))
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		size        int
+		chunked     bool // Sent without a Content-Length.
+		want        int
+	}{
+		{"json under limit", "application/json", 100, false, http.StatusOK},
+		{"json over limit", "application/json", 101, false, http.StatusRequestEntityTooLarge},
+		{"chunked json under limit", "application/json", 100, true, http.StatusOK},
+		{"chunked json over limit", "application/json", 101, true, http.StatusRequestEntityTooLarge},
+		{"multipart under limit", "multipart/form-data; boundary=xyz", 200, false, http.StatusOK},
+		{"multipart over limit", "multipart/form-data; boundary=xyz", 201, false, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			read = 0
+			req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(strings.Repeat("x", tc.size)))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("expected status %d, got %d: %s", tc.want, rec.Code, rec.Body.String())
+			}
+			if tc.want == http.StatusOK && read != tc.size {
+				t.Fatalf("expected the handler to read %d bytes, got %d", tc.size, read)
+			}
+			if tc.want == http.StatusRequestEntityTooLarge && !strings.Contains(rec.Body.String(), "request body too large") {
+				t.Fatalf("expected a request body too large error, got %q", rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("chunked multipart over limit", func(t *testing.T) {
+		// Multipart bodies aren't buffered, so the handler sees the limit as a read error.
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(strings.Repeat("x", 201)))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+		req.ContentLength = -1
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "request body too large") {
+			t.Fatalf("expected the handler to fail reading the body, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+}
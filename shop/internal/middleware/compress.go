@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultCompressionMinSize is the response size, in bytes, below which responses are sent uncompressed.
+const DefaultCompressionMinSize = 1024
+
+// Compress returns a middleware that gzip- or deflate-encodes responses according to the
+// client's Accept-Encoding header.
+//
+// Responses are buffered until minSize bytes have been written; smaller responses are sent
+// as-is since compressing them costs more than it saves. Websocket upgrade requests are passed
+// through untouched.
+//
+// Parameters:
+//   - minSize: The minimum response size, in bytes, that will be compressed.
+//
+// Returns:
+//   - A function wrapping an http.Handler with response compression.
+func Compress(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isWebsocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			w.Header().Add("Vary", "Accept-Encoding")
+			if encoding == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// isWebsocketUpgrade reports whether the request asks to switch to the websocket protocol.
+func isWebsocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header, preferring gzip.
+// It returns an empty string when neither is acceptable.
+func negotiateEncoding(header string) string {
+	var deflate bool
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0" {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip":
+			return "gzip"
+		case "deflate":
+			deflate = true
+		}
+	}
+	if deflate {
+		return "deflate"
+	}
+	return ""
+}
+
+// compressWriter buffers the start of a response to decide whether it is large enough to compress.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	status   int
+	buf      []byte
+	enc      io.WriteCloser
+	decided  bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if !cw.decided {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide commits the response headers and flushes any buffered bytes, compressed or not.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	h := cw.ResponseWriter.Header()
+	if h.Get("Content-Encoding") != "" || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		compress = false
+	}
+
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		switch cw.encoding {
+		case "gzip":
+			cw.enc = gzip.NewWriter(cw.ResponseWriter)
+		case "deflate":
+			fw, err := flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+			if err != nil {
+				return err
+			}
+			cw.enc = fw
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.Write(buf)
+	return err
+}
+
+// Flush sends any buffered data to the client, compressing it if the threshold has been reached.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(len(cw.buf) >= cw.minSize); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, bypassing compression entirely.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	cw.decided = true
+	return hj.Hijack()
+}
+
+// Close writes out a small buffered response uncompressed, or finishes the compressed stream.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		return cw.decide(false)
+	}
+	if cw.enc != nil {
+		return cw.enc.Close()
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressLargeResponse(t *testing.T) {
+	body := strings.Repeat(`{"data":"value"}`, 200)
+	h := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("expected gzip encoding, got %q", got)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to open gzip body: %v", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to read gzip body: %v", err)
+	}
+	if string(decoded) != body {
+		t.Fatalf("decoded body does not match original")
+	}
+}
+
+func TestCompressSkipsSmallResponse(t *testing.T) {
+	h := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"ok":true}`)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("expected no encoding, got %q", got)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	if rec.Body.String() != `{"ok":true}` {
+		t.Fatalf("unexpected body %q", rec.Body.String())
+	}
+}
+
+func TestCompressSkipsWebsocketUpgrade(t *testing.T) {
+	var wrapped bool
+	h := Compress(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, wrapped = w.(*compressWriter)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/query", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Upgrade", "websocket")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if wrapped {
+		t.Fatal("websocket upgrade request should not be wrapped")
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                  "",
+		"gzip":              "gzip",
+		"deflate":           "deflate",
+		"deflate, gzip":     "gzip",
+		"gzip;q=0, deflate": "deflate",
+		"br, identity":      "",
+		"GZIP":              "gzip",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	corsAllowMethods  = "GET, POST, OPTIONS"
+	corsAllowHeaders  = "Authorization, Content-Type, " + RequestIDHeader
+	corsExposeHeaders = RequestIDHeader + ", Retry-After"
+	corsMaxAge        = "600"
+)
+
+// OriginAllowlist is the set of origins allowed to make cross-origin requests. The zero
+// value allows no cross-origin requests.
+type OriginAllowlist struct {
+	origins map[string]bool
+	any     bool
+}
+
+// ParseOriginAllowlist parses a comma-separated list of origins such as the ALLOWED_ORIGINS
+// environment variable. A "*" entry allows every origin and must be opted into explicitly.
+//
+// Parameters:
+//   - list: The comma-separated origins, e.g. "https://shop.example.com,http://localhost:3000".
+//
+// Returns:
+//   - A new OriginAllowlist instance.
+func ParseOriginAllowlist(list string) *OriginAllowlist {
+	a := &OriginAllowlist{origins: map[string]bool{}}
+	for _, origin := range strings.Split(list, ",") {
+		origin = normalizeOrigin(origin)
+		switch origin {
+		case "":
+		case "*":
+			a.any = true
+		default:
+			a.origins[origin] = true
+		}
+	}
+	return a
+}
+
+// Allowed reports whether origin may make cross-origin requests.
+func (a *OriginAllowlist) Allowed(origin string) bool {
+	origin = normalizeOrigin(origin)
+	return origin != "" && (a.any || a.origins[origin])
+}
+
+// CheckOrigin is a websocket.Upgrader CheckOrigin function. Like the upgrader's default, it
+// accepts requests without an Origin header and same-host origins; other origins must be in
+// the allowlist.
+func (a *OriginAllowlist) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return a.Allowed(origin)
+}
+
+// normalizeOrigin lowercases an origin and strips surrounding whitespace and a trailing slash.
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+// CORS returns a middleware that adds CORS headers for origins in allowlist and answers
+// preflight requests itself. Requests from other origins are passed through without CORS
+// headers so the browser blocks them, and their preflights are rejected with 403.
+//
+// Parameters:
+//   - allowlist: The origins allowed to make cross-origin requests.
+//
+// Returns:
+//   - A function wrapping an http.Handler with CORS handling.
+func CORS(allowlist *OriginAllowlist) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" || !allowlist.Allowed(origin) {
+				if preflight && origin != "" {
+					http.Error(w, "origin not allowed", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("Access-Control-Allow-Origin", origin)
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				h.Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
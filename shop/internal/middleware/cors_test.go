@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveCORS(allowlist *OriginAllowlist, method, origin string, preflight bool) (*httptest.ResponseRecorder, bool) {
+	var called bool
+	h := CORS(allowlist)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(method, "/query", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflight {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec, called
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	allowlist := ParseOriginAllowlist("https://shop.example.com, http://localhost:3000/")
+
+	rec, called := serveCORS(allowlist, http.MethodPost, "http://localhost:3000", false)
+	if !called {
+		t.Fatal("expected request to reach the handler")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Fatalf("expected origin to be echoed, got %q", got)
+	}
+
+	rec, called = serveCORS(allowlist, http.MethodOptions, "https://shop.example.com", true)
+	if called {
+		t.Fatal("expected preflight to be answered by the middleware")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://shop.example.com" {
+		t.Fatalf("expected origin to be echoed, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != corsAllowMethods {
+		t.Fatalf("unexpected allowed methods %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != corsAllowHeaders {
+		t.Fatalf("unexpected allowed headers %q", got)
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	allowlist := ParseOriginAllowlist("https://shop.example.com")
+
+	rec, called := serveCORS(allowlist, http.MethodPost, "https://evil.example.com", false)
+	if !called {
+		t.Fatal("expected request to reach the handler")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("expected no CORS headers, got Access-Control-Allow-Origin %q", got)
+	}
+
+	rec, called = serveCORS(allowlist, http.MethodOptions, "https://evil.example.com", true)
+	if called {
+		t.Fatal("expected preflight to be rejected by the middleware")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestCORSDefaultAllowsNoOrigins(t *testing.T) {
+	allowlist := ParseOriginAllowlist("")
+
+	rec, _ := serveCORS(allowlist, http.MethodOptions, "http://localhost:3000", true)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	// Same-origin and non-browser requests don't send Origin and are unaffected.
+	rec, called := serveCORS(allowlist, http.MethodPost, "", false)
+	if !called || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("expected request without Origin to pass through untouched")
+	}
+
+	if !ParseOriginAllowlist("*").Allowed("http://localhost:3000") {
+		t.Fatal("expected an explicit wildcard to allow any origin")
+	}
+}
+
+func TestOriginAllowlistCheckOrigin(t *testing.T) {
+	allowlist := ParseOriginAllowlist("https://shop.example.com")
+	tests := map[string]bool{
+		"":                         true,
+		"http://api.example.com":   true, // Same host as the request.
+		"https://shop.example.com": true,
+		"https://evil.example.com": false,
+	}
+	for origin, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://api.example.com/query", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if got := allowlist.CheckOrigin(req); got != want {
+			t.Errorf("CheckOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRateLimit is the sustained number of requests per second allowed per client.
+	DefaultRateLimit = 10
+
+	// DefaultRateBurst is the number of requests a client may make in a burst.
+	DefaultRateBurst = 20
+
+	// DefaultRateIdleTTL is how long a client's bucket is kept after its last request.
+	DefaultRateIdleTTL = 10 * time.Minute
+)
+
+// RateLimiter is an in-memory token-bucket rate limiter keyed by client.
+//
+// Each client gets a bucket holding up to burst tokens that refills at rate tokens per
+// second; a request spends one token. Buckets that have been idle for longer than the idle
+// TTL are evicted, since a fully refilled bucket is indistinguishable from a new one.
+type RateLimiter struct {
+	rate    float64          // Tokens added to a bucket per second.
+	burst   float64          // The maximum number of tokens a bucket holds.
+	idleTTL time.Duration    // How long an untouched bucket is kept.
+	now     func() time.Time // The clock, replaceable in tests.
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket is a single client's token bucket.
+type bucket struct {
+	tokens float64   // Tokens available as of last.
+	last   time.Time // When tokens was last updated.
+}
+
+// NewRateLimiter creates a new rate limiter.
+//
+// Parameters:
+//   - rate: The sustained number of requests per second allowed per client.
+//   - burst: The number of requests a client may make in a burst.
+//
+// Returns:
+//   - A new RateLimiter instance.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	idleTTL := DefaultRateIdleTTL
+	// Never evict a bucket before it could have refilled, or clients could reset their
+	// limit by going quiet for a while.
+	if refill := time.Duration(float64(burst) / rate * float64(time.Second)); refill > idleTTL {
+		idleTTL = refill
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		idleTTL: idleTTL,
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow spends a token from key's bucket.
+//
+// Parameters:
+//   - key: The client identifier, typically an IP address.
+//
+// Returns:
+//   - Whether the request is allowed.
+//   - How long the client should wait before retrying when it isn't.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed.Seconds()*l.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep evicts buckets that have been idle for longer than the idle TTL. It runs at most
+// once per TTL so the cost is amortised across requests.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx carrying the client IP.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client IP stored by RateLimit, if any.
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok
+}
+
+// RateLimit returns a middleware that rejects requests with 429 Too Many Requests once a
+// client IP has exhausted its bucket in limiter. The response carries a Retry-After header
+// with the number of seconds until the next request would be allowed. Allowed requests
+// carry the client IP in their context for handlers that apply their own limits.
+//
+// Parameters:
+//   - limiter: The rate limiter tracking each client's bucket.
+//   - trustProxy: Whether to take the client IP from X-Forwarded-For. Only enable this when
+//     the server sits behind a proxy that sets the header, since clients can forge it.
+//
+// Returns:
+//   - A function wrapping an http.Handler with rate limiting.
+func RateLimit(limiter *RateLimiter, trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r, trustProxy)
+			allowed, wait := limiter.Allow(ip)
+			if !allowed {
+				seconds := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithClientIP(r.Context(), ip)))
+		})
+	}
+}
+
+// clientIP returns the IP address a request came from. When trustProxy is set it uses the
+// last X-Forwarded-For entry, which is the one appended by our proxy; earlier entries are
+// supplied by the client and can't be trusted.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			parts := strings.Split(xff[len(xff)-1], ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for driving a RateLimiter.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestRateLimiter(rate float64, burst int) (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := NewRateLimiter(rate, burst)
+	l.now = clock.Now
+	return l, clock
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l, clock := newTestRateLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("1.2.3.4"); !ok {
+			t.Fatalf("request %d within burst was rejected", i+1)
+		}
+	}
+	ok, wait := l.Allow("1.2.3.4")
+	if ok {
+		t.Fatal("expected request beyond burst to be rejected")
+	}
+	if wait != 500*time.Millisecond {
+		t.Fatalf("expected wait of 500ms, got %v", wait)
+	}
+
+	if ok, _ := l.Allow("5.6.7.8"); !ok {
+		t.Fatal("expected other clients to have their own bucket")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if ok, _ := l.Allow("1.2.3.4"); !ok {
+		t.Fatal("expected a token after refilling for 500ms")
+	}
+	if ok, _ := l.Allow("1.2.3.4"); ok {
+		t.Fatal("expected the refilled token to be spent")
+	}
+
+	// Refill never exceeds the burst size.
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("1.2.3.4"); !ok {
+			t.Fatalf("request %d after full refill was rejected", i+1)
+		}
+	}
+	if ok, _ := l.Allow("1.2.3.4"); ok {
+		t.Fatal("expected bucket to be capped at burst")
+	}
+}
+
+func TestRateLimiterEvictsIdleBuckets(t *testing.T) {
+	l, clock := newTestRateLimiter(1, 1)
+	l.Allow("1.2.3.4")
+	clock.Advance(DefaultRateIdleTTL / 2)
+	l.Allow("5.6.7.8")
+
+	clock.Advance(DefaultRateIdleTTL / 2)
+	l.Allow("9.9.9.9")
+	if _, ok := l.buckets["1.2.3.4"]; ok {
+		t.Fatal("expected idle bucket to be evicted")
+	}
+	if _, ok := l.buckets["5.6.7.8"]; !ok {
+		t.Fatal("expected recently used bucket to be kept")
+	}
+}
+
+func TestNewRateLimiterKeepsBucketsUntilRefilled(t *testing.T) {
+	l := NewRateLimiter(0.01, 100)
+	if want := 10000 * time.Second; l.idleTTL != want {
+		t.Fatalf("expected idle TTL of %v, got %v", want, l.idleTTL)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	l, _ := newTestRateLimiter(0.5, 1)
+	var ip string
+	h := RateLimit(l, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _ = ClientIPFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if ip != "1.2.3.4" {
+		t.Fatalf("expected the client IP in the context, got %q", ip)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("expected Retry-After 2, got %q", got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Add("X-Forwarded-For", "6.6.6.6")
+	req.Header.Add("X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+
+	if got := clientIP(req, false); got != "10.0.0.1" {
+		t.Fatalf("expected remote address without proxy trust, got %q", got)
+	}
+	if got := clientIP(req, true); got != "2.2.2.2" {
+		t.Fatalf("expected last forwarded address, got %q", got)
+	}
+
+	req.Header.Del("X-Forwarded-For")
+	if got := clientIP(req, true); got != "10.0.0.1" {
+		t.Fatalf("expected remote address without X-Forwarded-For, got %q", got)
+	}
+}
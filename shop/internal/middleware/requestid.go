@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+)
+
+// RequestIDHeader is the header used to propagate request IDs.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID is a middleware that stores the incoming X-Request-ID header, or a newly
+// generated ID, in the request context and echoes it back in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{name: "propagates incoming header", incoming: "abc-123", wantSame: true},
+		{name: "generates when missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = logging.RequestID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if got == "" {
+				t.Fatal("request ID missing from context")
+			}
+			if tt.wantSame && got != tt.incoming {
+				t.Errorf("request ID = %q, want %q", got, tt.incoming)
+			}
+			if echoed := rec.Header().Get(RequestIDHeader); echoed != got {
+				t.Errorf("%s header = %q, want %q", RequestIDHeader, echoed, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// ErrInvalidTransition is returned when an order can't move from its status to the requested one.
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// transitions lists the statuses an order in each status may move to. Orders move forward
+// from PENDING to PAID to SHIPPED to DELIVERED, going through PENDING_PAYMENT while a
+// payment provider collects the payment, and can only be cancelled before they're paid
+// for. A failed payment can still be retried, so PAYMENT_FAILED orders may yet be paid.
+// Statuses without an entry are final.
+var transitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPending:        {models.OrderStatusPendingPayment, models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPendingPayment: {models.OrderStatusPaid, models.OrderStatusPaymentFailed, models.OrderStatusCancelled},
+	models.OrderStatusPaymentFailed:  {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:           {models.OrderStatusShipped},
+	models.OrderStatusShipped:        {models.OrderStatusDelivered},
+}
+
+// CanTransition checks that an order may move from status from to status to. Every change
+// to an order's status must be checked with it.
+//
+// Parameters:
+//   - from: The order's current status.
+//   - to: The status the order would move to.
+//
+// Returns:
+//   - nil if the transition is allowed, or an error wrapping ErrInvalidTransition that
+//     names both statuses.
+func CanTransition(from, to models.OrderStatus) error {
+	if !slices.Contains(transitions[from], to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package orders
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestCanTransition(t *testing.T) {
+	statuses := []models.OrderStatus{
+		models.OrderStatusPending,
+		models.OrderStatusPendingPayment,
+		models.OrderStatusPaymentFailed,
+		models.OrderStatusPaid,
+		models.OrderStatusShipped,
+		models.OrderStatusDelivered,
+		models.OrderStatusCancelled,
+	}
+	allowed := map[[2]models.OrderStatus]bool{
+		{models.OrderStatusPending, models.OrderStatusPendingPayment}:       true,
+		{models.OrderStatusPending, models.OrderStatusPaid}:                 true,
+		{models.OrderStatusPending, models.OrderStatusCancelled}:            true,
+		{models.OrderStatusPendingPayment, models.OrderStatusPaid}:          true,
+		{models.OrderStatusPendingPayment, models.OrderStatusPaymentFailed}: true,
+		{models.OrderStatusPendingPayment, models.OrderStatusCancelled}:     true,
+		{models.OrderStatusPaymentFailed, models.OrderStatusPaid}:           true,
+		{models.OrderStatusPaymentFailed, models.OrderStatusCancelled}:      true,
+		{models.OrderStatusPaid, models.OrderStatusShipped}:                 true,
+		{models.OrderStatusShipped, models.OrderStatusDelivered}:            true,
+	}
+
+	// Every pair of statuses, including staying in the same status, is either allowed or
+	// rejected with ErrInvalidTransition.
+	for _, from := range statuses {
+		for _, to := range statuses {
+			err := CanTransition(from, to)
+			if allowed[[2]models.OrderStatus{from, to}] {
+				if err != nil {
+					t.Errorf("%s -> %s: expected the transition to be allowed, got %v", from, to, err)
+				}
+				continue
+			}
+			if !errors.Is(err, ErrInvalidTransition) {
+				t.Errorf("%s -> %s: expected ErrInvalidTransition, got %v", from, to, err)
+			} else if !strings.Contains(err.Error(), string(from)+" to "+string(to)) {
+				t.Errorf("%s -> %s: expected the error to name both statuses, got %q", from, to, err)
+			}
+		}
+	}
+}
+
+func TestCanTransitionUnknownStatus(t *testing.T) {
+	if err := CanTransition("LOST", models.OrderStatusPaid); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition from an unknown status, got %v", err)
+	}
+	if err := CanTransition(models.OrderStatusPending, "LOST"); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition to an unknown status, got %v", err)
+	}
+}
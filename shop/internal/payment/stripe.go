@@ -0,0 +1,236 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const (
+	// DefaultStripeURL is the base URL of the Stripe API.
+	DefaultStripeURL = "https://api.stripe.com"
+
+	// maxErrorBody bounds how much of a Stripe error response is read.
+	maxErrorBody = 64 << 10
+)
+
+// Stripe is a models.PaymentProvider backed by Stripe payment intents.
+type Stripe struct {
+	SecretKey  string       // The Stripe secret API key (e.g., "sk_live_...").
+	BaseURL    string       // The Stripe API URL, DefaultStripeURL unless testing.
+	HTTPClient *http.Client // The HTTP client to use for API requests.
+}
+
+var _ models.PaymentProvider = (*Stripe)(nil)
+
+// NewStripe creates a Stripe payment provider.
+//
+// Parameters:
+//   - secretKey: The Stripe secret API key.
+//
+// Returns:
+//   - A new Stripe payment provider.
+func NewStripe(secretKey string) *Stripe {
+	return &Stripe{
+		SecretKey: secretKey,
+		BaseURL:   DefaultStripeURL,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// StripeError is an error returned by the Stripe API.
+// Use errors.As to inspect the Stripe error type and code, e.g. to detect a declined card.
+type StripeError struct {
+	StatusCode int    // The HTTP status code of the response.
+	Type       string // The Stripe error type (e.g., "card_error").
+	Code       string // The Stripe error code, if any (e.g., "card_declined").
+	Message    string // A human-readable description of the error.
+}
+
+// Error implements the error interface.
+func (e *StripeError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("stripe error %s/%s (status: %d): %s", e.Type, e.Code, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("stripe error %s (status: %d): %s", e.Type, e.StatusCode, e.Message)
+}
+
+// paymentIntent is the part of a Stripe PaymentIntent object we use.
+type paymentIntent struct {
+	ID           string `json:"id"`
+	ClientSecret string `json:"client_secret"`
+	Status       string `json:"status"`
+}
+
+// CreateIntent creates a payment intent for an order. The order ID is sent as the
+// idempotency key, so retrying for the same order returns the intent created first.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - amountCents: The amount to collect, in the currency's smallest unit.
+//   - currency: The ISO 4217 currency code.
+//   - orderID: The order being paid for, recorded in the intent's metadata.
+//
+// Returns:
+//   - The payment intent's ID and client secret.
+//   - An error if the request fails.
+func (s *Stripe) CreateIntent(ctx context.Context, amountCents int64, currency, orderID string) (string, string, error) {
+	form := url.Values{
+		"amount":                             {strconv.FormatInt(amountCents, 10)},
+		"currency":                           {strings.ToLower(currency)},
+		"metadata[order_id]":                 {orderID},
+		"automatic_payment_methods[enabled]": {"true"},
+	}
+	var intent paymentIntent
+	if err := s.post(ctx, "/v1/payment_intents", form, "order-"+orderID, &intent); err != nil {
+		return "", "", fmt.Errorf("failed to create payment intent for order %s: %w", orderID, err)
+	}
+	return intent.ID, intent.ClientSecret, nil
+}
+
+// ClientSecret retrieves a payment intent and returns its client secret.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - intentID: The payment intent to retrieve.
+//
+// Returns:
+//   - The payment intent's client secret.
+//   - An error if the request fails.
+func (s *Stripe) ClientSecret(ctx context.Context, intentID string) (string, error) {
+	var intent paymentIntent
+	if err := s.do(ctx, http.MethodGet, "/v1/payment_intents/"+url.PathEscape(intentID), nil, "", &intent); err != nil {
+		return "", fmt.Errorf("failed to retrieve payment intent %s: %w", intentID, err)
+	}
+	return intent.ClientSecret, nil
+}
+
+// Capture captures the full amount a payment intent has authorized.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - intentID: The payment intent to capture.
+//
+// Returns:
+//   - An error if the request fails.
+func (s *Stripe) Capture(ctx context.Context, intentID string) error {
+	if err := s.post(ctx, "/v1/payment_intents/"+url.PathEscape(intentID)+"/capture", url.Values{}, "", nil); err != nil {
+		return fmt.Errorf("failed to capture payment intent %s: %w", intentID, err)
+	}
+	return nil
+}
+
+// Refund refunds a payment intent in full. The intent ID is sent as the idempotency key,
+// so a retried refund doesn't refund twice.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - intentID: The payment intent to refund.
+//
+// Returns:
+//   - An error if the request fails.
+func (s *Stripe) Refund(ctx context.Context, intentID string) error {
+	form := url.Values{"payment_intent": {intentID}}
+	if err := s.post(ctx, "/v1/refunds", form, "refund-"+intentID, nil); err != nil {
+		return fmt.Errorf("failed to refund payment intent %s: %w", intentID, err)
+	}
+	return nil
+}
+
+// CancelIntent cancels a payment intent. The intent ID is sent as the idempotency key, so
+// cancelling it again returns the first cancellation's result instead of failing because
+// the intent is already cancelled.
+//
+// Parameters:
+//   - ctx: The context for the request.
+//   - intentID: The payment intent to cancel.
+//
+// Returns:
+//   - An error if the request fails, e.g. because the intent has already succeeded.
+func (s *Stripe) CancelIntent(ctx context.Context, intentID string) error {
+	if err := s.post(ctx, "/v1/payment_intents/"+url.PathEscape(intentID)+"/cancel", url.Values{}, "cancel-"+intentID, nil); err != nil {
+		return fmt.Errorf("failed to cancel payment intent %s: %w", intentID, err)
+	}
+	return nil
+}
+
+// post sends a form-encoded POST request to the Stripe API and decodes the response into
+// out, unless out is nil.
+func (s *Stripe) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out any) error {
+	return s.do(ctx, http.MethodPost, path, form, idempotencyKey, out)
+}
+
+// do sends a request to the Stripe API, with form as its form-encoded body unless form is
+// nil, and decodes the response into out, unless out is nil.
+func (s *Stripe) do(ctx context.Context, method, path string, form url.Values, idempotencyKey string, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.BaseURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.SecretKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// decodeError decodes a Stripe error response into a *StripeError.
+func decodeError(resp *http.Response) error {
+	var body struct {
+		Error struct {
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil {
+		return fmt.Errorf("failed to read error response (status: %d): %w", resp.StatusCode, err)
+	}
+	if err := json.Unmarshal(raw, &body); err != nil || body.Error.Type == "" {
+		return &StripeError{StatusCode: resp.StatusCode, Type: "unknown", Message: http.StatusText(resp.StatusCode)}
+	}
+	return &StripeError{
+		StatusCode: resp.StatusCode,
+		Type:       body.Error.Type,
+		Code:       body.Error.Code,
+		Message:    body.Error.Message,
+	}
+}
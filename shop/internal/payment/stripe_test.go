@@ -0,0 +1,144 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newStripeServer starts a fake Stripe API that records the last request and answers
+// with handle.
+func newStripeServer(t *testing.T, handle http.HandlerFunc) (*Stripe, *http.Request) {
+	t.Helper()
+	var last http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		last = *r
+		handle(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	stripe := NewStripe("sk_test_123")
+	stripe.BaseURL = srv.URL
+	return stripe, &last
+}
+
+func TestStripeCreateIntent(t *testing.T) {
+	stripe, req := newStripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "pi_1", "client_secret": "pi_1_secret_abc", "status": "requires_payment_method"}`))
+	})
+
+	intentID, clientSecret, err := stripe.CreateIntent(context.Background(), 2797, "USD", "100")
+	if err != nil {
+		t.Fatalf("CreateIntent returned error: %v", err)
+	}
+	if intentID != "pi_1" || clientSecret != "pi_1_secret_abc" {
+		t.Fatalf("unexpected intent %q with secret %q", intentID, clientSecret)
+	}
+
+	if req.Method != http.MethodPost || req.URL.Path != "/v1/payment_intents" {
+		t.Fatalf("unexpected request %s %s", req.Method, req.URL.Path)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer sk_test_123" {
+		t.Errorf("unexpected Authorization header %q", got)
+	}
+	if got := req.Header.Get("Idempotency-Key"); got != "order-100" {
+		t.Errorf("expected the order ID as idempotency key, got %q", got)
+	}
+	for field, want := range map[string]string{
+		"amount":             "2797",
+		"currency":           "usd",
+		"metadata[order_id]": "100",
+	} {
+		if got := req.PostForm.Get(field); got != want {
+			t.Errorf("%s: expected %q, got %q", field, want, got)
+		}
+	}
+}
+
+func TestStripeClientSecret(t *testing.T) {
+	stripe, req := newStripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "pi_1", "client_secret": "pi_1_secret_abc", "status": "requires_payment_method"}`))
+	})
+
+	secret, err := stripe.ClientSecret(context.Background(), "pi_1")
+	if err != nil {
+		t.Fatalf("ClientSecret returned error: %v", err)
+	}
+	if secret != "pi_1_secret_abc" {
+		t.Fatalf("unexpected client secret %q", secret)
+	}
+	if req.Method != http.MethodGet || req.URL.Path != "/v1/payment_intents/pi_1" {
+		t.Fatalf("unexpected request %s %s", req.Method, req.URL.Path)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer sk_test_123" {
+		t.Errorf("unexpected Authorization header %q", got)
+	}
+}
+
+func TestStripeCaptureRefundAndCancel(t *testing.T) {
+	stripe, req := newStripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "re_1"}`))
+	})
+
+	if err := stripe.Capture(context.Background(), "pi_1"); err != nil {
+		t.Fatalf("Capture returned error: %v", err)
+	}
+	if req.URL.Path != "/v1/payment_intents/pi_1/capture" {
+		t.Fatalf("unexpected capture path %s", req.URL.Path)
+	}
+
+	if err := stripe.Refund(context.Background(), "pi_1"); err != nil {
+		t.Fatalf("Refund returned error: %v", err)
+	}
+	if req.URL.Path != "/v1/refunds" || req.PostForm.Get("payment_intent") != "pi_1" {
+		t.Fatalf("unexpected refund request %s %v", req.URL.Path, req.PostForm)
+	}
+	if got := req.Header.Get("Idempotency-Key"); got != "refund-pi_1" {
+		t.Errorf("expected the intent ID as refund idempotency key, got %q", got)
+	}
+
+	if err := stripe.CancelIntent(context.Background(), "pi_1"); err != nil {
+		t.Fatalf("CancelIntent returned error: %v", err)
+	}
+	if req.URL.Path != "/v1/payment_intents/pi_1/cancel" {
+		t.Fatalf("unexpected cancel path %s", req.URL.Path)
+	}
+	if got := req.Header.Get("Idempotency-Key"); got != "cancel-pi_1" {
+		t.Errorf("expected the intent ID as cancel idempotency key, got %q", got)
+	}
+}
+
+func TestStripeErrors(t *testing.T) {
+	t.Run("stripe error", func(t *testing.T) {
+		stripe, _ := newStripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusPaymentRequired)
+			w.Write([]byte(`{"error": {"type": "card_error", "code": "card_declined", "message": "Your card was declined."}}`))
+		})
+
+		err := stripe.Capture(context.Background(), "pi_1")
+		var stripeErr *StripeError
+		if !errors.As(err, &stripeErr) {
+			t.Fatalf("expected a *StripeError, got %v", err)
+		}
+		if stripeErr.StatusCode != http.StatusPaymentRequired || stripeErr.Code != "card_declined" || stripeErr.Message != "Your card was declined." {
+			t.Fatalf("unexpected error %+v", stripeErr)
+		}
+	})
+
+	t.Run("non-JSON body", func(t *testing.T) {
+		stripe, _ := newStripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "<html>bad gateway</html>", http.StatusBadGateway)
+		})
+
+		_, _, err := stripe.CreateIntent(context.Background(), 100, "USD", "100")
+		var stripeErr *StripeError
+		if !errors.As(err, &stripeErr) || stripeErr.StatusCode != http.StatusBadGateway {
+			t.Fatalf("expected a 502 *StripeError, got %v", err)
+		}
+	})
+}
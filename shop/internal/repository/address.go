@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/internal/database"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// addressColumns is the column list scanned by scanAddress.
+const addressColumns = `id, user_id, line1, line2, city, region, postal_code, country, is_default, created_at`
+
+// sqlAddressRepository is a models.AddressRepository backed by the addresses table.
+type sqlAddressRepository struct {
+	db *sql.DB
+}
+
+// NewAddressRepository creates an AddressRepository backed by db.
+func NewAddressRepository(db *sql.DB) models.AddressRepository {
+	return &sqlAddressRepository{db: db}
+}
+
+// ListByUser returns the user's addresses, the default first.
+func (r *sqlAddressRepository) ListByUser(ctx context.Context, userID string) ([]*models.Address, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+addressColumns+` FROM addresses WHERE user_id = $1 ORDER BY is_default DESC, created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []*models.Address{}
+	for rows.Next() {
+		address, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+// GetByID returns one of the user's addresses.
+func (r *sqlAddressRepository) GetByID(ctx context.Context, userID, id string) (*models.Address, error) {
+	address, err := scanAddress(r.db.QueryRowContext(ctx,
+		`SELECT `+addressColumns+` FROM addresses WHERE id = $1 AND user_id = $2`,
+		id, userID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	return address, err
+}
+
+// Create inserts an address, first unsetting the user's default if it replaces it.
+func (r *sqlAddressRepository) Create(ctx context.Context, address *models.Address) error {
+	return defaultConflict(database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		if address.IsDefault {
+			if err := unsetDefaultAddress(ctx, tx, address.UserID); err != nil {
+				return err
+			}
+		}
+		return tx.QueryRowContext(ctx,
+			`INSERT INTO addresses (user_id, line1, line2, city, region, postal_code, country, is_default)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+			address.UserID, address.Line1, address.Line2, address.City, address.Region, address.PostalCode, address.Country, address.IsDefault,
+		).Scan(&address.ID, &address.CreatedAt)
+	}))
+}
+
+// Update saves an address, first unsetting the user's default if it replaces it. The
+// transaction is rolled back if the address doesn't exist, so the old default is kept.
+func (r *sqlAddressRepository) Update(ctx context.Context, address *models.Address) error {
+	return defaultConflict(database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		if address.IsDefault {
+			if err := unsetDefaultAddress(ctx, tx, address.UserID); err != nil {
+				return err
+			}
+		}
+		res, err := tx.ExecContext(ctx,
+			`UPDATE addresses SET line1 = $3, line2 = $4, city = $5, region = $6, postal_code = $7, country = $8, is_default = $9
+			WHERE id = $1 AND user_id = $2`,
+			address.ID, address.UserID, address.Line1, address.Line2, address.City, address.Region, address.PostalCode, address.Country, address.IsDefault,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return models.ErrNotFound
+		}
+		return nil
+	}))
+}
+
+// Delete removes one of the user's addresses.
+func (r *sqlAddressRepository) Delete(ctx context.Context, userID, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM addresses WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// unsetDefaultAddress clears the user's default address, if they have one.
+func unsetDefaultAddress(ctx context.Context, tx *sql.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE addresses SET is_default = false WHERE user_id = $1 AND is_default`, userID)
+	return err
+}
+
+// defaultConflict maps a violation of the one-default-per-user index, which happens when
+// another request set a different default at the same time, to ErrConcurrentModification.
+func defaultConflict(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return models.ErrConcurrentModification
+	}
+	return err
+}
+
+// scanAddress scans a row selected with addressColumns.
+func scanAddress(row scanner) (*models.Address, error) {
+	var a models.Address
+	if err := row.Scan(&a.ID, &a.UserID, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode, &a.Country, &a.IsDefault, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
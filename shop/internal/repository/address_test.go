@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+var addressRowColumns = []string{"id", "user_id", "line1", "line2", "city", "region", "postal_code", "country", "is_default", "created_at"}
+
+func TestAddressRepositoryCreate(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("default replaces the previous default", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewAddressRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE addresses SET is_default = false WHERE user_id = \$1 AND is_default`).
+			WithArgs("42").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO addresses \(user_id, line1, line2, city, region, postal_code, country, is_default\)\s+VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8\) RETURNING id, created_at`).
+			WithArgs("42", "1 Main St", "", "Springfield", "IL", "62701", "US", true).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("5", created))
+		mock.ExpectCommit()
+
+		address := &models.Address{UserID: "42", Line1: "1 Main St", City: "Springfield", Region: "IL", PostalCode: "62701", Country: "US", IsDefault: true}
+		if err := repo.Create(context.Background(), address); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		if address.ID != "5" || !address.CreatedAt.Equal(created) {
+			t.Fatalf("expected ID and CreatedAt from the database, got %+v", address)
+		}
+	})
+
+	t.Run("not default", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewAddressRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO addresses`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("6", created))
+		mock.ExpectCommit()
+
+		if err := repo.Create(context.Background(), &models.Address{UserID: "42", Line1: "2 Elm St", City: "Springfield", PostalCode: "62701", Country: "US"}); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+	})
+
+	t.Run("concurrent default", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewAddressRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE addresses SET is_default = false`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`INSERT INTO addresses`).
+			WillReturnError(&pq.Error{Code: pqUniqueViolation, Constraint: "addresses_user_id_default_idx"})
+		mock.ExpectRollback()
+
+		err := repo.Create(context.Background(), &models.Address{UserID: "42", IsDefault: true})
+		if !errors.Is(err, models.ErrConcurrentModification) {
+			t.Fatalf("expected ErrConcurrentModification, got %v", err)
+		}
+	})
+}
+
+func TestAddressRepositoryUpdate(t *testing.T) {
+	address := &models.Address{ID: "6", UserID: "42", Line1: "2 Elm St", City: "Springfield", PostalCode: "62701", Country: "US", IsDefault: true}
+
+	t.Run("switches the default", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewAddressRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE addresses SET is_default = false WHERE user_id = \$1 AND is_default`).
+			WithArgs("42").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE addresses SET line1 = \$3, line2 = \$4, city = \$5, region = \$6, postal_code = \$7, country = \$8, is_default = \$9\s+WHERE id = \$1 AND user_id = \$2`).
+			WithArgs("6", "42", "2 Elm St", "", "Springfield", "", "62701", "US", true).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := repo.Update(context.Background(), address); err != nil {
+			t.Fatalf("Update returned error: %v", err)
+		}
+	})
+
+	t.Run("not found keeps the old default", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewAddressRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE addresses SET is_default = false`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE addresses SET line1`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		if err := repo.Update(context.Background(), address); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestAddressRepositoryDelete(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewAddressRepository(db)
+
+	mock.ExpectExec(`DELETE FROM addresses WHERE id = \$1 AND user_id = \$2`).
+		WithArgs("5", "42").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM addresses`).
+		WithArgs("5", "43").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := repo.Delete(context.Background(), "42", "5"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if err := repo.Delete(context.Background(), "43", "5"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for another user's address, got %v", err)
+	}
+}
+
+func TestAddressRepositoryList(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewAddressRepository(db)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT id, user_id, line1, line2, city, region, postal_code, country, is_default, created_at FROM addresses WHERE user_id = \$1 ORDER BY is_default DESC, created_at, id`).
+		WithArgs("42").
+		WillReturnRows(sqlmock.NewRows(addressRowColumns).
+			AddRow("6", "42", "2 Elm St", "Apt 3", "Springfield", "IL", "62701", "US", true, created).
+			AddRow("5", "42", "1 Main St", "", "Springfield", "IL", "62701", "US", false, created))
+	mock.ExpectQuery(`SELECT .* FROM addresses WHERE id = \$1 AND user_id = \$2`).
+		WithArgs("5", "43").
+		WillReturnRows(sqlmock.NewRows(addressRowColumns))
+
+	addresses, err := repo.ListByUser(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("ListByUser returned error: %v", err)
+	}
+	if len(addresses) != 2 || !addresses[0].IsDefault || addresses[0].Line2 != "Apt 3" || addresses[1].ID != "5" {
+		t.Fatalf("unexpected addresses: %+v", addresses)
+	}
+	if _, err := repo.GetByID(context.Background(), "43", "5"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for another user's address, got %v", err)
+	}
+}
@@ -0,0 +1,360 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// cartQuery selects the items in a user's cart with their products.
+const cartQuery = `SELECT ` + productColumns + `, qty FROM cart_items
+	JOIN products ON products.id = cart_items.product_id
+	WHERE user_id = $1 ORDER BY added_at, product_id`
+
+// savedItemsQuery selects a user's saved items with their products.
+const savedItemsQuery = `SELECT ` + productColumns + `, qty FROM saved_items
+	JOIN products ON products.id = saved_items.product_id
+	WHERE user_id = $1 ORDER BY saved_at, product_id`
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// sqlCartRepository is a models.CartRepository backed by the cart_items table.
+type sqlCartRepository struct {
+	db *sql.DB
+}
+
+// NewCartRepository creates a CartRepository backed by db.
+func NewCartRepository(db *sql.DB) models.CartRepository {
+	return &sqlCartRepository{db: db}
+}
+
+// Get returns the user's cart.
+func (r *sqlCartRepository) Get(ctx context.Context, userID string) (*models.Cart, error) {
+	return loadCart(ctx, r.db, userID)
+}
+
+// AddItem upserts a cart item in a transaction, rolling back if the new quantity exceeds stock.
+func (r *sqlCartRepository) AddItem(ctx context.Context, userID, productID string, qty int) (*models.Cart, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := addCartItem(ctx, tx, userID, productID, qty); err != nil {
+		return nil, err
+	}
+
+	cart, err := loadCart(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return cart, tx.Commit()
+}
+
+// AddItems adds the items in one transaction, in product ID order so that concurrent bulk
+// additions lock the same cart rows in the same order. Each item is added under a savepoint,
+// which is rolled back if the item is rejected, leaving the items added before it in place.
+func (r *sqlCartRepository) AddItems(ctx context.Context, userID string, items []*models.CartItemInput, allOrNothing bool) (*models.Cart, []error, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(items[a].ProductID, items[b].ProductID) })
+
+	itemErrs := make([]error, len(items))
+	for _, i := range order {
+		item := items[i]
+		if allOrNothing {
+			if err := addCartItem(ctx, tx, userID, item.ProductID, item.Qty); err != nil {
+				itemErrs[i] = err
+				return nil, itemErrs, err
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT cart_item`); err != nil {
+			return nil, nil, err
+		}
+		itemErr := addCartItem(ctx, tx, userID, item.ProductID, item.Qty)
+		if errors.Is(itemErr, models.ErrNotFound) || errors.Is(itemErr, models.ErrExceedsStock) || errors.Is(itemErr, models.ErrPurchaseLimit) {
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT cart_item`); err != nil {
+				return nil, nil, err
+			}
+			itemErrs[i] = itemErr
+			continue
+		}
+		if itemErr != nil {
+			return nil, nil, itemErr
+		}
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT cart_item`); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	cart, err := loadCart(ctx, tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cart, itemErrs, tx.Commit()
+}
+
+// SetItemQty updates a cart item's quantity in a transaction, checking it against stock.
+func (r *sqlCartRepository) SetItemQty(ctx context.Context, userID, productID string, qty int) (*models.Cart, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		stock  int
+		limits purchaseLimits
+	)
+	err = tx.QueryRowContext(ctx,
+		`SELECT stock_qty, max_per_order, max_per_customer
+		FROM cart_items JOIN products ON products.id = cart_items.product_id
+		WHERE user_id = $1 AND product_id = $2 FOR UPDATE OF cart_items`,
+		userID, productID,
+	).Scan(&stock, &limits.maxPerOrder, &limits.maxPerCustomer)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotInCart
+	}
+	if err != nil {
+		return nil, err
+	}
+	if qty > stock {
+		return nil, models.ErrExceedsStock
+	}
+	if err := checkPurchaseLimits(ctx, tx, userID, productID, qty, limits); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE cart_items SET qty = $3 WHERE user_id = $1 AND product_id = $2`,
+		userID, productID, qty,
+	); err != nil {
+		return nil, err
+	}
+
+	cart, err := loadCart(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return cart, tx.Commit()
+}
+
+// RemoveItem deletes a cart item.
+func (r *sqlCartRepository) RemoveItem(ctx context.Context, userID, productID string) (*models.Cart, error) {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM cart_items WHERE user_id = $1 AND product_id = $2`,
+		userID, productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, models.ErrNotInCart
+	}
+	return loadCart(ctx, r.db, userID)
+}
+
+// SaveForLater moves a cart item to the user's saved items in a transaction, giving back the
+// stock reserved for it, if any. Its quantity is added to the product's saved quantity.
+func (r *sqlCartRepository) SaveForLater(ctx context.Context, userID, productID string) (*models.Cart, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var qty int
+	err = tx.QueryRowContext(ctx,
+		`DELETE FROM cart_items WHERE user_id = $1 AND product_id = $2 RETURNING qty`,
+		userID, productID,
+	).Scan(&qty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotInCart
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO saved_items (user_id, product_id, qty) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, product_id) DO UPDATE SET qty = saved_items.qty + EXCLUDED.qty, saved_at = now()`,
+		userID, productID, qty,
+	); err != nil {
+		return nil, err
+	}
+
+	var held int
+	err = tx.QueryRowContext(ctx,
+		`DELETE FROM reservations WHERE user_id = $1 AND product_id = $2 RETURNING qty`,
+		userID, productID,
+	).Scan(&held)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if held > 0 {
+		if err := adjustStock(ctx, tx, productID, held); err != nil {
+			return nil, err
+		}
+	}
+
+	cart, err := loadCart(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return cart, tx.Commit()
+}
+
+// MoveToCart moves a saved item back to the user's cart in a transaction, rolling back if the
+// cart's new quantity exceeds stock.
+func (r *sqlCartRepository) MoveToCart(ctx context.Context, userID, productID string) (*models.Cart, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var qty int
+	err = tx.QueryRowContext(ctx,
+		`DELETE FROM saved_items WHERE user_id = $1 AND product_id = $2 RETURNING qty`,
+		userID, productID,
+	).Scan(&qty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotSaved
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := addCartItem(ctx, tx, userID, productID, qty); err != nil {
+		return nil, err
+	}
+
+	cart, err := loadCart(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return cart, tx.Commit()
+}
+
+// SavedItems returns the user's saved items with their products, oldest first.
+func (r *sqlCartRepository) SavedItems(ctx context.Context, userID string) ([]*models.CartItem, error) {
+	rows, err := r.db.QueryContext(ctx, savedItemsQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*models.CartItem{}
+	for rows.Next() {
+		item := &models.CartItem{}
+		if item.Product, err = scanProduct(rows, &item.Qty); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// addCartItem upserts a cart item in tx, returning ErrExceedsStock if the new quantity is more
+// than the product has in stock and a *PurchaseLimitError if it's over the product's limits.
+func addCartItem(ctx context.Context, tx *sql.Tx, userID, productID string, qty int) error {
+	var (
+		stock  int
+		limits purchaseLimits
+	)
+	err := tx.QueryRowContext(ctx,
+		`SELECT stock_qty, max_per_order, max_per_customer FROM products WHERE id = $1`,
+		productID,
+	).Scan(&stock, &limits.maxPerOrder, &limits.maxPerCustomer)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// The upsert locks the cart row, so concurrent adds of the same product queue up
+	// behind each other instead of both reading the old quantity.
+	var total int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO cart_items (user_id, product_id, qty) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, product_id) DO UPDATE SET qty = cart_items.qty + EXCLUDED.qty
+		RETURNING qty`,
+		userID, productID, qty,
+	).Scan(&total)
+	if err != nil {
+		return err
+	}
+	if total > stock {
+		return models.ErrExceedsStock
+	}
+	return checkPurchaseLimits(ctx, tx, userID, productID, total, limits)
+}
+
+// purchaseLimits are a product's max_per_order and max_per_customer, which are NULL when the
+// product has no such limit.
+type purchaseLimits struct {
+	maxPerOrder    sql.NullInt32
+	maxPerCustomer sql.NullInt32
+}
+
+// checkPurchaseLimits returns a *PurchaseLimitError if qty of a product is more than its
+// per-order limit or, added to what the user bought in orders that weren't cancelled, more
+// than its per-customer limit.
+func checkPurchaseLimits(ctx context.Context, tx *sql.Tx, userID, productID string, qty int, limits purchaseLimits) error {
+	if limits.maxPerOrder.Valid && qty > int(limits.maxPerOrder.Int32) {
+		return &models.PurchaseLimitError{ProductID: productID, Limit: int(limits.maxPerOrder.Int32)}
+	}
+	if !limits.maxPerCustomer.Valid {
+		return nil
+	}
+	var purchased int
+	err := tx.QueryRowContext(ctx,
+		`SELECT coalesce(sum(qty), 0) FROM order_items JOIN orders ON orders.id = order_items.order_id
+		WHERE orders.user_id = $1 AND order_items.product_id = $2 AND orders.status <> $3`,
+		userID, productID, models.OrderStatusCancelled,
+	).Scan(&purchased)
+	if err != nil {
+		return err
+	}
+	if limit := int(limits.maxPerCustomer.Int32); purchased+qty > limit {
+		return &models.PurchaseLimitError{ProductID: productID, Limit: limit, PerCustomer: true, Purchased: purchased}
+	}
+	return nil
+}
+
+// loadCart reads a user's cart items and computes the subtotal.
+func loadCart(ctx context.Context, q queryer, userID string) (*models.Cart, error) {
+	rows, err := q.QueryContext(ctx, cartQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cart := &models.Cart{UserID: userID, Items: []*models.CartItem{}}
+	for rows.Next() {
+		item := &models.CartItem{}
+		if item.Product, err = scanProduct(rows, &item.Qty); err != nil {
+			return nil, err
+		}
+		cart.Items = append(cart.Items, item)
+		cart.SubtotalCents += item.Product.PriceCents * int64(item.Qty)
+	}
+	return cart, rows.Err()
+}
@@ -0,0 +1,377 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+var cartRows = append(append([]string{}, productRows...), "qty")
+
+// stockRows are the columns read to check a cart quantity against stock and purchase limits.
+var stockRows = []string{"stock_qty", "max_per_order", "max_per_customer"}
+
+func TestCartRepositoryAddItem(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("new item", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products WHERE id = \$1`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(5, nil, nil))
+		mock.ExpectQuery(`INSERT INTO cart_items \(user_id, product_id, qty\) VALUES \(\$1, \$2, \$3\)\s+ON CONFLICT`).
+			WithArgs("42", "7", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(2))
+		mock.ExpectQuery(`FROM cart_items\s+JOIN products`).WithArgs("42").
+			WillReturnRows(sqlmock.NewRows(cartRows).AddRow("7", "Mug", "Ceramic", int64(899), "USD", "MUG-1", 5, created, nil, nil, nil, 2))
+		mock.ExpectCommit()
+
+		cart, err := repo.AddItem(context.Background(), "42", "7", 2)
+		if err != nil {
+			t.Fatalf("AddItem returned error: %v", err)
+		}
+		if len(cart.Items) != 1 || cart.Items[0].Qty != 2 || cart.Items[0].Product.ID != "7" {
+			t.Fatalf("unexpected cart items: %+v", cart.Items)
+		}
+		if cart.SubtotalCents != 2*899 {
+			t.Fatalf("expected subtotal %d, got %d", 2*899, cart.SubtotalCents)
+		}
+	})
+
+	t.Run("existing item increments", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(5, nil, nil))
+		mock.ExpectQuery(`DO UPDATE SET qty = cart_items.qty \+ EXCLUDED.qty`).
+			WithArgs("42", "7", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(3))
+		mock.ExpectQuery(`FROM cart_items`).WithArgs("42").
+			WillReturnRows(sqlmock.NewRows(cartRows).AddRow("7", "Mug", "Ceramic", int64(899), "USD", "MUG-1", 5, created, nil, nil, nil, 3))
+		mock.ExpectCommit()
+
+		cart, err := repo.AddItem(context.Background(), "42", "7", 1)
+		if err != nil {
+			t.Fatalf("AddItem returned error: %v", err)
+		}
+		if cart.Items[0].Qty != 3 || cart.SubtotalCents != 3*899 {
+			t.Fatalf("expected qty 3, got %+v (subtotal %d)", cart.Items[0], cart.SubtotalCents)
+		}
+	})
+
+	t.Run("over stock rolls back", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(5, nil, nil))
+		mock.ExpectQuery(`INSERT INTO cart_items`).WithArgs("42", "7", 4).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(6))
+		mock.ExpectRollback()
+
+		if _, err := repo.AddItem(context.Background(), "42", "7", 4); !errors.Is(err, models.ErrExceedsStock) {
+			t.Fatalf("expected ErrExceedsStock, got %v", err)
+		}
+	})
+
+	t.Run("over per-order limit", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(5, 2, nil))
+		mock.ExpectQuery(`INSERT INTO cart_items`).WithArgs("42", "7", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(3))
+		mock.ExpectRollback()
+
+		_, err := repo.AddItem(context.Background(), "42", "7", 1)
+		if err == nil || err.Error() != "product 7 is limited to 2 per order" {
+			t.Fatalf("expected the per-order limit to be exceeded, got %v", err)
+		}
+	})
+
+	t.Run("over per-customer limit", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(5, nil, 4))
+		mock.ExpectQuery(`INSERT INTO cart_items`).WithArgs("42", "7", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(2))
+		mock.ExpectQuery(`FROM order_items JOIN orders .* orders.status <> \$3`).WithArgs("42", "7", models.OrderStatusCancelled).
+			WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(3))
+		mock.ExpectRollback()
+
+		_, err := repo.AddItem(context.Background(), "42", "7", 2)
+		if !errors.Is(err, models.ErrPurchaseLimit) || err.Error() != "product 7 is limited to 4 per customer and 3 were already purchased" {
+			t.Fatalf("expected the per-customer limit to be exceeded, got %v", err)
+		}
+	})
+
+	t.Run("unknown product", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("404").
+			WillReturnRows(sqlmock.NewRows(stockRows))
+		mock.ExpectRollback()
+
+		if _, err := repo.AddItem(context.Background(), "42", "404", 1); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestCartRepositoryAddItems(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	items := []*models.CartItemInput{{ProductID: "9", Qty: 1}, {ProductID: "7", Qty: 6}}
+
+	t.Run("rejected items are left out", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		// Product 7 is added first, since items are added in product ID order.
+		mock.ExpectExec(`SAVEPOINT cart_item`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(5, nil, nil))
+		mock.ExpectQuery(`INSERT INTO cart_items`).WithArgs("42", "7", 6).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(6))
+		mock.ExpectExec(`ROLLBACK TO SAVEPOINT cart_item`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`SAVEPOINT cart_item`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("9").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(3, nil, nil))
+		mock.ExpectQuery(`INSERT INTO cart_items`).WithArgs("42", "9", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(1))
+		mock.ExpectExec(`RELEASE SAVEPOINT cart_item`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`FROM cart_items`).WithArgs("42").
+			WillReturnRows(sqlmock.NewRows(cartRows).AddRow("9", "Tote bag", nil, int64(1999), "USD", "TOTE-1", 3, created, nil, nil, nil, 1))
+		mock.ExpectCommit()
+
+		cart, itemErrs, err := repo.AddItems(context.Background(), "42", items, false)
+		if err != nil {
+			t.Fatalf("AddItems returned error: %v", err)
+		}
+		if len(cart.Items) != 1 || cart.Items[0].Product.ID != "9" {
+			t.Fatalf("unexpected cart items: %+v", cart.Items)
+		}
+		if len(itemErrs) != 2 || itemErrs[0] != nil || !errors.Is(itemErrs[1], models.ErrExceedsStock) {
+			t.Fatalf("expected the second item to exceed the stock, got %v", itemErrs)
+		}
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(5, nil, nil))
+		mock.ExpectQuery(`INSERT INTO cart_items`).WithArgs("42", "7", 6).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(6))
+		mock.ExpectRollback()
+
+		if _, _, err := repo.AddItems(context.Background(), "42", items, true); !errors.Is(err, models.ErrExceedsStock) {
+			t.Fatalf("expected ErrExceedsStock, got %v", err)
+		}
+	})
+}
+
+func TestCartRepositoryGetEmpty(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewCartRepository(db)
+
+	mock.ExpectQuery(`FROM cart_items`).WithArgs("42").WillReturnRows(sqlmock.NewRows(cartRows))
+
+	cart, err := repo.Get(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if cart.UserID != "42" || cart.Items == nil || len(cart.Items) != 0 || cart.SubtotalCents != 0 {
+		t.Fatalf("expected an empty cart, got %+v", cart)
+	}
+}
+
+func TestCartRepositorySetItemQty(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("decrement", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM cart_items JOIN products .* FOR UPDATE OF cart_items`).WithArgs("42", "7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(5, nil, nil))
+		mock.ExpectExec(`UPDATE cart_items SET qty = \$3 WHERE user_id = \$1 AND product_id = \$2`).WithArgs("42", "7", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FROM cart_items`).WithArgs("42").
+			WillReturnRows(sqlmock.NewRows(cartRows).AddRow("7", "Mug", "Ceramic", int64(899), "USD", "MUG-1", 5, created, nil, nil, nil, 1))
+		mock.ExpectCommit()
+
+		cart, err := repo.SetItemQty(context.Background(), "42", "7", 1)
+		if err != nil {
+			t.Fatalf("SetItemQty returned error: %v", err)
+		}
+		if cart.Items[0].Qty != 1 || cart.SubtotalCents != 899 {
+			t.Fatalf("unexpected cart: %+v", cart)
+		}
+	})
+
+	t.Run("not in cart", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM cart_items`).WithArgs("42", "8").
+			WillReturnRows(sqlmock.NewRows(stockRows))
+		mock.ExpectRollback()
+
+		if _, err := repo.SetItemQty(context.Background(), "42", "8", 1); !errors.Is(err, models.ErrNotInCart) {
+			t.Fatalf("expected ErrNotInCart, got %v", err)
+		}
+	})
+}
+
+func TestCartRepositoryRemoveItem(t *testing.T) {
+	t.Run("removed", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectExec(`DELETE FROM cart_items WHERE user_id = \$1 AND product_id = \$2`).WithArgs("42", "7").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FROM cart_items`).WithArgs("42").WillReturnRows(sqlmock.NewRows(cartRows))
+
+		cart, err := repo.RemoveItem(context.Background(), "42", "7")
+		if err != nil {
+			t.Fatalf("RemoveItem returned error: %v", err)
+		}
+		if len(cart.Items) != 0 || cart.SubtotalCents != 0 {
+			t.Fatalf("expected an empty cart, got %+v", cart)
+		}
+	})
+
+	t.Run("not in cart", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectExec(`DELETE FROM cart_items`).WithArgs("42", "8").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if _, err := repo.RemoveItem(context.Background(), "42", "8"); !errors.Is(err, models.ErrNotInCart) {
+			t.Fatalf("expected ErrNotInCart, got %v", err)
+		}
+	})
+}
+
+func TestCartRepositorySaveForLater(t *testing.T) {
+	t.Run("releases the reservation", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM cart_items WHERE user_id = \$1 AND product_id = \$2 RETURNING qty`).WithArgs("42", "7").
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(2))
+		mock.ExpectExec(`INSERT INTO saved_items .* DO UPDATE SET qty = saved_items.qty \+ EXCLUDED.qty`).WithArgs("42", "7", 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`DELETE FROM reservations WHERE user_id = \$1 AND product_id = \$2 RETURNING qty`).WithArgs("42", "7").
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(2))
+		mock.ExpectQuery(`SELECT stock_qty, version FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"stock_qty", "version"}).AddRow(3, 4))
+		mock.ExpectExec(`UPDATE products SET stock_qty = \$3`).WithArgs("7", 4, 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FROM cart_items`).WithArgs("42").WillReturnRows(sqlmock.NewRows(cartRows))
+		mock.ExpectCommit()
+
+		cart, err := repo.SaveForLater(context.Background(), "42", "7")
+		if err != nil {
+			t.Fatalf("SaveForLater returned error: %v", err)
+		}
+		if len(cart.Items) != 0 {
+			t.Fatalf("expected the item to leave the cart, got %+v", cart.Items)
+		}
+	})
+
+	t.Run("not in cart", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM cart_items`).WithArgs("42", "8").WillReturnRows(sqlmock.NewRows([]string{"qty"}))
+		mock.ExpectRollback()
+
+		if _, err := repo.SaveForLater(context.Background(), "42", "8"); !errors.Is(err, models.ErrNotInCart) {
+			t.Fatalf("expected ErrNotInCart, got %v", err)
+		}
+	})
+}
+
+func TestCartRepositoryMoveToCart(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("moved", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM saved_items WHERE user_id = \$1 AND product_id = \$2 RETURNING qty`).WithArgs("42", "7").
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(2))
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(5, nil, nil))
+		mock.ExpectQuery(`INSERT INTO cart_items`).WithArgs("42", "7", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(2))
+		mock.ExpectQuery(`FROM cart_items`).WithArgs("42").
+			WillReturnRows(sqlmock.NewRows(cartRows).AddRow("7", "Mug", "Ceramic", int64(899), "USD", "MUG-1", 5, created, nil, nil, nil, 2))
+		mock.ExpectCommit()
+
+		cart, err := repo.MoveToCart(context.Background(), "42", "7")
+		if err != nil {
+			t.Fatalf("MoveToCart returned error: %v", err)
+		}
+		if len(cart.Items) != 1 || cart.Items[0].Qty != 2 {
+			t.Fatalf("expected the saved quantity in the cart, got %+v", cart.Items)
+		}
+	})
+
+	t.Run("over stock stays saved", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM saved_items`).WithArgs("42", "7").
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(4))
+		mock.ExpectQuery(`SELECT stock_qty, max_per_order, max_per_customer FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(stockRows).AddRow(3, nil, nil))
+		mock.ExpectQuery(`INSERT INTO cart_items`).WithArgs("42", "7", 4).
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(4))
+		mock.ExpectRollback()
+
+		if _, err := repo.MoveToCart(context.Background(), "42", "7"); !errors.Is(err, models.ErrExceedsStock) {
+			t.Fatalf("expected ErrExceedsStock, got %v", err)
+		}
+	})
+
+	t.Run("not saved", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewCartRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM saved_items`).WithArgs("42", "8").WillReturnRows(sqlmock.NewRows([]string{"qty"}))
+		mock.ExpectRollback()
+
+		if _, err := repo.MoveToCart(context.Background(), "42", "8"); !errors.Is(err, models.ErrNotSaved) {
+			t.Fatalf("expected ErrNotSaved, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// sqlCategoryRepository is a models.CategoryRepository backed by the categories table.
+type sqlCategoryRepository struct {
+	db *sql.DB
+}
+
+// NewCategoryRepository creates a CategoryRepository backed by db.
+func NewCategoryRepository(db *sql.DB) models.CategoryRepository {
+	return &sqlCategoryRepository{db: db}
+}
+
+// List returns every category ordered by name.
+func (r *sqlCategoryRepository) List(ctx context.Context) ([]*models.Category, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, slug, parent_id FROM categories ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*models.Category{}
+	for rows.Next() {
+		var (
+			category models.Category
+			parentID sql.NullString
+		)
+		if err := rows.Scan(&category.ID, &category.Name, &category.Slug, &parentID); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			category.ParentID = &parentID.String
+		}
+		categories = append(categories, &category)
+	}
+	return categories, rows.Err()
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCategoryRepositoryList(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewCategoryRepository(db)
+
+	t.Run("rows", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, name, slug, parent_id FROM categories ORDER BY name, id`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "parent_id"}).
+				AddRow("1", "Bags", "bags", nil).
+				AddRow("2", "Totes", "totes", "1"))
+
+		categories, err := repo.List(context.Background())
+		if err != nil {
+			t.Fatalf("List returned error: %v", err)
+		}
+		if len(categories) != 2 {
+			t.Fatalf("expected 2 categories, got %d", len(categories))
+		}
+		if c := categories[0]; c.ID != "1" || c.Name != "Bags" || c.Slug != "bags" || c.ParentID != nil {
+			t.Fatalf("unexpected first category: %+v", c)
+		}
+		if c := categories[1]; c.ParentID == nil || *c.ParentID != "1" {
+			t.Fatalf("unexpected second category: %+v", c)
+		}
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		dbErr := errors.New("connection reset")
+		mock.ExpectQuery(`FROM categories`).WillReturnError(dbErr)
+
+		if _, err := repo.List(context.Background()); !errors.Is(err, dbErr) {
+			t.Fatalf("expected %v, got %v", dbErr, err)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// couponColumns is the column list scanned by scanCoupon.
+const couponColumns = `id, code, percent_off, amount_off_cents, currency, expires_at, max_redemptions, times_redeemed, created_at`
+
+// applyCoupon redeems the coupon with the given code for order, setting the discount it
+// takes off the order's subtotal. The coupon row stays locked until the transaction ends,
+// so concurrent checkouts can't redeem it past its limit, and a rolled back checkout
+// doesn't use it up. now is the time the coupon's expiry is checked against.
+func applyCoupon(ctx context.Context, tx *sql.Tx, code string, order *models.Order, now time.Time) error {
+	coupon, err := scanCoupon(tx.QueryRowContext(ctx,
+		`SELECT `+couponColumns+` FROM coupons WHERE code = $1 FOR UPDATE`,
+		strings.ToUpper(code),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrCouponInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if err := coupon.Check(order.Currency, now); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE coupons SET times_redeemed = times_redeemed + 1 WHERE id = $1`, coupon.ID); err != nil {
+		return err
+	}
+
+	order.DiscountCents = coupon.Discount(order.SubtotalCents)
+	order.CouponCode = &coupon.Code
+	return nil
+}
+
+// scanCoupon scans a row selected with couponColumns.
+func scanCoupon(row scanner) (*models.Coupon, error) {
+	var (
+		c              models.Coupon
+		percentOff     sql.NullInt32
+		amountOffCents sql.NullInt64
+		currency       sql.NullString
+		expiresAt      sql.NullTime
+		maxRedemptions sql.NullInt32
+	)
+	if err := row.Scan(&c.ID, &c.Code, &percentOff, &amountOffCents, &currency, &expiresAt, &maxRedemptions, &c.TimesRedeemed, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	if percentOff.Valid {
+		n := int(percentOff.Int32)
+		c.PercentOff = &n
+	}
+	if amountOffCents.Valid {
+		c.AmountOffCents = &amountOffCents.Int64
+	}
+	c.Currency = currency.String
+	if expiresAt.Valid {
+		c.ExpiresAt = &expiresAt.Time
+	}
+	if maxRedemptions.Valid {
+		n := int(maxRedemptions.Int32)
+		c.MaxRedemptions = &n
+	}
+	return &c, nil
+}
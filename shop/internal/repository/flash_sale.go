@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// flashSaleColumns is the column list scanned by scanFlashSale.
+const flashSaleColumns = `flash_sales.id, name, percent_off, starts_at, ends_at, flash_sales.created_at`
+
+// sqlFlashSaleRepository is a models.FlashSaleRepository backed by the flash_sales and
+// flash_sale_products tables.
+type sqlFlashSaleRepository struct {
+	db *sql.DB
+}
+
+// NewFlashSaleRepository creates a FlashSaleRepository backed by db.
+func NewFlashSaleRepository(db *sql.DB) models.FlashSaleRepository {
+	return &sqlFlashSaleRepository{db: db}
+}
+
+// Active returns the sales running at now, ordered by end time.
+func (r *sqlFlashSaleRepository) Active(ctx context.Context, now time.Time) ([]*models.FlashSale, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+flashSaleColumns+` FROM flash_sales WHERE starts_at <= $1 AND ends_at > $1 ORDER BY ends_at, id`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sales := []*models.FlashSale{}
+	for rows.Next() {
+		sale, err := scanFlashSale(rows)
+		if err != nil {
+			return nil, err
+		}
+		sales = append(sales, sale)
+	}
+	return sales, rows.Err()
+}
+
+// ActiveByProducts picks each product's deepest running discount in one query. Ties go to the
+// sale that runs longest, so the countdown shown for the product is the one that matters.
+func (r *sqlFlashSaleRepository) ActiveByProducts(ctx context.Context, productIDs []string, now time.Time) (map[string]*models.FlashSale, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT DISTINCT ON (product_id) `+flashSaleColumns+`, product_id
+		FROM flash_sale_products JOIN flash_sales ON flash_sales.id = flash_sale_products.flash_sale_id
+		WHERE product_id = ANY($1) AND starts_at <= $2 AND ends_at > $2
+		ORDER BY product_id, percent_off DESC, ends_at DESC, flash_sales.id`,
+		pq.Array(productIDs), now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sales := make(map[string]*models.FlashSale, len(productIDs))
+	for rows.Next() {
+		var productID string
+		sale, err := scanFlashSale(rows, &productID)
+		if err != nil {
+			return nil, err
+		}
+		sales[productID] = sale
+	}
+	return sales, rows.Err()
+}
+
+// Products returns the products on a sale.
+func (r *sqlFlashSaleRepository) Products(ctx context.Context, saleID string) ([]*models.Product, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+productColumns+` FROM products
+		JOIN flash_sale_products ON flash_sale_products.product_id = products.id
+		WHERE flash_sale_id = $1 ORDER BY id`,
+		saleID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*models.Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+// scanFlashSale scans a row selected with flashSaleColumns, followed by any extra columns into extra.
+func scanFlashSale(row scanner, extra ...any) (*models.FlashSale, error) {
+	var sale models.FlashSale
+	dest := []any{&sale.ID, &sale.Name, &sale.PercentOff, &sale.StartsAt, &sale.EndsAt, &sale.CreatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &sale, nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+var flashSaleRows = []string{"id", "name", "percent_off", "starts_at", "ends_at", "created_at"}
+
+func TestFlashSaleRepositoryActive(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewFlashSaleRepository(db)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`FROM flash_sales WHERE starts_at <= \$1 AND ends_at > \$1 ORDER BY ends_at, id`).WithArgs(now).
+		WillReturnRows(sqlmock.NewRows(flashSaleRows).
+			AddRow("1", "Lunch deals", 20, now.Add(-time.Hour), now.Add(time.Hour), now.Add(-24*time.Hour)).
+			AddRow("2", "Weekend", 10, now.Add(-time.Hour), now.Add(48*time.Hour), now.Add(-24*time.Hour)))
+
+	sales, err := repo.Active(context.Background(), now)
+	if err != nil {
+		t.Fatalf("Active returned error: %v", err)
+	}
+	if len(sales) != 2 || sales[0].ID != "1" || sales[0].PercentOff != 20 || !sales[0].EndsAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected sales: %+v", sales)
+	}
+}
+
+func TestFlashSaleRepositoryActiveByProducts(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewFlashSaleRepository(db)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT DISTINCT ON \(product_id\) .* FROM flash_sale_products JOIN flash_sales .* ORDER BY product_id, percent_off DESC, ends_at DESC`).
+		WithArgs(pq.Array([]string{"7", "8"}), now).
+		WillReturnRows(sqlmock.NewRows(append(flashSaleRows, "product_id")).
+			AddRow("1", "Lunch deals", 20, now.Add(-time.Hour), now.Add(time.Hour), now.Add(-24*time.Hour), "7"))
+
+	sales, err := repo.ActiveByProducts(context.Background(), []string{"7", "8"}, now)
+	if err != nil {
+		t.Fatalf("ActiveByProducts returned error: %v", err)
+	}
+	if len(sales) != 1 || sales["7"] == nil || sales["7"].ID != "1" {
+		t.Fatalf("expected only product 7 to be on sale, got %+v", sales)
+	}
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// sqlListingPreferencesRepository is a models.ListingPreferencesRepository backed by the
+// listing_preferences table.
+type sqlListingPreferencesRepository struct {
+	db *sql.DB
+}
+
+// NewListingPreferencesRepository creates a ListingPreferencesRepository backed by db.
+func NewListingPreferencesRepository(db *sql.DB) models.ListingPreferencesRepository {
+	return &sqlListingPreferencesRepository{db: db}
+}
+
+// Get reads the user's preferences, returning empty ones if there's no row.
+func (r *sqlListingPreferencesRepository) Get(ctx context.Context, userID string) (*models.ListingPreferences, error) {
+	var (
+		sort     sql.NullString
+		pageSize sql.NullInt32
+		slug     sql.NullString
+	)
+	err := r.db.QueryRowContext(ctx,
+		`SELECT sort, page_size, category_slug FROM listing_preferences WHERE user_id = $1`, userID,
+	).Scan(&sort, &pageSize, &slug)
+	prefs := &models.ListingPreferences{}
+	if errors.Is(err, sql.ErrNoRows) {
+		return prefs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sort.Valid {
+		s := models.ProductSort(sort.String)
+		prefs.Sort = &s
+	}
+	if pageSize.Valid {
+		n := int(pageSize.Int32)
+		prefs.PageSize = &n
+	}
+	if slug.Valid {
+		prefs.CategorySlug = &slug.String
+	}
+	return prefs, nil
+}
+
+// Save upserts the user's preferences.
+func (r *sqlListingPreferencesRepository) Save(ctx context.Context, userID string, prefs *models.ListingPreferences) error {
+	var sort sql.NullString
+	if prefs.Sort != nil {
+		sort = sql.NullString{String: string(*prefs.Sort), Valid: true}
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO listing_preferences (user_id, sort, page_size, category_slug) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET sort = EXCLUDED.sort, page_size = EXCLUDED.page_size,
+			category_slug = EXCLUDED.category_slug, updated_at = now()`,
+		userID, sort, prefs.PageSize, prefs.CategorySlug,
+	)
+	return err
+}
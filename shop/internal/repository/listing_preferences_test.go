@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestListingPreferencesRepositoryGet(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewListingPreferencesRepository(db)
+	query := `SELECT sort, page_size, category_slug FROM listing_preferences WHERE user_id = \$1`
+
+	t.Run("saved", func(t *testing.T) {
+		mock.ExpectQuery(query).WithArgs("42").
+			WillReturnRows(sqlmock.NewRows([]string{"sort", "page_size", "category_slug"}).AddRow("PRICE_ASC", 50, nil))
+
+		prefs, err := repo.Get(context.Background(), "42")
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		if prefs.Sort == nil || *prefs.Sort != models.ProductSortPriceAsc || prefs.PageSize == nil || *prefs.PageSize != 50 || prefs.CategorySlug != nil {
+			t.Fatalf("unexpected preferences: %+v", prefs)
+		}
+	})
+
+	t.Run("none saved", func(t *testing.T) {
+		mock.ExpectQuery(query).WithArgs("43").WillReturnRows(sqlmock.NewRows([]string{"sort", "page_size", "category_slug"}))
+
+		prefs, err := repo.Get(context.Background(), "43")
+		if err != nil || prefs.Sort != nil || prefs.PageSize != nil || prefs.CategorySlug != nil {
+			t.Fatalf("expected empty preferences, got (%+v, %v)", prefs, err)
+		}
+	})
+}
+
+func TestListingPreferencesRepositorySave(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewListingPreferencesRepository(db)
+
+	sort, slug := models.ProductSortNewest, "bags"
+	mock.ExpectExec(`INSERT INTO listing_preferences \(user_id, sort, page_size, category_slug\) VALUES \(\$1, \$2, \$3, \$4\)\s+ON CONFLICT \(user_id\) DO UPDATE`).
+		WithArgs("42", "NEWEST", nil, "bags").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.Save(context.Background(), "42", &models.ListingPreferences{Sort: &sort, CategorySlug: &slug}); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+}
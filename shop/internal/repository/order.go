@@ -0,0 +1,583 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/internal/database"
+	"github.com/ShoppingDem/backend/shop/internal/orders"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// orderColumns is the column list scanned by scanOrder.
+const orderColumns = `id, user_id, status, total_cents, currency, shipping_address, tracking_number, payment_intent_id, discount_cents, coupon_code, subtotal_cents, tax_cents, created_at`
+
+// sqlOrderRepository is a models.OrderRepository backed by the orders and order_items tables.
+type sqlOrderRepository struct {
+	db    *sql.DB
+	tax   models.TaxCalculator // Charges tax at checkout; nil if no tax is charged.
+	clock clock.Clock          // What coupon expiry is checked against.
+}
+
+// NewOrderRepository creates an OrderRepository backed by db, charging tax at checkout with
+// tax unless it's nil, and checking coupon expiry against clk, or the system clock if it's
+// nil.
+func NewOrderRepository(db *sql.DB, tax models.TaxCalculator, clk clock.Clock) models.OrderRepository {
+	if clk == nil {
+		clk = clock.Real{}
+	}
+	return &sqlOrderRepository{db: db, tax: tax, clock: clk}
+}
+
+// Checkout places an order for the user's cart in a single transaction, claiming the stock
+// the user has reserved, redeeming the coupon, if any, and charging tax.
+func (r *sqlOrderRepository) Checkout(ctx context.Context, userID, idempotencyKey string, shippingAddress *models.ShippingAddress, couponCode string) (*models.Order, bool, error) {
+	var shipTo []byte
+	if shippingAddress != nil {
+		var err error
+		if shipTo, err = json.Marshal(shippingAddress); err != nil {
+			return nil, false, fmt.Errorf("failed to encode shipping address: %w", err)
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	if idempotencyKey != "" {
+		// The insert waits for a concurrent checkout holding the same key to finish, so only
+		// one of them places an order and the other returns it.
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO idempotency_keys (user_id, key) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			userID, idempotencyKey,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, false, err
+		} else if n == 0 {
+			order, err := scanOrder(tx.QueryRowContext(ctx,
+				`SELECT `+orderColumns+` FROM orders
+				WHERE id = (SELECT order_id FROM idempotency_keys WHERE user_id = $1 AND key = $2)`,
+				userID, idempotencyKey,
+			))
+			return order, false, err
+		}
+	}
+
+	// The stock read here is only used to report every short item at once; adjustStock
+	// re-checks it when taking the stock. Items are ordered by product ID so concurrent
+	// checkouts update products in the same order and can't deadlock. Each item is priced
+	// with the deepest discount of the flash sales running now, whatever the cart showed.
+	now := r.clock.Now()
+	rows, err := tx.QueryContext(ctx,
+		`SELECT product_id, name, sku, qty, price_cents, currency, stock_qty, max_per_order, max_per_customer,
+			coalesce((
+				SELECT max(percent_off) FROM flash_sale_products
+				JOIN flash_sales ON flash_sales.id = flash_sale_products.flash_sale_id
+				WHERE flash_sale_products.product_id = products.id AND starts_at <= $2 AND ends_at > $2
+			), 0)
+		FROM cart_items JOIN products ON products.id = cart_items.product_id
+		WHERE user_id = $1 ORDER BY product_id`,
+		userID, now,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	order := &models.Order{UserID: userID, Status: models.OrderStatusPending, ShippingAddress: shippingAddress, Items: []*models.OrderItem{}}
+	stock := map[string]int{}
+	limits := map[string]purchaseLimits{}
+	for rows.Next() {
+		var (
+			item     models.OrderItem
+			currency string
+			inStock  int
+			limit    purchaseLimits
+			saleOff  int
+		)
+		if err := rows.Scan(&item.ProductID, &item.Name, &item.SKU, &item.Qty, &item.UnitPriceCents, &currency, &inStock,
+			&limit.maxPerOrder, &limit.maxPerCustomer, &saleOff); err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		item.UnitPriceCents = models.SalePrice(item.UnitPriceCents, saleOff)
+		if order.Currency == "" {
+			order.Currency = currency
+		} else if currency != order.Currency {
+			rows.Close()
+			return nil, false, errors.New("cart contains products priced in different currencies")
+		}
+		stock[item.ProductID] = inStock
+		limits[item.ProductID] = limit
+		order.Items = append(order.Items, &item)
+		order.SubtotalCents += item.UnitPriceCents * int64(item.Qty)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(order.Items) == 0 {
+		return nil, false, models.ErrEmptyCart
+	}
+
+	// Reserved stock has already been taken out of stock_qty, so it counts toward the items
+	// it was reserved for and only the difference is taken from (or given back to) stock.
+	reserved, err := claimReservations(ctx, tx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	var short []string
+	for _, item := range order.Items {
+		if item.Qty > stock[item.ProductID]+reserved[item.ProductID] {
+			short = append(short, item.ProductID)
+		}
+	}
+	if len(short) > 0 {
+		return nil, false, &models.InsufficientStockError{ProductIDs: short}
+	}
+
+	// The cart was checked against the purchase limits when items were added, but the limits
+	// or the user's other orders may have changed since.
+	for _, item := range order.Items {
+		if err := checkPurchaseLimits(ctx, tx, userID, item.ProductID, item.Qty, limits[item.ProductID]); err != nil {
+			return nil, false, err
+		}
+	}
+	if couponCode != "" {
+		if err := applyCoupon(ctx, tx, couponCode, order, now); err != nil {
+			return nil, false, err
+		}
+	}
+	if r.tax != nil {
+		if order.TaxCents, err = r.tax.Tax(ctx, shippingAddress, order.SubtotalCents-order.DiscountCents, order.Currency); err != nil {
+			return nil, false, fmt.Errorf("failed to calculate tax: %w", err)
+		}
+	}
+	order.TotalCents = order.SubtotalCents - order.DiscountCents + order.TaxCents
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO orders (user_id, status, total_cents, currency, shipping_address, discount_cents, coupon_code, subtotal_cents, tax_cents)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`,
+		userID, order.Status, order.TotalCents, order.Currency, shipTo, order.DiscountCents, order.CouponCode, order.SubtotalCents, order.TaxCents,
+	).Scan(&order.ID, &order.CreatedAt)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, item := range order.Items {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO order_items (order_id, product_id, name, sku, qty, unit_price_cents) VALUES ($1, $2, $3, $4, $5, $6)`,
+			order.ID, item.ProductID, item.Name, item.SKU, item.Qty, item.UnitPriceCents,
+		); err != nil {
+			return nil, false, err
+		}
+
+		need := item.Qty - reserved[item.ProductID]
+		delete(reserved, item.ProductID)
+		if need == 0 {
+			continue
+		}
+		if err := adjustStock(ctx, tx, item.ProductID, -need); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Give back the stock reserved for products that are no longer in the cart.
+	for _, productID := range slices.Sorted(maps.Keys(reserved)) {
+		if err := adjustStock(ctx, tx, productID, reserved[productID]); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cart_items WHERE user_id = $1`, userID); err != nil {
+		return nil, false, err
+	}
+	if idempotencyKey != "" {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE idempotency_keys SET order_id = $3 WHERE user_id = $1 AND key = $2`,
+			userID, idempotencyKey, order.ID,
+		); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return order, true, nil
+}
+
+// claimReservations deletes the user's reservations and returns their quantities by product ID.
+func claimReservations(ctx context.Context, tx *sql.Tx, userID string) (map[string]int, error) {
+	rows, err := tx.QueryContext(ctx, `DELETE FROM reservations WHERE user_id = $1 RETURNING product_id, qty`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reserved := map[string]int{}
+	for rows.Next() {
+		var (
+			productID string
+			qty       int
+		)
+		if err := rows.Scan(&productID, &qty); err != nil {
+			return nil, err
+		}
+		reserved[productID] = qty
+	}
+	return reserved, rows.Err()
+}
+
+// List returns a page of the user's orders, newest first.
+func (r *sqlOrderRepository) List(ctx context.Context, userID string, status *models.OrderStatus, page models.PageArgs) (*models.PageResult[*models.Order], error) {
+	query := `SELECT ` + orderColumns + `, count(*) OVER () FROM orders WHERE user_id = $1`
+	args := []any{userID}
+	if status != nil {
+		query += ` AND status = $2`
+		args = append(args, string(*status))
+	}
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	args = append(args, page.Limit, page.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &models.PageResult[*models.Order]{Items: []*models.Order{}}
+	for rows.Next() {
+		order, err := scanOrder(rows, &result.Total)
+		if err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, order)
+	}
+	return result, rows.Err()
+}
+
+// GetByID looks up an order by primary key.
+func (r *sqlOrderRepository) GetByID(ctx context.Context, id string) (*models.Order, error) {
+	order, err := scanOrder(r.db.QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	return order, err
+}
+
+// DeleteExpiredIdempotencyKeys deletes the checkout idempotency keys created more than maxAge ago.
+func (r *sqlOrderRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, maxAge time.Duration) (int, error) {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE created_at <= now() - make_interval(secs => $1)`,
+		maxAge.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// UpdateStatus sets an order's status. The order row is locked while the transition is
+// checked, so a concurrent status change can't slip in before the update.
+func (r *sqlOrderRepository) UpdateStatus(ctx context.Context, id string, status models.OrderStatus) (*models.Order, error) {
+	var order *models.Order
+	err := database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		order, err = lockOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := orders.CanTransition(order.Status, status); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $2 WHERE id = $1`, id, string(status)); err != nil {
+			return err
+		}
+		order.Status = status
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Cancel cancels an order and restocks its items. The order row is locked while the
+// transition is checked, so a concurrent status change can't slip in before the update.
+func (r *sqlOrderRepository) Cancel(ctx context.Context, id string) (*models.Order, error) {
+	var order *models.Order
+	err := database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		order, err = lockOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := orders.CanTransition(order.Status, models.OrderStatusCancelled); err != nil {
+			return fmt.Errorf("%w: %w", models.ErrOrderNotCancellable, err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $2 WHERE id = $1`, id, string(models.OrderStatusCancelled)); err != nil {
+			return err
+		}
+		order.Status = models.OrderStatusCancelled
+
+		// Items are ordered by product ID so restocking can't deadlock with a checkout.
+		rows, err := tx.QueryContext(ctx, `SELECT product_id, qty FROM order_items WHERE order_id = $1 ORDER BY product_id`, id)
+		if err != nil {
+			return err
+		}
+		var items []models.OrderItem
+		for rows.Next() {
+			var item models.OrderItem
+			if err := rows.Scan(&item.ProductID, &item.Qty); err != nil {
+				rows.Close()
+				return err
+			}
+			items = append(items, item)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := adjustStock(ctx, tx, item.ProductID, item.Qty); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Ship ships a paid order. The order row is locked while the transition is checked, so an
+// order that's cancelled concurrently can't be shipped.
+func (r *sqlOrderRepository) Ship(ctx context.Context, id, trackingNumber string) (*models.Order, error) {
+	var order *models.Order
+	err := database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		order, err = lockOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := orders.CanTransition(order.Status, models.OrderStatusShipped); err != nil {
+			return fmt.Errorf("%w: %w", models.ErrOrderNotShippable, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE orders SET status = $2, tracking_number = $3 WHERE id = $1`,
+			id, string(models.OrderStatusShipped), trackingNumber,
+		); err != nil {
+			return err
+		}
+		order.Status = models.OrderStatusShipped
+		order.TrackingNumber = &trackingNumber
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// SetPaymentIntent records a pending order's payment intent and how long its stock is held
+// for the payment, and moves it to PENDING_PAYMENT.
+func (r *sqlOrderRepository) SetPaymentIntent(ctx context.Context, id, intentID string, heldUntil time.Time) (*models.Order, error) {
+	var order *models.Order
+	err := database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		order, err = lockOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := orders.CanTransition(order.Status, models.OrderStatusPendingPayment); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE orders SET status = $2, payment_intent_id = $3, payment_held_until = $4 WHERE id = $1`,
+			id, string(models.OrderStatusPendingPayment), intentID, heldUntil,
+		); err != nil {
+			return err
+		}
+		order.Status = models.OrderStatusPendingPayment
+		order.PaymentIntentID = intentID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// ExpiredPaymentHolds lists the unpaid orders whose payment hold ran out by now. Once an
+// order is paid or cancelled its status leaves it out, so the hold needn't be cleared.
+func (r *sqlOrderRepository) ExpiredPaymentHolds(ctx context.Context, now time.Time, limit int) ([]*models.Order, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+orderColumns+` FROM orders
+		WHERE status IN ($2, $3) AND payment_held_until <= $1
+		ORDER BY payment_held_until, id LIMIT $4`,
+		now, string(models.OrderStatusPendingPayment), string(models.OrderStatusPaymentFailed), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []*models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, order)
+	}
+	return expired, rows.Err()
+}
+
+// ConfirmPayment marks the order paid for by a payment intent as PAID.
+func (r *sqlOrderRepository) ConfirmPayment(ctx context.Context, intentID string) (*models.Order, error) {
+	return r.setPaymentStatus(ctx, intentID, models.OrderStatusPaid)
+}
+
+// FailPayment marks the order paid for by a payment intent as PAYMENT_FAILED.
+func (r *sqlOrderRepository) FailPayment(ctx context.Context, intentID string) (*models.Order, error) {
+	return r.setPaymentStatus(ctx, intentID, models.OrderStatusPaymentFailed)
+}
+
+// setPaymentStatus moves the order paid for by a payment intent to status, locking the order
+// row while the transition is checked.
+func (r *sqlOrderRepository) setPaymentStatus(ctx context.Context, intentID string, status models.OrderStatus) (*models.Order, error) {
+	var order *models.Order
+	err := database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		order, err = scanOrder(tx.QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE payment_intent_id = $1 FOR UPDATE`, intentID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := orders.CanTransition(order.Status, status); err != nil {
+			if status == models.OrderStatusPaid && order.Status == models.OrderStatusCancelled {
+				return fmt.Errorf("%w: %w", models.ErrPaidAfterCancellation, err)
+			}
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $2 WHERE id = $1`, order.ID, string(status)); err != nil {
+			return err
+		}
+		order.Status = status
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// lockOrder selects an order FOR UPDATE, so its status can be checked and changed without
+// a concurrent change slipping in between.
+func lockOrder(ctx context.Context, tx *sql.Tx, id string) (*models.Order, error) {
+	order, err := scanOrder(tx.QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = $1 FOR UPDATE`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	return order, err
+}
+
+// scanOrder scans a row selected with orderColumns, followed by any extra columns into extra.
+func scanOrder(row scanner, extra ...any) (*models.Order, error) {
+	var (
+		order    models.Order
+		shipTo   []byte
+		tracking sql.NullString
+		intentID sql.NullString
+		coupon   sql.NullString
+	)
+	dest := []any{
+		&order.ID, &order.UserID, &order.Status, &order.TotalCents, &order.Currency, &shipTo, &tracking,
+		&intentID, &order.DiscountCents, &coupon, &order.SubtotalCents, &order.TaxCents, &order.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if tracking.Valid {
+		order.TrackingNumber = &tracking.String
+	}
+	order.PaymentIntentID = intentID.String
+	if coupon.Valid {
+		order.CouponCode = &coupon.String
+	}
+	if shipTo != nil {
+		order.ShippingAddress = &models.ShippingAddress{}
+		if err := json.Unmarshal(shipTo, order.ShippingAddress); err != nil {
+			return nil, fmt.Errorf("order %s: failed to decode shipping address: %w", order.ID, err)
+		}
+	}
+	return &order, nil
+}
+
+// CustomerStats counts and sums the delivered orders of several users in one query.
+func (r *sqlOrderRepository) CustomerStats(ctx context.Context, userIDs []string) (map[string]*models.CustomerStats, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT user_id, count(*), SUM(total_cents) FROM orders
+		WHERE user_id = ANY($1) AND status = $2 GROUP BY user_id`,
+		pq.Array(userIDs), models.OrderStatusDelivered,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]*models.CustomerStats, len(userIDs))
+	for rows.Next() {
+		var (
+			userID string
+			s      models.CustomerStats
+		)
+		if err := rows.Scan(&userID, &s.OrderCount, &s.LifetimeValueCents); err != nil {
+			return nil, err
+		}
+		stats[userID] = &s
+	}
+	return stats, rows.Err()
+}
+
+// Items loads the items of several orders in one query.
+func (r *sqlOrderRepository) Items(ctx context.Context, orderIDs []string) (map[string][]*models.OrderItem, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT order_id, product_id, name, sku, qty, unit_price_cents FROM order_items
+		WHERE order_id = ANY($1) ORDER BY order_id, product_id`,
+		pq.Array(orderIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[string][]*models.OrderItem, len(orderIDs))
+	for rows.Next() {
+		var (
+			orderID string
+			item    models.OrderItem
+		)
+		if err := rows.Scan(&orderID, &item.ProductID, &item.Name, &item.SKU, &item.Qty, &item.UnitPriceCents); err != nil {
+			return nil, err
+		}
+		items[orderID] = append(items[orderID], &item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,905 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/internal/orders"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+var checkoutRows = []string{"product_id", "name", "sku", "qty", "price_cents", "currency", "stock_qty", "max_per_order", "max_per_customer", "sale_percent_off"}
+
+// expectClaimReservations expects checkout to claim the user's reservations, given as
+// alternating product IDs and quantities.
+func expectClaimReservations(mock sqlmock.Sqlmock, reserved ...any) {
+	rows := sqlmock.NewRows([]string{"product_id", "qty"})
+	for i := 0; i < len(reserved); i += 2 {
+		rows.AddRow(reserved[i], reserved[i+1])
+	}
+	mock.ExpectQuery(`DELETE FROM reservations WHERE user_id = \$1 RETURNING product_id, qty`).WithArgs("42").WillReturnRows(rows)
+}
+
+var orderRows = []string{"id", "user_id", "status", "total_cents", "currency", "shipping_address", "tracking_number", "payment_intent_id", "discount_cents", "coupon_code", "subtotal_cents", "tax_cents", "created_at"}
+
+// orderPageRows are the columns of a page of orders, counted with count(*) OVER ().
+var orderPageRows = slices.Concat(orderRows, []string{"count"})
+
+// shippingAddress is stored in orders.shipping_address as shippingAddressJSON.
+var shippingAddress = &models.ShippingAddress{Line1: "1 Main St", City: "Springfield", Region: "IL", PostalCode: "62701", Country: "US"}
+
+const shippingAddressJSON = `{"line1":"1 Main St","line2":"","city":"Springfield","region":"IL","postalCode":"62701","country":"US"}`
+
+func TestOrderRepositoryCheckout(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products .* ORDER BY product_id`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).
+				AddRow("7", "Mug", "MUG-1", 2, int64(899), "USD", 5, nil, nil, 0).
+				AddRow("8", "Tote bag", "TOTE-1", 1, int64(1999), "USD", 1, nil, nil, 0))
+		expectClaimReservations(mock)
+		mock.ExpectQuery(`INSERT INTO orders \(user_id, status, total_cents, currency, shipping_address, discount_cents, coupon_code, subtotal_cents, tax_cents\)`).
+			WithArgs("42", models.OrderStatusPending, int64(2*899+1999), "USD", []byte(shippingAddressJSON), int64(0), nil, int64(2*899+1999), int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("100", created))
+		mock.ExpectExec(`INSERT INTO order_items`).WithArgs("100", "7", "Mug", "MUG-1", 2, int64(899)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAdjustStock(mock, "7", 5, 1, 3, 1)
+		mock.ExpectExec(`INSERT INTO order_items`).WithArgs("100", "8", "Tote bag", "TOTE-1", 1, int64(1999)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAdjustStock(mock, "8", 1, 1, 0, 1)
+		mock.ExpectExec(`DELETE FROM cart_items WHERE user_id = \$1`).WithArgs("42").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		order, _, err := repo.Checkout(context.Background(), "42", "", shippingAddress, "")
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.ID != "100" || order.Status != models.OrderStatusPending || order.TotalCents != 2*899+1999 || !order.CreatedAt.Equal(created) {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+		if order.ShippingAddress != shippingAddress {
+			t.Fatalf("expected the shipping address on the order, got %+v", order.ShippingAddress)
+		}
+		if len(order.Items) != 2 || order.Items[0].UnitPriceCents != 899 || order.Items[1].Qty != 1 {
+			t.Fatalf("unexpected order items: %+v", order.Items)
+		}
+	})
+
+	t.Run("insufficient stock", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).
+				AddRow("7", "Mug", "MUG-1", 6, int64(899), "USD", 5, nil, nil, 0).
+				AddRow("8", "Tote bag", "TOTE-1", 1, int64(1999), "USD", 1, nil, nil, 0).
+				AddRow("9", "Bottle", "BOTTLE-1", 1, int64(2450), "USD", 0, nil, nil, 0))
+		expectClaimReservations(mock)
+		mock.ExpectRollback()
+
+		_, _, err := repo.Checkout(context.Background(), "42", "", nil, "")
+		var stockErr *models.InsufficientStockError
+		if !errors.As(err, &stockErr) || !errors.Is(err, models.ErrInsufficientStock) {
+			t.Fatalf("expected *InsufficientStockError, got %v", err)
+		}
+		if !reflect.DeepEqual(stockErr.ProductIDs, []string{"7", "9"}) {
+			t.Fatalf("expected products 7 and 9, got %v", stockErr.ProductIDs)
+		}
+	})
+
+	t.Run("stock conflict mid-checkout", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).AddRow("7", "Mug", "MUG-1", 2, int64(899), "USD", 5, nil, nil, 0))
+		expectClaimReservations(mock)
+		mock.ExpectQuery(`INSERT INTO orders`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("100", created))
+		mock.ExpectExec(`INSERT INTO order_items`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT stock_qty, version FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"stock_qty", "version"}).AddRow(1, 2))
+		mock.ExpectRollback()
+
+		if _, _, err := repo.Checkout(context.Background(), "42", "", nil, ""); !errors.Is(err, models.ErrInsufficientStock) {
+			t.Fatalf("expected ErrInsufficientStock, got %v", err)
+		}
+	})
+
+	t.Run("sells reserved stock", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		// The mug is fully reserved and sold out, the tote bag is partly reserved, and the
+		// bottle was reserved but then removed from the cart.
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).
+				AddRow("7", "Mug", "MUG-1", 2, int64(899), "USD", 0, nil, nil, 0).
+				AddRow("8", "Tote bag", "TOTE-1", 3, int64(1999), "USD", 1, nil, nil, 0))
+		expectClaimReservations(mock, "7", 2, "8", 2, "9", 1)
+		mock.ExpectQuery(`INSERT INTO orders`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("100", created))
+		mock.ExpectExec(`INSERT INTO order_items`).WithArgs("100", "7", "Mug", "MUG-1", 2, int64(899)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO order_items`).WithArgs("100", "8", "Tote bag", "TOTE-1", 3, int64(1999)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAdjustStock(mock, "8", 1, 3, 0, 1)
+		expectAdjustStock(mock, "9", 0, 7, 1, 1)
+		mock.ExpectExec(`DELETE FROM cart_items`).WithArgs("42").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		order, _, err := repo.Checkout(context.Background(), "42", "", nil, "")
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.TotalCents != 2*899+3*1999 {
+			t.Fatalf("unexpected order total: %d", order.TotalCents)
+		}
+	})
+
+	t.Run("flash sale price", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, clock.NewFake(created))
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT max\(percent_off\) FROM flash_sale_products .* starts_at <= \$2 AND ends_at > \$2`).WithArgs("42", created).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).AddRow("7", "Mug", "MUG-1", 2, int64(899), "USD", 5, nil, nil, 20))
+		expectClaimReservations(mock)
+		mock.ExpectQuery(`INSERT INTO orders`).
+			WithArgs("42", models.OrderStatusPending, int64(2*720), "USD", []byte(nil), int64(0), nil, int64(2*720), int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("100", created))
+		mock.ExpectExec(`INSERT INTO order_items`).WithArgs("100", "7", "Mug", "MUG-1", 2, int64(720)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAdjustStock(mock, "7", 5, 1, 3, 1)
+		mock.ExpectExec(`DELETE FROM cart_items`).WithArgs("42").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		order, _, err := repo.Checkout(context.Background(), "42", "", nil, "")
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.Items[0].UnitPriceCents != 720 || order.TotalCents != 2*720 {
+			t.Fatalf("expected the 20%% sale price, got %+v (total %d)", order.Items[0], order.TotalCents)
+		}
+	})
+
+	t.Run("over purchase limit", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		// The mug was added before the customer bought 2 more of it in another order.
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).AddRow("7", "Mug", "MUG-1", 2, int64(899), "USD", 5, nil, 3, 0))
+		expectClaimReservations(mock)
+		mock.ExpectQuery(`SELECT coalesce\(sum\(qty\), 0\) FROM order_items JOIN orders`).
+			WithArgs("42", "7", models.OrderStatusCancelled).
+			WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(2))
+		mock.ExpectRollback()
+
+		_, _, err := repo.Checkout(context.Background(), "42", "", nil, "")
+		var limitErr *models.PurchaseLimitError
+		if !errors.As(err, &limitErr) || !limitErr.PerCustomer || limitErr.Limit != 3 || limitErr.Purchased != 2 {
+			t.Fatalf("expected the per-customer limit to be exceeded, got %v", err)
+		}
+	})
+
+	t.Run("new idempotency key", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO idempotency_keys \(user_id, key\) VALUES \(\$1, \$2\) ON CONFLICT DO NOTHING`).
+			WithArgs("42", "3f1c9a").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).AddRow("7", "Mug", "MUG-1", 1, int64(899), "USD", 5, nil, nil, 0))
+		expectClaimReservations(mock)
+		mock.ExpectQuery(`INSERT INTO orders`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("100", created))
+		mock.ExpectExec(`INSERT INTO order_items`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAdjustStock(mock, "7", 5, 1, 4, 1)
+		mock.ExpectExec(`DELETE FROM cart_items`).WithArgs("42").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE idempotency_keys SET order_id = \$3 WHERE user_id = \$1 AND key = \$2`).
+			WithArgs("42", "3f1c9a", "100").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		order, placed, err := repo.Checkout(context.Background(), "42", "3f1c9a", nil, "")
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if !placed || order.ID != "100" || len(order.Items) != 1 {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("replayed idempotency key", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		// The cart isn't touched: the order placed with the key the first time is returned.
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO idempotency_keys`).WithArgs("42", "3f1c9a").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT id, user_id, status, total_cents, currency, shipping_address, tracking_number, payment_intent_id, discount_cents, coupon_code, subtotal_cents, tax_cents, created_at FROM orders\s+WHERE id = \(SELECT order_id FROM idempotency_keys WHERE user_id = \$1 AND key = \$2\)`).
+			WithArgs("42", "3f1c9a").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PENDING", int64(899), "USD", []byte(shippingAddressJSON), nil, nil, int64(0), nil, int64(899), int64(0), created))
+		mock.ExpectRollback()
+
+		order, placed, err := repo.Checkout(context.Background(), "42", "3f1c9a", nil, "")
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if placed || order.ID != "100" || order.Items != nil {
+			t.Fatalf("expected the earlier order 100 without items, got %+v (placed: %t)", order, placed)
+		}
+		if order.ShippingAddress == nil || *order.ShippingAddress != *shippingAddress {
+			t.Fatalf("expected the stored shipping address, got %+v", order.ShippingAddress)
+		}
+	})
+
+	t.Run("empty cart", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(checkoutRows))
+		mock.ExpectRollback()
+
+		if _, _, err := repo.Checkout(context.Background(), "42", "", nil, ""); !errors.Is(err, models.ErrEmptyCart) {
+			t.Fatalf("expected ErrEmptyCart, got %v", err)
+		}
+	})
+}
+
+var couponRows = []string{"id", "code", "percent_off", "amount_off_cents", "currency", "expires_at", "max_redemptions", "times_redeemed", "created_at"}
+
+func TestOrderRepositoryCheckoutCoupon(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// expectCartWithCoupon expects a checkout of 3 mugs at 8.99 that looks up the coupon,
+	// answering with row.
+	expectCartWithCoupon := func(mock sqlmock.Sqlmock, row ...driver.Value) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).AddRow("7", "Mug", "MUG-1", 3, int64(899), "USD", 5, nil, nil, 0))
+		expectClaimReservations(mock)
+		mock.ExpectQuery(`SELECT id, code, percent_off, amount_off_cents, currency, expires_at, max_redemptions, times_redeemed, created_at FROM coupons WHERE code = \$1 FOR UPDATE`).
+			WithArgs("SPRING").
+			WillReturnRows(sqlmock.NewRows(couponRows).AddRow(row...))
+	}
+	// expectOrderPlaced expects the rest of a successful checkout of the mugs for total cents.
+	expectOrderPlaced := func(mock sqlmock.Sqlmock, total, discount int64) {
+		mock.ExpectExec(`UPDATE coupons SET times_redeemed = times_redeemed \+ 1 WHERE id = \$1`).WithArgs("3").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO orders`).
+			WithArgs("42", models.OrderStatusPending, total, "USD", []byte(nil), discount, "SPRING", int64(3*899), int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("100", created))
+		mock.ExpectExec(`INSERT INTO order_items`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAdjustStock(mock, "7", 5, 1, 2, 1)
+		mock.ExpectExec(`DELETE FROM cart_items`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	t.Run("percent off", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		// 15% of 26.97 is 4.0455, rounded down to 4.04.
+		expectCartWithCoupon(mock, "3", "SPRING", 15, nil, nil, nil, nil, 0, created)
+		expectOrderPlaced(mock, 3*899-404, 404)
+
+		order, _, err := repo.Checkout(context.Background(), "42", "", nil, "spring")
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.TotalCents != 3*899-404 || order.DiscountCents != 404 || order.CouponCode == nil || *order.CouponCode != "SPRING" {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("amount off", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		expectCartWithCoupon(mock, "3", "SPRING", nil, int64(500), "USD", created.Add(time.Hour*24*365*100), 10, 9, created)
+		expectOrderPlaced(mock, 3*899-500, 500)
+
+		order, _, err := repo.Checkout(context.Background(), "42", "", nil, "SPRING")
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.TotalCents != 3*899-500 || order.DiscountCents != 500 {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("amount off more than the total", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		expectCartWithCoupon(mock, "3", "SPRING", nil, int64(5000), "USD", nil, nil, 0, created)
+		expectOrderPlaced(mock, 0, 3*899)
+
+		order, _, err := repo.Checkout(context.Background(), "42", "", nil, "SPRING")
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.TotalCents != 0 || order.DiscountCents != 3*899 {
+			t.Fatalf("expected the discount to be capped at the total, got %+v", order)
+		}
+	})
+
+	for name, tc := range map[string]struct {
+		row  []driver.Value
+		want error
+	}{
+		"exhausted":      {[]driver.Value{"3", "SPRING", 15, nil, nil, nil, 10, 10, created}, models.ErrCouponExhausted},
+		"expired":        {[]driver.Value{"3", "SPRING", 15, nil, nil, created, nil, 0, created}, models.ErrCouponExpired},
+		"other currency": {[]driver.Value{"3", "SPRING", nil, int64(500), "EUR", nil, nil, 0, created}, models.ErrCouponInvalid},
+	} {
+		t.Run(name, func(t *testing.T) {
+			db, mock := newMock(t)
+			repo := NewOrderRepository(db, nil, nil)
+
+			expectCartWithCoupon(mock, tc.row...)
+			mock.ExpectRollback()
+
+			if _, _, err := repo.Checkout(context.Background(), "42", "", nil, "SPRING"); !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+
+	t.Run("expires at the checkout time", func(t *testing.T) {
+		expires := created.Add(time.Hour)
+		for _, tc := range []struct {
+			now  time.Time
+			want error
+		}{
+			{expires.Add(-time.Second), nil},
+			{expires, models.ErrCouponExpired},
+		} {
+			db, mock := newMock(t)
+			repo := NewOrderRepository(db, nil, clock.NewFake(tc.now))
+
+			expectCartWithCoupon(mock, "3", "SPRING", 15, nil, nil, expires, nil, 0, created)
+			if tc.want == nil {
+				expectOrderPlaced(mock, 3*899-404, 404)
+			} else {
+				mock.ExpectRollback()
+			}
+
+			if _, _, err := repo.Checkout(context.Background(), "42", "", nil, "SPRING"); !errors.Is(err, tc.want) {
+				t.Fatalf("at %v: expected %v, got %v", tc.now, tc.want, err)
+			}
+		}
+	})
+
+	t.Run("unknown code", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).AddRow("7", "Mug", "MUG-1", 3, int64(899), "USD", 5, nil, nil, 0))
+		expectClaimReservations(mock)
+		mock.ExpectQuery(`FROM coupons WHERE code = \$1 FOR UPDATE`).WithArgs("NOPE").WillReturnRows(sqlmock.NewRows(couponRows))
+		mock.ExpectRollback()
+
+		if _, _, err := repo.Checkout(context.Background(), "42", "", nil, "nope"); !errors.Is(err, models.ErrCouponInvalid) {
+			t.Fatalf("expected ErrCouponInvalid, got %v", err)
+		}
+	})
+}
+
+// fakeTax is a models.TaxCalculator charging 10% and recording what it was asked to tax.
+type fakeTax struct {
+	address *models.ShippingAddress
+	amount  int64
+	err     error
+}
+
+func (f *fakeTax) Tax(ctx context.Context, address *models.ShippingAddress, amountCents int64, currency string) (int64, error) {
+	f.address, f.amount = address, amountCents
+	return amountCents / 10, f.err
+}
+
+func TestOrderRepositoryCheckoutTax(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("taxed after discount", func(t *testing.T) {
+		db, mock := newMock(t)
+		tax := &fakeTax{}
+		repo := NewOrderRepository(db, tax, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).AddRow("7", "Mug", "MUG-1", 3, int64(899), "USD", 5, nil, nil, 0))
+		expectClaimReservations(mock)
+		mock.ExpectQuery(`FROM coupons WHERE code = \$1 FOR UPDATE`).WithArgs("SPRING").
+			WillReturnRows(sqlmock.NewRows(couponRows).AddRow("3", "SPRING", nil, int64(697), "USD", nil, nil, 0, created))
+		mock.ExpectExec(`UPDATE coupons`).WithArgs("3").WillReturnResult(sqlmock.NewResult(0, 1))
+		// 26.97 less 6.97 off is 20.00, and 10% tax on that makes 22.00.
+		mock.ExpectQuery(`INSERT INTO orders`).
+			WithArgs("42", models.OrderStatusPending, int64(2200), "USD", []byte(shippingAddressJSON), int64(697), "SPRING", int64(3*899), int64(200)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("100", created))
+		mock.ExpectExec(`INSERT INTO order_items`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAdjustStock(mock, "7", 5, 1, 2, 1)
+		mock.ExpectExec(`DELETE FROM cart_items`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		order, _, err := repo.Checkout(context.Background(), "42", "", shippingAddress, "SPRING")
+		if err != nil {
+			t.Fatalf("Checkout returned error: %v", err)
+		}
+		if order.SubtotalCents != 3*899 || order.DiscountCents != 697 || order.TaxCents != 200 || order.TotalCents != 2200 {
+			t.Fatalf("unexpected order totals: %+v", order)
+		}
+		if tax.address != shippingAddress || tax.amount != 2000 {
+			t.Fatalf("expected tax on 2000 cents shipping to the order's address, got %d to %+v", tax.amount, tax.address)
+		}
+	})
+
+	t.Run("calculator error", func(t *testing.T) {
+		db, mock := newMock(t)
+		errRates := errors.New("rates unavailable")
+		repo := NewOrderRepository(db, &fakeTax{err: errRates}, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM cart_items JOIN products`).WithArgs("42", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(checkoutRows).AddRow("7", "Mug", "MUG-1", 1, int64(899), "USD", 5, nil, nil, 0))
+		expectClaimReservations(mock)
+		mock.ExpectRollback()
+
+		if _, _, err := repo.Checkout(context.Background(), "42", "", shippingAddress, ""); err == nil || !errors.Is(err, errRates) {
+			t.Fatalf("expected the tax error, got %v", err)
+		}
+	})
+}
+
+func TestOrderRepositoryList(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewOrderRepository(db, nil, nil)
+	newer := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("unfiltered", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, user_id, status, total_cents, currency, shipping_address, tracking_number, payment_intent_id, discount_cents, coupon_code, subtotal_cents, tax_cents, created_at, count\(\*\) OVER \(\) FROM orders WHERE user_id = \$1 ORDER BY created_at DESC, id DESC LIMIT \$2 OFFSET \$3`).
+			WithArgs("42", 20, 0).
+			WillReturnRows(sqlmock.NewRows(orderPageRows).
+				AddRow("101", "42", "SHIPPED", int64(899), "USD", nil, nil, nil, int64(0), nil, int64(899), int64(0), newer, 2).
+				AddRow("100", "42", "PENDING", int64(1999), "USD", nil, nil, nil, int64(0), nil, int64(1999), int64(0), older, 2))
+
+		page, err := repo.List(context.Background(), "42", nil, models.PageArgs{Limit: 20})
+		if err != nil {
+			t.Fatalf("List returned error: %v", err)
+		}
+		orders := page.Items
+		if page.Total != 2 || len(orders) != 2 || orders[0].ID != "101" || orders[0].Status != models.OrderStatusShipped || orders[1].Status != models.OrderStatusPending {
+			t.Fatalf("unexpected orders: %+v", orders)
+		}
+	})
+
+	t.Run("filtered by status", func(t *testing.T) {
+		status := models.OrderStatusPending
+		mock.ExpectQuery(`FROM orders WHERE user_id = \$1 AND status = \$2 ORDER BY created_at DESC, id DESC LIMIT \$3 OFFSET \$4`).
+			WithArgs("42", "PENDING", 10, 5).
+			WillReturnRows(sqlmock.NewRows(orderPageRows).AddRow("100", "42", "PENDING", int64(1999), "USD", nil, nil, nil, int64(0), nil, int64(1999), int64(0), older, 6))
+
+		page, err := repo.List(context.Background(), "42", &status, models.PageArgs{Limit: 10, Offset: 5})
+		if err != nil {
+			t.Fatalf("List returned error: %v", err)
+		}
+		if len(page.Items) != 1 || page.Items[0].ID != "100" || page.Total != 6 {
+			t.Fatalf("unexpected page: %+v", page)
+		}
+	})
+}
+
+func TestOrderRepositoryItems(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewOrderRepository(db, nil, nil)
+
+	mock.ExpectQuery(`FROM order_items\s+WHERE order_id = ANY\(\$1\)`).
+		WithArgs(pq.Array([]string{"100", "101"})).
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "product_id", "name", "sku", "qty", "unit_price_cents"}).
+			AddRow("100", "7", "Mug", "MUG-1", 2, int64(899)).
+			AddRow("100", "8", "Tote bag", "TOTE-1", 1, int64(1999)).
+			AddRow("101", "7", "Mug", "MUG-1", 1, int64(899)))
+
+	items, err := repo.Items(context.Background(), []string{"100", "101"})
+	if err != nil {
+		t.Fatalf("Items returned error: %v", err)
+	}
+	if len(items["100"]) != 2 || len(items["101"]) != 1 || items["100"][1].SKU != "TOTE-1" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+}
+
+func TestOrderRepositoryCustomerStats(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewOrderRepository(db, nil, nil)
+
+	mock.ExpectQuery(`SELECT user_id, count\(\*\), SUM\(total_cents\) FROM orders\s+WHERE user_id = ANY\(\$1\) AND status = \$2 GROUP BY user_id`).
+		WithArgs(pq.Array([]string{"42", "43"}), models.OrderStatusDelivered).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "count", "sum"}).AddRow("42", 3, int64(12597)))
+
+	stats, err := repo.CustomerStats(context.Background(), []string{"42", "43"})
+	if err != nil {
+		t.Fatalf("CustomerStats returned error: %v", err)
+	}
+	if s := stats["42"]; s == nil || s.OrderCount != 3 || s.LifetimeValueCents != 12597 {
+		t.Fatalf("unexpected stats for user 42: %+v", s)
+	}
+	if _, ok := stats["43"]; ok {
+		t.Fatal("expected a user without delivered orders to be left out")
+	}
+}
+
+func TestOrderRepositoryGetByID(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewOrderRepository(db, nil, nil)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT id, user_id, status, total_cents, currency, shipping_address, tracking_number, payment_intent_id, discount_cents, coupon_code, subtotal_cents, tax_cents, created_at FROM orders WHERE id = \$1`).WithArgs("100").
+		WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PAID", int64(1999), "USD", nil, nil, nil, int64(0), nil, int64(1999), int64(0), created))
+	order, err := repo.GetByID(context.Background(), "100")
+	if err != nil {
+		t.Fatalf("GetByID returned error: %v", err)
+	}
+	if order.ID != "100" || order.UserID != "42" || order.Status != models.OrderStatusPaid {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+
+	mock.ExpectQuery(`FROM orders WHERE id = \$1`).WithArgs("999").WillReturnRows(sqlmock.NewRows(orderRows))
+	if _, err := repo.GetByID(context.Background(), "999"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestOrderRepositoryUpdateStatus(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("allowed", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id, user_id, status, total_cents, currency, shipping_address, tracking_number, payment_intent_id, discount_cents, coupon_code, subtotal_cents, tax_cents, created_at FROM orders WHERE id = \$1 FOR UPDATE`).
+			WithArgs("100").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "SHIPPED", int64(1999), "USD", nil, "1Z999", nil, int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectExec(`UPDATE orders SET status = \$2 WHERE id = \$1`).WithArgs("100", "DELIVERED").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		order, err := repo.UpdateStatus(context.Background(), "100", models.OrderStatusDelivered)
+		if err != nil {
+			t.Fatalf("UpdateStatus returned error: %v", err)
+		}
+		if order.Status != models.OrderStatusDelivered || order.TotalCents != 1999 {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("invalid transition", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("100").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PENDING", int64(1999), "USD", nil, nil, nil, int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectRollback()
+
+		if _, err := repo.UpdateStatus(context.Background(), "100", models.OrderStatusShipped); !errors.Is(err, orders.ErrInvalidTransition) {
+			t.Fatalf("expected ErrInvalidTransition, got %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("999").WillReturnRows(sqlmock.NewRows(orderRows))
+		mock.ExpectRollback()
+
+		if _, err := repo.UpdateStatus(context.Background(), "999", models.OrderStatusShipped); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestOrderRepositoryCancel(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("restores stock", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id, user_id, status, total_cents, currency, shipping_address, tracking_number, payment_intent_id, discount_cents, coupon_code, subtotal_cents, tax_cents, created_at FROM orders WHERE id = \$1 FOR UPDATE`).
+			WithArgs("100").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PENDING", int64(2*899+1999), "USD", nil, nil, nil, int64(0), nil, int64(2*899+1999), int64(0), created))
+		mock.ExpectExec(`UPDATE orders SET status = \$2 WHERE id = \$1`).WithArgs("100", "CANCELLED").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT product_id, qty FROM order_items WHERE order_id = \$1 ORDER BY product_id`).WithArgs("100").
+			WillReturnRows(sqlmock.NewRows([]string{"product_id", "qty"}).AddRow("7", 2).AddRow("8", 1))
+		expectAdjustStock(mock, "7", 3, 4, 5, 1)
+		expectAdjustStock(mock, "8", 0, 2, 1, 1)
+		mock.ExpectCommit()
+
+		order, err := repo.Cancel(context.Background(), "100")
+		if err != nil {
+			t.Fatalf("Cancel returned error: %v", err)
+		}
+		if order.ID != "100" || order.Status != models.OrderStatusCancelled {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("paid", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("100").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PAID", int64(1999), "USD", nil, nil, nil, int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectRollback()
+
+		_, err := repo.Cancel(context.Background(), "100")
+		if !errors.Is(err, models.ErrOrderNotCancellable) || !errors.Is(err, orders.ErrInvalidTransition) {
+			t.Fatalf("expected ErrOrderNotCancellable wrapping ErrInvalidTransition, got %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("999").WillReturnRows(sqlmock.NewRows(orderRows))
+		mock.ExpectRollback()
+
+		if _, err := repo.Cancel(context.Background(), "999"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestOrderRepositoryShip(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("paid", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id, user_id, status, total_cents, currency, shipping_address, tracking_number, payment_intent_id, discount_cents, coupon_code, subtotal_cents, tax_cents, created_at FROM orders WHERE id = \$1 FOR UPDATE`).
+			WithArgs("100").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PAID", int64(1999), "USD", nil, nil, nil, int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectExec(`UPDATE orders SET status = \$2, tracking_number = \$3 WHERE id = \$1`).
+			WithArgs("100", "SHIPPED", "1Z999").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		order, err := repo.Ship(context.Background(), "100", "1Z999")
+		if err != nil {
+			t.Fatalf("Ship returned error: %v", err)
+		}
+		if order.Status != models.OrderStatusShipped || order.TrackingNumber == nil || *order.TrackingNumber != "1Z999" {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("not paid", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("100").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PENDING", int64(1999), "USD", nil, nil, nil, int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectRollback()
+
+		_, err := repo.Ship(context.Background(), "100", "1Z999")
+		if !errors.Is(err, models.ErrOrderNotShippable) || !errors.Is(err, orders.ErrInvalidTransition) {
+			t.Fatalf("expected ErrOrderNotShippable wrapping ErrInvalidTransition, got %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("999").WillReturnRows(sqlmock.NewRows(orderRows))
+		mock.ExpectRollback()
+
+		if _, err := repo.Ship(context.Background(), "999", "1Z999"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestOrderRepositorySetPaymentIntent(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	heldUntil := created.Add(30 * time.Minute)
+
+	t.Run("pending", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("100").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PENDING", int64(1999), "USD", nil, nil, nil, int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectExec(`UPDATE orders SET status = \$2, payment_intent_id = \$3, payment_held_until = \$4 WHERE id = \$1`).
+			WithArgs("100", "PENDING_PAYMENT", "pi_1", heldUntil).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		order, err := repo.SetPaymentIntent(context.Background(), "100", "pi_1", heldUntil)
+		if err != nil {
+			t.Fatalf("SetPaymentIntent returned error: %v", err)
+		}
+		if order.Status != models.OrderStatusPendingPayment || order.PaymentIntentID != "pi_1" {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("already awaiting payment", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("100").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PENDING_PAYMENT", int64(1999), "USD", nil, nil, "pi_1", int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectRollback()
+
+		if _, err := repo.SetPaymentIntent(context.Background(), "100", "pi_2", heldUntil); !errors.Is(err, orders.ErrInvalidTransition) {
+			t.Fatalf("expected ErrInvalidTransition, got %v", err)
+		}
+	})
+}
+
+func TestOrderRepositoryExpiredPaymentHolds(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewOrderRepository(db, nil, nil)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := created.Add(time.Hour)
+
+	mock.ExpectQuery(`SELECT id, user_id, status, total_cents, currency, shipping_address, tracking_number, payment_intent_id, discount_cents, coupon_code, subtotal_cents, tax_cents, created_at FROM orders\s+`+
+		`WHERE status IN \(\$2, \$3\) AND payment_held_until <= \$1\s+ORDER BY payment_held_until, id LIMIT \$4`).
+		WithArgs(now, "PENDING_PAYMENT", "PAYMENT_FAILED", 100).
+		WillReturnRows(sqlmock.NewRows(orderRows).
+			AddRow("100", "42", "PAYMENT_FAILED", int64(1999), "USD", nil, nil, "pi_1", int64(0), nil, int64(1999), int64(0), created).
+			AddRow("101", "43", "PENDING_PAYMENT", int64(899), "USD", nil, nil, "pi_2", int64(0), nil, int64(899), int64(0), created))
+
+	expired, err := repo.ExpiredPaymentHolds(context.Background(), now, 100)
+	if err != nil {
+		t.Fatalf("ExpiredPaymentHolds returned error: %v", err)
+	}
+	if len(expired) != 2 || expired[0].PaymentIntentID != "pi_1" || expired[1].ID != "101" {
+		t.Fatalf("unexpected orders: %+v", expired)
+	}
+}
+
+func TestOrderRepositoryConfirmPayment(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("awaiting payment", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id, user_id, status, total_cents, currency, shipping_address, tracking_number, payment_intent_id, discount_cents, coupon_code, subtotal_cents, tax_cents, created_at FROM orders WHERE payment_intent_id = \$1 FOR UPDATE`).
+			WithArgs("pi_1").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PENDING_PAYMENT", int64(1999), "USD", nil, nil, "pi_1", int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectExec(`UPDATE orders SET status = \$2 WHERE id = \$1`).WithArgs("100", "PAID").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		order, err := repo.ConfirmPayment(context.Background(), "pi_1")
+		if err != nil {
+			t.Fatalf("ConfirmPayment returned error: %v", err)
+		}
+		if order.ID != "100" || order.Status != models.OrderStatusPaid {
+			t.Fatalf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("already paid", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE payment_intent_id = \$1 FOR UPDATE`).WithArgs("pi_1").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PAID", int64(1999), "USD", nil, nil, "pi_1", int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectRollback()
+
+		_, err := repo.ConfirmPayment(context.Background(), "pi_1")
+		if !errors.Is(err, orders.ErrInvalidTransition) || errors.Is(err, models.ErrPaidAfterCancellation) {
+			t.Fatalf("expected ErrInvalidTransition, got %v", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE payment_intent_id = \$1 FOR UPDATE`).WithArgs("pi_1").
+			WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "CANCELLED", int64(1999), "USD", nil, nil, "pi_1", int64(0), nil, int64(1999), int64(0), created))
+		mock.ExpectRollback()
+
+		_, err := repo.ConfirmPayment(context.Background(), "pi_1")
+		if !errors.Is(err, models.ErrPaidAfterCancellation) || !errors.Is(err, orders.ErrInvalidTransition) {
+			t.Fatalf("expected ErrPaidAfterCancellation wrapping ErrInvalidTransition, got %v", err)
+		}
+	})
+
+	t.Run("unknown intent", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewOrderRepository(db, nil, nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM orders WHERE payment_intent_id = \$1 FOR UPDATE`).WithArgs("pi_404").WillReturnRows(sqlmock.NewRows(orderRows))
+		mock.ExpectRollback()
+
+		if _, err := repo.ConfirmPayment(context.Background(), "pi_404"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestOrderRepositoryFailPayment(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewOrderRepository(db, nil, nil)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM orders WHERE payment_intent_id = \$1 FOR UPDATE`).WithArgs("pi_1").
+		WillReturnRows(sqlmock.NewRows(orderRows).AddRow("100", "42", "PENDING_PAYMENT", int64(1999), "USD", nil, nil, "pi_1", int64(0), nil, int64(1999), int64(0), created))
+	mock.ExpectExec(`UPDATE orders SET status = \$2 WHERE id = \$1`).WithArgs("100", "PAYMENT_FAILED").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	order, err := repo.FailPayment(context.Background(), "pi_1")
+	if err != nil {
+		t.Fatalf("FailPayment returned error: %v", err)
+	}
+	if order.Status != models.OrderStatusPaymentFailed {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+}
+
+func TestOrderRepositoryDeleteExpiredIdempotencyKeys(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewOrderRepository(db, nil, nil)
+
+	mock.ExpectExec(`DELETE FROM idempotency_keys WHERE created_at <= now\(\) - make_interval\(secs => \$1\)`).
+		WithArgs(float64(86400)).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := repo.DeleteExpiredIdempotencyKeys(context.Background(), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("DeleteExpiredIdempotencyKeys returned error: %v", err)
+	}
+	if deleted != 3 {
+		t.Fatalf("expected 3 deleted keys, got %d", deleted)
+	}
+}
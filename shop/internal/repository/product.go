@@ -0,0 +1,405 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/internal/database"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// pqUniqueViolation is the Postgres error code for a unique constraint violation.
+const pqUniqueViolation = "23505"
+
+// pqUndefinedColumn is the Postgres error code for a reference to a column that doesn't exist.
+const pqUndefinedColumn = "42703"
+
+// maxStockRetries is how many times adjustStock re-reads a product whose version changed
+// between its read and its update before giving up.
+const maxStockRetries = 3
+
+// importBatchSize is how many products Import inserts per statement.
+const importBatchSize = 500
+
+// productColumns is the column list scanned by scanProduct.
+const productColumns = `id, name, description, price_cents, currency, sku, stock_qty, created_at, category_id,
+	max_per_order, max_per_customer`
+
+// sqlProductRepository is a models.ProductRepository backed by the products table.
+type sqlProductRepository struct {
+	db *sql.DB
+}
+
+// NewProductRepository creates a ProductRepository backed by db.
+func NewProductRepository(db *sql.DB) models.ProductRepository {
+	return &sqlProductRepository{db: db}
+}
+
+// Create inserts product and sets its generated ID and creation time.
+func (r *sqlProductRepository) Create(ctx context.Context, product *models.Product) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO products (name, description, price_cents, currency, sku, stock_qty, max_per_order, max_per_customer)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+		product.Name, nullString(product.Description), product.PriceCents, product.Currency, product.SKU, product.StockQty,
+		product.MaxPerOrder, product.MaxPerCustomer,
+	).Scan(&product.ID, &product.CreatedAt)
+
+	// The SKU is the only unique column a new row can collide on.
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return models.ErrDuplicateSKU
+	}
+	return err
+}
+
+// Import inserts products in batches of importBatchSize within one transaction, so either
+// every product that doesn't collide on SKU is inserted or none are.
+func (r *sqlProductRepository) Import(ctx context.Context, products []*models.Product) ([]*models.Product, error) {
+	var duplicates []*models.Product
+	err := database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		for batch := range slices.Chunk(products, importBatchSize) {
+			skipped, err := importProducts(ctx, tx, batch)
+			if err != nil {
+				return err
+			}
+			duplicates = append(duplicates, skipped...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
+
+// importProducts inserts a batch of products with one statement. Rows whose SKU is taken
+// are skipped rather than failing the statement, so the rest of the batch still goes in;
+// the skipped products are returned.
+func importProducts(ctx context.Context, tx *sql.Tx, products []*models.Product) ([]*models.Product, error) {
+	var (
+		names        = make([]string, len(products))
+		descriptions = make([]string, len(products))
+		prices       = make([]int64, len(products))
+		currencies   = make([]string, len(products))
+		skus         = make([]string, len(products))
+		stock        = make([]int64, len(products))
+		bySKU        = make(map[string]*models.Product, len(products))
+	)
+	for i, p := range products {
+		names[i], descriptions[i], prices[i], currencies[i], skus[i], stock[i] = p.Name, p.Description, p.PriceCents, p.Currency, p.SKU, int64(p.StockQty)
+		bySKU[p.SKU] = p
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`INSERT INTO products (name, description, price_cents, currency, sku, stock_qty)
+		SELECT name, NULLIF(description, ''), price_cents, currency, sku, stock_qty
+		FROM unnest($1::text[], $2::text[], $3::bigint[], $4::text[], $5::text[], $6::integer[])
+			AS p (name, description, price_cents, currency, sku, stock_qty)
+		ON CONFLICT (sku) DO NOTHING RETURNING sku, id, created_at`,
+		pq.Array(names), pq.Array(descriptions), pq.Array(prices), pq.Array(currencies), pq.Array(skus), pq.Array(stock),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sku string
+		var product models.Product
+		if err := rows.Scan(&sku, &product.ID, &product.CreatedAt); err != nil {
+			return nil, err
+		}
+		if p, ok := bySKU[sku]; ok {
+			p.ID, p.CreatedAt = product.ID, product.CreatedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var duplicates []*models.Product
+	for _, p := range products {
+		if p.ID == "" {
+			duplicates = append(duplicates, p)
+		}
+	}
+	return duplicates, nil
+}
+
+// productOrder returns the column products are ordered by in sort, before their ID, and
+// whether both are descending. An empty sort is DefaultProductSort.
+func productOrder(sort models.ProductSort) (column string, desc bool) {
+	switch sort {
+	case models.ProductSortNewest:
+		return "created_at", true
+	case models.ProductSortPriceAsc:
+		return "price_cents", false
+	case models.ProductSortPriceDesc:
+		return "price_cents", true
+	}
+	return "created_at", false
+}
+
+// orderBy returns the ORDER BY list of sort.
+func orderBy(sort models.ProductSort) string {
+	column, desc := productOrder(sort)
+	if desc {
+		return column + ` DESC, id DESC`
+	}
+	return column + `, id`
+}
+
+// List returns a page of products in sort order.
+func (r *sqlProductRepository) List(ctx context.Context, sort models.ProductSort, page models.PageArgs) (*models.PageResult[*models.Product], error) {
+	return r.listPage(ctx,
+		`SELECT `+productColumns+`, count(*) OVER () FROM products ORDER BY `+orderBy(sort)+` LIMIT $1 OFFSET $2`,
+		page.Limit, page.Offset,
+	)
+}
+
+// categoryTree selects, as "tree", the IDs of the category whose slug is $1 and of all its
+// descendants. The recursive walk uses UNION so that a cycle in the parent references ends it
+// rather than looping.
+const categoryTree = `WITH RECURSIVE tree AS (
+	SELECT id FROM categories WHERE slug = $1
+	UNION
+	SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id
+)
+`
+
+// ListByCategory returns a page of products, in sort order, in the category with the given slug
+// or any of its descendants.
+func (r *sqlProductRepository) ListByCategory(ctx context.Context, slug string, sort models.ProductSort, page models.PageArgs) (*models.PageResult[*models.Product], error) {
+	return r.listPage(ctx,
+		categoryTree+`SELECT `+productColumns+`, count(*) OVER () FROM products WHERE category_id IN (SELECT id FROM tree)
+		ORDER BY `+orderBy(sort)+` LIMIT $2 OFFSET $3`,
+		slug, page.Limit, page.Offset,
+	)
+}
+
+// ListAfter returns the page of products, in sort order, that follows after, limited to the
+// category with the given slug and its descendants unless slug is empty. Unlike an offset,
+// the position isn't shifted by rows inserted while a client pages through the list.
+func (r *sqlProductRepository) ListAfter(ctx context.Context, slug string, sort models.ProductSort, after *models.ProductCursor, limit int) ([]*models.Product, error) {
+	var (
+		with  string
+		conds []string
+		args  []any
+	)
+	if slug != "" {
+		with = categoryTree
+		conds = append(conds, `category_id IN (SELECT id FROM tree)`)
+		args = append(args, slug)
+	}
+	if after != nil {
+		column, desc := productOrder(sort)
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		conds = append(conds, fmt.Sprintf(`(%s, id) %s ($%d, $%d)`, column, op, len(args)+1, len(args)+2))
+		if column == "price_cents" {
+			args = append(args, after.PriceCents, after.ID)
+		} else {
+			args = append(args, after.CreatedAt, after.ID)
+		}
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+	args = append(args, limit)
+	return r.list(ctx,
+		fmt.Sprintf(`%sSELECT `+productColumns+` FROM products%s ORDER BY %s LIMIT $%d`, with, where, orderBy(sort), len(args)),
+		args...,
+	)
+}
+
+// Search returns a page of products whose name or description contains every word of query,
+// most relevant first. It uses the full-text search_vector column, falling back to a slower
+// case-insensitive substring match on databases where that column hasn't been added yet.
+func (r *sqlProductRepository) Search(ctx context.Context, query string, page models.PageArgs) (*models.PageResult[*models.Product], error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return &models.PageResult[*models.Product]{Items: []*models.Product{}}, nil
+	}
+
+	result, err := r.listPage(ctx,
+		`SELECT `+productColumns+`, count(*) OVER () FROM products, plainto_tsquery('english', $1) AS q
+		WHERE search_vector @@ q
+		ORDER BY ts_rank(search_vector, q) DESC, created_at, id LIMIT $2 OFFSET $3`,
+		strings.Join(terms, " "), page.Limit, page.Offset,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUndefinedColumn {
+		return r.searchSubstring(ctx, terms, page)
+	}
+	return result, err
+}
+
+// searchSubstring matches products whose name or description contains every term, ignoring
+// case, oldest first.
+func (r *sqlProductRepository) searchSubstring(ctx context.Context, terms []string, page models.PageArgs) (*models.PageResult[*models.Product], error) {
+	conds := make([]string, len(terms))
+	args := make([]any, 0, len(terms)+2)
+	for i, term := range terms {
+		conds[i] = fmt.Sprintf(`(name ILIKE $%[1]d OR description ILIKE $%[1]d)`, i+1)
+		args = append(args, "%"+term+"%")
+	}
+	args = append(args, page.Limit, page.Offset)
+	return r.listPage(ctx,
+		fmt.Sprintf(`SELECT `+productColumns+`, count(*) OVER () FROM products WHERE %s ORDER BY created_at, id LIMIT $%d OFFSET $%d`,
+			strings.Join(conds, " AND "), len(terms)+1, len(terms)+2),
+		args...,
+	)
+}
+
+// searchTerms splits query into words of letters and digits. Dropping everything else keeps
+// tsquery operators and LIKE wildcards out of the search.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// FrequentlyBoughtTogether ranks the products ordered alongside productID by the number of
+// delivered orders containing both, breaking ties by ID so the ranking is stable.
+func (r *sqlProductRepository) FrequentlyBoughtTogether(ctx context.Context, productID string, limit int) ([]*models.Product, error) {
+	return r.list(ctx,
+		`SELECT `+productColumns+` FROM products JOIN (
+			SELECT b.product_id, count(DISTINCT b.order_id) AS shared FROM order_items a
+			JOIN orders o ON o.id = a.order_id
+			JOIN order_items b ON b.order_id = a.order_id AND b.product_id <> a.product_id
+			WHERE a.product_id = $1 AND o.status = $2
+			GROUP BY b.product_id
+		) together ON together.product_id = products.id
+		WHERE stock_qty > 0 ORDER BY together.shared DESC, id LIMIT $3`,
+		productID, models.OrderStatusDelivered, limit,
+	)
+}
+
+// list runs a query selecting productColumns and scans the resulting products.
+func (r *sqlProductRepository) list(ctx context.Context, query string, args ...any) ([]*models.Product, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*models.Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+// listPage runs a query selecting productColumns followed by the count of rows matched
+// before the limit, and scans the resulting page of products.
+func (r *sqlProductRepository) listPage(ctx context.Context, query string, args ...any) (*models.PageResult[*models.Product], error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &models.PageResult[*models.Product]{Items: []*models.Product{}}
+	for rows.Next() {
+		product, err := scanProduct(rows, &page.Total)
+		if err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, product)
+	}
+	return page, rows.Err()
+}
+
+// GetByID looks up a product by primary key.
+func (r *sqlProductRepository) GetByID(ctx context.Context, id string) (*models.Product, error) {
+	product, err := scanProduct(r.db.QueryRowContext(ctx, `SELECT `+productColumns+` FROM products WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	return product, err
+}
+
+// adjustStock adds delta, which is negative to take stock, to a product's stock_qty. The update
+// only applies if the product's version is the one that was read, so a concurrent change makes
+// it re-read and try again, up to maxStockRetries times. It returns an
+// *InsufficientStockError if the stock would go negative and ErrConcurrentModification if the
+// retries run out.
+func adjustStock(ctx context.Context, tx *sql.Tx, productID string, delta int) error {
+	for range maxStockRetries {
+		var stock, version int
+		err := tx.QueryRowContext(ctx, `SELECT stock_qty, version FROM products WHERE id = $1`, productID).Scan(&stock, &version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if stock+delta < 0 {
+			return &models.InsufficientStockError{ProductIDs: []string{productID}}
+		}
+
+		res, err := tx.ExecContext(ctx,
+			`UPDATE products SET stock_qty = $3, version = version + 1 WHERE id = $1 AND version = $2`,
+			productID, version, stock+delta,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 1 {
+			return err
+		}
+	}
+	return models.ErrConcurrentModification
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanProduct scans a row selected with productColumns, followed by any extra columns into extra.
+func scanProduct(row scanner, extra ...any) (*models.Product, error) {
+	var (
+		product        models.Product
+		description    sql.NullString
+		categoryID     sql.NullString
+		maxPerOrder    sql.NullInt32
+		maxPerCustomer sql.NullInt32
+	)
+	dest := []any{
+		&product.ID, &product.Name, &description, &product.PriceCents,
+		&product.Currency, &product.SKU, &product.StockQty, &product.CreatedAt, &categoryID,
+		&maxPerOrder, &maxPerCustomer,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	product.Description = description.String
+	if categoryID.Valid {
+		product.CategoryID = &categoryID.String
+	}
+	if maxPerOrder.Valid {
+		n := int(maxPerOrder.Int32)
+		product.MaxPerOrder = &n
+	}
+	if maxPerCustomer.Valid {
+		n := int(maxPerCustomer.Int32)
+		product.MaxPerCustomer = &n
+	}
+	return &product, nil
+}
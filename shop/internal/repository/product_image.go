@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/internal/database"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// productImageColumns is the column list scanned by scanProductImage.
+const productImageColumns = `id, product_id, url, position`
+
+// sqlProductImageRepository is a models.ProductImageRepository backed by the product_images
+// table.
+type sqlProductImageRepository struct {
+	db *sql.DB
+}
+
+// NewProductImageRepository creates a ProductImageRepository backed by db.
+func NewProductImageRepository(db *sql.DB) models.ProductImageRepository {
+	return &sqlProductImageRepository{db: db}
+}
+
+// Add inserts an image at the position after the product's last image. Two images added at
+// the same time get the same position, so the second violates the unique constraint.
+func (r *sqlProductImageRepository) Add(ctx context.Context, image *models.ProductImage) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO product_images (product_id, url, position)
+		SELECT $1, $2, COALESCE(MAX(position) + 1, 0) FROM product_images WHERE product_id = $1
+		RETURNING id, position`,
+		image.ProductID, image.URL,
+	).Scan(&image.ID, &image.Position)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			return models.ErrConcurrentModification
+		case pqForeignKeyViolation:
+			return models.ErrNotFound
+		}
+	}
+	return err
+}
+
+// ListByProduct returns a product's images ordered by position.
+func (r *sqlProductImageRepository) ListByProduct(ctx context.Context, productID string) ([]*models.ProductImage, error) {
+	return listProductImages(ctx, r.db, productID)
+}
+
+// ListByProducts returns the images of several products in one query.
+func (r *sqlProductImageRepository) ListByProducts(ctx context.Context, productIDs []string) (map[string][]*models.ProductImage, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+productImageColumns+` FROM product_images WHERE product_id = ANY($1) ORDER BY product_id, position`,
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make(map[string][]*models.ProductImage, len(productIDs))
+	for rows.Next() {
+		image, err := scanProductImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images[image.ProductID] = append(images[image.ProductID], image)
+	}
+	return images, rows.Err()
+}
+
+// Reorder moves the product's images in a transaction that holds a lock on the product, so
+// no image is added or deleted while they're moved. Positions only have to be unique when
+// the transaction commits, so images can swap places.
+func (r *sqlProductImageRepository) Reorder(ctx context.Context, productID string, positions map[string]int) ([]*models.ProductImage, error) {
+	var images []*models.ProductImage
+	err := database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := lockProduct(ctx, tx, productID); err != nil {
+			return err
+		}
+		var err error
+		if images, err = listProductImages(ctx, tx, productID); err != nil {
+			return err
+		}
+		if len(images) != len(positions) {
+			return models.ErrImagesMismatch
+		}
+		for _, image := range images {
+			if _, ok := positions[image.ID]; !ok {
+				return models.ErrImagesMismatch
+			}
+		}
+		for _, image := range images {
+			position := positions[image.ID]
+			if position == image.Position {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE product_images SET position = $2 WHERE id = $1`, image.ID, position); err != nil {
+				return err
+			}
+			image.Position = position
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(images, func(a, b *models.ProductImage) int { return a.Position - b.Position })
+	return images, nil
+}
+
+// Delete removes an image and closes the gap it leaves, holding a lock on its product so
+// the positions can't change in between.
+func (r *sqlProductImageRepository) Delete(ctx context.Context, id string) error {
+	return database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var productID string
+		err := tx.QueryRowContext(ctx, `SELECT product_id FROM product_images WHERE id = $1`, id).Scan(&productID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := lockProduct(ctx, tx, productID); err != nil {
+			return err
+		}
+
+		// The image may have been deleted while waiting for the lock.
+		var position int
+		err = tx.QueryRowContext(ctx, `DELETE FROM product_images WHERE id = $1 RETURNING position`, id).Scan(&position)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`UPDATE product_images SET position = position - 1 WHERE product_id = $1 AND position > $2`,
+			productID, position,
+		)
+		return err
+	})
+}
+
+// lockProduct locks a product's row until the transaction ends. Adding an image takes a
+// share lock on the row for its foreign key, so this also blocks images being added.
+func lockProduct(ctx context.Context, tx *sql.Tx, id string) error {
+	var locked string
+	err := tx.QueryRowContext(ctx, `SELECT id FROM products WHERE id = $1 FOR UPDATE`, id).Scan(&locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrNotFound
+	}
+	return err
+}
+
+// listProductImages returns a product's images ordered by position.
+func listProductImages(ctx context.Context, q queryer, productID string) ([]*models.ProductImage, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT `+productImageColumns+` FROM product_images WHERE product_id = $1 ORDER BY position`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*models.ProductImage{}
+	for rows.Next() {
+		image, err := scanProductImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// scanProductImage scans a row selected with productImageColumns.
+func scanProductImage(row scanner) (*models.ProductImage, error) {
+	var image models.ProductImage
+	if err := row.Scan(&image.ID, &image.ProductID, &image.URL, &image.Position); err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+var productImageRowColumns = []string{"id", "product_id", "url", "position"}
+
+func TestProductImageRepositoryAdd(t *testing.T) {
+	t.Run("appends after the last image", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewProductImageRepository(db)
+
+		mock.ExpectQuery(`INSERT INTO product_images \(product_id, url, position\)\s+SELECT \$1, \$2, COALESCE\(MAX\(position\) \+ 1, 0\) FROM product_images WHERE product_id = \$1\s+RETURNING id, position`).
+			WithArgs("7", "https://cdn.example.com/a.png").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "position"}).AddRow("3", 2))
+
+		image := &models.ProductImage{ProductID: "7", URL: "https://cdn.example.com/a.png"}
+		if err := repo.Add(context.Background(), image); err != nil {
+			t.Fatalf("Add returned error: %v", err)
+		}
+		if image.ID != "3" || image.Position != 2 {
+			t.Fatalf("expected ID and Position from the database, got %+v", image)
+		}
+	})
+
+	for _, tc := range []struct {
+		code string
+		want error
+	}{
+		{pqForeignKeyViolation, models.ErrNotFound},
+		{pqUniqueViolation, models.ErrConcurrentModification},
+	} {
+		t.Run(tc.code, func(t *testing.T) {
+			db, mock := newMock(t)
+			repo := NewProductImageRepository(db)
+
+			mock.ExpectQuery(`INSERT INTO product_images`).WillReturnError(&pq.Error{Code: pq.ErrorCode(tc.code)})
+
+			err := repo.Add(context.Background(), &models.ProductImage{ProductID: "7", URL: "https://cdn.example.com/a.png"})
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestProductImageRepositoryListByProducts(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewProductImageRepository(db)
+
+	mock.ExpectQuery(`SELECT id, product_id, url, position FROM product_images WHERE product_id = ANY\(\$1\) ORDER BY product_id, position`).
+		WithArgs(pq.Array([]string{"7", "8", "9"})).
+		WillReturnRows(sqlmock.NewRows(productImageRowColumns).
+			AddRow("1", "7", "https://cdn.example.com/a.png", 0).
+			AddRow("3", "7", "https://cdn.example.com/c.png", 1).
+			AddRow("2", "8", "https://cdn.example.com/b.png", 0))
+
+	images, err := repo.ListByProducts(context.Background(), []string{"7", "8", "9"})
+	if err != nil {
+		t.Fatalf("ListByProducts returned error: %v", err)
+	}
+	if len(images) != 2 || len(images["7"]) != 2 || images["7"][1].ID != "3" || len(images["8"]) != 1 {
+		t.Fatalf("unexpected images: %v", images)
+	}
+	if _, ok := images["9"]; ok {
+		t.Fatal("expected a product without images to be left out")
+	}
+}
+
+func TestProductImageRepositoryReorder(t *testing.T) {
+	imageRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(productImageRowColumns).
+			AddRow("1", "7", "https://cdn.example.com/a.png", 0).
+			AddRow("2", "7", "https://cdn.example.com/b.png", 1).
+			AddRow("3", "7", "https://cdn.example.com/c.png", 2)
+	}
+
+	t.Run("moves the images", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewProductImageRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id FROM products WHERE id = \$1 FOR UPDATE`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7"))
+		mock.ExpectQuery(`SELECT id, product_id, url, position FROM product_images WHERE product_id = \$1 ORDER BY position`).WithArgs("7").
+			WillReturnRows(imageRows())
+		mock.ExpectExec(`UPDATE product_images SET position = \$2 WHERE id = \$1`).WithArgs("1", 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE product_images SET position = \$2 WHERE id = \$1`).WithArgs("3", 0).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		images, err := repo.Reorder(context.Background(), "7", map[string]int{"1": 2, "2": 1, "3": 0})
+		if err != nil {
+			t.Fatalf("Reorder returned error: %v", err)
+		}
+		var ids []string
+		for i, image := range images {
+			if image.Position != i {
+				t.Fatalf("expected image %d at position %d, got %d", i, i, image.Position)
+			}
+			ids = append(ids, image.ID)
+		}
+		if len(ids) != 3 || ids[0] != "3" || ids[1] != "2" || ids[2] != "1" {
+			t.Fatalf("expected images in the new order, got %v", ids)
+		}
+	})
+
+	for name, positions := range map[string]map[string]int{
+		"missing an image": {"1": 1, "2": 0},
+		"unknown image":    {"1": 2, "2": 1, "4": 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			db, mock := newMock(t)
+			repo := NewProductImageRepository(db)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT id FROM products WHERE id = \$1 FOR UPDATE`).WithArgs("7").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7"))
+			mock.ExpectQuery(`FROM product_images WHERE product_id = \$1`).WithArgs("7").WillReturnRows(imageRows())
+			mock.ExpectRollback()
+
+			if _, err := repo.Reorder(context.Background(), "7", positions); !errors.Is(err, models.ErrImagesMismatch) {
+				t.Fatalf("expected ErrImagesMismatch, got %v", err)
+			}
+		})
+	}
+
+	t.Run("unknown product", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewProductImageRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id FROM products WHERE id = \$1 FOR UPDATE`).WithArgs("404").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		if _, err := repo.Reorder(context.Background(), "404", map[string]int{}); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestProductImageRepositoryDelete(t *testing.T) {
+	t.Run("closes the gap", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewProductImageRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT product_id FROM product_images WHERE id = \$1`).WithArgs("2").
+			WillReturnRows(sqlmock.NewRows([]string{"product_id"}).AddRow("7"))
+		mock.ExpectQuery(`SELECT id FROM products WHERE id = \$1 FOR UPDATE`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7"))
+		mock.ExpectQuery(`DELETE FROM product_images WHERE id = \$1 RETURNING position`).WithArgs("2").
+			WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(1))
+		mock.ExpectExec(`UPDATE product_images SET position = position - 1 WHERE product_id = \$1 AND position > \$2`).WithArgs("7", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := repo.Delete(context.Background(), "2"); err != nil {
+			t.Fatalf("Delete returned error: %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewProductImageRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT product_id FROM product_images WHERE id = \$1`).WithArgs("404").
+			WillReturnRows(sqlmock.NewRows([]string{"product_id"}))
+		mock.ExpectRollback()
+
+		if err := repo.Delete(context.Background(), "404"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,454 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+var productRows = []string{"id", "name", "description", "price_cents", "currency", "sku", "stock_qty", "created_at", "category_id", "max_per_order", "max_per_customer"}
+
+// productPageRows are the columns of a page of products, counted with count(*) OVER ().
+var productPageRows = slices.Concat(productRows, []string{"count"})
+
+func TestProductRepositoryList(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewProductRepository(db)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("rows", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, name, description, price_cents, currency, sku, stock_qty, created_at, category_id, max_per_order, max_per_customer, count\(\*\) OVER \(\) FROM products ORDER BY created_at, id LIMIT \$1 OFFSET \$2`).
+			WithArgs(3, 10).
+			WillReturnRows(sqlmock.NewRows(productPageRows).
+				AddRow("1", "Tote bag", "Canvas, 15L", int64(1999), "USD", "TOTE-1", 12, created, nil, nil, nil, 15).
+				AddRow("2", "Water bottle", nil, int64(2450), "USD", "BOTTLE-1", 0, created, nil, nil, nil, 15).
+				AddRow("3", "Mug", "Ceramic", int64(899), "EUR", "MUG-1", 40, created, nil, nil, nil, 15))
+
+		page, err := repo.List(context.Background(), "", models.PageArgs{Limit: 3, Offset: 10})
+		if err != nil {
+			t.Fatalf("List returned error: %v", err)
+		}
+		products := page.Items
+		if len(products) != 3 || page.Total != 15 {
+			t.Fatalf("expected 3 of 15 products, got %d of %d", len(products), page.Total)
+		}
+		if p := products[0]; p.ID != "1" || p.Name != "Tote bag" || p.PriceCents != 1999 || p.Currency != "USD" || p.SKU != "TOTE-1" || p.StockQty != 12 || !p.CreatedAt.Equal(created) {
+			t.Fatalf("unexpected first product: %+v", p)
+		}
+		if products[1].Description != "" || products[1].PriceCents != 2450 {
+			t.Fatalf("unexpected second product: %+v", products[1])
+		}
+		if products[2].Currency != "EUR" {
+			t.Fatalf("unexpected third product: %+v", products[2])
+		}
+	})
+
+	t.Run("newest first", func(t *testing.T) {
+		mock.ExpectQuery(`FROM products ORDER BY created_at DESC, id DESC LIMIT \$1 OFFSET \$2`).
+			WithArgs(20, 0).
+			WillReturnRows(sqlmock.NewRows(productPageRows))
+
+		if _, err := repo.List(context.Background(), models.ProductSortNewest, models.PageArgs{Limit: 20}); err != nil {
+			t.Fatalf("List returned error: %v", err)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		mock.ExpectQuery(`FROM products`).WithArgs(20, 0).WillReturnRows(sqlmock.NewRows(productPageRows))
+
+		page, err := repo.List(context.Background(), "", models.PageArgs{Limit: 20})
+		if err != nil || page.Items == nil || len(page.Items) != 0 || page.Total != 0 {
+			t.Fatalf("expected an empty non-nil page, got (%+v, %v)", page, err)
+		}
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		dbErr := errors.New("connection reset")
+		mock.ExpectQuery(`FROM products`).WillReturnError(dbErr)
+
+		if _, err := repo.List(context.Background(), "", models.PageArgs{Limit: 20}); !errors.Is(err, dbErr) {
+			t.Fatalf("expected %v, got %v", dbErr, err)
+		}
+	})
+}
+
+func TestProductRepositoryListByCategory(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewProductRepository(db)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`WITH RECURSIVE tree AS \(\s*SELECT id FROM categories WHERE slug = \$1\s+UNION\s+SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id\s*\)\s*SELECT .* FROM products WHERE category_id IN \(SELECT id FROM tree\)\s+ORDER BY created_at, id LIMIT \$2 OFFSET \$3`).
+		WithArgs("bags", 20, 0).
+		WillReturnRows(sqlmock.NewRows(productPageRows).AddRow("1", "Tote bag", "Canvas, 15L", int64(1999), "USD", "TOTE-1", 12, created, "4", nil, nil, 1))
+
+	page, err := repo.ListByCategory(context.Background(), "bags", models.ProductSortOldest, models.PageArgs{Limit: 20})
+	if err != nil {
+		t.Fatalf("ListByCategory returned error: %v", err)
+	}
+	if products := page.Items; len(products) != 1 || products[0].CategoryID == nil || *products[0].CategoryID != "4" || page.Total != 1 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+}
+
+func TestProductRepositoryListAfter(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewProductRepository(db)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("first page", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, name, description, price_cents, currency, sku, stock_qty, created_at, category_id, max_per_order, max_per_customer FROM products ORDER BY created_at, id LIMIT \$1`).
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(productRows).AddRow("1", "Tote bag", nil, int64(1999), "USD", "TOTE-1", 12, created, nil, nil, nil))
+
+		products, err := repo.ListAfter(context.Background(), "", "", nil, 3)
+		if err != nil {
+			t.Fatalf("ListAfter returned error: %v", err)
+		}
+		if len(products) != 1 || products[0].ID != "1" {
+			t.Fatalf("unexpected products: %+v", products)
+		}
+	})
+
+	t.Run("after cursor", func(t *testing.T) {
+		mock.ExpectQuery(`FROM products WHERE \(created_at, id\) > \(\$1, \$2\) ORDER BY created_at, id LIMIT \$3`).
+			WithArgs(created, "1", 3).
+			WillReturnRows(sqlmock.NewRows(productRows).AddRow("2", "Mug", "Ceramic", int64(899), "EUR", "MUG-1", 40, created, nil, nil, nil))
+
+		products, err := repo.ListAfter(context.Background(), "", "", &models.ProductCursor{CreatedAt: created, ID: "1"}, 3)
+		if err != nil {
+			t.Fatalf("ListAfter returned error: %v", err)
+		}
+		if len(products) != 1 || products[0].ID != "2" {
+			t.Fatalf("unexpected products: %+v", products)
+		}
+	})
+
+	t.Run("by price descending", func(t *testing.T) {
+		mock.ExpectQuery(`FROM products WHERE \(price_cents, id\) < \(\$1, \$2\) ORDER BY price_cents DESC, id DESC LIMIT \$3`).
+			WithArgs(int64(1999), "1", 3).
+			WillReturnRows(sqlmock.NewRows(productRows).AddRow("2", "Mug", "Ceramic", int64(899), "EUR", "MUG-1", 40, created, nil, nil, nil))
+
+		products, err := repo.ListAfter(context.Background(), "", models.ProductSortPriceDesc, &models.ProductCursor{PriceCents: 1999, ID: "1"}, 3)
+		if err != nil {
+			t.Fatalf("ListAfter returned error: %v", err)
+		}
+		if len(products) != 1 || products[0].ID != "2" {
+			t.Fatalf("unexpected products: %+v", products)
+		}
+	})
+
+	t.Run("in a category", func(t *testing.T) {
+		mock.ExpectQuery(`WITH RECURSIVE tree AS \(\s*SELECT id FROM categories WHERE slug = \$1\s+UNION\s+SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id\s*\)\s*SELECT .* FROM products WHERE category_id IN \(SELECT id FROM tree\) AND \(created_at, id\) > \(\$2, \$3\) ORDER BY created_at, id LIMIT \$4`).
+			WithArgs("bags", created, "1", 3).
+			WillReturnRows(sqlmock.NewRows(productRows).AddRow("3", "Backpack", nil, int64(4999), "USD", "PACK-1", 5, created, "4", nil, nil))
+
+		products, err := repo.ListAfter(context.Background(), "bags", models.ProductSortOldest, &models.ProductCursor{CreatedAt: created, ID: "1"}, 3)
+		if err != nil {
+			t.Fatalf("ListAfter returned error: %v", err)
+		}
+		if len(products) != 1 || products[0].ID != "3" {
+			t.Fatalf("unexpected products: %+v", products)
+		}
+	})
+}
+
+func TestProductRepositorySearch(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewProductRepository(db)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("multi-word", func(t *testing.T) {
+		mock.ExpectQuery(`FROM products, plainto_tsquery\('english', \$1\) AS q\s+WHERE search_vector @@ q\s+ORDER BY ts_rank\(search_vector, q\) DESC, created_at, id LIMIT \$2 OFFSET \$3`).
+			WithArgs("Canvas tote", 20, 0).
+			WillReturnRows(sqlmock.NewRows(productPageRows).AddRow("1", "Tote bag", "Canvas, 15L", int64(1999), "USD", "TOTE-1", 12, created, nil, nil, nil, 1))
+
+		page, err := repo.Search(context.Background(), "  Canvas   tote ", models.PageArgs{Limit: 20})
+		if err != nil {
+			t.Fatalf("Search returned error: %v", err)
+		}
+		if len(page.Items) != 1 || page.Items[0].ID != "1" || page.Total != 1 {
+			t.Fatalf("unexpected page: %+v", page)
+		}
+	})
+
+	t.Run("special characters", func(t *testing.T) {
+		mock.ExpectQuery(`plainto_tsquery`).
+			WithArgs("tote bag 100 café", 20, 0).
+			WillReturnRows(sqlmock.NewRows(productPageRows))
+
+		if _, err := repo.Search(context.Background(), `tote & !bag | (100%_:*) 'café'`, models.PageArgs{Limit: 20}); err != nil {
+			t.Fatalf("Search returned error: %v", err)
+		}
+	})
+
+	t.Run("no words", func(t *testing.T) {
+		page, err := repo.Search(context.Background(), "&|!():*", models.PageArgs{Limit: 20})
+		if err != nil || page.Items == nil || len(page.Items) != 0 {
+			t.Fatalf("expected an empty non-nil page, got (%+v, %v)", page, err)
+		}
+	})
+
+	t.Run("substring fallback", func(t *testing.T) {
+		mock.ExpectQuery(`plainto_tsquery`).
+			WillReturnError(&pq.Error{Code: "42703", Message: `column "search_vector" does not exist`})
+		mock.ExpectQuery(`FROM products WHERE \(name ILIKE \$1 OR description ILIKE \$1\) AND \(name ILIKE \$2 OR description ILIKE \$2\) ORDER BY created_at, id LIMIT \$3 OFFSET \$4`).
+			WithArgs("%canvas%", "%tote%", 5, 10).
+			WillReturnRows(sqlmock.NewRows(productPageRows).AddRow("1", "Tote bag", "Canvas, 15L", int64(1999), "USD", "TOTE-1", 12, created, nil, nil, nil, 11))
+
+		page, err := repo.Search(context.Background(), "canvas tote", models.PageArgs{Limit: 5, Offset: 10})
+		if err != nil {
+			t.Fatalf("Search returned error: %v", err)
+		}
+		if len(page.Items) != 1 || page.Items[0].ID != "1" || page.Total != 11 {
+			t.Fatalf("unexpected page: %+v", page)
+		}
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		dbErr := errors.New("connection reset")
+		mock.ExpectQuery(`plainto_tsquery`).WillReturnError(dbErr)
+
+		if _, err := repo.Search(context.Background(), "mug", models.PageArgs{Limit: 20}); !errors.Is(err, dbErr) {
+			t.Fatalf("expected %v, got %v", dbErr, err)
+		}
+	})
+}
+
+// expectAdjustStock expects adjustStock to read a product's stock and version and then try
+// to store newStock, with the update matching the given number of rows.
+func expectAdjustStock(mock sqlmock.Sqlmock, productID string, stock, version, newStock int, matched int64) {
+	mock.ExpectQuery(`SELECT stock_qty, version FROM products WHERE id = \$1`).WithArgs(productID).
+		WillReturnRows(sqlmock.NewRows([]string{"stock_qty", "version"}).AddRow(stock, version))
+	mock.ExpectExec(`UPDATE products SET stock_qty = \$3, version = version \+ 1 WHERE id = \$1 AND version = \$2`).
+		WithArgs(productID, version, newStock).
+		WillReturnResult(sqlmock.NewResult(0, matched))
+}
+
+// decrementStock runs adjustStock in its own transaction.
+func decrementStock(db *sql.DB, productID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := adjustStock(context.Background(), tx, productID, -1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func TestProductRepositoryFrequentlyBoughtTogether(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewProductRepository(db)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT id, name, description, price_cents, currency, sku, stock_qty, created_at, category_id, max_per_order, max_per_customer FROM products JOIN \(\s*`+
+		`SELECT b.product_id, count\(DISTINCT b.order_id\) AS shared FROM order_items a\s+`+
+		`JOIN orders o ON o.id = a.order_id\s+`+
+		`JOIN order_items b ON b.order_id = a.order_id AND b.product_id <> a.product_id\s+`+
+		`WHERE a.product_id = \$1 AND o.status = \$2\s+GROUP BY b.product_id\s+`+
+		`\) together ON together.product_id = products.id\s+`+
+		`WHERE stock_qty > 0 ORDER BY together.shared DESC, id LIMIT \$3`).
+		WithArgs("7", models.OrderStatusDelivered, 5).
+		WillReturnRows(sqlmock.NewRows(productRows).
+			AddRow("9", "Coaster", nil, int64(299), "USD", "COASTER-1", 80, created, nil, nil, nil).
+			AddRow("8", "Tea", nil, int64(1299), "USD", "TEA-1", 4, created, nil, nil, nil))
+
+	products, err := repo.FrequentlyBoughtTogether(context.Background(), "7", 5)
+	if err != nil {
+		t.Fatalf("FrequentlyBoughtTogether returned error: %v", err)
+	}
+	if len(products) != 2 || products[0].ID != "9" || products[1].ID != "8" {
+		t.Fatalf("unexpected products: %+v", products)
+	}
+}
+
+func TestAdjustStock(t *testing.T) {
+	// Two checkouts read the product at the same version and race to take one unit each.
+	// The first to update wins; the second matches no row, re-reads and tries again.
+	t.Run("one unit, one winner", func(t *testing.T) {
+		db, mock := newMock(t)
+
+		mock.ExpectBegin()
+		expectAdjustStock(mock, "7", 1, 4, 0, 1)
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		expectAdjustStock(mock, "7", 1, 4, 0, 0)
+		mock.ExpectQuery(`SELECT stock_qty, version FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"stock_qty", "version"}).AddRow(0, 5))
+		mock.ExpectRollback()
+
+		if err := decrementStock(db, "7"); err != nil {
+			t.Fatalf("first decrement returned error: %v", err)
+		}
+		if err := decrementStock(db, "7"); !errors.Is(err, models.ErrInsufficientStock) {
+			t.Fatalf("expected the second decrement to find the stock gone, got %v", err)
+		}
+	})
+
+	t.Run("two units, two winners", func(t *testing.T) {
+		db, mock := newMock(t)
+
+		mock.ExpectBegin()
+		expectAdjustStock(mock, "7", 2, 4, 1, 1)
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		expectAdjustStock(mock, "7", 2, 4, 1, 0)
+		expectAdjustStock(mock, "7", 1, 5, 0, 1)
+		mock.ExpectCommit()
+
+		for i := range 2 {
+			if err := decrementStock(db, "7"); err != nil {
+				t.Fatalf("decrement %d returned error: %v", i+1, err)
+			}
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		db, mock := newMock(t)
+
+		mock.ExpectBegin()
+		for v := range maxStockRetries {
+			expectAdjustStock(mock, "7", 5, v, 4, 0)
+		}
+		mock.ExpectRollback()
+
+		if err := decrementStock(db, "7"); !errors.Is(err, models.ErrConcurrentModification) {
+			t.Fatalf("expected ErrConcurrentModification, got %v", err)
+		}
+	})
+}
+
+func TestProductRepositoryGetByID(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewProductRepository(db)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, name, description, price_cents, currency, sku, stock_qty, created_at, category_id, max_per_order, max_per_customer FROM products WHERE id = \$1`).
+			WithArgs("7").
+			WillReturnRows(sqlmock.NewRows(productRows).AddRow("7", "Mug", "Ceramic", int64(899), "EUR", "MUG-1", 40, created, nil, 2, nil))
+
+		product, err := repo.GetByID(context.Background(), "7")
+		if err != nil {
+			t.Fatalf("GetByID returned error: %v", err)
+		}
+		if product.ID != "7" || product.Name != "Mug" || product.PriceCents != 899 || product.StockQty != 40 {
+			t.Fatalf("unexpected product: %+v", product)
+		}
+		if product.MaxPerOrder == nil || *product.MaxPerOrder != 2 || product.MaxPerCustomer != nil {
+			t.Fatalf("expected a per-order limit of 2 only, got %v and %v", product.MaxPerOrder, product.MaxPerCustomer)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectQuery(`FROM products WHERE id = \$1`).WithArgs("8").WillReturnRows(sqlmock.NewRows(productRows))
+
+		if _, err := repo.GetByID(context.Background(), "8"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := repo.GetByID(ctx, "7"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestProductRepositoryCreate(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewProductRepository(db)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("inserted", func(t *testing.T) {
+		maxPerOrder := 2
+		mock.ExpectQuery(`INSERT INTO products \(name, description, price_cents, currency, sku, stock_qty, max_per_order, max_per_customer\)`).
+			WithArgs("Mug", sql.NullString{String: "Ceramic", Valid: true}, int64(899), "EUR", "MUG-1", 40, 2, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("7", created))
+
+		product := &models.Product{Name: "Mug", Description: "Ceramic", PriceCents: 899, Currency: "EUR", SKU: "MUG-1", StockQty: 40, MaxPerOrder: &maxPerOrder}
+		if err := repo.Create(context.Background(), product); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		if product.ID != "7" || !product.CreatedAt.Equal(created) {
+			t.Fatalf("expected generated ID and timestamp, got %+v", product)
+		}
+	})
+
+	t.Run("duplicate SKU", func(t *testing.T) {
+		mock.ExpectQuery(`INSERT INTO products`).
+			WillReturnError(&pq.Error{Code: "23505", Constraint: "products_sku_key"})
+
+		product := &models.Product{Name: "Mug", PriceCents: 899, Currency: "EUR", SKU: "MUG-1"}
+		if err := repo.Create(context.Background(), product); !errors.Is(err, models.ErrDuplicateSKU) {
+			t.Fatalf("expected ErrDuplicateSKU, got %v", err)
+		}
+	})
+}
+
+func TestProductRepositoryImport(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("skips duplicate SKUs", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewProductRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO products \(name, description, price_cents, currency, sku, stock_qty\)\s+SELECT name, NULLIF\(description, ''\), price_cents, currency, sku, stock_qty\s+FROM unnest\(.*\)\s+AS p .*\s+ON CONFLICT \(sku\) DO NOTHING RETURNING sku, id, created_at`).
+			WithArgs(
+				pq.Array([]string{"Mug", "Tote bag"}), pq.Array([]string{"Ceramic", ""}), pq.Array([]int64{899, 1999}),
+				pq.Array([]string{"EUR", "USD"}), pq.Array([]string{"MUG-1", "TOTE-1"}), pq.Array([]int64{40, 0}),
+			).
+			WillReturnRows(sqlmock.NewRows([]string{"sku", "id", "created_at"}).AddRow("TOTE-1", "8", created))
+		mock.ExpectCommit()
+
+		mug := &models.Product{Name: "Mug", Description: "Ceramic", PriceCents: 899, Currency: "EUR", SKU: "MUG-1", StockQty: 40}
+		tote := &models.Product{Name: "Tote bag", PriceCents: 1999, Currency: "USD", SKU: "TOTE-1"}
+		duplicates, err := repo.Import(context.Background(), []*models.Product{mug, tote})
+		if err != nil {
+			t.Fatalf("Import returned error: %v", err)
+		}
+		if len(duplicates) != 1 || duplicates[0] != mug || mug.ID != "" {
+			t.Fatalf("expected the mug to be skipped, got %v", duplicates)
+		}
+		if tote.ID != "8" || !tote.CreatedAt.Equal(created) {
+			t.Fatalf("expected generated ID and timestamp, got %+v", tote)
+		}
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewProductRepository(db)
+
+		products := make([]*models.Product, importBatchSize+1)
+		for i := range products {
+			products[i] = &models.Product{Name: "Mug", PriceCents: 899, Currency: "EUR", SKU: fmt.Sprintf("MUG-%d", i)}
+		}
+		mock.ExpectBegin()
+		first := sqlmock.NewRows([]string{"sku", "id", "created_at"})
+		for i, p := range products[:importBatchSize] {
+			first.AddRow(p.SKU, strconv.Itoa(i+1), created)
+		}
+		mock.ExpectQuery(`INSERT INTO products`).WillReturnRows(first)
+		mock.ExpectQuery(`INSERT INTO products`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		if _, err := repo.Import(context.Background(), products); err == nil {
+			t.Fatal("expected the failed second batch to fail the import")
+		}
+	})
+}
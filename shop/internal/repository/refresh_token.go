@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/database"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// sqlRefreshTokenRepository is a models.RefreshTokenRepository backed by the refresh_tokens
+// table.
+type sqlRefreshTokenRepository struct {
+	db *sql.DB
+}
+
+// NewRefreshTokenRepository creates a RefreshTokenRepository backed by db.
+func NewRefreshTokenRepository(db *sql.DB) models.RefreshTokenRepository {
+	return &sqlRefreshTokenRepository{db: db}
+}
+
+// Create inserts token with no family_id, which makes it the first of its family.
+func (r *sqlRefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		token.UserID, token.TokenHash, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return err
+	}
+	token.FamilyID = token.ID
+	return nil
+}
+
+// Rotate swaps the token for next in a transaction that locks the used token's row, so two
+// concurrent refreshes with the same token can't both succeed: the second sees the token
+// revoked and revokes the family. That revocation is committed even though Rotate fails.
+func (r *sqlRefreshTokenRepository) Rotate(ctx context.Context, hash string, next *models.RefreshToken, now time.Time) error {
+	var revoked bool
+	err := database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var (
+			id        string
+			familyID  string
+			expiresAt time.Time
+			revokedAt sql.NullTime
+		)
+		err := tx.QueryRowContext(ctx,
+			`SELECT id, user_id, COALESCE(family_id, id), expires_at, revoked_at FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`,
+			hash,
+		).Scan(&id, &next.UserID, &familyID, &expiresAt, &revokedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if revokedAt.Valid {
+			revoked = true
+			_, err := tx.ExecContext(ctx,
+				`UPDATE refresh_tokens SET revoked_at = $2 WHERE (id = $1 OR family_id = $1) AND revoked_at IS NULL`,
+				familyID, now,
+			)
+			return err
+		}
+		if !now.Before(expiresAt) {
+			return models.ErrRefreshTokenExpired
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = $2 WHERE id = $1`, id, now); err != nil {
+			return err
+		}
+		next.FamilyID = familyID
+		return tx.QueryRowContext(ctx,
+			`INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+			next.UserID, next.TokenHash, familyID, next.ExpiresAt,
+		).Scan(&next.ID, &next.CreatedAt)
+	})
+	if err == nil && revoked {
+		return models.ErrRefreshTokenRevoked
+	}
+	return err
+}
+
+// Revoke revokes the token's family in one statement. Tokens that were already revoked keep
+// the time they were revoked at.
+func (r *sqlRefreshTokenRepository) Revoke(ctx context.Context, hash string, now time.Time) error {
+	var familyID string
+	err := r.db.QueryRowContext(ctx,
+		`WITH family AS (
+			SELECT COALESCE(family_id, id) AS id FROM refresh_tokens WHERE token_hash = $1
+		), revoked AS (
+			UPDATE refresh_tokens SET revoked_at = $2
+			WHERE (id IN (SELECT id FROM family) OR family_id IN (SELECT id FROM family)) AND revoked_at IS NULL
+		)
+		SELECT id FROM family`,
+		hash, now,
+	).Scan(&familyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrNotFound
+	}
+	return err
+}
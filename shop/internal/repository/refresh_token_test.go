@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+var refreshTokenRows = []string{"id", "user_id", "family_id", "expires_at", "revoked_at"}
+
+func TestRefreshTokenRepositoryCreate(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewRefreshTokenRepository(db)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expires := now.Add(30 * 24 * time.Hour)
+
+	mock.ExpectQuery(`INSERT INTO refresh_tokens \(user_id, token_hash, expires_at\) VALUES \(\$1, \$2, \$3\) RETURNING id, created_at`).
+		WithArgs("42", "hash", expires).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("5", now))
+
+	token := &models.RefreshToken{UserID: "42", TokenHash: "hash", ExpiresAt: expires}
+	if err := repo.Create(context.Background(), token); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if token.ID != "5" || token.FamilyID != "5" || !token.CreatedAt.Equal(now) {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+}
+
+func TestRefreshTokenRepositoryRotate(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	selectToken := `SELECT id, user_id, COALESCE\(family_id, id\), expires_at, revoked_at FROM refresh_tokens WHERE token_hash = \$1 FOR UPDATE`
+
+	t.Run("rotates", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewRefreshTokenRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectToken).WithArgs("old").
+			WillReturnRows(sqlmock.NewRows(refreshTokenRows).AddRow("6", "42", "5", expires, nil))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = \$2 WHERE id = \$1`).WithArgs("6", now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO refresh_tokens \(user_id, token_hash, family_id, expires_at\) VALUES \(\$1, \$2, \$3, \$4\) RETURNING id, created_at`).
+			WithArgs("42", "new", "5", expires.Add(time.Hour)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("7", now))
+		mock.ExpectCommit()
+
+		next := &models.RefreshToken{TokenHash: "new", ExpiresAt: expires.Add(time.Hour)}
+		if err := repo.Rotate(context.Background(), "old", next, now); err != nil {
+			t.Fatalf("Rotate returned error: %v", err)
+		}
+		if next.ID != "7" || next.UserID != "42" || next.FamilyID != "5" {
+			t.Fatalf("unexpected token: %+v", next)
+		}
+	})
+
+	t.Run("reused token revokes its family", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewRefreshTokenRepository(db)
+
+		// The revocation is committed, so the stolen token's successor stops working too.
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectToken).WithArgs("old").
+			WillReturnRows(sqlmock.NewRows(refreshTokenRows).AddRow("6", "42", "5", expires, now.Add(-time.Minute)))
+		mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = \$2 WHERE \(id = \$1 OR family_id = \$1\) AND revoked_at IS NULL`).
+			WithArgs("5", now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.Rotate(context.Background(), "old", &models.RefreshToken{TokenHash: "new", ExpiresAt: expires}, now)
+		if !errors.Is(err, models.ErrRefreshTokenRevoked) {
+			t.Fatalf("expected ErrRefreshTokenRevoked, got %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewRefreshTokenRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectToken).WithArgs("old").
+			WillReturnRows(sqlmock.NewRows(refreshTokenRows).AddRow("6", "42", "5", now, nil))
+		mock.ExpectRollback()
+
+		err := repo.Rotate(context.Background(), "old", &models.RefreshToken{TokenHash: "new", ExpiresAt: expires}, now)
+		if !errors.Is(err, models.ErrRefreshTokenExpired) {
+			t.Fatalf("expected ErrRefreshTokenExpired, got %v", err)
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewRefreshTokenRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectToken).WithArgs("old").WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		err := repo.Rotate(context.Background(), "old", &models.RefreshToken{TokenHash: "new", ExpiresAt: expires}, now)
+		if !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestRefreshTokenRepositoryRevoke(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	revoke := `WITH family AS \(\s*SELECT COALESCE\(family_id, id\) AS id FROM refresh_tokens WHERE token_hash = \$1\s*\), revoked AS \(\s*UPDATE refresh_tokens SET revoked_at = \$2\s+WHERE \(id IN \(SELECT id FROM family\) OR family_id IN \(SELECT id FROM family\)\) AND revoked_at IS NULL\s*\)\s*SELECT id FROM family`
+
+	t.Run("revokes", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewRefreshTokenRepository(db)
+
+		mock.ExpectQuery(revoke).WithArgs("hash", now).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("5"))
+
+		if err := repo.Revoke(context.Background(), "hash", now); err != nil {
+			t.Fatalf("Revoke returned error: %v", err)
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewRefreshTokenRepository(db)
+
+		mock.ExpectQuery(revoke).WithArgs("hash", now).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		if err := repo.Revoke(context.Background(), "hash", now); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// sqlReservationRepository is a models.ReservationRepository backed by the reservations table.
+type sqlReservationRepository struct {
+	db *sql.DB
+}
+
+// NewReservationRepository creates a ReservationRepository backed by db.
+func NewReservationRepository(db *sql.DB) models.ReservationRepository {
+	return &sqlReservationRepository{db: db}
+}
+
+// Reserve takes qty of a product out of stock for the user in a transaction. Only the
+// difference from the user's existing reservation, if any, is taken or given back. The
+// product's purchase limits apply as they do in the cart, so limited stock can't be held by
+// reserving more of it than the user may buy.
+func (r *sqlReservationRepository) Reserve(ctx context.Context, userID, productID string, qty int, expiresAt time.Time) (*models.Reservation, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the product makes concurrent reservations of it by the same user queue up, so
+	// the one that comes second sees the quantity the first one reserved.
+	var limits purchaseLimits
+	err = tx.QueryRowContext(ctx,
+		`SELECT max_per_order, max_per_customer FROM products WHERE id = $1 FOR UPDATE`, productID,
+	).Scan(&limits.maxPerOrder, &limits.maxPerCustomer)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPurchaseLimits(ctx, tx, userID, productID, qty, limits); err != nil {
+		return nil, err
+	}
+
+	var held int
+	err = tx.QueryRowContext(ctx,
+		`SELECT qty FROM reservations WHERE user_id = $1 AND product_id = $2 FOR UPDATE`,
+		userID, productID,
+	).Scan(&held)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if qty != held {
+		if err := adjustStock(ctx, tx, productID, held-qty); err != nil {
+			return nil, err
+		}
+	}
+
+	reservation := &models.Reservation{UserID: userID, ProductID: productID, Qty: qty}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO reservations (user_id, product_id, qty, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, product_id) DO UPDATE SET qty = EXCLUDED.qty, expires_at = EXCLUDED.expires_at
+		RETURNING expires_at`,
+		userID, productID, qty, expiresAt,
+	).Scan(&reservation.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return reservation, tx.Commit()
+}
+
+// ReleaseExpired deletes the expired reservations and adds their quantities back to stock in
+// one statement, so stock is never returned for a reservation that checkout claimed.
+func (r *sqlReservationRepository) ReleaseExpired(ctx context.Context, now time.Time) (int, error) {
+	var released int
+	err := r.db.QueryRowContext(ctx,
+		`WITH expired AS (
+			DELETE FROM reservations WHERE expires_at <= $1 RETURNING product_id, qty
+		), restocked AS (
+			UPDATE products SET stock_qty = stock_qty + e.qty, version = version + 1
+			FROM (SELECT product_id, sum(qty) AS qty FROM expired GROUP BY product_id) e
+			WHERE products.id = e.product_id
+		)
+		SELECT count(*) FROM expired`,
+		now,
+	).Scan(&released)
+	return released, err
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestReservationRepositoryReserve(t *testing.T) {
+	expires := time.Date(2024, 1, 2, 3, 19, 5, 0, time.UTC)
+
+	t.Run("new reservation", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewReservationRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT max_per_order, max_per_customer FROM products WHERE id = \$1 FOR UPDATE`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"max_per_order", "max_per_customer"}).AddRow(nil, nil))
+		mock.ExpectQuery(`SELECT qty FROM reservations WHERE user_id = \$1 AND product_id = \$2 FOR UPDATE`).WithArgs("42", "7").
+			WillReturnError(sql.ErrNoRows)
+		expectAdjustStock(mock, "7", 5, 0, 3, 1)
+		mock.ExpectQuery(`INSERT INTO reservations \(user_id, product_id, qty, expires_at\)\s+VALUES \(\$1, \$2, \$3, \$4\)\s+ON CONFLICT \(user_id, product_id\) DO UPDATE`).
+			WithArgs("42", "7", 2, expires).
+			WillReturnRows(sqlmock.NewRows([]string{"expires_at"}).AddRow(expires))
+		mock.ExpectCommit()
+
+		reservation, err := repo.Reserve(context.Background(), "42", "7", 2, expires)
+		if err != nil {
+			t.Fatalf("Reserve returned error: %v", err)
+		}
+		if reservation.UserID != "42" || reservation.ProductID != "7" || reservation.Qty != 2 || !reservation.ExpiresAt.Equal(expires) {
+			t.Fatalf("unexpected reservation: %+v", reservation)
+		}
+	})
+
+	t.Run("replaces existing reservation", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewReservationRepository(db)
+
+		// Going from 3 reserved to 1 gives 2 back to stock.
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM products WHERE id = \$1 FOR UPDATE`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"max_per_order", "max_per_customer"}).AddRow(nil, nil))
+		mock.ExpectQuery(`SELECT qty FROM reservations`).WithArgs("42", "7").
+			WillReturnRows(sqlmock.NewRows([]string{"qty"}).AddRow(3))
+		expectAdjustStock(mock, "7", 0, 6, 2, 1)
+		mock.ExpectQuery(`INSERT INTO reservations`).WithArgs("42", "7", 1, expires).
+			WillReturnRows(sqlmock.NewRows([]string{"expires_at"}).AddRow(expires))
+		mock.ExpectCommit()
+
+		if _, err := repo.Reserve(context.Background(), "42", "7", 1, expires); err != nil {
+			t.Fatalf("Reserve returned error: %v", err)
+		}
+	})
+
+	t.Run("loses race for the last unit", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewReservationRepository(db)
+
+		// The concurrent reservation that got the row lock first has taken the last unit.
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM products WHERE id = \$1 FOR UPDATE`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"max_per_order", "max_per_customer"}).AddRow(nil, nil))
+		mock.ExpectQuery(`SELECT qty FROM reservations`).WithArgs("43", "7").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(`SELECT stock_qty, version FROM products`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"stock_qty", "version"}).AddRow(0, 6))
+		mock.ExpectRollback()
+
+		_, err := repo.Reserve(context.Background(), "43", "7", 1, expires)
+		var stockErr *models.InsufficientStockError
+		if !errors.As(err, &stockErr) || len(stockErr.ProductIDs) != 1 || stockErr.ProductIDs[0] != "7" {
+			t.Fatalf("expected *InsufficientStockError for product 7, got %v", err)
+		}
+	})
+
+	t.Run("over purchase limit", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewReservationRepository(db)
+
+		// The user already bought 2 of the 3 they may buy.
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM products WHERE id = \$1 FOR UPDATE`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"max_per_order", "max_per_customer"}).AddRow(nil, 3))
+		mock.ExpectQuery(`SELECT coalesce\(sum\(qty\), 0\) FROM order_items`).WithArgs("42", "7", models.OrderStatusCancelled).
+			WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(2))
+		mock.ExpectRollback()
+
+		_, err := repo.Reserve(context.Background(), "42", "7", 2, expires)
+		var limitErr *models.PurchaseLimitError
+		if !errors.As(err, &limitErr) || !limitErr.PerCustomer || limitErr.Limit != 3 || limitErr.Purchased != 2 {
+			t.Fatalf("expected a per-customer *PurchaseLimitError, got %v", err)
+		}
+	})
+
+	t.Run("unknown product", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewReservationRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM products WHERE id = \$1 FOR UPDATE`).WithArgs("404").WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		if _, err := repo.Reserve(context.Background(), "42", "404", 1, expires); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestReservationRepositoryReleaseExpired(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	db, mock := newMock(t)
+	repo := NewReservationRepository(db)
+
+	mock.ExpectQuery(`WITH expired AS \(\s*DELETE FROM reservations WHERE expires_at <= \$1 RETURNING product_id, qty\s*\), restocked AS \(\s*UPDATE products SET stock_qty = stock_qty \+ e.qty, version = version \+ 1 .*\)\s*SELECT count\(\*\) FROM expired`).
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	released, err := repo.ReleaseExpired(context.Background(), now)
+	if err != nil {
+		t.Fatalf("ReleaseExpired returned error: %v", err)
+	}
+	if released != 3 {
+		t.Fatalf("expected 3 reservations released, got %d", released)
+	}
+}
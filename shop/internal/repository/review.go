@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// reviewColumns is the column list scanned by ListByProduct.
+const reviewColumns = `id, product_id, user_id, rating, body, created_at`
+
+// sqlReviewRepository is a models.ReviewRepository backed by the reviews table.
+type sqlReviewRepository struct {
+	db *sql.DB
+}
+
+// NewReviewRepository creates a ReviewRepository backed by db.
+func NewReviewRepository(db *sql.DB) models.ReviewRepository {
+	return &sqlReviewRepository{db: db}
+}
+
+// Create inserts a review, relying on the (product_id, user_id) unique constraint to
+// reject a second review by the same user.
+func (r *sqlReviewRepository) Create(ctx context.Context, review *models.Review) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO reviews (product_id, user_id, rating, body) VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		review.ProductID, review.UserID, review.Rating, review.Body,
+	).Scan(&review.ID, &review.CreatedAt)
+
+	// The user is the caller, so a missing reference is the product.
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			return models.ErrAlreadyReviewed
+		case pqForeignKeyViolation:
+			return models.ErrNotFound
+		}
+	}
+	return err
+}
+
+// ListByProduct returns a page of a product's reviews, newest first.
+func (r *sqlReviewRepository) ListByProduct(ctx context.Context, productID string, limit, offset int) ([]*models.Review, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+reviewColumns+` FROM reviews WHERE product_id = $1
+		ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`,
+		productID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make([]*models.Review, 0, limit)
+	for rows.Next() {
+		var review models.Review
+		if err := rows.Scan(&review.ID, &review.ProductID, &review.UserID, &review.Rating, &review.Body, &review.CreatedAt); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, &review)
+	}
+	return reviews, rows.Err()
+}
+
+// AverageRatings averages the ratings of several products in one query.
+func (r *sqlReviewRepository) AverageRatings(ctx context.Context, productIDs []string) (map[string]float64, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT product_id, AVG(rating)::float8 FROM reviews WHERE product_id = ANY($1) GROUP BY product_id`,
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := make(map[string]float64, len(productIDs))
+	for rows.Next() {
+		var (
+			productID string
+			rating    float64
+		)
+		if err := rows.Scan(&productID, &rating); err != nil {
+			return nil, err
+		}
+		ratings[productID] = rating
+	}
+	return ratings, rows.Err()
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestReviewRepositoryCreate(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewReviewRepository(db)
+
+		mock.ExpectQuery(`INSERT INTO reviews \(product_id, user_id, rating, body\) VALUES \(\$1, \$2, \$3, \$4\) RETURNING id, created_at`).
+			WithArgs("7", "42", 4, "Sturdy mug").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("100", created))
+
+		review := &models.Review{ProductID: "7", UserID: "42", Rating: 4, Body: "Sturdy mug"}
+		if err := repo.Create(context.Background(), review); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		if review.ID != "100" || !review.CreatedAt.Equal(created) {
+			t.Fatalf("expected ID and CreatedAt from the database, got %+v", review)
+		}
+	})
+
+	t.Run("already reviewed", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewReviewRepository(db)
+
+		mock.ExpectQuery(`INSERT INTO reviews`).WillReturnError(&pq.Error{Code: pqUniqueViolation, Constraint: "reviews_product_id_user_id_key"})
+
+		if err := repo.Create(context.Background(), &models.Review{ProductID: "7", UserID: "42", Rating: 5}); !errors.Is(err, models.ErrAlreadyReviewed) {
+			t.Fatalf("expected ErrAlreadyReviewed, got %v", err)
+		}
+	})
+
+	t.Run("missing product", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewReviewRepository(db)
+
+		mock.ExpectQuery(`INSERT INTO reviews`).WillReturnError(&pq.Error{Code: pqForeignKeyViolation, Constraint: "reviews_product_id_fkey"})
+
+		if err := repo.Create(context.Background(), &models.Review{ProductID: "404", UserID: "42", Rating: 5}); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestReviewRepositoryListByProduct(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewReviewRepository(db)
+	newer := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT id, product_id, user_id, rating, body, created_at FROM reviews WHERE product_id = \$1\s+ORDER BY created_at DESC, id DESC LIMIT \$2 OFFSET \$3`).
+		WithArgs("7", 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "user_id", "rating", "body", "created_at"}).
+			AddRow("101", "7", "43", 2, "", newer).
+			AddRow("100", "7", "42", 4, "Sturdy mug", newer.Add(-time.Hour)))
+
+	reviews, err := repo.ListByProduct(context.Background(), "7", 20, 0)
+	if err != nil {
+		t.Fatalf("ListByProduct returned error: %v", err)
+	}
+	if len(reviews) != 2 || reviews[0].ID != "101" || reviews[1].Rating != 4 || reviews[1].Body != "Sturdy mug" {
+		t.Fatalf("unexpected reviews: %+v", reviews)
+	}
+}
+
+func TestReviewRepositoryAverageRatings(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewReviewRepository(db)
+
+	mock.ExpectQuery(`SELECT product_id, AVG\(rating\)::float8 FROM reviews WHERE product_id = ANY\(\$1\) GROUP BY product_id`).
+		WithArgs(pq.Array([]string{"7", "8", "9"})).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "avg"}).AddRow("7", 4.5).AddRow("9", 1.0))
+
+	ratings, err := repo.AverageRatings(context.Background(), []string{"7", "8", "9"})
+	if err != nil {
+		t.Fatalf("AverageRatings returned error: %v", err)
+	}
+	if len(ratings) != 2 || ratings["7"] != 4.5 || ratings["9"] != 1 {
+		t.Fatalf("unexpected ratings: %v", ratings)
+	}
+	if _, ok := ratings["8"]; ok {
+		t.Fatal("expected a product without reviews to be left out")
+	}
+}
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// userColumns is the column list scanned by scanUser.
+const userColumns = `id, phone_number, email, okta_id, created_at, updated_at, deleted_at, status, role, email_verified, phone_verified, avatar_url`
+
+// notDeleted restricts a query to users that haven't been soft-deleted.
+const notDeleted = ` AND deleted_at IS NULL`
+
+// sqlUserRepository is a models.UserRepository backed by the users table.
+type sqlUserRepository struct {
+	db *sql.DB
+}
+
+// NewUserRepository creates a UserRepository backed by db.
+func NewUserRepository(db *sql.DB) models.UserRepository {
+	return &sqlUserRepository{db: db}
+}
+
+// Create inserts user and sets its generated ID, timestamps, initial status and role.
+func (r *sqlUserRepository) Create(ctx context.Context, user *models.User) error {
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO users (phone_number, email, okta_id) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at, status, role`,
+		nullString(user.PhoneNumber), nullString(user.Email), user.OktaID,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.Status, &user.Role)
+}
+
+// Update saves the contact details of an existing, non-deleted user and sets its UpdatedAt
+// and verification flags, clearing the flag of a changed email or phone number. Timestamps
+// come from the database clock, so they are consistent across instances.
+func (r *sqlUserRepository) Update(ctx context.Context, user *models.User) error {
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE users SET phone_number = $1, email = $2, updated_at = now(),
+			phone_verified = phone_verified AND phone_number IS NOT DISTINCT FROM $1,
+			email_verified = email_verified AND email IS NOT DISTINCT FROM $2
+		WHERE id = $3`+notDeleted+` RETURNING updated_at, email_verified, phone_verified`,
+		nullString(user.PhoneNumber), nullString(user.Email), user.ID,
+	).Scan(&user.UpdatedAt, &user.EmailVerified, &user.PhoneVerified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrNotFound
+	}
+	return err
+}
+
+// Delete soft-deletes the user with the given ID by setting deleted_at, if it exists and
+// isn't already deleted. The row is kept for auditing.
+func (r *sqlUserRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET deleted_at = now() WHERE id = $1`+notDeleted, id)
+	return err
+}
+
+// Restore clears deleted_at on a soft-deleted user.
+func (r *sqlUserRepository) Restore(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// GetByID looks up a non-deleted user by primary key.
+func (r *sqlUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`+notDeleted, id))
+}
+
+// GetByIDIncludingDeleted looks up a user by primary key, whether or not it's soft-deleted.
+func (r *sqlUserRepository) GetByIDIncludingDeleted(ctx context.Context, id string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+// GetByIDs looks up several non-deleted users by primary key in one query.
+func (r *sqlUserRepository) GetByIDs(ctx context.Context, ids []string) ([]*models.User, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ANY($1)`+notDeleted, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*models.User, 0, len(ids))
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetByEmail looks up a non-deleted user by email address.
+func (r *sqlUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`+notDeleted, email))
+}
+
+// GetByPhone looks up a non-deleted user by phone number, which must be in E.164 form.
+func (r *sqlUserRepository) GetByPhone(ctx context.Context, phone string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE phone_number = $1`+notDeleted, phone))
+}
+
+// GetByOktaID looks up a non-deleted user by their Okta user ID.
+func (r *sqlUserRepository) GetByOktaID(ctx context.Context, oktaID string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE okta_id = $1`+notDeleted, oktaID))
+}
+
+// SetStatusByOktaID updates the status of a non-deleted user looked up by Okta user ID.
+func (r *sqlUserRepository) SetStatusByOktaID(ctx context.Context, oktaID string, status models.UserStatus) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET status = $2, updated_at = now() WHERE okta_id = $1`+notDeleted,
+		oktaID, string(status),
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// MarkVerified sets the verification flag of whichever of a non-deleted user's email and
+// phone number is contact.
+func (r *sqlUserRepository) MarkVerified(ctx context.Context, id, contact string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET email_verified = email_verified OR email IS NOT DISTINCT FROM $2,
+			phone_verified = phone_verified OR phone_number IS NOT DISTINCT FROM $2, updated_at = now()
+		WHERE id = $1`+notDeleted,
+		id, contact,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// SetAvatarURL sets the avatar URL of a non-deleted user.
+func (r *sqlUserRepository) SetAvatarURL(ctx context.Context, id, url string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET avatar_url = $2, updated_at = now() WHERE id = $1`+notDeleted,
+		id, nullString(url),
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// SetRole sets the role of a non-deleted user.
+func (r *sqlUserRepository) SetRole(ctx context.Context, id string, role models.Role) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET role = $2, updated_at = now() WHERE id = $1`+notDeleted,
+		id, string(role),
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// scanUser scans a row selected with userColumns, mapping no rows to models.ErrNotFound.
+func scanUser(row scanner) (*models.User, error) {
+	var (
+		user      models.User
+		phone     sql.NullString
+		email     sql.NullString
+		deletedAt sql.NullTime
+		avatarURL sql.NullString
+	)
+	err := row.Scan(&user.ID, &phone, &email, &user.OktaID, &user.CreatedAt, &user.UpdatedAt, &deletedAt, &user.Status, &user.Role, &user.EmailVerified, &user.PhoneVerified, &avatarURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user.PhoneNumber = phone.String
+	user.Email = email.String
+	user.AvatarURL = avatarURL.String
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	return &user, nil
+}
+
+// nullString maps an empty string to SQL NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+var userRows = []string{"id", "phone_number", "email", "okta_id", "created_at", "updated_at", "deleted_at", "status", "role", "email_verified", "phone_verified", "avatar_url"}
+
+// userCreatedAt is the created_at (and updated_at) of the users in the mocked rows.
+var userCreatedAt = time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db, mock
+}
+
+func TestUserRepositoryCreate(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectQuery(`INSERT INTO users \(phone_number, email, okta_id\) VALUES \(\$1, \$2, \$3\) RETURNING id, created_at, updated_at`).
+		WithArgs(sql.NullString{}, sql.NullString{String: "john.doe@example.com", Valid: true}, "00u1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "status", "role"}).AddRow("42", userCreatedAt, userCreatedAt, "ACTIVE", "CUSTOMER"))
+
+	user := &models.User{Email: "john.doe@example.com", OktaID: "00u1"}
+	if err := repo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if user.ID != "42" || !user.CreatedAt.Equal(userCreatedAt) || !user.UpdatedAt.Equal(userCreatedAt) {
+		t.Fatalf("expected ID 42 and timestamps from the database, got %+v", user)
+	}
+}
+
+func TestUserRepositoryGetByID(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	t.Run("found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, phone_number, email, okta_id, created_at, updated_at, deleted_at, status, role, email_verified, phone_verified, avatar_url FROM users WHERE id = \$1 AND deleted_at IS NULL`).
+			WithArgs("42").
+			WillReturnRows(sqlmock.NewRows(userRows).AddRow("42", nil, "john.doe@example.com", "00u1", userCreatedAt, userCreatedAt, nil, "ACTIVE", "CUSTOMER", false, false, nil))
+
+		user, err := repo.GetByID(context.Background(), "42")
+		if err != nil {
+			t.Fatalf("GetByID returned error: %v", err)
+		}
+		want := models.User{ID: "42", Email: "john.doe@example.com", OktaID: "00u1", CreatedAt: userCreatedAt, UpdatedAt: userCreatedAt, Status: models.UserStatusActive, Role: models.RoleCustomer}
+		if *user != want {
+			t.Fatalf("got %+v, want %+v", user, want)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		mock.ExpectQuery(`FROM users WHERE id = \$1`).WithArgs("404").WillReturnRows(sqlmock.NewRows(userRows))
+
+		if _, err := repo.GetByID(context.Background(), "404"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		mock.ExpectQuery(`FROM users WHERE id = \$1`).WithArgs("42").WillReturnError(errors.New("connection reset"))
+
+		_, err := repo.GetByID(context.Background(), "42")
+		if err == nil || errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected a database error, got %v", err)
+		}
+	})
+}
+
+func TestUserRepositoryGetByEmail(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectQuery(`FROM users WHERE email = \$1 AND deleted_at IS NULL`).
+		WithArgs("john.doe@example.com").
+		WillReturnRows(sqlmock.NewRows(userRows).AddRow("42", "+15555550100", "john.doe@example.com", "00u1", userCreatedAt, userCreatedAt, nil, "ACTIVE", "CUSTOMER", false, false, nil))
+
+	user, err := repo.GetByEmail(context.Background(), "john.doe@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail returned error: %v", err)
+	}
+	if user.ID != "42" || user.PhoneNumber != "+15555550100" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+}
+
+func TestUserRepositoryGetByPhone(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectQuery(`FROM users WHERE phone_number = \$1 AND deleted_at IS NULL`).
+		WithArgs("+15555550100").
+		WillReturnRows(sqlmock.NewRows(userRows).AddRow("42", "+15555550100", nil, "00u1", userCreatedAt, userCreatedAt, nil, "ACTIVE", "CUSTOMER", false, false, nil))
+
+	user, err := repo.GetByPhone(context.Background(), "+15555550100")
+	if err != nil {
+		t.Fatalf("GetByPhone returned error: %v", err)
+	}
+	if user.ID != "42" || user.PhoneNumber != "+15555550100" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	mock.ExpectQuery(`FROM users WHERE phone_number = \$1`).WithArgs("+15555550199").WillReturnRows(sqlmock.NewRows(userRows))
+	if _, err := repo.GetByPhone(context.Background(), "+15555550199"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUserRepositoryDelete(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectExec(`UPDATE users SET deleted_at = now\(\) WHERE id = \$1 AND deleted_at IS NULL`).WithArgs("42").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Delete(context.Background(), "42"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+
+	mock.ExpectExec(`UPDATE users SET deleted_at = now\(\)`).WithArgs("42").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := repo.Delete(context.Background(), "42"); err != nil {
+		t.Fatalf("Delete of a missing user returned error: %v", err)
+	}
+}
+
+func TestUserRepositorySoftDelete(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+	deletedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// The soft-deleted row only matches the query without the deleted_at filter.
+	mock.ExpectQuery(`FROM users WHERE id = \$1 AND deleted_at IS NULL`).WithArgs("42").WillReturnRows(sqlmock.NewRows(userRows))
+	if _, err := repo.GetByID(context.Background(), "42"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a soft-deleted user, got %v", err)
+	}
+
+	mock.ExpectQuery(`SELECT id, phone_number, email, okta_id, created_at, updated_at, deleted_at, status, role, email_verified, phone_verified, avatar_url FROM users WHERE id = \$1$`).
+		WithArgs("42").
+		WillReturnRows(sqlmock.NewRows(userRows).AddRow("42", nil, "john.doe@example.com", "00u1", userCreatedAt, userCreatedAt, deletedAt, "ACTIVE", "CUSTOMER", false, false, nil))
+	user, err := repo.GetByIDIncludingDeleted(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("GetByIDIncludingDeleted returned error: %v", err)
+	}
+	if user.DeletedAt == nil || !user.DeletedAt.Equal(deletedAt) {
+		t.Fatalf("expected DeletedAt %v, got %v", deletedAt, user.DeletedAt)
+	}
+}
+
+func TestUserRepositoryRestore(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectExec(`UPDATE users SET deleted_at = NULL WHERE id = \$1 AND deleted_at IS NOT NULL`).WithArgs("42").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Restore(context.Background(), "42"); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+
+	mock.ExpectExec(`UPDATE users SET deleted_at = NULL`).WithArgs("43").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := repo.Restore(context.Background(), "43"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUserRepositorySetStatusByOktaID(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectExec(`UPDATE users SET status = \$2, updated_at = now\(\) WHERE okta_id = \$1 AND deleted_at IS NULL`).
+		WithArgs("00u1", "DEACTIVATED").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.SetStatusByOktaID(context.Background(), "00u1", models.UserStatusDeactivated); err != nil {
+		t.Fatalf("SetStatusByOktaID returned error: %v", err)
+	}
+
+	mock.ExpectExec(`UPDATE users SET status`).WithArgs("00u404", "SUSPENDED").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := repo.SetStatusByOktaID(context.Background(), "00u404", models.UserStatusSuspended); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUserRepositoryMarkVerified(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectExec(`UPDATE users SET email_verified = email_verified OR email IS NOT DISTINCT FROM \$2,\s+`+
+		`phone_verified = phone_verified OR phone_number IS NOT DISTINCT FROM \$2, updated_at = now\(\)\s+`+
+		`WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs("42", "+15555550100").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.MarkVerified(context.Background(), "42", "+15555550100"); err != nil {
+		t.Fatalf("MarkVerified returned error: %v", err)
+	}
+
+	mock.ExpectExec(`UPDATE users SET email_verified`).WithArgs("404", "+15555550100").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := repo.MarkVerified(context.Background(), "404", "+15555550100"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUserRepositorySetAvatarURL(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectExec(`UPDATE users SET avatar_url = \$2, updated_at = now\(\) WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs("42", sql.NullString{String: "/uploads/avatars/42/a.png", Valid: true}).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.SetAvatarURL(context.Background(), "42", "/uploads/avatars/42/a.png"); err != nil {
+		t.Fatalf("SetAvatarURL returned error: %v", err)
+	}
+
+	mock.ExpectExec(`UPDATE users SET avatar_url`).WithArgs("404", sql.NullString{}).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := repo.SetAvatarURL(context.Background(), "404", ""); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUserRepositorySetRole(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectExec(`UPDATE users SET role = \$2, updated_at = now\(\) WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs("42", "ADMIN").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.SetRole(context.Background(), "42", models.RoleAdmin); err != nil {
+		t.Fatalf("SetRole returned error: %v", err)
+	}
+
+	mock.ExpectExec(`UPDATE users SET role`).WithArgs("404", "CUSTOMER").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := repo.SetRole(context.Background(), "404", models.RoleCustomer); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUserRepositoryUpdate(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+	updatedAt := userCreatedAt.Add(time.Hour)
+
+	mock.ExpectQuery(`UPDATE users SET phone_number = \$1, email = \$2, updated_at = now\(\),\s+`+
+		`phone_verified = phone_verified AND phone_number IS NOT DISTINCT FROM \$1,\s+`+
+		`email_verified = email_verified AND email IS NOT DISTINCT FROM \$2\s+`+
+		`WHERE id = \$3 AND deleted_at IS NULL RETURNING updated_at, email_verified, phone_verified`).
+		WithArgs(sql.NullString{}, sql.NullString{String: "new@example.com", Valid: true}, "42").
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at", "email_verified", "phone_verified"}).AddRow(updatedAt, false, false))
+	user := &models.User{ID: "42", Email: "new@example.com", CreatedAt: userCreatedAt, UpdatedAt: userCreatedAt, EmailVerified: true}
+	if err := repo.Update(context.Background(), user); err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	if !user.UpdatedAt.Equal(updatedAt) {
+		t.Fatalf("expected UpdatedAt %v, got %v", updatedAt, user.UpdatedAt)
+	}
+	if user.EmailVerified {
+		t.Fatal("expected the changed email to be unverified")
+	}
+
+	mock.ExpectQuery(`UPDATE users`).WillReturnRows(sqlmock.NewRows([]string{"updated_at", "email_verified", "phone_verified"}))
+	if err := repo.Update(context.Background(), &models.User{ID: "404"}); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUserRepositoryGetByIDs(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewUserRepository(db)
+
+	mock.ExpectQuery(`SELECT id, phone_number, email, okta_id, created_at, updated_at, deleted_at, status, role, email_verified, phone_verified, avatar_url FROM users WHERE id = ANY\(\$1\) AND deleted_at IS NULL`).
+		WithArgs(pq.Array([]string{"42", "43", "404"})).
+		WillReturnRows(sqlmock.NewRows(userRows).
+			AddRow("42", nil, "john.doe@example.com", "00u1", userCreatedAt, userCreatedAt, nil, "ACTIVE", "CUSTOMER", false, false, nil).
+			AddRow("43", "+15555550100", nil, "00u2", userCreatedAt, userCreatedAt, nil, "ACTIVE", "ADMIN", false, false, nil))
+
+	users, err := repo.GetByIDs(context.Background(), []string{"42", "43", "404"})
+	if err != nil {
+		t.Fatalf("GetByIDs returned error: %v", err)
+	}
+	if len(users) != 2 || users[0].Email != "john.doe@example.com" || users[1].PhoneNumber != "+15555550100" || users[1].Role != models.RoleAdmin {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/database"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// webhookDeliveryColumns is the column list scanned by scanWebhookDelivery.
+const webhookDeliveryColumns = `id, event_type, url, payload, status, attempts, last_error, next_attempt_at, delivered_at, created_at`
+
+// sqlWebhookDeliveryRepository is a models.WebhookDeliveryRepository backed by the
+// webhook_deliveries table.
+type sqlWebhookDeliveryRepository struct {
+	db *sql.DB
+}
+
+// NewWebhookDeliveryRepository creates a WebhookDeliveryRepository backed by db.
+func NewWebhookDeliveryRepository(db *sql.DB) models.WebhookDeliveryRepository {
+	return &sqlWebhookDeliveryRepository{db: db}
+}
+
+// Enqueue inserts a PENDING delivery.
+func (r *sqlWebhookDeliveryRepository) Enqueue(ctx context.Context, delivery *models.WebhookDelivery) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO webhook_deliveries (event_type, url, payload, next_attempt_at) VALUES ($1, $2, $3, $4)
+		RETURNING id, status, created_at`,
+		delivery.EventType, delivery.URL, []byte(delivery.Payload), delivery.NextAttemptAt,
+	).Scan(&delivery.ID, &delivery.Status, &delivery.CreatedAt)
+	return err
+}
+
+// Claim postpones the due deliveries in the same statement that selects them. Rows another
+// worker is claiming at the same time are skipped rather than waited for.
+func (r *sqlWebhookDeliveryRepository) Claim(ctx context.Context, now, leaseUntil time.Time, maxAttempts, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`UPDATE webhook_deliveries SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status IN ('PENDING', 'FAILED') AND next_attempt_at <= $1 AND attempts < $3
+			ORDER BY next_attempt_at, id LIMIT $4 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+webhookDeliveryColumns,
+		now, leaseUntil, maxAttempts, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// MarkDelivered records a successful attempt.
+func (r *sqlWebhookDeliveryRepository) MarkDelivered(ctx context.Context, id string, at time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = 'DELIVERED', attempts = attempts + 1, last_error = NULL, delivered_at = $2
+		WHERE id = $1`,
+		id, at,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// MarkFailed records a failed attempt.
+func (r *sqlWebhookDeliveryRepository) MarkFailed(ctx context.Context, id, reason string, nextAttemptAt time.Time, dead bool) error {
+	status := models.WebhookDeliveryStatusFailed
+	if dead {
+		status = models.WebhookDeliveryStatusDead
+	}
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = $2, attempts = attempts + 1, last_error = $3, next_attempt_at = $4
+		WHERE id = $1`,
+		id, string(status), reason, nextAttemptAt,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// ListDead returns a page of the dead deliveries with the total count.
+func (r *sqlWebhookDeliveryRepository) ListDead(ctx context.Context, page models.PageArgs) (*models.PageResult[*models.WebhookDelivery], error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+webhookDeliveryColumns+`, count(*) OVER () FROM webhook_deliveries
+		WHERE status = 'DEAD' ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2`,
+		page.Limit, page.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &models.PageResult[*models.WebhookDelivery]{Items: []*models.WebhookDelivery{}}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows, &result.Total)
+		if err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, delivery)
+	}
+	return result, rows.Err()
+}
+
+// Requeue resets a dead delivery in a transaction that locks it, so it can't be requeued
+// twice at once.
+func (r *sqlWebhookDeliveryRepository) Requeue(ctx context.Context, id string, now time.Time) (*models.WebhookDelivery, error) {
+	var delivery *models.WebhookDelivery
+	err := database.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var status models.WebhookDeliveryStatus
+		err := tx.QueryRowContext(ctx, `SELECT status FROM webhook_deliveries WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if status != models.WebhookDeliveryStatusDead {
+			return models.ErrDeliveryNotDead
+		}
+		delivery, err = scanWebhookDelivery(tx.QueryRowContext(ctx,
+			`UPDATE webhook_deliveries SET status = 'PENDING', attempts = 0, last_error = NULL, next_attempt_at = $2
+			WHERE id = $1 RETURNING `+webhookDeliveryColumns,
+			id, now,
+		))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// scanWebhookDelivery scans a row selected with webhookDeliveryColumns, followed by any
+// extra columns into extra.
+func scanWebhookDelivery(row scanner, extra ...any) (*models.WebhookDelivery, error) {
+	var (
+		delivery models.WebhookDelivery
+		payload  []byte
+	)
+	dest := append([]any{
+		&delivery.ID, &delivery.EventType, &delivery.URL, &payload, &delivery.Status, &delivery.Attempts,
+		&delivery.LastError, &delivery.NextAttemptAt, &delivery.DeliveredAt, &delivery.CreatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+	return &delivery, nil
+}
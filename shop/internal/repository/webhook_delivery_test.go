@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+var webhookDeliveryRows = []string{"id", "event_type", "url", "payload", "status", "attempts", "last_error", "next_attempt_at", "delivered_at", "created_at"}
+
+func TestWebhookDeliveryRepositoryEnqueue(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewWebhookDeliveryRepository(db)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`INSERT INTO webhook_deliveries \(event_type, url, payload, next_attempt_at\) VALUES \(\$1, \$2, \$3, \$4\)\s+RETURNING id, status, created_at`).
+		WithArgs("order.completed", "https://ledger.example.com/hooks", []byte(`{"id":"100"}`), now).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow("1", "PENDING", now))
+
+	delivery := &models.WebhookDelivery{EventType: "order.completed", URL: "https://ledger.example.com/hooks", Payload: []byte(`{"id":"100"}`), NextAttemptAt: now}
+	if err := repo.Enqueue(context.Background(), delivery); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	if delivery.ID != "1" || delivery.Status != models.WebhookDeliveryStatusPending {
+		t.Fatalf("unexpected delivery: %+v", delivery)
+	}
+}
+
+func TestWebhookDeliveryRepositoryClaim(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewWebhookDeliveryRepository(db)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	lease := now.Add(time.Minute)
+
+	mock.ExpectQuery(`UPDATE webhook_deliveries SET next_attempt_at = \$2\s+WHERE id IN \(\s*SELECT id FROM webhook_deliveries\s+WHERE status IN \('PENDING', 'FAILED'\) AND next_attempt_at <= \$1 AND attempts < \$3\s+ORDER BY next_attempt_at, id LIMIT \$4 FOR UPDATE SKIP LOCKED\s*\)`).
+		WithArgs(now, lease, 5, 10).
+		WillReturnRows(sqlmock.NewRows(webhookDeliveryRows).
+			AddRow("1", "order.completed", "https://ledger.example.com/hooks", []byte(`{"id":"100"}`), "FAILED", 2, "status 503", lease, nil, now))
+
+	deliveries, err := repo.Claim(context.Background(), now, lease, 5, 10)
+	if err != nil {
+		t.Fatalf("Claim returned error: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Attempts != 2 || string(deliveries[0].Payload) != `{"id":"100"}` || *deliveries[0].LastError != "status 503" {
+		t.Fatalf("unexpected deliveries: %+v", deliveries)
+	}
+}
+
+func TestWebhookDeliveryRepositoryMark(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("delivered", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewWebhookDeliveryRepository(db)
+		mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'DELIVERED', attempts = attempts \+ 1, last_error = NULL, delivered_at = \$2\s+WHERE id = \$1`).
+			WithArgs("1", now).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := repo.MarkDelivered(context.Background(), "1", now); err != nil {
+			t.Fatalf("MarkDelivered returned error: %v", err)
+		}
+	})
+
+	t.Run("dead", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewWebhookDeliveryRepository(db)
+		mock.ExpectExec(`UPDATE webhook_deliveries SET status = \$2, attempts = attempts \+ 1, last_error = \$3, next_attempt_at = \$4\s+WHERE id = \$1`).
+			WithArgs("1", "DEAD", "status 500", now).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := repo.MarkFailed(context.Background(), "1", "status 500", now, true); err != nil {
+			t.Fatalf("MarkFailed returned error: %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewWebhookDeliveryRepository(db)
+		mock.ExpectExec(`UPDATE webhook_deliveries SET status = \$2`).
+			WithArgs("404", "FAILED", "timeout", now).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := repo.MarkFailed(context.Background(), "404", "timeout", now, false); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestWebhookDeliveryRepositoryListDead(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewWebhookDeliveryRepository(db)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT .*, count\(\*\) OVER \(\) FROM webhook_deliveries\s+WHERE status = 'DEAD' ORDER BY created_at DESC, id DESC LIMIT \$1 OFFSET \$2`).
+		WithArgs(20, 0).
+		WillReturnRows(sqlmock.NewRows(append(webhookDeliveryRows, "count")).
+			AddRow("3", "order.completed", "https://ledger.example.com/hooks", []byte(`{}`), "DEAD", 8, "status 500", now, nil, now, 1))
+
+	page, err := repo.ListDead(context.Background(), models.PageArgs{Limit: 20})
+	if err != nil {
+		t.Fatalf("ListDead returned error: %v", err)
+	}
+	if page.Total != 1 || len(page.Items) != 1 || page.Items[0].Status != models.WebhookDeliveryStatusDead {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+}
+
+func TestWebhookDeliveryRepositoryRequeue(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	selectStatus := `SELECT status FROM webhook_deliveries WHERE id = \$1 FOR UPDATE`
+
+	t.Run("requeues", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewWebhookDeliveryRepository(db)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectStatus).WithArgs("3").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("DEAD"))
+		mock.ExpectQuery(`UPDATE webhook_deliveries SET status = 'PENDING', attempts = 0, last_error = NULL, next_attempt_at = \$2\s+WHERE id = \$1 RETURNING`).
+			WithArgs("3", now).
+			WillReturnRows(sqlmock.NewRows(webhookDeliveryRows).
+				AddRow("3", "order.completed", "https://ledger.example.com/hooks", []byte(`{}`), "PENDING", 0, nil, now, nil, now))
+		mock.ExpectCommit()
+
+		delivery, err := repo.Requeue(context.Background(), "3", now)
+		if err != nil {
+			t.Fatalf("Requeue returned error: %v", err)
+		}
+		if delivery.Status != models.WebhookDeliveryStatusPending || delivery.Attempts != 0 || delivery.LastError != nil {
+			t.Fatalf("unexpected delivery: %+v", delivery)
+		}
+	})
+
+	for name, tc := range map[string]struct {
+		rows *sqlmock.Rows
+		want error
+	}{
+		"not found": {sqlmock.NewRows([]string{"status"}), models.ErrNotFound},
+		"not dead":  {sqlmock.NewRows([]string{"status"}).AddRow("FAILED"), models.ErrDeliveryNotDead},
+	} {
+		t.Run(name, func(t *testing.T) {
+			db, mock := newMock(t)
+			repo := NewWebhookDeliveryRepository(db)
+			mock.ExpectBegin()
+			mock.ExpectQuery(selectStatus).WithArgs("3").WillReturnRows(tc.rows)
+			mock.ExpectRollback()
+
+			if _, err := repo.Requeue(context.Background(), "3", now); !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// pqForeignKeyViolation is the Postgres error code for a reference to a row that doesn't exist.
+const pqForeignKeyViolation = "23503"
+
+// wishlistQuery selects the items in a user's wishlist with their products.
+const wishlistQuery = `SELECT ` + productColumns + `, added_at FROM wishlist_items
+	JOIN products ON products.id = wishlist_items.product_id
+	WHERE user_id = $1 ORDER BY added_at, product_id`
+
+// sqlWishlistRepository is a models.WishlistRepository backed by the wishlist_items table.
+type sqlWishlistRepository struct {
+	db *sql.DB
+}
+
+// NewWishlistRepository creates a WishlistRepository backed by db.
+func NewWishlistRepository(db *sql.DB) models.WishlistRepository {
+	return &sqlWishlistRepository{db: db}
+}
+
+// Get returns the user's wishlist.
+func (r *sqlWishlistRepository) Get(ctx context.Context, userID string) (*models.Wishlist, error) {
+	return r.load(ctx, userID)
+}
+
+// AddItem inserts a wishlist item, leaving an existing one for the same product untouched.
+func (r *sqlWishlistRepository) AddItem(ctx context.Context, userID, productID string) (*models.Wishlist, error) {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO wishlist_items (user_id, product_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		userID, productID,
+	)
+	// The user is the caller, so a missing reference is the product.
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqForeignKeyViolation {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.load(ctx, userID)
+}
+
+// RemoveItem deletes a wishlist item if there is one.
+func (r *sqlWishlistRepository) RemoveItem(ctx context.Context, userID, productID string) (*models.Wishlist, error) {
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM wishlist_items WHERE user_id = $1 AND product_id = $2`,
+		userID, productID,
+	); err != nil {
+		return nil, err
+	}
+	return r.load(ctx, userID)
+}
+
+// load reads a user's wishlist items.
+func (r *sqlWishlistRepository) load(ctx context.Context, userID string) (*models.Wishlist, error) {
+	rows, err := r.db.QueryContext(ctx, wishlistQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wishlist := &models.Wishlist{UserID: userID, Items: []*models.WishlistItem{}}
+	for rows.Next() {
+		item := &models.WishlistItem{}
+		if item.Product, err = scanProduct(rows, &item.AddedAt); err != nil {
+			return nil, err
+		}
+		wishlist.Items = append(wishlist.Items, item)
+	}
+	return wishlist, rows.Err()
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+var wishlistRows = append(append([]string{}, productRows...), "added_at")
+
+func TestWishlistRepositoryAddItem(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	added := created.Add(time.Hour)
+
+	t.Run("new item", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewWishlistRepository(db)
+
+		mock.ExpectExec(`INSERT INTO wishlist_items \(user_id, product_id\) VALUES \(\$1, \$2\) ON CONFLICT DO NOTHING`).
+			WithArgs("42", "7").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FROM wishlist_items\s+JOIN products .* ORDER BY added_at, product_id`).WithArgs("42").
+			WillReturnRows(sqlmock.NewRows(wishlistRows).AddRow("7", "Mug", "Ceramic", int64(899), "USD", "MUG-1", 5, created, nil, nil, nil, added))
+
+		wishlist, err := repo.AddItem(context.Background(), "42", "7")
+		if err != nil {
+			t.Fatalf("AddItem returned error: %v", err)
+		}
+		if len(wishlist.Items) != 1 || wishlist.Items[0].Product.ID != "7" || !wishlist.Items[0].AddedAt.Equal(added) {
+			t.Fatalf("unexpected wishlist items: %+v", wishlist.Items)
+		}
+	})
+
+	t.Run("duplicate is a no-op", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewWishlistRepository(db)
+
+		mock.ExpectExec(`INSERT INTO wishlist_items`).WithArgs("42", "7").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`FROM wishlist_items`).WithArgs("42").
+			WillReturnRows(sqlmock.NewRows(wishlistRows).AddRow("7", "Mug", "Ceramic", int64(899), "USD", "MUG-1", 5, created, nil, nil, nil, added))
+
+		wishlist, err := repo.AddItem(context.Background(), "42", "7")
+		if err != nil {
+			t.Fatalf("AddItem returned error: %v", err)
+		}
+		if len(wishlist.Items) != 1 {
+			t.Fatalf("expected a single item, got %+v", wishlist.Items)
+		}
+	})
+
+	t.Run("missing product", func(t *testing.T) {
+		db, mock := newMock(t)
+		repo := NewWishlistRepository(db)
+
+		mock.ExpectExec(`INSERT INTO wishlist_items`).WithArgs("42", "404").
+			WillReturnError(&pq.Error{Code: pqForeignKeyViolation, Constraint: "wishlist_items_product_id_fkey"})
+
+		if _, err := repo.AddItem(context.Background(), "42", "404"); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestWishlistRepositoryRemoveItem(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewWishlistRepository(db)
+
+	mock.ExpectExec(`DELETE FROM wishlist_items WHERE user_id = \$1 AND product_id = \$2`).
+		WithArgs("42", "7").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM wishlist_items`).WithArgs("42").WillReturnRows(sqlmock.NewRows(wishlistRows))
+
+	wishlist, err := repo.RemoveItem(context.Background(), "42", "7")
+	if err != nil {
+		t.Fatalf("RemoveItem returned error: %v", err)
+	}
+	if wishlist.Items == nil || len(wishlist.Items) != 0 {
+		t.Fatalf("expected an empty, non-nil item list, got %+v", wishlist.Items)
+	}
+}
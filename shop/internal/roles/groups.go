@@ -0,0 +1,67 @@
+package roles
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// rank orders the roles from least to most privileged.
+var rank = map[models.Role]int{
+	models.RoleCustomer: 0,
+	models.RoleAdmin:    1,
+}
+
+// GroupRoles maps the names of Okta groups to the roles their members get. A user in
+// several mapped groups gets the most privileged of their roles, and a user in none of them
+// is a customer.
+type GroupRoles map[string]models.Role
+
+// ParseGroupRoles parses a comma-separated list of group roles such as the OKTA_GROUP_ROLES
+// environment variable.
+//
+// Parameters:
+//   - list: The roles as group=role pairs, e.g. "Shop Admins=ADMIN,Support=ADMIN".
+//
+// Returns:
+//   - The roles by group name.
+//   - An error if an entry is malformed or names an unknown role.
+func ParseGroupRoles(list string) (GroupRoles, error) {
+	groups := GroupRoles{}
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		group, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid group role %q: expected group=role", entry)
+		}
+		if group = strings.TrimSpace(group); group == "" {
+			return nil, fmt.Errorf("invalid group role %q: empty group", entry)
+		}
+		role := models.Role(strings.ToUpper(strings.TrimSpace(value)))
+		if _, ok := rank[role]; !ok {
+			return nil, fmt.Errorf("invalid group role %q: unknown role %q", entry, value)
+		}
+		groups[group] = role
+	}
+	return groups, nil
+}
+
+// Role returns the role of a member of the named groups.
+//
+// Parameters:
+//   - groups: The names of the Okta groups the user is a member of.
+//
+// Returns:
+//   - The most privileged role mapped to any of the groups, or models.RoleCustomer.
+func (g GroupRoles) Role(groups []string) models.Role {
+	role := models.RoleCustomer
+	for _, group := range groups {
+		if r, ok := g[group]; ok && rank[r] > rank[role] {
+			role = r
+		}
+	}
+	return role
+}
@@ -0,0 +1,42 @@
+package roles
+
+import (
+	"testing"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestGroupRolesRole(t *testing.T) {
+	groups, err := ParseGroupRoles("Shop Admins=ADMIN, Support = admin, Everyone=CUSTOMER")
+	if err != nil {
+		t.Fatalf("ParseGroupRoles returned error: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		groups []string
+		want   models.Role
+	}{
+		"admin group":              {[]string{"Everyone", "Shop Admins"}, models.RoleAdmin},
+		"trimmed and upper cased":  {[]string{"Support"}, models.RoleAdmin},
+		"customer group":           {[]string{"Everyone"}, models.RoleCustomer},
+		"unmapped groups":          {[]string{"Engineering", "shop admins"}, models.RoleCustomer},
+		"no groups":                {nil, models.RoleCustomer},
+		"most privileged role won": {[]string{"Shop Admins", "Everyone"}, models.RoleAdmin},
+	} {
+		if got := groups.Role(tc.groups); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", name, tc.want, got)
+		}
+	}
+
+	if got := GroupRoles(nil).Role([]string{"Shop Admins"}); got != models.RoleCustomer {
+		t.Errorf("expected no mapping to make everyone a customer, got %s", got)
+	}
+}
+
+func TestParseGroupRolesInvalid(t *testing.T) {
+	for _, list := range []string{"Shop Admins", "=ADMIN", "Shop Admins=OWNER"} {
+		if _, err := ParseGroupRoles(list); err == nil {
+			t.Errorf("ParseGroupRoles(%q): expected an error", list)
+		}
+	}
+}
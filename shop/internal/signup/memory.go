@@ -0,0 +1,58 @@
+package signup
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store. Its counts are lost on restart and aren't shared
+// between instances.
+type MemoryStore struct {
+	mu        sync.Mutex
+	attempts  map[string][]time.Time // Attempt times per key, oldest first.
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string][]time.Time{}}
+}
+
+// Allow implements Store.
+func (s *MemoryStore) Allow(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now, window)
+	recent := trim(s.attempts[key], now.Add(-window))
+	if len(recent) >= limit {
+		s.attempts[key] = recent
+		return false, nil
+	}
+	s.attempts[key] = append(recent, now)
+	return true, nil
+}
+
+// sweep drops keys with no attempts in the window. It runs at most once per window so the
+// cost is amortised across calls.
+func (s *MemoryStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+	for key, times := range s.attempts {
+		if len(trim(times, now.Add(-window))) == 0 {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+// trim drops the times at or before cutoff from times, which is sorted.
+func trim(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
@@ -0,0 +1,123 @@
+package signup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultWindow is the period over which registrations are counted.
+	DefaultWindow = time.Hour
+
+	// DefaultLimitPerIP is how many registrations a client IP may make per window.
+	DefaultLimitPerIP = 5
+
+	// DefaultLimitPerDomain is how many registrations may use the same email domain per
+	// window. It is set high because many legitimate users share large providers.
+	DefaultLimitPerDomain = 100
+
+	// DefaultLookupLimitPerIP is how many identifier availability checks a client IP may make
+	// per window. It allows a signup form checking as the user types, but keeps the checks
+	// useless for finding out which of a list of addresses have accounts.
+	DefaultLookupLimitPerIP = 30
+)
+
+// ErrTooManyRegistrations is returned when a client IP or email domain has used up its
+// registrations for the current window.
+var ErrTooManyRegistrations = errors.New("too many registrations")
+
+// ErrTooManyLookups is returned when a client IP has used up its identifier availability
+// checks for the current window.
+var ErrTooManyLookups = errors.New("too many availability checks")
+
+// Store counts registration attempts per key over a sliding window. MemoryStore keeps the
+// counts in the process; a shared store, such as one backed by Redis, makes the limits hold
+// across instances.
+type Store interface {
+	// Allow records an attempt for key at now if fewer than limit attempts were recorded for
+	// it in the window ending at now, and reports whether it did. The check and the record
+	// must be atomic.
+	Allow(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (bool, error)
+}
+
+// Throttle limits how many registrations, or identifier availability checks, can be made
+// from one client IP and for one email domain within a sliding window.
+type Throttle struct {
+	store     Store
+	window    time.Duration
+	perIP     int
+	perDomain int
+	prefix    string           // Keeps the keys apart from other throttles sharing the store.
+	limited   error            // What Allow returns for an attempt over a limit.
+	now       func() time.Time // The clock, replaceable in tests.
+}
+
+// NewThrottle creates a registration throttle.
+//
+// Parameters:
+//   - store: Where attempts are counted.
+//   - window: The period over which attempts are counted.
+//   - perIP: The registrations allowed per client IP per window, or 0 for no limit.
+//   - perDomain: The registrations allowed per email domain per window, or 0 for no limit.
+//
+// Returns:
+//   - A new Throttle instance.
+func NewThrottle(store Store, window time.Duration, perIP, perDomain int) *Throttle {
+	return &Throttle{store: store, window: window, perIP: perIP, perDomain: perDomain, limited: ErrTooManyRegistrations, now: time.Now}
+}
+
+// NewLookupThrottle creates a throttle for identifier availability checks, which are only
+// limited per client IP. It can share a store with a registration throttle.
+//
+// Parameters:
+//   - store: Where checks are counted.
+//   - window: The period over which checks are counted.
+//   - perIP: The checks allowed per client IP per window, or 0 for no limit.
+//
+// Returns:
+//   - A new Throttle instance whose Allow returns ErrTooManyLookups.
+func NewLookupThrottle(store Store, window time.Duration, perIP int) *Throttle {
+	return &Throttle{store: store, window: window, perIP: perIP, prefix: "lookup:", limited: ErrTooManyLookups, now: time.Now}
+}
+
+// Allow records a registration attempt from ip for email, which may be empty for
+// registrations by phone number.
+//
+// Parameters:
+//   - ctx: The context for the store.
+//   - ip: The client IP, or "" if unknown.
+//   - email: The email address being registered, or "".
+//
+// Returns:
+//   - ErrTooManyRegistrations, or ErrTooManyLookups for a lookup throttle, if the IP or the
+//     email's domain is over its limit.
+//   - The store's error if it fails.
+func (t *Throttle) Allow(ctx context.Context, ip, email string) error {
+	now := t.now()
+	if ip != "" && t.perIP > 0 {
+		if err := t.allow(ctx, "ip:"+ip, t.perIP, now); err != nil {
+			return err
+		}
+	}
+	if _, domain, ok := strings.Cut(email, "@"); ok && t.perDomain > 0 {
+		if err := t.allow(ctx, "domain:"+strings.ToLower(domain), t.perDomain, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allow checks a single key against its limit.
+func (t *Throttle) allow(ctx context.Context, key string, limit int, now time.Time) error {
+	ok, err := t.store.Allow(ctx, t.prefix+key, limit, t.window, now)
+	if err != nil {
+		return fmt.Errorf("registration throttle: %w", err)
+	}
+	if !ok {
+		return t.limited
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package signup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for Throttle.now.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestThrottle(window time.Duration, perIP, perDomain int) (*Throttle, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)}
+	throttle := NewThrottle(NewMemoryStore(), window, perIP, perDomain)
+	throttle.now = clock.now
+	return throttle, clock
+}
+
+func TestThrottlePerIP(t *testing.T) {
+	throttle, clock := newTestThrottle(time.Hour, 2, 0)
+	ctx := context.Background()
+
+	for i := range 2 {
+		if err := throttle.Allow(ctx, "203.0.113.7", ""); err != nil {
+			t.Fatalf("attempt %d: unexpected error %v", i+1, err)
+		}
+		clock.t = clock.t.Add(10 * time.Minute)
+	}
+	if err := throttle.Allow(ctx, "203.0.113.7", ""); !errors.Is(err, ErrTooManyRegistrations) {
+		t.Fatalf("expected ErrTooManyRegistrations, got %v", err)
+	}
+	if err := throttle.Allow(ctx, "203.0.113.8", ""); err != nil {
+		t.Fatalf("expected another IP to be allowed, got %v", err)
+	}
+
+	// The window slides: once the first attempt is an hour old, one more is allowed.
+	clock.t = clock.t.Add(40 * time.Minute)
+	if err := throttle.Allow(ctx, "203.0.113.7", ""); err != nil {
+		t.Fatalf("expected the window to have moved past the first attempt, got %v", err)
+	}
+	if err := throttle.Allow(ctx, "203.0.113.7", ""); !errors.Is(err, ErrTooManyRegistrations) {
+		t.Fatalf("expected the second attempt to still count, got %v", err)
+	}
+
+	// Rejected attempts aren't counted, so a full window later the IP starts afresh.
+	clock.t = clock.t.Add(time.Hour)
+	for i := range 2 {
+		if err := throttle.Allow(ctx, "203.0.113.7", ""); err != nil {
+			t.Fatalf("attempt %d after reset: unexpected error %v", i+1, err)
+		}
+	}
+}
+
+func TestThrottlePerDomain(t *testing.T) {
+	throttle, clock := newTestThrottle(time.Hour, 0, 1)
+	ctx := context.Background()
+
+	if err := throttle.Allow(ctx, "203.0.113.7", "jane@spam.example"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := throttle.Allow(ctx, "198.51.100.1", "john@SPAM.example"); !errors.Is(err, ErrTooManyRegistrations) {
+		t.Fatalf("expected the domain to be limited regardless of case and IP, got %v", err)
+	}
+	if err := throttle.Allow(ctx, "198.51.100.1", ""); err != nil {
+		t.Fatalf("expected a phone registration to skip the domain limit, got %v", err)
+	}
+
+	clock.t = clock.t.Add(time.Hour)
+	if err := throttle.Allow(ctx, "198.51.100.1", "john@spam.example"); err != nil {
+		t.Fatalf("expected the window to reset, got %v", err)
+	}
+}
+
+func TestLookupThrottle(t *testing.T) {
+	store := NewMemoryStore()
+	registrations := NewThrottle(store, time.Hour, 1, 0)
+	lookups := NewLookupThrottle(store, time.Hour, 2)
+	ctx := context.Background()
+
+	for i := range 2 {
+		if err := lookups.Allow(ctx, "203.0.113.7", "john@example.com"); err != nil {
+			t.Fatalf("check %d: unexpected error %v", i+1, err)
+		}
+	}
+	if err := lookups.Allow(ctx, "203.0.113.7", ""); !errors.Is(err, ErrTooManyLookups) {
+		t.Fatalf("expected ErrTooManyLookups, got %v", err)
+	}
+	if err := registrations.Allow(ctx, "203.0.113.7", "john@example.com"); err != nil {
+		t.Fatalf("expected checks not to count towards registrations, got %v", err)
+	}
+}
+
+// failingStore is a Store that always fails.
+type failingStore struct{}
+
+func (failingStore) Allow(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestThrottleStoreError(t *testing.T) {
+	throttle := NewThrottle(failingStore{}, time.Hour, 1, 1)
+	err := throttle.Allow(context.Background(), "203.0.113.7", "")
+	if err == nil || errors.Is(err, ErrTooManyRegistrations) {
+		t.Fatalf("expected the store error, got %v", err)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	store.Allow(context.Background(), "ip:203.0.113.7", 5, time.Hour, start)
+	store.Allow(context.Background(), "ip:203.0.113.8", 5, time.Hour, start.Add(2*time.Hour))
+
+	if _, ok := store.attempts["ip:203.0.113.7"]; ok {
+		t.Fatal("expected the idle key to be swept")
+	}
+	if _, ok := store.attempts["ip:203.0.113.8"]; !ok {
+		t.Fatal("expected the active key to be kept")
+	}
+}
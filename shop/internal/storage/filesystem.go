@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// FileStore is a models.ObjectStore that keeps objects as files under a directory, for
+// development. Objects are served by its Handler, mounted at the store's base URL.
+type FileStore struct {
+	dir     string // The directory objects are written to.
+	baseURL string // The URL the directory is served from.
+}
+
+var _ models.ObjectStore = (*FileStore)(nil)
+
+// NewFileStore creates a FileStore writing to dir, whose objects are served from baseURL,
+// e.g. "/uploads" or "https://cdn.example.com/uploads".
+func NewFileStore(dir, baseURL string) *FileStore {
+	return &FileStore{dir: dir, baseURL: baseURL}
+}
+
+// Put implements models.ObjectStore. The object is written to a temporary file that's
+// renamed into place, so readers never see a partial object. contentType isn't stored; the
+// Handler derives it from the key's extension.
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once the file is renamed.
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return url.JoinPath(s.baseURL, key)
+}
+
+// Delete implements models.ObjectStore.
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL implements models.ObjectStore. The Handler serves every object to anyone with
+// its URL, so this is the object's URL and doesn't expire.
+func (s *FileStore) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	return url.JoinPath(s.baseURL, key)
+}
+
+// path returns the path of the file for key, which must stay within the store's directory.
+func (s *FileStore) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Handler serves the stored objects by key. Directory listings aren't served, so objects
+// can only be fetched by a client that knows their URL.
+func (s *FileStore) Handler() http.Handler {
+	files := http.FileServer(http.Dir(s.dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStorePut(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir, "/uploads")
+
+	url, err := store.Put(context.Background(), "avatars/42/a.png", strings.NewReader("png data"), "image/png")
+	if err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	if url != "/uploads/avatars/42/a.png" {
+		t.Fatalf("expected URL /uploads/avatars/42/a.png, got %q", url)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "avatars", "42", "a.png"))
+	if err != nil || string(data) != "png data" {
+		t.Fatalf("expected the object on disk, got (%q, %v)", data, err)
+	}
+
+	// Putting the same key again replaces the object.
+	if _, err := store.Put(context.Background(), "avatars/42/a.png", strings.NewReader("new data"), "image/png"); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "avatars", "42", "a.png")); string(data) != "new data" {
+		t.Fatalf("expected the object to be replaced, got %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "avatars", "42")); len(entries) != 1 {
+		t.Fatalf("expected no temporary files to be left behind, got %v", entries)
+	}
+}
+
+func TestFileStoreDelete(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir, "/uploads")
+	if _, err := store.Put(context.Background(), "avatars/42/a.png", strings.NewReader("png data"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete(context.Background(), "avatars/42/a.png"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "avatars", "42", "a.png")); !os.IsNotExist(err) {
+		t.Fatalf("expected the object to be removed, got %v", err)
+	}
+	if err := store.Delete(context.Background(), "avatars/42/a.png"); err != nil {
+		t.Fatalf("expected deleting a missing object to succeed, got %v", err)
+	}
+}
+
+func TestFileStoreSignedURL(t *testing.T) {
+	store := NewFileStore(t.TempDir(), "https://cdn.example.com/uploads/")
+	url, err := store.SignedURL(context.Background(), "avatars/42/a.png", time.Minute)
+	if err != nil || url != "https://cdn.example.com/uploads/avatars/42/a.png" {
+		t.Fatalf("expected the object's URL, got (%q, %v)", url, err)
+	}
+}
+
+func TestFileStoreRejectsKeysOutsideDir(t *testing.T) {
+	store := NewFileStore(t.TempDir(), "/uploads")
+	for _, key := range []string{"../escape.png", "/etc/passwd", "avatars/../../escape.png", ""} {
+		if _, err := store.Put(context.Background(), key, strings.NewReader("x"), "image/png"); err == nil {
+			t.Errorf("Put(%q): expected an error", key)
+		}
+		if err := store.Delete(context.Background(), key); err == nil {
+			t.Errorf("Delete(%q): expected an error", key)
+		}
+	}
+}
+
+func TestFileStoreHandler(t *testing.T) {
+	store := NewFileStore(t.TempDir(), "/uploads")
+	if _, err := store.Put(context.Background(), "avatars/42/a.png", strings.NewReader("png data"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	h := http.StripPrefix("/uploads", store.Handler())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/uploads/avatars/42/a.png", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "png data" || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected the object to be served as image/png, got %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	for _, path := range []string{"/uploads/avatars/42/", "/uploads/", "/uploads/avatars/42/missing.png"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const (
+	// DefaultS3Region is the region requests are signed for when none is configured.
+	DefaultS3Region = "us-east-1"
+
+	// maxS3ErrorBody bounds how much of an S3 error response is read.
+	maxS3ErrorBody = 64 << 10
+
+	// maxSignedURLExpiry is the longest a presigned URL can be valid for.
+	maxSignedURLExpiry = 7 * 24 * time.Hour
+)
+
+// S3Store is a models.ObjectStore backed by a bucket of Amazon S3 or an S3-compatible service
+// such as MinIO. Objects are addressed path-style, as Endpoint/Bucket/key.
+type S3Store struct {
+	Endpoint        string       // The service URL (e.g., "https://s3.us-east-1.amazonaws.com", "http://localhost:9000").
+	Region          string       // The region requests are signed for (e.g., "us-east-1").
+	Bucket          string       // The bucket objects are stored in.
+	AccessKeyID     string       // The access key ID.
+	SecretAccessKey string       // The secret access key.
+	PublicURL       string       // The URL the bucket's objects are served from; Endpoint/Bucket if empty.
+	HTTPClient      *http.Client // The HTTP client to use for API requests.
+
+	now func() time.Time // The clock, replaceable in tests.
+}
+
+var _ models.ObjectStore = (*S3Store)(nil)
+
+// NewS3Store creates an S3Store.
+//
+// Parameters:
+//   - endpoint: The service URL.
+//   - region: The region requests are signed for; DefaultS3Region if empty.
+//   - bucket: The bucket objects are stored in.
+//   - accessKeyID: The access key ID.
+//   - secretAccessKey: The secret access key.
+//
+// Returns:
+//   - A new S3Store instance.
+func NewS3Store(endpoint, region, bucket, accessKeyID, secretAccessKey string) *S3Store {
+	if region == "" {
+		region = DefaultS3Region
+	}
+	return &S3Store{
+		Endpoint:        endpoint,
+		Region:          region,
+		Bucket:          bucket,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		now: time.Now,
+	}
+}
+
+// S3Error is an error returned by the S3 API.
+// Use errors.As to inspect the S3 error code, e.g. to detect NoSuchBucket.
+type S3Error struct {
+	StatusCode int    // The HTTP status code of the response.
+	Code       string // The S3 error code (e.g., "AccessDenied").
+	Message    string // A human-readable description of the error.
+}
+
+// Error implements the error interface.
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3 error %s (status: %d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// Put implements models.ObjectStore. The object is read into memory, since S3 needs its
+// length and hash up front.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if err := s.do(req, hashHex(body)); err != nil {
+		return "", fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+
+	if s.PublicURL != "" {
+		return url.JoinPath(s.PublicURL, key)
+	}
+	return s.objectURL(key).String(), nil
+}
+
+// Delete implements models.ObjectStore.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	// S3 answers 204 whether or not the object existed.
+	if err := s.do(req, hashHex(nil)); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+// SignedURL implements models.ObjectStore with a presigned GET URL. S3 caps expires at
+// seven days.
+func (s *S3Store) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > maxSignedURLExpiry {
+		return "", fmt.Errorf("signed URL expiry %v must be positive and at most %v", expires, maxSignedURLExpiry)
+	}
+	return s.signer().presign(http.MethodGet, s.objectURL(key), expires, s.clock()).String(), nil
+}
+
+// objectURL returns the path-style URL of the object stored under key.
+func (s *S3Store) objectURL(key string) *url.URL {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		// Fall back to naive joining; the request itself will surface the bad endpoint.
+		u = &url.URL{Path: s.Endpoint}
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + key
+	u.RawPath = ""
+	return u
+}
+
+// signer returns the request signer for the store's credentials.
+func (s *S3Store) signer() signer {
+	return signer{accessKeyID: s.AccessKeyID, secretAccessKey: s.SecretAccessKey, region: s.Region}
+}
+
+// clock returns the current time.
+func (s *S3Store) clock() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+	return s.now()
+}
+
+// do signs and sends req, whose body has the given SHA-256 hex hash, and decodes an error
+// response into an *S3Error.
+func (s *S3Store) do(req *http.Request, payloadHash string) error {
+	s.signer().sign(req, payloadHash, s.clock())
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return decodeS3Error(resp)
+	}
+	return nil
+}
+
+// decodeS3Error decodes an S3 XML error response into an *S3Error.
+func decodeS3Error(resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxS3ErrorBody))
+	if err != nil {
+		return fmt.Errorf("failed to read error response (status: %d): %w", resp.StatusCode, err)
+	}
+	if err := xml.Unmarshal(raw, &body); err != nil || body.Code == "" {
+		return &S3Error{StatusCode: resp.StatusCode, Code: "Unknown", Message: http.StatusText(resp.StatusCode)}
+	}
+	return &S3Error{StatusCode: resp.StatusCode, Code: body.Code, Message: body.Message}
+}
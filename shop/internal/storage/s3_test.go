@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory S3 API serving a single bucket. It checks that requests are
+// signed, but not the signatures themselves; TestSignerSign covers those.
+type fakeS3 struct {
+	t      *testing.T
+	bucket string
+
+	mu           sync.Mutex
+	objects      map[string]string
+	contentTypes map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>`)
+		return
+	}
+	if r.Method == http.MethodGet {
+		if r.URL.Query().Get("X-Amz-Signature") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	} else if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+		f.t.Errorf("unsigned request %s %s", r.Method, r.URL)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-Amz-Content-Sha256"); got != hashHex(body) {
+			f.t.Errorf("expected the payload hash %s, got %s", hashHex(body), got)
+		}
+		f.objects[key], f.contentTypes[key] = string(body), r.Header.Get("Content-Type")
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, body)
+	}
+}
+
+func newTestS3Store(t *testing.T) (*S3Store, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{t: t, bucket: "shop", objects: map[string]string{}, contentTypes: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return NewS3Store(srv.URL, "", "shop", "minio", "minio-secret"), fake
+}
+
+func TestS3StorePut(t *testing.T) {
+	store, fake := newTestS3Store(t)
+
+	url, err := store.Put(context.Background(), "avatars/42/a.png", strings.NewReader("png data"), "image/png")
+	if err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	if url != store.Endpoint+"/shop/avatars/42/a.png" {
+		t.Fatalf("expected the object's URL in the bucket, got %q", url)
+	}
+	if fake.objects["avatars/42/a.png"] != "png data" || fake.contentTypes["avatars/42/a.png"] != "image/png" {
+		t.Fatalf("expected the object to be stored as image/png, got %q as %q", fake.objects["avatars/42/a.png"], fake.contentTypes["avatars/42/a.png"])
+	}
+
+	store.PublicURL = "https://cdn.example.com/"
+	if url, err := store.Put(context.Background(), "avatars/42/b.png", strings.NewReader("png data"), "image/png"); err != nil || url != "https://cdn.example.com/avatars/42/b.png" {
+		t.Fatalf("expected the object's public URL, got (%q, %v)", url, err)
+	}
+}
+
+func TestS3StoreDelete(t *testing.T) {
+	store, fake := newTestS3Store(t)
+	fake.objects["avatars/42/a.png"] = "png data"
+
+	if err := store.Delete(context.Background(), "avatars/42/a.png"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, ok := fake.objects["avatars/42/a.png"]; ok {
+		t.Fatal("expected the object to be deleted")
+	}
+	if err := store.Delete(context.Background(), "avatars/42/a.png"); err != nil {
+		t.Fatalf("expected deleting a missing object to succeed, got %v", err)
+	}
+}
+
+func TestS3StoreSignedURL(t *testing.T) {
+	store, fake := newTestS3Store(t)
+	fake.objects["avatars/42/a.png"] = "png data"
+	store.now = func() time.Time { return time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC) }
+
+	signed, err := store.SignedURL(context.Background(), "avatars/42/a.png", time.Hour)
+	if err != nil {
+		t.Fatalf("SignedURL returned error: %v", err)
+	}
+	if !strings.HasPrefix(signed, store.Endpoint+"/shop/avatars/42/a.png?") ||
+		!strings.Contains(signed, "X-Amz-Credential=minio%2F20240401%2Fus-east-1%2Fs3%2Faws4_request") ||
+		!strings.Contains(signed, "X-Amz-Expires=3600") {
+		t.Fatalf("unexpected signed URL %s", signed)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != "png data" {
+		t.Fatalf("expected the signed URL to fetch the object, got %d %q", resp.StatusCode, body)
+	}
+
+	for _, expires := range []time.Duration{0, 8 * 24 * time.Hour} {
+		if _, err := store.SignedURL(context.Background(), "avatars/42/a.png", expires); err == nil {
+			t.Errorf("SignedURL(%v): expected an error", expires)
+		}
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	store, _ := newTestS3Store(t)
+	store.Bucket = "missing"
+
+	_, err := store.Put(context.Background(), "avatars/42/a.png", strings.NewReader("png data"), "image/png")
+	var s3Err *S3Error
+	if !errors.As(err, &s3Err) || s3Err.Code != "NoSuchBucket" || s3Err.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected S3 error NoSuchBucket, got %v", err)
+	}
+}
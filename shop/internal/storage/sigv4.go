@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sigV4Algorithm identifies AWS Signature Version 4 in signed requests.
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+	// sigV4TimeFormat is the format of the X-Amz-Date timestamp.
+	sigV4TimeFormat = "20060102T150405Z"
+
+	// unsignedPayload stands in for the payload hash of presigned URLs, whose body isn't known
+	// when they're signed.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// signer signs S3 requests with AWS Signature Version 4.
+type signer struct {
+	accessKeyID     string
+	secretAccessKey string
+	region          string
+}
+
+// sign adds the X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers to req, signing
+// its Host, the headers already set and the payload with the given SHA-256 hex hash.
+func (s signer) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(sigV4TimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	scope := s.scope(now)
+	signature := s.signature(now, scope, req.Method, req.URL, canonicalHeaders.String(), signedHeaders, payloadHash)
+	req.Header.Set("Authorization", sigV4Algorithm+" Credential="+s.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// presign returns u with the query parameters that authorize a method request to it until
+// expires from now.
+func (s signer) presign(method string, u *url.URL, expires time.Duration, now time.Time) *url.URL {
+	scope := s.scope(now)
+	signed := *u
+	query := signed.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", s.accessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.UTC().Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	signed.RawQuery = canonicalQuery(query)
+
+	signature := s.signature(now, scope, method, &signed, "host:"+u.Host+"\n", "host", unsignedPayload)
+	signed.RawQuery += "&X-Amz-Signature=" + signature
+	return &signed
+}
+
+// scope returns the credential scope of a request signed at now.
+func (s signer) scope(now time.Time) string {
+	return now.UTC().Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature computes the signature of a canonical request.
+func (s signer) signature(now time.Time, scope, method string, u *url.URL, canonicalHeaders, signedHeaders, payloadHash string) string {
+	canonicalRequest := strings.Join([]string{
+		method,
+		uriEncode(u.EscapedPath(), false),
+		canonicalQuery(u.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.UTC().Format(sigV4TimeFormat),
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), now.UTC().Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalQuery encodes query sorted by name, with names and values URI-encoded.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var pairs []string
+	for _, name := range names {
+		values := slices.Clone(query[name])
+		slices.Sort(values)
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters, and slashes unless
+// encodeSlash is set. Escapes already in s, as in an escaped path, are kept as they are.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		case c == '%' && !encodeSlash && i+2 < len(s):
+			// An escape from url.URL.EscapedPath; normalize it to upper case.
+			b.WriteString("%" + strings.ToUpper(s[i+1:i+3]))
+			i += 2
+		default:
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+// hashHex returns the hex-encoded SHA-256 hash of data.
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
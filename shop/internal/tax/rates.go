@@ -0,0 +1,107 @@
+package tax
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const (
+	// ppmPerPercent is one percent in parts per million, the unit rates are kept in so
+	// rates such as 8.875% are exact.
+	ppmPerPercent = 10_000
+
+	// million is a whole, 100%, in parts per million.
+	million = 100 * ppmPerPercent
+)
+
+// RegionRates is a models.TaxCalculator charging a flat rate by the region an order ships to.
+// Rates are keyed by country (e.g., "US") or by country and region (e.g., "US-CA"); a
+// region's rate takes precedence over its country's. Orders shipping elsewhere, or without
+// a shipping address, are tax exempt.
+type RegionRates struct {
+	rates map[string]int64 // Rates in parts per million, by upper case key.
+}
+
+var _ models.TaxCalculator = (*RegionRates)(nil)
+
+// NewRegionRates creates a RegionRates calculator.
+//
+// Parameters:
+//   - percents: The tax rates, as percentages, keyed by country or country and region.
+//
+// Returns:
+//   - A new RegionRates calculator.
+//   - An error if a key is empty or a rate isn't between 0 and 100.
+func NewRegionRates(percents map[string]float64) (*RegionRates, error) {
+	r := &RegionRates{rates: make(map[string]int64, len(percents))}
+	for key, percent := range percents {
+		key = strings.ToUpper(strings.TrimSpace(key))
+		if key == "" {
+			return nil, fmt.Errorf("empty region for rate %v%%", percent)
+		}
+		if !(percent >= 0 && percent <= 100) {
+			return nil, fmt.Errorf("rate %v%% for %s must be between 0 and 100", percent, key)
+		}
+		r.rates[key] = int64(math.Round(percent * ppmPerPercent))
+	}
+	return r, nil
+}
+
+// ParseRegionRates parses a comma-separated list of region rates such as the TAX_RATES
+// environment variable.
+//
+// Parameters:
+//   - list: The rates as region=percent pairs, e.g. "US-CA=7.25,US-NY=8.875,GB=20".
+//
+// Returns:
+//   - A new RegionRates calculator.
+//   - An error if an entry is malformed or its rate is out of range.
+func ParseRegionRates(list string) (*RegionRates, error) {
+	percents := map[string]float64{}
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate %q: expected region=percent", entry)
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate %q: %w", entry, err)
+		}
+		percents[key] = percent
+	}
+	return NewRegionRates(percents)
+}
+
+// Tax implements models.TaxCalculator. The tax is rounded to the nearest cent, halves up.
+func (r *RegionRates) Tax(ctx context.Context, address *models.ShippingAddress, amountCents int64, currency string) (int64, error) {
+	if address == nil || amountCents <= 0 {
+		return 0, nil
+	}
+	rate, ok := r.rate(address)
+	if !ok {
+		return 0, nil
+	}
+	// Splitting off the whole millions keeps amountCents * rate from overflowing.
+	whole, rest := amountCents/million, amountCents%million
+	return whole*rate + (rest*rate+million/2)/million, nil
+}
+
+// rate returns the rate for the address's region, or else its country.
+func (r *RegionRates) rate(address *models.ShippingAddress) (int64, bool) {
+	country := strings.ToUpper(strings.TrimSpace(address.Country))
+	if region := strings.ToUpper(strings.TrimSpace(address.Region)); region != "" {
+		if rate, ok := r.rates[country+"-"+region]; ok {
+			return rate, true
+		}
+	}
+	rate, ok := r.rates[country]
+	return rate, ok
+}
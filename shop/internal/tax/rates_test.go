@@ -0,0 +1,99 @@
+package tax
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func newTestRates(t *testing.T) *RegionRates {
+	t.Helper()
+	rates, err := ParseRegionRates("US-CA=7.25, US-NY=8.875%, US-OR=0, gb=20")
+	if err != nil {
+		t.Fatalf("ParseRegionRates returned error: %v", err)
+	}
+	return rates
+}
+
+func TestRegionRatesTax(t *testing.T) {
+	rates := newTestRates(t)
+
+	for name, tc := range map[string]struct {
+		address *models.ShippingAddress
+		amount  int64
+		want    int64
+	}{
+		"taxed region":        {&models.ShippingAddress{Country: "US", Region: "CA"}, 10000, 725},
+		"fractional rate":     {&models.ShippingAddress{Country: "US", Region: "NY"}, 10000, 888},
+		"lower case region":   {&models.ShippingAddress{Country: "us", Region: "ca "}, 10000, 725},
+		"country rate":        {&models.ShippingAddress{Country: "GB", Region: "London"}, 2499, 500},
+		"exempt region":       {&models.ShippingAddress{Country: "US", Region: "OR"}, 10000, 0},
+		"region without rate": {&models.ShippingAddress{Country: "US", Region: "TX"}, 10000, 0},
+		"no shipping address": {nil, 10000, 0},
+		"nothing to tax":      {&models.ShippingAddress{Country: "US", Region: "CA"}, 0, 0},
+	} {
+		got, err := rates.Tax(context.Background(), tc.address, tc.amount, "USD")
+		if err != nil {
+			t.Fatalf("%s: Tax returned error: %v", name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected tax %d, got %d", name, tc.want, got)
+		}
+	}
+}
+
+func TestRegionRatesRounding(t *testing.T) {
+	rates := newTestRates(t)
+	ca := &models.ShippingAddress{Country: "US", Region: "CA"}
+
+	// At 7.25%, 1 cent is 0.0725 cents of tax, 7 cents 0.5075 and 2 cents 0.145: amounts
+	// are rounded to the nearest cent, and halves up.
+	for amount, want := range map[int64]int64{
+		1:    0,
+		7:    1,
+		2:    0,
+		199:  14,  // 14.4275
+		1999: 145, // 144.9275
+		2069: 150, // 150.0025
+	} {
+		got, err := rates.Tax(context.Background(), ca, amount, "USD")
+		if err != nil {
+			t.Fatalf("Tax returned error: %v", err)
+		}
+		if got != want {
+			t.Errorf("tax on %d cents: expected %d, got %d", amount, want, got)
+		}
+	}
+
+	// 50% of an odd amount is exactly half a cent, which rounds up.
+	half, err := NewRegionRates(map[string]float64{"XX": 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := half.Tax(context.Background(), &models.ShippingAddress{Country: "XX"}, 3, "USD"); got != 2 {
+		t.Errorf("expected half a cent to round up to 2, got %d", got)
+	}
+
+	// Large amounts don't overflow.
+	if got, _ := rates.Tax(context.Background(), ca, 1_000_000_000_000_001, "USD"); got != 72_500_000_000_000 {
+		t.Errorf("expected 72500000000000, got %d", got)
+	}
+}
+
+func TestParseRegionRatesErrors(t *testing.T) {
+	for _, list := range []string{
+		"US-CA",
+		"US-CA=abc",
+		"US-CA=-1",
+		"US-CA=101",
+		"=5",
+	} {
+		if _, err := ParseRegionRates(list); err == nil {
+			t.Errorf("expected an error for %q", list)
+		}
+	}
+	if rates, err := ParseRegionRates(""); err != nil || len(rates.rates) != 0 {
+		t.Errorf("expected no rates for an empty list, got %v, %v", rates, err)
+	}
+}
@@ -0,0 +1,159 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+)
+
+const (
+	// DefaultExpiry is how long a session token remains valid when JWT_EXPIRY is not set.
+	DefaultExpiry = time.Hour
+
+	// DefaultRefreshExpiry is how long a refresh token remains valid when
+	// REFRESH_TOKEN_EXPIRY is not set.
+	DefaultRefreshExpiry = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalid is returned when a token is malformed or its signature doesn't verify.
+	ErrInvalid = errors.New("invalid token")
+
+	// ErrExpired is returned when a token's expiry has passed.
+	ErrExpired = errors.New("token expired")
+)
+
+// Claims are the claims encoded in a session token.
+type Claims struct {
+	UserID string `json:"uid"`    // The user's ID in the users table.
+	OktaID string `json:"oktaId"` // The user's ID in Okta.
+	jwt.RegisteredClaims
+}
+
+// Signer issues HS256-signed session tokens.
+type Signer struct {
+	secret []byte        // The HMAC secret used to sign tokens.
+	expiry time.Duration // How long issued tokens remain valid.
+	clock  clock.Clock   // The time tokens are issued at and checked against.
+}
+
+// New creates a new token signer.
+//
+// Parameters:
+//   - secret: The HMAC secret used to sign tokens.
+//   - expiry: How long issued tokens remain valid.
+//
+// Returns:
+//   - A new Signer instance.
+func New(secret []byte, expiry time.Duration) *Signer {
+	return &Signer{
+		secret: secret,
+		expiry: expiry,
+		clock:  clock.Real{},
+	}
+}
+
+// WithClock returns a copy of the signer that issues and checks tokens against c, e.g. a
+// clock.Fake in tests. The original signer is left unchanged.
+//
+// Parameters:
+//   - c: The clock tokens are issued at and checked against.
+//
+// Returns:
+//   - A new Signer with the original's secret and expiry.
+func (s *Signer) WithClock(c clock.Clock) *Signer {
+	copied := *s
+	copied.clock = c
+	return &copied
+}
+
+// Sign issues a session token for a user.
+//
+// Parameters:
+//   - userID: The user's ID in the users table.
+//   - oktaID: The user's ID in Okta.
+//
+// Returns:
+//   - The signed token string.
+//   - An error if signing fails.
+func (s *Signer) Sign(userID, oktaID string) (string, error) {
+	now := s.clock.Now()
+	claims := Claims{
+		UserID: userID,
+		OktaID: oktaID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.expiry)),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// Parse validates a session token and returns its claims.
+//
+// Parameters:
+//   - signed: The signed token string.
+//
+// Returns:
+//   - The token's claims.
+//   - ErrExpired if the token has expired, or ErrInvalid if it is otherwise malformed or
+//     not signed by this signer.
+func (s *Signer) Parse(signed string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(signed, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithTimeFunc(s.clock.Now))
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, fmt.Errorf("%w: %w", ErrExpired, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if claims.UserID == "" {
+		return nil, fmt.Errorf("%w: missing uid claim", ErrInvalid)
+	}
+	return &claims, nil
+}
+
+// NewRefresh generates an opaque refresh token. Unlike session tokens, refresh tokens carry
+// no claims; they're looked up by their hash, so they can be revoked.
+//
+// Returns:
+//   - The token to give the client.
+//   - The hash the token is stored by, as returned by HashRefresh.
+//   - An error if no random bytes could be read.
+func NewRefresh() (token, hash string, err error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b[:])
+	return token, HashRefresh(token), nil
+}
+
+// HashRefresh returns the hex-encoded SHA-256 hash a refresh token is stored by. The token
+// has enough entropy that a fast, unsalted hash is safe.
+//
+// Parameters:
+//   - token: The refresh token given to the client.
+//
+// Returns:
+//   - The token's hash.
+func HashRefresh(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,106 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+)
+
+func TestSign(t *testing.T) {
+	secret := []byte("test-secret")
+	signed, err := New(secret, time.Minute).Sign("42", "00u1")
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+
+	var claims Claims
+	parsed, err := jwt.ParseWithClaims(signed, &claims, func(t *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !parsed.Valid {
+		t.Fatalf("failed to parse signed token: %v", err)
+	}
+	if claims.UserID != "42" || claims.OktaID != "00u1" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if ttl := time.Until(claims.ExpiresAt.Time); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("unexpected expiry %v", claims.ExpiresAt)
+	}
+}
+
+func TestParse(t *testing.T) {
+	s := New([]byte("test-secret"), time.Minute)
+	signed, err := s.Sign("42", "00u1")
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+
+	claims, err := s.Parse(signed)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if claims.UserID != "42" || claims.OktaID != "00u1" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	expired, err := New([]byte("test-secret"), -time.Minute).Sign("42", "00u1")
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+	if _, err := s.Parse(expired); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+
+	other, err := New([]byte("other-secret"), time.Minute).Sign("42", "00u1")
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+	if _, err := s.Parse(other); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid for foreign signature, got %v", err)
+	}
+	if _, err := s.Parse("not-a-token"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid for garbage, got %v", err)
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := clock.NewFake(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	s := New([]byte("test-secret"), time.Hour).WithClock(now)
+
+	signed, err := s.Sign("42", "00u1")
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+
+	now.Advance(time.Hour - time.Second)
+	if _, err := s.Parse(signed); err != nil {
+		t.Fatalf("expected the token to be valid a second before it expires, got %v", err)
+	}
+
+	now.Advance(time.Second)
+	if _, err := s.Parse(signed); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired once the expiry is reached, got %v", err)
+	}
+}
+
+func TestNewRefresh(t *testing.T) {
+	token, hash, err := NewRefresh()
+	if err != nil {
+		t.Fatalf("NewRefresh returned error: %v", err)
+	}
+	if len(token) != 43 || hash != HashRefresh(token) || hash == token {
+		t.Fatalf("unexpected token %q with hash %q", token, hash)
+	}
+
+	other, _, err := NewRefresh()
+	if err != nil {
+		t.Fatalf("NewRefresh returned error: %v", err)
+	}
+	if other == token {
+		t.Fatal("expected a different token each time")
+	}
+}
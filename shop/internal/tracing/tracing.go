@@ -0,0 +1,52 @@
+// Package tracing configures OpenTelemetry tracing for the API.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName is the service.name resource attribute of exported spans.
+const ServiceName = "shop-api"
+
+// Setup installs the global W3C trace context propagator and, if OTEL_EXPORTER_OTLP_ENDPOINT
+// is set, a global tracer provider exporting spans to that endpoint over OTLP/HTTP. The
+// exporter reads the other standard OTEL_EXPORTER_OTLP_* variables, such as headers.
+//
+// Without an endpoint, spans are not recorded, but incoming trace context is still forwarded
+// on outgoing requests.
+//
+// Parameters:
+//   - ctx: The context for creating the exporter.
+//
+// Returns:
+//   - A function that flushes pending spans and shuts the tracer provider down.
+//   - An error if the exporter can't be created.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
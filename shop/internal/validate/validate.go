@@ -0,0 +1,76 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+var (
+	// ErrInvalidEmail is returned when an email address is malformed.
+	ErrInvalidEmail = errors.New("invalid email")
+
+	// ErrInvalidPhone is returned when a phone number can't be normalized to E.164.
+	ErrInvalidPhone = errors.New("invalid phone number")
+)
+
+// Email checks that email is a single bare address such as "john.doe@example.com".
+// Display names ("John <john@example.com>") and addresses without a dotted domain are rejected.
+// Okta matches logins case-insensitively, so addresses are lowercased to be stored and looked
+// up the same way.
+//
+// Parameters:
+//   - email: The email address to check.
+//
+// Returns:
+//   - The address lowercased, with surrounding whitespace removed.
+//   - ErrInvalidEmail if the address is malformed.
+func Email(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", fmt.Errorf("%w: %q is not a valid email address", ErrInvalidEmail, email)
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fmt.Errorf("%w: %q is not a valid email address", ErrInvalidEmail, email)
+	}
+	return strings.ToLower(email), nil
+}
+
+// Phone normalizes a phone number to E.164 ("+" followed by up to 15 digits, the first non-zero).
+// Spaces, dashes, dots and parentheses are removed, and a leading "00" international prefix is
+// treated as "+". Numbers without a country code are rejected since the region can't be inferred.
+//
+// Parameters:
+//   - phone: The phone number to normalize, e.g. "+1 (555) 555-0100".
+//
+// Returns:
+//   - The E.164 form of the number, e.g. "+15555550100".
+//   - ErrInvalidPhone if the number can't be normalized.
+func Phone(phone string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9', r == '+' && b.Len() == 0:
+			b.WriteRune(r)
+		case r == ' ', r == '-', r == '.', r == '(', r == ')':
+		default:
+			return "", fmt.Errorf("%w: %q contains invalid characters", ErrInvalidPhone, phone)
+		}
+	}
+
+	normalized := b.String()
+	if strings.HasPrefix(normalized, "00") {
+		normalized = "+" + normalized[2:]
+	}
+	if !strings.HasPrefix(normalized, "+") {
+		return "", fmt.Errorf("%w: %q must include a country code, e.g. +15555550100", ErrInvalidPhone, phone)
+	}
+	digits := normalized[1:]
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("%w: %q is not an E.164 number", ErrInvalidPhone, phone)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,48 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEmail(t *testing.T) {
+	valid := map[string]string{
+		"john.doe@example.com":     "john.doe@example.com",
+		"  jane+shop@example.co ":  "jane+shop@example.co",
+		"John.Doe@Example.COM":     "john.doe@example.com",
+		"o'brien@mail.example.org": "o'brien@mail.example.org",
+	}
+	for in, want := range valid {
+		got, err := Email(in)
+		if err != nil || got != want {
+			t.Errorf("Email(%q) = (%q, %v), want (%q, nil)", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "john.doe", "john@", "@example.com", "john@localhost", "john@example.", "John <john@example.com>", "a@b@example.com"} {
+		if _, err := Email(in); !errors.Is(err, ErrInvalidEmail) {
+			t.Errorf("Email(%q) = %v, want ErrInvalidEmail", in, err)
+		}
+	}
+}
+
+func TestPhone(t *testing.T) {
+	valid := map[string]string{
+		"+15555550100":      "+15555550100",
+		"+1 (555) 555-0100": "+15555550100",
+		"0044 20 7946 0958": "+442079460958",
+		"+49.30.1234567":    "+49301234567",
+	}
+	for in, want := range valid {
+		got, err := Phone(in)
+		if err != nil || got != want {
+			t.Errorf("Phone(%q) = (%q, %v), want (%q, nil)", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "5555550100", "+1555", "+0123456789", "+1234567890123456", "+1 555 CALL NOW", "+1+5555550100"} {
+		if _, err := Phone(in); !errors.Is(err, ErrInvalidPhone) {
+			t.Errorf("Phone(%q) = %v, want ErrInvalidPhone", in, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// OrderCompletedEvent is the type of the event sent to the accounting system when an order
+// is delivered.
+const OrderCompletedEvent = "order.completed"
+
+// OrderCompletedSchemaVersion is the version of the OrderCompleted payload. It's bumped when
+// a field is removed or changes meaning, so the accounting system can reject payloads it
+// doesn't understand; adding a field doesn't bump it.
+const OrderCompletedSchemaVersion = 1
+
+// OrderCompleted is the payload of an order.completed event. Amounts are in the minor unit
+// of Currency. Deliveries are sent at least once, so the accounting system should record
+// each OrderID only once.
+type OrderCompleted struct {
+	SchemaVersion   int                     `json:"schemaVersion"`
+	OrderID         string                  `json:"orderId"`
+	UserID          string                  `json:"userId"`
+	Currency        string                  `json:"currency"`
+	Items           []*OrderCompletedItem   `json:"items"`
+	SubtotalCents   int64                   `json:"subtotalCents"` // The items' total.
+	DiscountCents   int64                   `json:"discountCents"` // How much CouponCode took off the subtotal.
+	CouponCode      *string                 `json:"couponCode"`
+	TaxCents        int64                   `json:"taxCents"`   // The tax on the discounted subtotal.
+	TotalCents      int64                   `json:"totalCents"` // The subtotal less the discount, plus tax.
+	ShippingAddress *models.ShippingAddress `json:"shippingAddress"`
+	PlacedAt        time.Time               `json:"placedAt"`
+	CompletedAt     time.Time               `json:"completedAt"` // When the order was marked DELIVERED.
+}
+
+// OrderCompletedItem is a line of an OrderCompleted payload.
+type OrderCompletedItem struct {
+	ProductID      string `json:"productId"`
+	Name           string `json:"name"`
+	SKU            string `json:"sku"`
+	Qty            int    `json:"qty"`
+	UnitPriceCents int64  `json:"unitPriceCents"`
+	LineTotalCents int64  `json:"lineTotalCents"` // Qty times UnitPriceCents.
+}
+
+// NewOrderCompleted returns the order.completed payload of a delivered order.
+//
+// Parameters:
+//   - order: The order, with its Items loaded.
+//   - completedAt: When the order was delivered.
+//
+// Returns:
+//   - The payload, at the current schema version.
+func NewOrderCompleted(order *models.Order, completedAt time.Time) *OrderCompleted {
+	items := make([]*OrderCompletedItem, len(order.Items))
+	for i, item := range order.Items {
+		items[i] = &OrderCompletedItem{
+			ProductID:      item.ProductID,
+			Name:           item.Name,
+			SKU:            item.SKU,
+			Qty:            item.Qty,
+			UnitPriceCents: item.UnitPriceCents,
+			LineTotalCents: int64(item.Qty) * item.UnitPriceCents,
+		}
+	}
+	return &OrderCompleted{
+		SchemaVersion:   OrderCompletedSchemaVersion,
+		OrderID:         order.ID,
+		UserID:          order.UserID,
+		Currency:        order.Currency,
+		Items:           items,
+		SubtotalCents:   order.SubtotalCents,
+		DiscountCents:   order.DiscountCents,
+		CouponCode:      order.CouponCode,
+		TaxCents:        order.TaxCents,
+		TotalCents:      order.TotalCents,
+		ShippingAddress: order.ShippingAddress,
+		PlacedAt:        order.CreatedAt,
+		CompletedAt:     completedAt,
+	}
+}
+
+// Accounting queues the events the accounting system is sent, which the dispatcher delivers
+// with its retries.
+type Accounting struct {
+	dispatcher *Dispatcher
+	url        string
+}
+
+// NewAccounting creates an Accounting.
+//
+// Parameters:
+//   - dispatcher: The dispatcher events are queued with.
+//   - url: The accounting system's endpoint.
+//
+// Returns:
+//   - An Accounting that sends events to url.
+func NewAccounting(dispatcher *Dispatcher, url string) *Accounting {
+	return &Accounting{dispatcher: dispatcher, url: url}
+}
+
+// OrderCompleted queues the order.completed event of a delivered order.
+//
+// Parameters:
+//   - order: The order, with its Items loaded.
+//   - completedAt: When the order was delivered.
+//
+// Returns:
+//   - The queued delivery.
+//   - An error if the delivery can't be stored.
+func (a *Accounting) OrderCompleted(ctx context.Context, order *models.Order, completedAt time.Time) (*models.WebhookDelivery, error) {
+	return a.dispatcher.Enqueue(ctx, OrderCompletedEvent, a.url, NewOrderCompleted(order, completedAt))
+}
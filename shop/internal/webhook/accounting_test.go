@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+func TestAccountingOrderCompleted(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	deliveries := &fakeDeliveries{}
+	dispatcher := NewDispatcher(deliveries, http.DefaultClient, "", DefaultRetryPolicy(), time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil))).WithClock(clock.NewFake(now))
+	accounting := NewAccounting(dispatcher, "https://ledger.example.com/orders")
+
+	coupon := "SAVE10"
+	order := &models.Order{
+		ID:            "100",
+		UserID:        "42",
+		Status:        models.OrderStatusDelivered,
+		SubtotalCents: 2500,
+		DiscountCents: 250,
+		TaxCents:      180,
+		TotalCents:    2430,
+		CouponCode:    &coupon,
+		Currency:      "USD",
+		Items: []*models.OrderItem{
+			{ProductID: "7", Name: "Mug", SKU: "MUG-1", Qty: 2, UnitPriceCents: 1000},
+			{ProductID: "8", Name: "Coaster", SKU: "CST-1", Qty: 1, UnitPriceCents: 500},
+		},
+		CreatedAt: now.Add(-72 * time.Hour),
+	}
+	delivery, err := accounting.OrderCompleted(context.Background(), order, now)
+	if err != nil {
+		t.Fatalf("OrderCompleted returned error: %v", err)
+	}
+	if delivery.EventType != OrderCompletedEvent || delivery.URL != "https://ledger.example.com/orders" || delivery.Status != models.WebhookDeliveryStatusPending {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(delivery.Payload, &payload); err != nil {
+		t.Fatalf("payload isn't JSON: %v", err)
+	}
+	want := map[string]any{
+		"schemaVersion": float64(OrderCompletedSchemaVersion),
+		"orderId":       "100",
+		"userId":        "42",
+		"currency":      "USD",
+		"subtotalCents": float64(2500),
+		"discountCents": float64(250),
+		"couponCode":    "SAVE10",
+		"taxCents":      float64(180),
+		"totalCents":    float64(2430),
+		"placedAt":      "2023-12-30T03:04:05Z",
+		"completedAt":   "2024-01-02T03:04:05Z",
+	}
+	for field, value := range want {
+		if payload[field] != value {
+			t.Errorf("%s: expected %v, got %v", field, value, payload[field])
+		}
+	}
+	items, _ := payload["items"].([]any)
+	if len(items) != 2 {
+		t.Fatalf("expected both items, got %v", payload["items"])
+	}
+	if first := items[0].(map[string]any); first["sku"] != "MUG-1" || first["qty"] != float64(2) || first["lineTotalCents"] != float64(2000) {
+		t.Errorf("unexpected line %v", first)
+	}
+}
@@ -0,0 +1,242 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a delivery is attempted before it's marked dead
+	// when WEBHOOK_MAX_ATTEMPTS isn't set.
+	DefaultMaxAttempts = 8
+
+	// DefaultRetryBaseDelay is the wait before the first retry of a failed delivery when
+	// WEBHOOK_RETRY_BASE_DELAY isn't set. Each later retry waits twice as long as the last.
+	DefaultRetryBaseDelay = 30 * time.Second
+
+	// DefaultRetryMaxDelay caps the wait between retries when WEBHOOK_RETRY_MAX_DELAY isn't set.
+	DefaultRetryMaxDelay = 6 * time.Hour
+
+	// DefaultDispatchInterval is how often due deliveries are sent when
+	// WEBHOOK_DISPATCH_INTERVAL isn't set.
+	DefaultDispatchInterval = 15 * time.Second
+
+	// DefaultDeliveryTimeout is how long an endpoint is given to answer a delivery.
+	DefaultDeliveryTimeout = 10 * time.Second
+)
+
+const (
+	// DeliverySignatureHeader carries the signature of an outbound delivery, in the same
+	// "t=<unix time>,v1=<hex HMAC-SHA256>" form as Stripe's, so endpoints can verify it the
+	// same way.
+	DeliverySignatureHeader = "X-Shop-Signature"
+
+	// DeliveryEventHeader carries the event type of an outbound delivery.
+	DeliveryEventHeader = "X-Shop-Event"
+
+	// DeliveryIDHeader carries the ID of an outbound delivery. Deliveries are sent at least
+	// once, so endpoints should use it to ignore repeats.
+	DeliveryIDHeader = "X-Shop-Delivery"
+)
+
+const (
+	// dispatchBatchSize is the most deliveries sent per dispatch.
+	dispatchBatchSize = 20
+
+	// dispatchLease is how long claimed deliveries are hidden from other workers while
+	// they're sent. It comfortably exceeds a batch of timed-out attempts, so a delivery is
+	// only claimed twice if the worker sending it dies.
+	dispatchLease = 5 * time.Minute
+
+	// maxErrorBodySize bounds how much of a failed response's body is kept as the reason.
+	maxErrorBodySize = 512
+)
+
+// RetryPolicy is how failed deliveries are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // How many attempts are made before a delivery is marked dead.
+	BaseDelay   time.Duration // The wait before the first retry, doubled for each later one.
+	MaxDelay    time.Duration // The longest wait between retries.
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: DefaultMaxAttempts, BaseDelay: DefaultRetryBaseDelay, MaxDelay: DefaultRetryMaxDelay}
+}
+
+// backoff returns how long to wait before retrying a delivery that has failed attempts times.
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Dispatcher sends outbound webhook deliveries, retrying failed ones with exponential backoff
+// until they succeed or run out of attempts and are marked dead.
+type Dispatcher struct {
+	deliveries models.WebhookDeliveryRepository
+	client     *http.Client
+	secret     string
+	retry      RetryPolicy
+	interval   time.Duration
+	logger     *slog.Logger
+	clock      clock.Clock // What deliveries are scheduled by.
+}
+
+// NewDispatcher creates a Dispatcher.
+//
+// Parameters:
+//   - deliveries: The repository deliveries are queued in.
+//   - client: The client deliveries are sent with; its timeout bounds each attempt.
+//   - secret: The key deliveries are signed with, or empty to send them unsigned.
+//   - retry: How failed deliveries are retried.
+//   - interval: How long to wait between dispatches.
+//   - logger: Where failed deliveries are logged.
+//
+// Returns:
+//   - A Dispatcher that starts sending deliveries when Run is called.
+func NewDispatcher(deliveries models.WebhookDeliveryRepository, client *http.Client, secret string, retry RetryPolicy, interval time.Duration, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{deliveries: deliveries, client: client, secret: secret, retry: retry, interval: interval, logger: logger, clock: clock.Real{}}
+}
+
+// WithClock returns a copy of the dispatcher that schedules deliveries by c's current time.
+// The original dispatcher is left unchanged.
+//
+// Parameters:
+//   - c: The clock deliveries are scheduled by.
+//
+// Returns:
+//   - A new Dispatcher with the original's repository, client, secret, policy and logger.
+func (d *Dispatcher) WithClock(c clock.Clock) *Dispatcher {
+	copied := *d
+	copied.clock = c
+	return &copied
+}
+
+// Enqueue queues an event to be POSTed to url as JSON at the next dispatch.
+//
+// Parameters:
+//   - eventType: The type of the event, e.g. "order.completed".
+//   - url: The endpoint the event is sent to.
+//   - payload: The event, encoded with encoding/json.
+//
+// Returns:
+//   - The queued delivery.
+//   - An error if the payload can't be encoded or the delivery can't be stored.
+func (d *Dispatcher) Enqueue(ctx context.Context, eventType, url string, payload any) (*models.WebhookDelivery, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s payload: %w", eventType, err)
+	}
+	delivery := &models.WebhookDelivery{EventType: eventType, URL: url, Payload: data, NextAttemptAt: d.clock.Now()}
+	if err := d.deliveries.Enqueue(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// Run dispatches once immediately and then every interval until ctx is cancelled. A failed
+// dispatch is logged and retried at the next interval.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch sends the deliveries that are due and records the outcome of each.
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	now := d.clock.Now()
+	deliveries, err := d.deliveries.Claim(ctx, now, now.Add(dispatchLease), d.retry.MaxAttempts, dispatchBatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.ErrorContext(ctx, "failed to claim webhook deliveries", slog.Any("error", err))
+		}
+		return
+	}
+	for _, delivery := range deliveries {
+		log := d.logger.With(slog.String("delivery_id", delivery.ID), slog.String("event", delivery.EventType))
+
+		sendErr := d.send(ctx, delivery)
+		if ctx.Err() != nil {
+			// Shutting down; the lease runs out and the delivery is claimed again.
+			return
+		}
+		now := d.clock.Now()
+		if sendErr == nil {
+			if err := d.deliveries.MarkDelivered(ctx, delivery.ID, now); err != nil {
+				log.ErrorContext(ctx, "failed to record webhook delivery", slog.Any("error", err))
+			}
+			continue
+		}
+
+		attempts := delivery.Attempts + 1
+		dead := attempts >= d.retry.MaxAttempts
+		if err := d.deliveries.MarkFailed(ctx, delivery.ID, sendErr.Error(), now.Add(d.retry.backoff(attempts)), dead); err != nil {
+			log.ErrorContext(ctx, "failed to record failed webhook delivery", slog.Any("error", err))
+			continue
+		}
+		if dead {
+			log.ErrorContext(ctx, "webhook delivery is dead", slog.Int("attempts", attempts), slog.Any("error", sendErr))
+		} else {
+			log.WarnContext(ctx, "webhook delivery failed", slog.Int("attempts", attempts), slog.Any("error", sendErr))
+		}
+	}
+}
+
+// send POSTs a delivery's payload to its URL, signed if the dispatcher has a secret. Any
+// response other than a 2xx is a failure.
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryEventHeader, delivery.EventType)
+	req.Header.Set(DeliveryIDHeader, delivery.ID)
+	if d.secret != "" {
+		req.Header.Set(DeliverySignatureHeader, signPayload(delivery.Payload, d.secret, d.clock.Now()))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return fmt.Errorf("endpoint responded %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// signPayload returns the signature header of body signed with secret at now, computed over
+// "<unix time>.<body>" as verifyStripeSignature expects.
+func signPayload(body []byte, secret string, now time.Time) string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/clock"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// fakeDeliveries is a models.WebhookDeliveryRepository that keeps deliveries in memory.
+type fakeDeliveries struct {
+	models.WebhookDeliveryRepository
+	mu         sync.Mutex
+	deliveries []*models.WebhookDelivery
+}
+
+func (f *fakeDeliveries) Enqueue(ctx context.Context, delivery *models.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delivery.ID = strconv.Itoa(len(f.deliveries) + 1)
+	delivery.Status = models.WebhookDeliveryStatusPending
+	f.deliveries = append(f.deliveries, delivery)
+	return nil
+}
+
+func (f *fakeDeliveries) Claim(ctx context.Context, now, leaseUntil time.Time, maxAttempts, limit int) ([]*models.WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var claimed []*models.WebhookDelivery
+	for _, d := range f.deliveries {
+		due := d.Status == models.WebhookDeliveryStatusPending || d.Status == models.WebhookDeliveryStatusFailed
+		if due && !d.NextAttemptAt.After(now) && d.Attempts < maxAttempts && len(claimed) < limit {
+			d.NextAttemptAt = leaseUntil
+			copied := *d
+			claimed = append(claimed, &copied)
+		}
+	}
+	return claimed, nil
+}
+
+func (f *fakeDeliveries) find(id string) *models.WebhookDelivery {
+	for _, d := range f.deliveries {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+func (f *fakeDeliveries) MarkDelivered(ctx context.Context, id string, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := f.find(id)
+	d.Status = models.WebhookDeliveryStatusDelivered
+	d.Attempts++
+	d.DeliveredAt = &at
+	return nil
+}
+
+func (f *fakeDeliveries) MarkFailed(ctx context.Context, id, reason string, nextAttemptAt time.Time, dead bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := f.find(id)
+	d.Status = models.WebhookDeliveryStatusFailed
+	if dead {
+		d.Status = models.WebhookDeliveryStatusDead
+	}
+	d.Attempts++
+	d.LastError = &reason
+	d.NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var (
+		body    []byte
+		headers http.Header
+	)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		headers = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer endpoint.Close()
+
+	deliveries := &fakeDeliveries{}
+	dispatcher := NewDispatcher(deliveries, endpoint.Client(), "whsec_outbound", DefaultRetryPolicy(), time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil))).WithClock(clock.NewFake(now))
+
+	delivery, err := dispatcher.Enqueue(context.Background(), "order.completed", endpoint.URL, map[string]string{"orderId": "100"})
+	if err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	dispatcher.dispatch(context.Background())
+
+	if string(body) != `{"orderId":"100"}` {
+		t.Fatalf("unexpected body %s", body)
+	}
+	if headers.Get(DeliveryEventHeader) != "order.completed" || headers.Get(DeliveryIDHeader) != delivery.ID {
+		t.Errorf("unexpected headers %v", headers)
+	}
+	if err := verifyStripeSignature(body, headers.Get(DeliverySignatureHeader), "whsec_outbound", now); err != nil {
+		t.Errorf("expected a valid signature, got %v", err)
+	}
+	if delivery.Status != models.WebhookDeliveryStatusDelivered || delivery.Attempts != 1 || !delivery.DeliveredAt.Equal(now) {
+		t.Fatalf("expected the delivery to be delivered, got %+v", delivery)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	requests := 0
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "ledger unavailable", http.StatusServiceUnavailable)
+	}))
+	defer endpoint.Close()
+
+	fake := clock.NewFake(now)
+	deliveries := &fakeDeliveries{}
+	retry := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: 90 * time.Second}
+	dispatcher := NewDispatcher(deliveries, endpoint.Client(), "", retry, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil))).WithClock(fake)
+
+	delivery, err := dispatcher.Enqueue(context.Background(), "order.completed", endpoint.URL, struct{}{})
+	if err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+
+	dispatcher.dispatch(context.Background())
+	if delivery.Status != models.WebhookDeliveryStatusFailed || delivery.Attempts != 1 || !delivery.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected a retry after the base delay, got %+v", delivery)
+	}
+	if *delivery.LastError != "endpoint responded 503 Service Unavailable: ledger unavailable" {
+		t.Errorf("unexpected reason %q", *delivery.LastError)
+	}
+
+	// Not due yet.
+	dispatcher.dispatch(context.Background())
+	if requests != 1 {
+		t.Fatalf("expected the delivery to wait for its retry, got %d requests", requests)
+	}
+
+	fake.Advance(time.Minute)
+	dispatcher.dispatch(context.Background())
+	if delivery.Attempts != 2 || !delivery.NextAttemptAt.Equal(fake.Now().Add(90*time.Second)) {
+		t.Fatalf("expected the doubled delay to be capped, got %+v", delivery)
+	}
+
+	fake.Advance(90 * time.Second)
+	dispatcher.dispatch(context.Background())
+	if delivery.Status != models.WebhookDeliveryStatusDead || delivery.Attempts != 3 {
+		t.Fatalf("expected the delivery to be dead after the last attempt, got %+v", delivery)
+	}
+
+	fake.Advance(time.Hour)
+	dispatcher.dispatch(context.Background())
+	if requests != 3 {
+		t.Fatalf("expected a dead delivery not to be retried, got %d requests", requests)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 30 * time.Second, MaxDelay: 6 * time.Hour}
+	for attempts, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		10: 4*time.Hour + 16*time.Minute,
+		11: 6 * time.Hour,
+		64: 6 * time.Hour,
+	} {
+		if got := policy.backoff(attempts); got != want {
+			t.Errorf("backoff(%d): expected %s, got %s", attempts, want, got)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// maxEventBodySize bounds the size of an event hook request body. Okta batches at most a
+// few dozen events per request, well under this.
+const maxEventBodySize = 1 << 20
+
+// challengeHeader carries the one-time verification challenge Okta sends when an event hook
+// is registered.
+const challengeHeader = "X-Okta-Verification-Challenge"
+
+// lifecycleStatuses maps the Okta user lifecycle events we mirror to the resulting status.
+var lifecycleStatuses = map[string]models.UserStatus{
+	"user.lifecycle.activate":   models.UserStatusActive,
+	"user.lifecycle.reactivate": models.UserStatusActive,
+	"user.lifecycle.unsuspend":  models.UserStatusActive,
+	"user.lifecycle.suspend":    models.UserStatusSuspended,
+	"user.lifecycle.deactivate": models.UserStatusDeactivated,
+}
+
+// eventHook is the body of an Okta event hook request.
+type eventHook struct {
+	Data struct {
+		Events []event `json:"events"`
+	} `json:"data"`
+}
+
+// event is a single System Log event delivered by an event hook.
+type event struct {
+	UUID      string   `json:"uuid"`
+	EventType string   `json:"eventType"`
+	Target    []target `json:"target"`
+}
+
+// target is an entity an event acted on.
+type target struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// Okta returns a handler for Okta event hooks that keeps the users table in sync with user
+// lifecycle changes made directly in Okta, such as an admin deactivating an account.
+//
+// Okta authenticates hook requests by sending the Authorization header value configured on
+// the hook, so every request must carry exactly that value. A GET with the verification
+// challenge header is answered with the challenge, as Okta requires when the hook is
+// registered. Events for users we don't know are ignored.
+//
+// Parameters:
+//   - users: The repository whose user statuses are updated.
+//   - secret: The Authorization header value configured on the event hook in Okta.
+//   - logger: Where rejected requests and failed updates are logged.
+//
+// Returns:
+//   - A handler responding 204 once the events are applied, 401 for requests without the
+//     expected Authorization header and 500 if an update fails, so that Okta retries.
+func Okta(users models.UserRepository, secret string, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.With(slog.String(logging.RequestIDKey, logging.RequestID(ctx)))
+
+		if secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(secret)) != 1 {
+			log.WarnContext(ctx, "rejected Okta event hook with invalid authorization")
+			http.Error(w, "invalid authorization", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			challenge := r.Header.Get(challengeHeader)
+			if challenge == "" {
+				http.Error(w, "missing verification challenge", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"verification": challenge})
+		case http.MethodPost:
+			var hook eventHook
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventBodySize)).Decode(&hook); err != nil {
+				http.Error(w, "malformed event hook", http.StatusBadRequest)
+				return
+			}
+			for _, e := range hook.Data.Events {
+				status, ok := lifecycleStatuses[e.EventType]
+				if !ok {
+					continue
+				}
+				for _, t := range e.Target {
+					if t.Type != "User" {
+						continue
+					}
+					err := users.SetStatusByOktaID(ctx, t.ID, status)
+					if errors.Is(err, models.ErrNotFound) {
+						log.DebugContext(ctx, "ignored Okta event for unknown user", slog.String("event", e.UUID), slog.String("okta_id", t.ID))
+						continue
+					}
+					if err != nil {
+						log.ErrorContext(ctx, "failed to apply Okta event", slog.String("event", e.UUID), slog.String("okta_id", t.ID), slog.Any("error", err))
+						http.Error(w, "failed to apply event", http.StatusInternalServerError)
+						return
+					}
+					log.InfoContext(ctx, "applied Okta event", slog.String("event", e.UUID), slog.String("type", e.EventType), slog.String("okta_id", t.ID))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
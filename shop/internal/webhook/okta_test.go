@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const testSecret = "Basic c2hvcDpob29rLXNlY3JldA=="
+
+// fakeUsers is a models.UserRepository that records status updates by Okta ID.
+type fakeUsers struct {
+	models.UserRepository
+	statuses map[string]models.UserStatus
+}
+
+func (f *fakeUsers) SetStatusByOktaID(ctx context.Context, oktaID string, status models.UserStatus) error {
+	if _, ok := f.statuses[oktaID]; !ok {
+		return models.ErrNotFound
+	}
+	f.statuses[oktaID] = status
+	return nil
+}
+
+func newHandler() (http.Handler, *fakeUsers) {
+	users := &fakeUsers{statuses: map[string]models.UserStatus{"00u1": models.UserStatusActive, "00u2": models.UserStatusActive}}
+	return Okta(users, testSecret, slog.New(slog.NewTextHandler(io.Discard, nil))), users
+}
+
+func TestOktaVerificationChallenge(t *testing.T) {
+	handler, _ := newHandler()
+	req := httptest.NewRequest(http.MethodGet, "/webhooks/okta", nil)
+	req.Header.Set("Authorization", testSecret)
+	req.Header.Set("X-Okta-Verification-Challenge", "Lh2yZRJBBCYeGmvcsPGxxf9AcGXtPO")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"verification":"Lh2yZRJBBCYeGmvcsPGxxf9AcGXtPO"}` {
+		t.Fatalf("unexpected body %s", body)
+	}
+}
+
+func TestOktaEvent(t *testing.T) {
+	handler, users := newHandler()
+	body := `{
+		"eventType": "com.okta.event_hook",
+		"data": {"events": [
+			{"uuid": "a1", "eventType": "user.lifecycle.deactivate", "target": [{"id": "00u1", "type": "User"}]},
+			{"uuid": "a2", "eventType": "user.lifecycle.suspend", "target": [{"id": "00u404", "type": "User"}]},
+			{"uuid": "a3", "eventType": "user.session.start", "target": [{"id": "00u2", "type": "User"}]}
+		]}
+	}`
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/okta", strings.NewReader(body))
+	req.Header.Set("Authorization", testSecret)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if users.statuses["00u1"] != models.UserStatusDeactivated {
+		t.Errorf("expected 00u1 to be deactivated, got %s", users.statuses["00u1"])
+	}
+	if users.statuses["00u2"] != models.UserStatusActive {
+		t.Errorf("expected unrelated events to be ignored, got %s for 00u2", users.statuses["00u2"])
+	}
+}
+
+func TestOktaRejectsBadAuthorization(t *testing.T) {
+	handler, users := newHandler()
+	for _, header := range []string{"", "Basic d3Jvbmc="} {
+		body := `{"data": {"events": [{"eventType": "user.lifecycle.deactivate", "target": [{"id": "00u1", "type": "User"}]}]}}`
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/okta", strings.NewReader(body))
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected status 401, got %d", header, rec.Code)
+		}
+	}
+	if users.statuses["00u1"] != models.UserStatusActive {
+		t.Fatalf("expected rejected events not to be applied, got %s", users.statuses["00u1"])
+	}
+}
@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/logging"
+	"github.com/ShoppingDem/backend/shop/internal/orders"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+// signatureHeader carries Stripe's signature of a webhook request.
+const signatureHeader = "Stripe-Signature"
+
+// signatureTolerance is how old a signed webhook request may be, to limit replays. It
+// matches the tolerance of Stripe's own libraries.
+const signatureTolerance = 5 * time.Minute
+
+// errInvalidSignature is returned when a webhook request isn't signed with the endpoint's secret.
+var errInvalidSignature = errors.New("invalid signature")
+
+// stripeEvent is the part of a Stripe event we use.
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID string `json:"id"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// Stripe returns a handler for Stripe webhooks that moves orders on as their payment
+// intents succeed or fail: to PAID, or to PAYMENT_FAILED while the shopper can still retry.
+//
+// Stripe signs each request with the endpoint's signing secret, so requests whose
+// Stripe-Signature header doesn't match the body, or whose timestamp is too old, are
+// rejected. Stripe delivers events at least once and not necessarily in order, so an event
+// for an order whose status can't make the transition, such as a redelivered event or a
+// failure reported after the payment succeeded, is acknowledged and ignored. So are events
+// for unknown payment intents and other event types. The exception is a payment that
+// succeeded although its order was cancelled, which is refunded; until that works the
+// event is refused, so Stripe retries it.
+//
+// Parameters:
+//   - repo: The repository whose orders are updated.
+//   - payments: The provider payments for cancelled orders are refunded through, or nil if
+//     there is none, in which case such events are refused.
+//   - secret: The webhook endpoint's signing secret (e.g., "whsec_...").
+//   - publish: Called with each order that was updated, e.g. to notify subscribers.
+//   - logger: Where rejected requests and failed updates are logged.
+//
+// Returns:
+//   - A handler responding 204 once the event is applied, 400 for requests with an invalid
+//     signature or body and 500 if an update or refund fails, so that Stripe retries.
+func Stripe(repo models.OrderRepository, payments models.PaymentProvider, secret string, publish func(*models.Order), logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.With(slog.String(logging.RequestIDKey, logging.RequestID(ctx)))
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventBodySize))
+		if err != nil {
+			http.Error(w, "malformed event", http.StatusBadRequest)
+			return
+		}
+		if err := verifyStripeSignature(body, r.Header.Get(signatureHeader), secret, time.Now()); err != nil {
+			log.WarnContext(ctx, "rejected Stripe webhook", slog.Any("error", err))
+			http.Error(w, "invalid signature", http.StatusBadRequest)
+			return
+		}
+		var e stripeEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			http.Error(w, "malformed event", http.StatusBadRequest)
+			return
+		}
+
+		var apply func(ctx context.Context, intentID string) (*models.Order, error)
+		switch e.Type {
+		case "payment_intent.succeeded":
+			apply = repo.ConfirmPayment
+		case "payment_intent.payment_failed":
+			apply = repo.FailPayment
+		default:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		intentID := e.Data.Object.ID
+		order, err := apply(ctx, intentID)
+		switch {
+		case errors.Is(err, models.ErrPaidAfterCancellation):
+			log := log.With(slog.String("event", e.ID), slog.String("payment_intent", intentID))
+			if payments == nil {
+				log.ErrorContext(ctx, "can't refund payment for cancelled order without a payment provider")
+				http.Error(w, "failed to refund payment", http.StatusInternalServerError)
+				return
+			}
+			if err := payments.Refund(ctx, intentID); err != nil {
+				log.ErrorContext(ctx, "failed to refund payment for cancelled order", slog.Any("error", err))
+				http.Error(w, "failed to refund payment", http.StatusInternalServerError)
+				return
+			}
+			log.WarnContext(ctx, "refunded payment for cancelled order")
+		case errors.Is(err, models.ErrNotFound):
+			log.DebugContext(ctx, "ignored Stripe event for unknown payment intent", slog.String("event", e.ID), slog.String("payment_intent", intentID))
+		case errors.Is(err, orders.ErrInvalidTransition):
+			log.InfoContext(ctx, "ignored Stripe event for order not awaiting payment", slog.String("event", e.ID), slog.String("type", e.Type), slog.String("payment_intent", intentID), slog.Any("error", err))
+		case err != nil:
+			log.ErrorContext(ctx, "failed to apply Stripe event", slog.String("event", e.ID), slog.String("payment_intent", intentID), slog.Any("error", err))
+			http.Error(w, "failed to apply event", http.StatusInternalServerError)
+			return
+		default:
+			log.InfoContext(ctx, "applied Stripe event", slog.String("event", e.ID), slog.String("type", e.Type), slog.String("order_id", order.ID), slog.String("status", string(order.Status)))
+			if publish != nil {
+				publish(order)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// verifyStripeSignature checks a Stripe-Signature header of the form
+// "t=<unix time>,v1=<hex HMAC-SHA256>[,v1=...]", where each v1 signature is computed over
+// "<unix time>.<body>" with the endpoint's signing secret.
+func verifyStripeSignature(body []byte, header, secret string, now time.Time) error {
+	if secret == "" {
+		return errInvalidSignature
+	}
+	var (
+		timestamp  string
+		signatures []string
+	)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return errInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, sig := range signatures {
+		if got, err := hex.DecodeString(sig); err == nil && hmac.Equal(got, expected) {
+			return nil
+		}
+	}
+	return errInvalidSignature
+}
@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ShoppingDem/backend/shop/internal/orders"
+	"github.com/ShoppingDem/backend/shop/pkg/models"
+)
+
+const testStripeSecret = "whsec_test"
+
+// fakeOrders is a models.OrderRepository that updates payment statuses by intent ID.
+type fakeOrders struct {
+	models.OrderRepository
+	byIntent map[string]*models.Order
+}
+
+func (f *fakeOrders) ConfirmPayment(ctx context.Context, intentID string) (*models.Order, error) {
+	return f.setStatus(intentID, models.OrderStatusPaid)
+}
+
+func (f *fakeOrders) FailPayment(ctx context.Context, intentID string) (*models.Order, error) {
+	return f.setStatus(intentID, models.OrderStatusPaymentFailed)
+}
+
+func (f *fakeOrders) setStatus(intentID string, status models.OrderStatus) (*models.Order, error) {
+	order, ok := f.byIntent[intentID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	if err := orders.CanTransition(order.Status, status); err != nil {
+		if status == models.OrderStatusPaid && order.Status == models.OrderStatusCancelled {
+			return nil, fmt.Errorf("%w: %w", models.ErrPaidAfterCancellation, err)
+		}
+		return nil, err
+	}
+	order.Status = status
+	copied := *order
+	return &copied, nil
+}
+
+// fakeRefunds is a models.PaymentProvider that records the intents it refunds. When err is
+// set Refund fails with it.
+type fakeRefunds struct {
+	models.PaymentProvider
+	refunded []string
+	err      error
+}
+
+func (f *fakeRefunds) Refund(ctx context.Context, intentID string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.refunded = append(f.refunded, intentID)
+	return nil
+}
+
+// signStripe returns a Stripe-Signature header for body signed at the given time.
+func signStripe(body string, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testStripeSecret))
+	mac.Write([]byte(timestamp + "." + body))
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func newStripeHandler() (http.Handler, *fakeOrders, *[]*models.Order) {
+	repo := &fakeOrders{byIntent: map[string]*models.Order{
+		"pi_1": {ID: "100", Status: models.OrderStatusPendingPayment, PaymentIntentID: "pi_1"},
+	}}
+	var published []*models.Order
+	publish := func(order *models.Order) { published = append(published, order) }
+	return Stripe(repo, &fakeRefunds{}, testStripeSecret, publish, slog.New(slog.NewTextHandler(io.Discard, nil))), repo, &published
+}
+
+func postStripe(handler http.Handler, body, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", strings.NewReader(body))
+	req.Header.Set("Stripe-Signature", signature)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+const (
+	succeededEvent = `{"id": "evt_1", "type": "payment_intent.succeeded", "data": {"object": {"id": "pi_1", "object": "payment_intent"}}}`
+	failedEvent    = `{"id": "evt_2", "type": "payment_intent.payment_failed", "data": {"object": {"id": "pi_1", "object": "payment_intent"}}}`
+)
+
+func TestStripePaymentSucceeded(t *testing.T) {
+	handler, repo, published := newStripeHandler()
+
+	rec := postStripe(handler, succeededEvent, signStripe(succeededEvent, time.Now()))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if repo.byIntent["pi_1"].Status != models.OrderStatusPaid {
+		t.Fatalf("expected the order to be PAID, got %s", repo.byIntent["pi_1"].Status)
+	}
+	if len(*published) != 1 || (*published)[0].ID != "100" || (*published)[0].Status != models.OrderStatusPaid {
+		t.Fatalf("expected a PAID update for order 100 to be published, got %v", *published)
+	}
+}
+
+func TestStripePaymentFailed(t *testing.T) {
+	handler, repo, published := newStripeHandler()
+
+	rec := postStripe(handler, failedEvent, signStripe(failedEvent, time.Now()))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if repo.byIntent["pi_1"].Status != models.OrderStatusPaymentFailed {
+		t.Fatalf("expected the order to be PAYMENT_FAILED, got %s", repo.byIntent["pi_1"].Status)
+	}
+	if len(*published) != 1 || (*published)[0].Status != models.OrderStatusPaymentFailed {
+		t.Fatalf("expected a PAYMENT_FAILED update to be published, got %v", *published)
+	}
+
+	// The shopper retries with another card, and that payment succeeds.
+	rec = postStripe(handler, succeededEvent, signStripe(succeededEvent, time.Now()))
+	if rec.Code != http.StatusNoContent || repo.byIntent["pi_1"].Status != models.OrderStatusPaid {
+		t.Fatalf("expected a retried payment to mark the order PAID, got status %d and %s", rec.Code, repo.byIntent["pi_1"].Status)
+	}
+}
+
+func TestStripeReplayedEvents(t *testing.T) {
+	handler, repo, published := newStripeHandler()
+
+	// Stripe delivers events at least once and in any order: a redelivered success, and a
+	// failure that arrives after the payment succeeded, are acknowledged without effect.
+	for _, body := range []string{succeededEvent, succeededEvent, failedEvent} {
+		if rec := postStripe(handler, body, signStripe(body, time.Now())); rec.Code != http.StatusNoContent {
+			t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if repo.byIntent["pi_1"].Status != models.OrderStatusPaid {
+		t.Fatalf("expected the order to stay PAID, got %s", repo.byIntent["pi_1"].Status)
+	}
+	if len(*published) != 1 {
+		t.Fatalf("expected one update to be published, got %d", len(*published))
+	}
+}
+
+func TestStripeRefundsCancelledOrders(t *testing.T) {
+	repo := &fakeOrders{byIntent: map[string]*models.Order{
+		"pi_1": {ID: "100", Status: models.OrderStatusCancelled, PaymentIntentID: "pi_1"},
+	}}
+	payments := &fakeRefunds{err: errors.New("stripe unavailable")}
+	var published []*models.Order
+	handler := Stripe(repo, payments, testStripeSecret, func(o *models.Order) { published = append(published, o) }, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// The refund fails, so the event is refused for Stripe to retry.
+	if rec := postStripe(handler, succeededEvent, signStripe(succeededEvent, time.Now())); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d: %s", rec.Code, rec.Body)
+	}
+
+	payments.err = nil
+	if rec := postStripe(handler, succeededEvent, signStripe(succeededEvent, time.Now())); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(payments.refunded) != 1 || payments.refunded[0] != "pi_1" {
+		t.Fatalf("expected the payment to be refunded, got %v", payments.refunded)
+	}
+	if repo.byIntent["pi_1"].Status != models.OrderStatusCancelled || len(published) != 0 {
+		t.Fatalf("expected the order to stay cancelled, got %s and %d updates", repo.byIntent["pi_1"].Status, len(published))
+	}
+
+	// Without a payment provider the payment can't be refunded, so the event is refused.
+	handler = Stripe(repo, nil, testStripeSecret, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if rec := postStripe(handler, succeededEvent, signStripe(succeededEvent, time.Now())); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestStripeIgnoresOtherEvents(t *testing.T) {
+	handler, repo, published := newStripeHandler()
+	for _, body := range []string{
+		`{"id": "evt_3", "type": "payment_intent.succeeded", "data": {"object": {"id": "pi_404"}}}`,
+		`{"id": "evt_4", "type": "payment_intent.created", "data": {"object": {"id": "pi_1"}}}`,
+	} {
+		if rec := postStripe(handler, body, signStripe(body, time.Now())); rec.Code != http.StatusNoContent {
+			t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if repo.byIntent["pi_1"].Status != models.OrderStatusPendingPayment || len(*published) != 0 {
+		t.Fatalf("expected no order to be confirmed, got %s", repo.byIntent["pi_1"].Status)
+	}
+}
+
+func TestStripeRejectsBadSignatures(t *testing.T) {
+	handler, repo, _ := newStripeHandler()
+	body := succeededEvent
+
+	for name, signature := range map[string]string{
+		"missing":       "",
+		"tampered body": signStripe(strings.Replace(body, "pi_1", "pi_2", 1), time.Now()),
+		"stale":         signStripe(body, time.Now().Add(-10*time.Minute)),
+		"malformed":     "t=abc,v1=zz",
+	} {
+		if rec := postStripe(handler, body, signature); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", name, rec.Code)
+		}
+	}
+	if repo.byIntent["pi_1"].Status != models.OrderStatusPendingPayment {
+		t.Fatalf("expected the order to be untouched, got %s", repo.byIntent["pi_1"].Status)
+	}
+}
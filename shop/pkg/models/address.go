@@ -0,0 +1,65 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Address is a shipping address in a user's address book. Each user has at most one default
+// address.
+type Address struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"userId"`
+	Line1      string    `json:"line1"`
+	Line2      string    `json:"line2"`
+	City       string    `json:"city"`
+	Region     string    `json:"region"`
+	PostalCode string    `json:"postalCode"`
+	Country    string    `json:"country"` // An ISO 3166-1 alpha-2 code, e.g. "US".
+	IsDefault  bool      `json:"isDefault"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type AddAddressInput struct {
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2,omitempty"`
+	City       string  `json:"city"`
+	Region     *string `json:"region,omitempty"`
+	PostalCode string  `json:"postalCode"`
+	Country    string  `json:"country"`
+	IsDefault  *bool   `json:"isDefault,omitempty"`
+}
+
+// UpdateAddressInput changes the fields of an address that are set, leaving the rest as they are.
+type UpdateAddressInput struct {
+	ID         string  `json:"id"`
+	Line1      *string `json:"line1,omitempty"`
+	Line2      *string `json:"line2,omitempty"`
+	City       *string `json:"city,omitempty"`
+	Region     *string `json:"region,omitempty"`
+	PostalCode *string `json:"postalCode,omitempty"`
+	Country    *string `json:"country,omitempty"`
+	IsDefault  *bool   `json:"isDefault,omitempty"`
+}
+
+// AddressRepository persists users' address books. Every method is scoped to a user, so an
+// address belonging to someone else is reported as ErrNotFound.
+type AddressRepository interface {
+	// ListByUser returns the user's addresses, the default first and the rest oldest first.
+	ListByUser(ctx context.Context, userID string) ([]*Address, error)
+
+	// GetByID returns one of the user's addresses, or ErrNotFound.
+	GetByID(ctx context.Context, userID, id string) (*Address, error)
+
+	// Create inserts address and sets its generated ID and CreatedAt. If it's the default,
+	// the user's previous default is unset in the same transaction.
+	Create(ctx context.Context, address *Address) error
+
+	// Update saves every field of address, or returns ErrNotFound. If it's the default, the
+	// user's previous default is unset in the same transaction.
+	Update(ctx context.Context, address *Address) error
+
+	// Delete removes one of the user's addresses, or returns ErrNotFound. Deleting the
+	// default address leaves the user without one.
+	Delete(ctx context.Context, userID, id string) error
+}
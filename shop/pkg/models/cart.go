@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type CartItem struct {
+	Product *Product `json:"product"`
+	Qty     int      `json:"qty"`
+}
+
+// Cart is a user's shopping cart. SubtotalCents is the sum of each item's current price
+// times its quantity.
+type Cart struct {
+	UserID        string      `json:"userId"`
+	Items         []*CartItem `json:"items"`
+	SubtotalCents int64       `json:"subtotalCents"`
+}
+
+// CartItemInput is a quantity of a product to add to a cart.
+type CartItemInput struct {
+	ProductID string `json:"productId"`
+	Qty       int    `json:"qty"`
+}
+
+// CartItemErrorReason is why an item of a bulk cart addition wasn't added.
+type CartItemErrorReason string
+
+const (
+	CartItemErrorReasonNotFound      CartItemErrorReason = "NOT_FOUND"
+	CartItemErrorReasonOutOfStock    CartItemErrorReason = "OUT_OF_STOCK"
+	CartItemErrorReasonPurchaseLimit CartItemErrorReason = "PURCHASE_LIMIT"
+)
+
+// IsValid reports whether r is one of the known reasons.
+func (r CartItemErrorReason) IsValid() bool {
+	switch r {
+	case CartItemErrorReasonNotFound, CartItemErrorReasonOutOfStock, CartItemErrorReasonPurchaseLimit:
+		return true
+	}
+	return false
+}
+
+func (r CartItemErrorReason) String() string {
+	return string(r)
+}
+
+func (r *CartItemErrorReason) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*r = CartItemErrorReason(str)
+	if !r.IsValid() {
+		return fmt.Errorf("%s is not a valid CartItemErrorReason", str)
+	}
+	return nil
+}
+
+func (r CartItemErrorReason) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(r.String()))
+}
+
+// CartItemError is an item of a bulk cart addition that wasn't added.
+type CartItemError struct {
+	Index     int                 `json:"index"` // The item's position in the input, from 0.
+	ProductID string              `json:"productId"`
+	Reason    CartItemErrorReason `json:"reason"`
+	Message   string              `json:"message"`
+}
+
+// AddItemsToCartPayload is the cart after a bulk addition and the items that weren't added.
+type AddItemsToCartPayload struct {
+	Cart   *Cart            `json:"cart"`
+	Errors []*CartItemError `json:"errors"`
+}
+
+// CartRepository persists shopping carts, one per user.
+type CartRepository interface {
+	// Get returns the user's cart, which is empty if they haven't added anything.
+	Get(ctx context.Context, userID string) (*Cart, error)
+
+	// AddItem adds qty of a product to the user's cart, incrementing the quantity if it's
+	// already there, and returns the updated cart. It returns ErrNotFound if the product
+	// doesn't exist, ErrExceedsStock if the resulting quantity is more than is in stock and a
+	// *PurchaseLimitError if it's more than the product's purchase limits allow.
+	AddItem(ctx context.Context, userID, productID string, qty int) (*Cart, error)
+
+	// AddItems adds several items to the user's cart at once, each as AddItem does, and
+	// returns the updated cart. An item that AddItem would reject with ErrNotFound,
+	// ErrExceedsStock or a *PurchaseLimitError is left out, with its error in itemErrs at the
+	// item's index, while the rest are added. With allOrNothing nothing is added if any item
+	// is rejected, and the first rejection is returned as err as well as in itemErrs.
+	AddItems(ctx context.Context, userID string, items []*CartItemInput, allOrNothing bool) (cart *Cart, itemErrs []error, err error)
+
+	// SetItemQty sets the quantity of a product already in the user's cart and returns the
+	// updated cart. It returns ErrNotInCart if the product isn't in the cart,
+	// ErrExceedsStock if qty is more than is in stock and a *PurchaseLimitError if it's more
+	// than the product's purchase limits allow.
+	SetItemQty(ctx context.Context, userID, productID string, qty int) (*Cart, error)
+
+	// RemoveItem removes a product from the user's cart and returns the updated cart. It
+	// returns ErrNotInCart if the product isn't in the cart.
+	RemoveItem(ctx context.Context, userID, productID string) (*Cart, error)
+
+	// SaveForLater moves a product from the user's cart to their saved items, adding to its
+	// saved quantity if it's already saved, and returns the updated cart. Saved items don't
+	// hold stock, so any reservation of the product is released. It returns ErrNotInCart if
+	// the product isn't in the cart.
+	SaveForLater(ctx context.Context, userID, productID string) (*Cart, error)
+
+	// MoveToCart moves a product from the user's saved items back to their cart with its
+	// saved quantity and returns the updated cart. It returns ErrNotSaved if the product
+	// isn't saved, and ErrExceedsStock or a *PurchaseLimitError if the resulting cart
+	// quantity is more than is in stock or the product's purchase limits allow, in which case
+	// the item stays saved.
+	MoveToCart(ctx context.Context, userID, productID string) (*Cart, error)
+
+	// SavedItems returns the products the user saved for later with their quantities.
+	SavedItems(ctx context.Context, userID string) ([]*CartItem, error)
+}
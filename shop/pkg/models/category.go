@@ -0,0 +1,19 @@
+package models
+
+import "context"
+
+// Category groups products. Categories form a tree through ParentID, which is nil for
+// top-level categories. Children is only populated when the tree is assembled.
+type Category struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	Slug     string      `json:"slug"`
+	ParentID *string     `json:"parentId,omitempty"`
+	Children []*Category `json:"children"`
+}
+
+// CategoryRepository persists product categories.
+type CategoryRepository interface {
+	// List returns every category ordered by name, without Children set.
+	List(ctx context.Context) ([]*Category, error)
+}
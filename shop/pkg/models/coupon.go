@@ -0,0 +1,48 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Coupon is a promo code that discounts an order at checkout, either by a percentage of its
+// total or by a fixed amount. Exactly one of PercentOff and AmountOffCents is set.
+type Coupon struct {
+	ID             string     `json:"id"`
+	Code           string     `json:"code"` // Stored upper-case; codes are matched case-insensitively.
+	PercentOff     *int       `json:"percentOff,omitempty"`
+	AmountOffCents *int64     `json:"amountOffCents,omitempty"`
+	Currency       string     `json:"currency,omitempty"`  // The currency of AmountOffCents; empty for percentage coupons.
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"` // Nil for coupons that don't expire.
+	MaxRedemptions *int       `json:"maxRedemptions,omitempty"`
+	TimesRedeemed  int        `json:"timesRedeemed"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// Check reports whether the coupon can be redeemed at now for an order in currency. It
+// returns ErrCouponExpired, ErrCouponExhausted, or ErrCouponInvalid if a fixed discount is
+// in another currency.
+func (c *Coupon) Check(currency string, now time.Time) error {
+	switch {
+	case c.ExpiresAt != nil && !now.Before(*c.ExpiresAt):
+		return ErrCouponExpired
+	case c.MaxRedemptions != nil && c.TimesRedeemed >= *c.MaxRedemptions:
+		return ErrCouponExhausted
+	case c.AmountOffCents != nil && c.Currency != currency:
+		return fmt.Errorf("%w: coupon %s only applies to %s orders", ErrCouponInvalid, c.Code, c.Currency)
+	}
+	return nil
+}
+
+// Discount returns how much the coupon takes off an order totalling totalCents. Percentages
+// are rounded down to the cent, and the discount is never more than the total.
+func (c *Coupon) Discount(totalCents int64) int64 {
+	var discount int64
+	switch {
+	case c.PercentOff != nil:
+		discount = totalCents * int64(*c.PercentOff) / 100
+	case c.AmountOffCents != nil:
+		discount = *c.AmountOffCents
+	}
+	return min(discount, totalCents)
+}
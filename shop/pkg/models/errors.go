@@ -0,0 +1,70 @@
+package models
+
+import "errors"
+
+var (
+	// ErrNotFound is returned by repositories when no record matches the lookup.
+	ErrNotFound = errors.New("not found")
+
+	// ErrDuplicateSKU is returned when a product is saved with a SKU that's already in use.
+	ErrDuplicateSKU = errors.New("duplicate SKU")
+
+	// ErrExceedsStock is returned when a cart quantity is more than the product has in stock.
+	ErrExceedsStock = errors.New("quantity exceeds stock")
+
+	// ErrNotInCart is returned when changing a cart item for a product that isn't in the cart.
+	ErrNotInCart = errors.New("product not in cart")
+
+	// ErrNotSaved is returned when moving a product to the cart that isn't saved for later.
+	ErrNotSaved = errors.New("product not saved for later")
+
+	// ErrInsufficientStock matches an *InsufficientStockError with errors.Is.
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// ErrPurchaseLimit matches a *PurchaseLimitError with errors.Is.
+	ErrPurchaseLimit = errors.New("purchase limit exceeded")
+
+	// ErrEmptyCart is returned when checking out a cart with no items.
+	ErrEmptyCart = errors.New("cart is empty")
+
+	// ErrConcurrentModification is returned when a record kept changing while an update was
+	// retried against it. Retrying the whole operation later is safe.
+	ErrConcurrentModification = errors.New("concurrent modification")
+
+	// ErrOrderNotCancellable is returned when cancelling an order that has been paid for or
+	// was already cancelled.
+	ErrOrderNotCancellable = errors.New("order can't be cancelled")
+
+	// ErrPaidAfterCancellation is returned when confirming the payment of an order that was
+	// cancelled in the meantime. The payment has to be refunded.
+	ErrPaidAfterCancellation = errors.New("order was paid for after it was cancelled")
+
+	// ErrOrderNotShippable is returned when shipping an order that hasn't been paid for or
+	// has already shipped or been cancelled.
+	ErrOrderNotShippable = errors.New("order can't be shipped")
+
+	// ErrCouponInvalid is returned when checking out with a coupon code that doesn't exist or
+	// doesn't apply to the order.
+	ErrCouponInvalid = errors.New("invalid coupon code")
+
+	// ErrCouponExpired is returned when checking out with a coupon past its expiry.
+	ErrCouponExpired = errors.New("coupon has expired")
+
+	// ErrCouponExhausted is returned when checking out with a coupon that has been redeemed
+	// as many times as it allows.
+	ErrCouponExhausted = errors.New("coupon has been fully redeemed")
+
+	// ErrAlreadyReviewed is returned when a user reviews a product they've already reviewed.
+	ErrAlreadyReviewed = errors.New("product already reviewed")
+
+	// ErrImagesMismatch is returned when reordering a product's images with a list that
+	// doesn't have exactly the product's images, for example because one was added since.
+	ErrImagesMismatch = errors.New("images don't match the product's images")
+
+	// ErrRefreshTokenExpired is returned when refreshing with a refresh token past its expiry.
+	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+
+	// ErrRefreshTokenRevoked is returned when refreshing with a refresh token that was
+	// already used or whose session was logged out.
+	ErrRefreshTokenRevoked = errors.New("refresh token has been revoked")
+)
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// FlashSale takes PercentOff off the price of its products from StartsAt until EndsAt.
+type FlashSale struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	PercentOff int       `json:"percentOff"`
+	StartsAt   time.Time `json:"startsAt"`
+	EndsAt     time.Time `json:"endsAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// SalePrice returns priceCents with percentOff taken off. The discount is rounded down to the
+// cent, as coupon discounts are.
+func SalePrice(priceCents int64, percentOff int) int64 {
+	return priceCents - priceCents*int64(percentOff)/100
+}
+
+// FlashSaleRepository reads flash sales. A sale is running at a time t when StartsAt <= t
+// and t < EndsAt.
+type FlashSaleRepository interface {
+	// Active returns the sales running at now, the soonest to end first.
+	Active(ctx context.Context, now time.Time) ([]*FlashSale, error)
+
+	// ActiveByProducts returns, by product ID, the sale running at now with the deepest
+	// discount on each of the given products. Products on no running sale are left out.
+	ActiveByProducts(ctx context.Context, productIDs []string, now time.Time) (map[string]*FlashSale, error)
+
+	// Products returns the products on the sale with the given ID, ordered by ID.
+	Products(ctx context.Context, saleID string) ([]*Product, error)
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatusPending        OrderStatus = "PENDING"
+	OrderStatusPendingPayment OrderStatus = "PENDING_PAYMENT"
+	OrderStatusPaymentFailed  OrderStatus = "PAYMENT_FAILED"
+	OrderStatusPaid           OrderStatus = "PAID"
+	OrderStatusShipped        OrderStatus = "SHIPPED"
+	OrderStatusDelivered      OrderStatus = "DELIVERED"
+	OrderStatusCancelled      OrderStatus = "CANCELLED"
+)
+
+// IsValid reports whether s is one of the known order statuses.
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusPendingPayment, OrderStatusPaymentFailed, OrderStatusPaid, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (s OrderStatus) String() string {
+	return string(s)
+}
+
+func (s *OrderStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*s = OrderStatus(str)
+	if !s.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderStatus", str)
+	}
+	return nil
+}
+
+func (s OrderStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(s.String()))
+}
+
+// OrderItem is a line of an order. UnitPriceCents is the product's price when the order was placed.
+type OrderItem struct {
+	ProductID      string `json:"productId"`
+	Name           string `json:"name"`
+	SKU            string `json:"sku"`
+	Qty            int    `json:"qty"`
+	UnitPriceCents int64  `json:"unitPriceCents"`
+}
+
+// ShippingAddress is the address an order ships to, copied from the user's address book at
+// checkout so later edits to the address don't change the order.
+type ShippingAddress struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postalCode"`
+	Country    string `json:"country"`
+}
+
+// ShippingAddressOf returns a snapshot of a for an order.
+func ShippingAddressOf(a *Address) *ShippingAddress {
+	return &ShippingAddress{
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+type Order struct {
+	ID              string           `json:"id"`
+	UserID          string           `json:"userId"`
+	Status          OrderStatus      `json:"status"`
+	SubtotalCents   int64            `json:"subtotalCents"` // The items' total.
+	DiscountCents   int64            `json:"discountCents"` // How much CouponCode took off the subtotal.
+	TaxCents        int64            `json:"taxCents"`      // The tax on the discounted subtotal.
+	TotalCents      int64            `json:"totalCents"`    // What the shopper pays: the subtotal less the discount, plus tax.
+	CouponCode      *string          `json:"couponCode"`    // The coupon redeemed at checkout, if any.
+	Currency        string           `json:"currency"`
+	ShippingAddress *ShippingAddress `json:"shippingAddress"` // Nil for orders placed before addresses were recorded.
+	TrackingNumber  *string          `json:"trackingNumber"`  // The carrier's tracking number, set when the order ships.
+	Items           []*OrderItem     `json:"items"`
+	CreatedAt       time.Time        `json:"createdAt"`
+
+	// PaymentIntentID is the payment provider's ID for the order's payment, set when checkout
+	// starts collecting it.
+	PaymentIntentID string `json:"paymentIntentId,omitempty"`
+	// PaymentClientSecret lets the storefront confirm the payment. It isn't stored, so it's
+	// only set on the order returned by the checkout that created the payment intent.
+	PaymentClientSecret *string `json:"paymentClientSecret,omitempty"`
+}
+
+// CustomerStats sums up what a customer has bought: their completed (DELIVERED) orders and
+// what those orders came to.
+type CustomerStats struct {
+	OrderCount         int   `json:"orderCount"`
+	LifetimeValueCents int64 `json:"lifetimeValueCents"`
+}
+
+// InsufficientStockError is returned by checkout when some cart items have more quantity
+// than is left in stock. ProductIDs lists the offending products.
+type InsufficientStockError struct {
+	ProductIDs []string
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for products %s", strings.Join(e.ProductIDs, ", "))
+}
+
+// Is lets errors.Is(err, ErrInsufficientStock) match any *InsufficientStockError.
+func (e *InsufficientStockError) Is(target error) bool {
+	return target == ErrInsufficientStock
+}
+
+// PurchaseLimitError is returned when a cart or order holds more of a product than its
+// MaxPerOrder, or more than its MaxPerCustomer once the customer's earlier orders are counted.
+type PurchaseLimitError struct {
+	ProductID   string
+	Limit       int
+	PerCustomer bool // Whether Limit is the product's MaxPerCustomer rather than its MaxPerOrder.
+	Purchased   int  // How many the customer already bought, counted for MaxPerCustomer.
+}
+
+func (e *PurchaseLimitError) Error() string {
+	if e.PerCustomer {
+		return fmt.Sprintf("product %s is limited to %d per customer and %d were already purchased", e.ProductID, e.Limit, e.Purchased)
+	}
+	return fmt.Sprintf("product %s is limited to %d per order", e.ProductID, e.Limit)
+}
+
+// Is lets errors.Is(err, ErrPurchaseLimit) match any *PurchaseLimitError.
+func (e *PurchaseLimitError) Is(target error) bool {
+	return target == ErrPurchaseLimit
+}
+
+// OrderRepository persists orders.
+type OrderRepository interface {
+	// Checkout converts the user's cart into a pending order, freezing the current prices,
+	// decrementing stock and clearing the cart in one transaction. The user's reservations
+	// are consumed: reserved quantities count toward the items and aren't taken from stock
+	// again. It returns ErrEmptyCart if the cart is empty, an *InsufficientStockError if any
+	// item is over stock, a *PurchaseLimitError if any item is over the product's purchase
+	// limits and ErrConcurrentModification if concurrent stock changes kept getting in the way.
+	//
+	// A non-empty couponCode redeems that coupon in the same transaction, discounting the
+	// order's total. It returns ErrCouponInvalid if no coupon has the code, and
+	// ErrCouponExpired or ErrCouponExhausted if the coupon can no longer be redeemed.
+	//
+	// Tax is charged on the discounted subtotal for the shipping address's region.
+	//
+	// A non-empty idempotencyKey makes retries safe: if the user already checked out with
+	// the key, the order placed then is returned without its Items and nothing changes.
+	// placed reports whether a new order was placed rather than an earlier one returned.
+	Checkout(ctx context.Context, userID, idempotencyKey string, shippingAddress *ShippingAddress, couponCode string) (order *Order, placed bool, err error)
+
+	// List returns a page of the user's orders, newest first, optionally filtered by status.
+	// The orders' Items are left nil; load them with Items.
+	List(ctx context.Context, userID string, status *OrderStatus, page PageArgs) (*PageResult[*Order], error)
+
+	// Items returns the items of the given orders, keyed by order ID.
+	Items(ctx context.Context, orderIDs []string) (map[string][]*OrderItem, error)
+
+	// CustomerStats returns the stats of the given users' DELIVERED orders, keyed by user
+	// ID. Users without any are left out.
+	CustomerStats(ctx context.Context, userIDs []string) (map[string]*CustomerStats, error)
+
+	// GetByID returns an order without its Items, or ErrNotFound if it doesn't exist.
+	GetByID(ctx context.Context, id string) (*Order, error)
+
+	// UpdateStatus sets an order's status and returns the updated order without its Items.
+	// It returns ErrNotFound if the order doesn't exist and an error wrapping
+	// orders.ErrInvalidTransition if its status can't move to status.
+	UpdateStatus(ctx context.Context, id string, status OrderStatus) (*Order, error)
+
+	// Cancel cancels an order and puts its items back in stock in one transaction, returning
+	// the updated order without its Items. It returns ErrNotFound if the order doesn't exist
+	// and ErrOrderNotCancellable, wrapping orders.ErrInvalidTransition, if its status can't
+	// move to CANCELLED.
+	Cancel(ctx context.Context, id string) (*Order, error)
+
+	// Ship moves a paid order to SHIPPED and records its tracking number, returning the
+	// updated order without its Items. It returns ErrNotFound if the order doesn't exist
+	// and ErrOrderNotShippable, wrapping orders.ErrInvalidTransition, if it isn't PAID.
+	Ship(ctx context.Context, id, trackingNumber string) (*Order, error)
+
+	// SetPaymentIntent records the payment intent collecting a pending order's payment and
+	// moves the order to PENDING_PAYMENT, returning the updated order without its Items. The
+	// order's stock stays held for it until heldUntil; after that ExpiredPaymentHolds lists
+	// the order if it still hasn't been paid. It returns ErrNotFound if the order doesn't
+	// exist and an error wrapping orders.ErrInvalidTransition if it isn't PENDING.
+	SetPaymentIntent(ctx context.Context, id, intentID string, heldUntil time.Time) (*Order, error)
+
+	// ExpiredPaymentHolds returns up to limit orders, without their Items, that are still
+	// PENDING_PAYMENT or PAYMENT_FAILED although the stock held for their payment was only
+	// held until now or earlier, the longest expired first.
+	ExpiredPaymentHolds(ctx context.Context, now time.Time, limit int) ([]*Order, error)
+
+	// ConfirmPayment moves the order paid for by a payment intent to PAID, returning the
+	// updated order without its Items. It returns ErrNotFound if no order has the intent
+	// and an error wrapping orders.ErrInvalidTransition if the order isn't awaiting payment,
+	// which also wraps ErrPaidAfterCancellation if the order was cancelled.
+	ConfirmPayment(ctx context.Context, intentID string) (*Order, error)
+
+	// FailPayment moves the order paid for by a payment intent to PAYMENT_FAILED, returning
+	// the updated order without its Items. It returns ErrNotFound if no order has the intent
+	// and an error wrapping orders.ErrInvalidTransition if the order isn't awaiting payment.
+	FailPayment(ctx context.Context, intentID string) (*Order, error)
+
+	// DeleteExpiredIdempotencyKeys forgets the checkout idempotency keys used more than
+	// maxAge ago and reports how many were deleted.
+	DeleteExpiredIdempotencyKeys(ctx context.Context, maxAge time.Duration) (int, error)
+}
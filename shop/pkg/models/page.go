@@ -0,0 +1,28 @@
+package models
+
+// DefaultPageLimit is the page size of a list when no limit is asked for.
+const DefaultPageLimit = 20
+
+// PageArgs selects a page of a list: up to Limit items, skipping the first Offset.
+type PageArgs struct {
+	Limit  int
+	Offset int
+}
+
+// Normalize returns p with its limit defaulted to DefaultPageLimit when it isn't positive
+// and capped at maxLimit, and its offset floored at 0.
+func (p PageArgs) Normalize(maxLimit int) PageArgs {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	p.Limit = min(p.Limit, maxLimit)
+	p.Offset = max(p.Offset, 0)
+	return p
+}
+
+// PageResult is a page of a list. Total is the number of items in the whole list, or 0 for
+// a page past its end.
+type PageResult[T any] struct {
+	Items []T
+	Total int
+}
@@ -0,0 +1,24 @@
+package models
+
+import "testing"
+
+func TestPageArgsNormalize(t *testing.T) {
+	for name, tc := range map[string]struct {
+		page     PageArgs
+		maxLimit int
+		want     PageArgs
+	}{
+		"within bounds":         {PageArgs{Limit: 10, Offset: 30}, 100, PageArgs{Limit: 10, Offset: 30}},
+		"zero limit":            {PageArgs{Limit: 0, Offset: 5}, 100, PageArgs{Limit: DefaultPageLimit, Offset: 5}},
+		"negative limit":        {PageArgs{Limit: -3}, 100, PageArgs{Limit: DefaultPageLimit}},
+		"over max":              {PageArgs{Limit: 500}, 100, PageArgs{Limit: 100}},
+		"at max":                {PageArgs{Limit: 100}, 100, PageArgs{Limit: 100}},
+		"default over max":      {PageArgs{}, 5, PageArgs{Limit: 5}},
+		"negative offset":       {PageArgs{Limit: 10, Offset: -1}, 100, PageArgs{Limit: 10}},
+		"negative limit/offset": {PageArgs{Limit: -1, Offset: -1}, 100, PageArgs{Limit: DefaultPageLimit}},
+	} {
+		if got := tc.page.Normalize(tc.maxLimit); got != tc.want {
+			t.Errorf("%s: expected %+v, got %+v", name, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "context"
+
+// PaymentProvider takes payments for orders through a payment service such as Stripe.
+type PaymentProvider interface {
+	// CreateIntent starts collecting amountCents in currency for the order. It returns the
+	// provider's ID for the payment intent and the client secret the storefront uses to
+	// confirm the payment. Creating an intent for the same order again returns the same one.
+	CreateIntent(ctx context.Context, amountCents int64, currency, orderID string) (intentID, clientSecret string, err error)
+
+	// ClientSecret returns the client secret of an existing payment intent, for handing it to
+	// the storefront again.
+	ClientSecret(ctx context.Context, intentID string) (string, error)
+
+	// Capture collects the funds a payment intent has authorized.
+	Capture(ctx context.Context, intentID string) error
+
+	// Refund refunds everything a payment intent has collected.
+	Refund(ctx context.Context, intentID string) error
+
+	// CancelIntent cancels a payment intent that hasn't succeeded, so it can no longer be
+	// paid. Cancelling an intent again succeeds.
+	CancelIntent(ctx context.Context, intentID string) error
+}
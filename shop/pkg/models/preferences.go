@@ -0,0 +1,27 @@
+package models
+
+import "context"
+
+// ListingPreferences are the defaults a user's product listings use for the arguments they
+// leave out. A nil field falls back to the global default.
+type ListingPreferences struct {
+	Sort         *ProductSort `json:"sort,omitempty"`
+	PageSize     *int         `json:"pageSize,omitempty"`
+	CategorySlug *string      `json:"categorySlug,omitempty"`
+}
+
+// ListingPreferencesInput replaces a user's listing preferences.
+type ListingPreferencesInput struct {
+	Sort         *ProductSort `json:"sort,omitempty"`
+	PageSize     *int         `json:"pageSize,omitempty"`
+	CategorySlug *string      `json:"categorySlug,omitempty"`
+}
+
+// ListingPreferencesRepository persists listing preferences, one set per user.
+type ListingPreferencesRepository interface {
+	// Get returns the user's preferences, which are all nil if they haven't saved any.
+	Get(ctx context.Context, userID string) (*ListingPreferences, error)
+
+	// Save replaces the user's preferences.
+	Save(ctx context.Context, userID string, prefs *ListingPreferences) error
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Product is an item in the catalog. Prices are integer amounts in the currency's minor
+// unit (e.g., cents) to avoid floating-point rounding.
+type Product struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	PriceCents  int64     `json:"priceCents"`
+	Currency    string    `json:"currency"`
+	SKU         string    `json:"sku"`
+	StockQty    int       `json:"stockQty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	CategoryID  *string   `json:"categoryId,omitempty"`
+
+	// MaxPerOrder caps how many of the product an order, and so a cart, can hold, and
+	// MaxPerCustomer how many a customer can buy across all their orders. Nil means no limit.
+	MaxPerOrder    *int `json:"maxPerOrder,omitempty"`
+	MaxPerCustomer *int `json:"maxPerCustomer,omitempty"`
+}
+
+// ProductSort is an order products are listed in. Ties are broken by ID.
+type ProductSort string
+
+const (
+	ProductSortOldest    ProductSort = "OLDEST"
+	ProductSortNewest    ProductSort = "NEWEST"
+	ProductSortPriceAsc  ProductSort = "PRICE_ASC"
+	ProductSortPriceDesc ProductSort = "PRICE_DESC"
+)
+
+// DefaultProductSort is the order products are listed in when none is asked for.
+const DefaultProductSort = ProductSortOldest
+
+// IsValid reports whether s is one of the known product orders.
+func (s ProductSort) IsValid() bool {
+	switch s {
+	case ProductSortOldest, ProductSortNewest, ProductSortPriceAsc, ProductSortPriceDesc:
+		return true
+	}
+	return false
+}
+
+// ByPrice reports whether s orders products by price rather than by creation time.
+func (s ProductSort) ByPrice() bool {
+	return s == ProductSortPriceAsc || s == ProductSortPriceDesc
+}
+
+func (s ProductSort) String() string {
+	return string(s)
+}
+
+func (s *ProductSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*s = ProductSort(str)
+	if !s.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductSort", str)
+	}
+	return nil
+}
+
+func (s ProductSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(s.String()))
+}
+
+// ProductCursor is a position in the product list: CreatedAt and then ID in the orders by
+// creation time, and PriceCents and then ID in the orders by price.
+type ProductCursor struct {
+	CreatedAt  time.Time
+	PriceCents int64
+	ID         string
+}
+
+// ProductConnection is a page of products for cursor-based pagination.
+type ProductConnection struct {
+	Edges    []*ProductEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+// ProductEdge is a product in a ProductConnection along with the cursor that points at it.
+type ProductEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Product `json:"node"`
+}
+
+// PageInfo describes whether a connection has more items after its last edge.
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor,omitempty"`
+}
+
+type CreateProductInput struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+	PriceCents  int64   `json:"priceCents"`
+	Currency    *string `json:"currency,omitempty"`
+	SKU         string  `json:"sku"`
+	StockQty    *int    `json:"stockQty,omitempty"`
+
+	MaxPerOrder    *int `json:"maxPerOrder,omitempty"`
+	MaxPerCustomer *int `json:"maxPerCustomer,omitempty"`
+}
+
+// ProductImportResult summarizes an importProducts file. Each row is imported or rejected on
+// its own, so some rows can fail while the rest are inserted.
+type ProductImportResult struct {
+	InsertedCount int                   `json:"insertedCount"`
+	FailedCount   int                   `json:"failedCount"`
+	Errors        []*ProductImportError `json:"errors"`
+}
+
+// ProductImportError is a row of an importProducts file that wasn't imported.
+type ProductImportError struct {
+	Line    int     `json:"line"` // Counting the header row as line 1.
+	SKU     *string `json:"sku,omitempty"`
+	Message string  `json:"message"`
+}
+
+// ProductRepository persists products in the catalog.
+type ProductRepository interface {
+	// Create inserts product and sets its generated ID and CreatedAt. It returns
+	// ErrDuplicateSKU if another product already uses the SKU.
+	Create(ctx context.Context, product *Product) error
+
+	// Import inserts products, which must have distinct SKUs, in one transaction and sets
+	// the generated ID and CreatedAt of each one. Products whose SKU another product already
+	// uses are skipped, left without an ID, and returned.
+	Import(ctx context.Context, products []*Product) (duplicates []*Product, err error)
+
+	// List returns a page of products in sort order, or DefaultProductSort if it's empty.
+	List(ctx context.Context, sort ProductSort, page PageArgs) (*PageResult[*Product], error)
+
+	// ListByCategory returns a page of products in sort order, as in List, that belong to the
+	// category with the given slug or one of its subcategories.
+	ListByCategory(ctx context.Context, slug string, sort ProductSort, page PageArgs) (*PageResult[*Product], error)
+
+	// ListAfter returns up to limit products in sort order, as in List, that come after the
+	// after position, or from the start when after is nil. A non-empty slug limits them to
+	// that category and its subcategories, as in ListByCategory.
+	ListAfter(ctx context.Context, slug string, sort ProductSort, after *ProductCursor, limit int) ([]*Product, error)
+
+	// Search returns a page of products matching every word of query, ordered by relevance.
+	Search(ctx context.Context, query string, page PageArgs) (*PageResult[*Product], error)
+
+	// GetByID looks up a product by ID, returning ErrNotFound when it doesn't exist.
+	GetByID(ctx context.Context, id string) (*Product, error)
+
+	// FrequentlyBoughtTogether returns up to limit other products that are in stock, ordered
+	// by how many delivered orders they share with the product with the given ID, most first.
+	FrequentlyBoughtTogether(ctx context.Context, productID string, limit int) ([]*Product, error)
+}
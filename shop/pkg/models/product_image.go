@@ -0,0 +1,42 @@
+package models
+
+import "context"
+
+// ProductImage is one of a product's images. A product's images are ordered by Position,
+// which runs from 0 to one less than the number of images without gaps.
+type ProductImage struct {
+	ID        string `json:"id"`
+	ProductID string `json:"productId"`
+	URL       string `json:"url"`
+	Position  int    `json:"position"`
+}
+
+// ProductImagePositionInput moves an image to a new position in reorderProductImages.
+type ProductImagePositionInput struct {
+	ID       string `json:"id"`
+	Position int    `json:"position"`
+}
+
+// ProductImageRepository persists product images.
+type ProductImageRepository interface {
+	// Add inserts image after the product's other images and sets its generated ID and
+	// Position. It returns ErrNotFound if the product doesn't exist and
+	// ErrConcurrentModification if another image was added to it at the same time.
+	Add(ctx context.Context, image *ProductImage) error
+
+	// ListByProduct returns a product's images ordered by position.
+	ListByProduct(ctx context.Context, productID string) ([]*ProductImage, error)
+
+	// ListByProducts returns the images of several products, keyed by product ID and each
+	// ordered by position. Products without images are left out.
+	ListByProducts(ctx context.Context, productIDs []string) (map[string][]*ProductImage, error)
+
+	// Reorder moves each of a product's images to the position it's keyed by in positions,
+	// and returns the images in their new order. It returns ErrNotFound if the product
+	// doesn't exist and ErrImagesMismatch unless positions has exactly the product's images.
+	Reorder(ctx context.Context, productID string, positions map[string]int) ([]*ProductImage, error)
+
+	// Delete removes an image and moves the images after it up one position, or returns
+	// ErrNotFound.
+	Delete(ctx context.Context, id string) error
+}
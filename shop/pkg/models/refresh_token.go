@@ -0,0 +1,44 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// RefreshToken is a long-lived credential that's exchanged for a new session token when the
+// old one expires. Only the hash of the token is stored. Each refresh rotates the token:
+// the used token is revoked and a new one is issued in the same family, which starts with
+// the token issued at sign-in.
+type RefreshToken struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	FamilyID  string // The ID of the first token in the family.
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// TokenPair is a session token together with the refresh token that renews it.
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// RefreshTokenRepository persists refresh tokens, which are looked up by their hash.
+type RefreshTokenRepository interface {
+	// Create inserts token as the first of a new family and sets its generated ID, FamilyID
+	// and CreatedAt.
+	Create(ctx context.Context, token *RefreshToken) error
+
+	// Rotate revokes the token with the given hash at now and inserts next in its family, for
+	// the same user, setting next's generated fields and UserID. It returns ErrNotFound if no
+	// token has the hash and ErrRefreshTokenExpired if it expired at or before now. Using a
+	// token that was already revoked returns ErrRefreshTokenRevoked and revokes the rest of
+	// its family, since it means the token was stolen or the session ended.
+	Rotate(ctx context.Context, hash string, next *RefreshToken, now time.Time) error
+
+	// Revoke revokes the token with the given hash and the rest of its family at now, or
+	// returns ErrNotFound.
+	Revoke(ctx context.Context, hash string, now time.Time) error
+}
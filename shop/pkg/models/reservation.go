@@ -0,0 +1,30 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Reservation holds stock of a product for a user until ExpiresAt, so it can't be sold to
+// someone else while they check out. Reserved stock is already taken out of the product's
+// StockQty; checkout turns it into a sale and expired reservations give it back.
+type Reservation struct {
+	UserID    string    `json:"userId"`
+	ProductID string    `json:"productId"`
+	Qty       int       `json:"qty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ReservationRepository persists stock reservations.
+type ReservationRepository interface {
+	// Reserve holds qty of a product for the user until expiresAt, replacing any earlier
+	// reservation the user has for it. It returns ErrNotFound if the product doesn't exist,
+	// a *PurchaseLimitError if qty is over the product's purchase limits for the user, an
+	// *InsufficientStockError if there isn't enough stock left, or
+	// ErrConcurrentModification if concurrent stock changes kept getting in the way.
+	Reserve(ctx context.Context, userID, productID string, qty int, expiresAt time.Time) (*Reservation, error)
+
+	// ReleaseExpired deletes the reservations that expire at or before now, returns their
+	// stock to the products and reports how many were released.
+	ReleaseExpired(ctx context.Context, now time.Time) (int, error)
+}
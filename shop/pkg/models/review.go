@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Review is a user's rating of a product, from 1 to 5 stars, with an optional comment.
+type Review struct {
+	ID        string    `json:"id"`
+	ProductID string    `json:"productId"`
+	UserID    string    `json:"userId"`
+	Rating    int       `json:"rating"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type CreateReviewInput struct {
+	ProductID string  `json:"productId"`
+	Rating    int     `json:"rating"`
+	Body      *string `json:"body,omitempty"`
+}
+
+// ReviewRepository persists product reviews. A user can review each product once.
+type ReviewRepository interface {
+	// Create inserts review and sets its generated ID and CreatedAt. It returns
+	// ErrAlreadyReviewed if the user already reviewed the product and ErrNotFound if the
+	// product doesn't exist.
+	Create(ctx context.Context, review *Review) error
+
+	// ListByProduct returns up to limit of a product's reviews, newest first, skipping the
+	// first offset.
+	ListByProduct(ctx context.Context, productID string, limit, offset int) ([]*Review, error)
+
+	// AverageRatings returns the average rating of each of the given products, keyed by
+	// product ID. Products without reviews are left out.
+	AverageRatings(ctx context.Context, productIDs []string) (map[string]float64, error)
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ObjectStore stores uploaded files, such as avatars, and serves them from a URL.
+type ObjectStore interface {
+	// Put stores the contents of r under key, replacing any object already stored there, and
+	// returns the URL it's served from.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (url string, err error)
+
+	// Delete removes the object stored under key. Deleting a missing object succeeds.
+	Delete(ctx context.Context, key string) error
+
+	// SignedURL returns a URL granting read access to the object stored under key for the
+	// given duration, for objects that aren't served publicly.
+	SignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+}
@@ -0,0 +1,10 @@
+package models
+
+import "context"
+
+// TaxCalculator works out the sales tax on orders.
+type TaxCalculator interface {
+	// Tax returns the tax, in currency's smallest unit, on amountCents for an order shipping
+	// to address. address is nil for orders placed without a shipping address.
+	Tax(ctx context.Context, address *ShippingAddress, amountCents int64, currency string) (int64, error)
+}
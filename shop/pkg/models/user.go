@@ -1,8 +1,141 @@
 package models
 
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// UserStatus is a user's lifecycle state, mirrored from Okta.
+type UserStatus string
+
+const (
+	UserStatusActive      UserStatus = "ACTIVE"
+	UserStatusSuspended   UserStatus = "SUSPENDED"
+	UserStatusDeactivated UserStatus = "DEACTIVATED"
+)
+
+// Role is what a user is allowed to do. Customers shop; admins also manage the catalog and
+// fulfil orders.
+type Role string
+
+const (
+	RoleCustomer Role = "CUSTOMER"
+	RoleAdmin    Role = "ADMIN"
+)
+
+// IsValid reports whether r is one of the known roles.
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleCustomer, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (r Role) String() string {
+	return string(r)
+}
+
+func (r *Role) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*r = Role(str)
+	if !r.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (r Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(r.String()))
+}
+
 type User struct {
-	ID          string `json:"id"`
-	PhoneNumber string `json:"phoneNumber,omitempty"`
-	Email       string `json:"email,omitempty"`
-	OktaID      string `json:"oktaId"`
+	ID          string    `json:"id"`
+	PhoneNumber string    `json:"phoneNumber,omitempty"`
+	Email       string    `json:"email,omitempty"`
+	OktaID      string    `json:"oktaId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// DeletedAt is set when the user has been soft-deleted.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Status is the user's lifecycle state in Okta.
+	Status UserStatus `json:"status"`
+	// Role is what the user is allowed to do.
+	Role Role `json:"role"`
+	// EmailVerified is set once the user has entered a passcode sent to Email.
+	EmailVerified bool `json:"emailVerified"`
+	// PhoneVerified is set once the user has entered a passcode sent to PhoneNumber.
+	PhoneVerified bool `json:"phoneVerified"`
+	// AvatarURL is where the user's uploaded avatar is served from, or empty without one.
+	AvatarURL string `json:"avatarUrl,omitempty"`
+}
+
+type CreateUserInput struct {
+	PhoneNumber *string `json:"phoneNumber,omitempty"`
+	Email       *string `json:"email,omitempty"`
+}
+
+// LoginInput holds the credentials of a login attempt: the user's identifier and exactly one
+// of a password or a one-time passcode sent to the identifier.
+type LoginInput struct {
+	Identifier *string `json:"identifier,omitempty"` // An email address or a phone number with country code.
+	// Deprecated: use Identifier.
+	PhoneNumber *string `json:"phoneNumber,omitempty"`
+	// Deprecated: use Identifier.
+	Email    *string `json:"email,omitempty"`
+	Password *string `json:"password,omitempty"`
+	Passcode *string `json:"passcode,omitempty"` // A one-time passcode, for passwordless login.
+}
+
+type UpdateUserInput struct {
+	ID          string  `json:"id"`
+	FirstName   *string `json:"firstName,omitempty"`
+	LastName    *string `json:"lastName,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	PhoneNumber *string `json:"phoneNumber,omitempty"`
+}
+
+type UpdateUserPayload struct {
+	User *User `json:"user"`
+	// NeedsVerification is set when the email or phone changed and must be re-verified.
+	NeedsVerification bool `json:"needsVerification"`
+}
+
+// UserRepository persists users. Lookups return ErrNotFound when no user matches, and
+// treat soft-deleted users as missing unless noted otherwise.
+// Delete soft-deletes the user; it is idempotent and succeeds when the user doesn't exist.
+type UserRepository interface {
+	Create(ctx context.Context, user *User) error
+	// Update saves the user's contact details. A changed email or phone number is no longer
+	// verified.
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id string) error
+	// Restore undoes Delete, returning ErrNotFound if the user isn't soft-deleted.
+	Restore(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*User, error)
+	// GetByIDIncludingDeleted is like GetByID but also returns soft-deleted users.
+	GetByIDIncludingDeleted(ctx context.Context, id string) (*User, error)
+	// GetByIDs returns the users with the given IDs in no particular order, omitting IDs that don't exist.
+	GetByIDs(ctx context.Context, ids []string) ([]*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// GetByPhone looks up a user by phone number, which must be in E.164 form.
+	GetByPhone(ctx context.Context, phone string) (*User, error)
+	GetByOktaID(ctx context.Context, oktaID string) (*User, error)
+	// SetStatusByOktaID sets the status of the user with the given Okta user ID.
+	SetStatusByOktaID(ctx context.Context, oktaID string, status UserStatus) error
+	// MarkVerified records that the user proved they own contact, their email address or
+	// phone number. A contact that is no longer the user's is ignored.
+	MarkVerified(ctx context.Context, id, contact string) error
+	// SetAvatarURL sets the URL of the user's avatar.
+	SetAvatarURL(ctx context.Context, id, url string) error
+
+	// SetRole sets what the user is allowed to do.
+	SetRole(ctx context.Context, id string, role Role) error
 }
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// WebhookDeliveryStatus is where an outbound webhook delivery is in its lifecycle.
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryStatusPending is a delivery that hasn't been attempted yet.
+	WebhookDeliveryStatusPending WebhookDeliveryStatus = "PENDING"
+	// WebhookDeliveryStatusFailed is a delivery whose last attempt failed and that will be retried.
+	WebhookDeliveryStatusFailed WebhookDeliveryStatus = "FAILED"
+	// WebhookDeliveryStatusDelivered is a delivery the endpoint accepted.
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = "DELIVERED"
+	// WebhookDeliveryStatusDead is a delivery that ran out of attempts. It's only retried
+	// once an admin requeues it.
+	WebhookDeliveryStatusDead WebhookDeliveryStatus = "DEAD"
+)
+
+// IsValid reports whether s is one of the known webhook delivery statuses.
+func (s WebhookDeliveryStatus) IsValid() bool {
+	switch s {
+	case WebhookDeliveryStatusPending, WebhookDeliveryStatusFailed, WebhookDeliveryStatusDelivered, WebhookDeliveryStatusDead:
+		return true
+	}
+	return false
+}
+
+func (s WebhookDeliveryStatus) String() string {
+	return string(s)
+}
+
+func (s *WebhookDeliveryStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*s = WebhookDeliveryStatus(str)
+	if !s.IsValid() {
+		return fmt.Errorf("%s is not a valid WebhookDeliveryStatus", str)
+	}
+	return nil
+}
+
+func (s WebhookDeliveryStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(s.String()))
+}
+
+// ErrDeliveryNotDead is returned when requeueing a webhook delivery that hasn't run out of
+// attempts.
+var ErrDeliveryNotDead = errors.New("webhook delivery isn't dead")
+
+// WebhookDelivery is an event sent, or to be sent, to an outbound webhook endpoint.
+type WebhookDelivery struct {
+	ID            string                `json:"id"`
+	EventType     string                `json:"eventType"` // e.g., "order.completed".
+	URL           string                `json:"url"`       // The endpoint the payload is POSTed to.
+	Payload       json.RawMessage       `json:"-"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`      // How many times sending it has been tried.
+	LastError     *string               `json:"lastError"`     // Why the last attempt failed, if it did.
+	NextAttemptAt time.Time             `json:"nextAttemptAt"` // When it's next due to be sent, while PENDING or FAILED.
+	DeliveredAt   *time.Time            `json:"deliveredAt"`
+	CreatedAt     time.Time             `json:"createdAt"`
+}
+
+// WebhookDeliveryRepository persists outbound webhook deliveries.
+type WebhookDeliveryRepository interface {
+	// Enqueue stores a PENDING delivery due at its NextAttemptAt and sets its generated ID,
+	// Status and CreatedAt.
+	Enqueue(ctx context.Context, delivery *WebhookDelivery) error
+
+	// Claim returns up to limit PENDING or FAILED deliveries with fewer than maxAttempts
+	// attempts that are due by now, oldest first, and postpones them to leaseUntil so that
+	// no other worker claims them while they're being sent.
+	Claim(ctx context.Context, now, leaseUntil time.Time, maxAttempts, limit int) ([]*WebhookDelivery, error)
+
+	// MarkDelivered records a successful attempt. It returns ErrNotFound if the delivery
+	// doesn't exist.
+	MarkDelivered(ctx context.Context, id string, at time.Time) error
+
+	// MarkFailed records a failed attempt and why it failed, and schedules the next one for
+	// nextAttemptAt. If dead is set the delivery isn't attempted again instead. It returns
+	// ErrNotFound if the delivery doesn't exist.
+	MarkFailed(ctx context.Context, id, reason string, nextAttemptAt time.Time, dead bool) error
+
+	// ListDead returns a page of the DEAD deliveries, newest first.
+	ListDead(ctx context.Context, page PageArgs) (*PageResult[*WebhookDelivery], error)
+
+	// Requeue makes a DEAD delivery PENDING again with no attempts, due at now, and returns
+	// it. It returns ErrNotFound if the delivery doesn't exist and ErrDeliveryNotDead if it
+	// isn't DEAD.
+	Requeue(ctx context.Context, id string, now time.Time) (*WebhookDelivery, error)
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// WishlistItem is a product a user saved for later.
+type WishlistItem struct {
+	Product *Product  `json:"product"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// Wishlist is the list of products a user saved for later, oldest first.
+type Wishlist struct {
+	UserID string          `json:"userId"`
+	Items  []*WishlistItem `json:"items"`
+}
+
+// WishlistRepository persists wishlists, one per user.
+type WishlistRepository interface {
+	// Get returns the user's wishlist, which is empty if they haven't saved anything.
+	Get(ctx context.Context, userID string) (*Wishlist, error)
+
+	// AddItem saves a product to the user's wishlist and returns the updated wishlist. Adding
+	// a product that's already there changes nothing. It returns ErrNotFound if the product
+	// doesn't exist.
+	AddItem(ctx context.Context, userID, productID string) (*Wishlist, error)
+
+	// RemoveItem removes a product from the user's wishlist, if it's there, and returns the
+	// updated wishlist.
+	RemoveItem(ctx context.Context, userID, productID string) (*Wishlist, error)
+}